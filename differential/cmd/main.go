@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/differential"
+)
+
+func main() {
+	primary := flag.String("primary", "http://localhost:8080", "base url of the server whose answers count, normally the unit server")
+	shadow := flag.String("shadow", "http://localhost:8081", "base url of the server being checked against it, normally the integration server")
+	ids := flag.String("ids", "1-24", "ids to compare, comma separated with ranges allowed, eg 1-24,9000,abc")
+	paths := flag.String("paths", "/generations", "other paths to compare, comma separated")
+	listen := flag.String("listen", "", "run as a shadow traffic proxy on this address instead of comparing ids, eg :8090")
+	mirrorMethods := flag.String("mirror-methods", "GET", "comma separated methods the proxy sends to the shadow too, eg GET,POST to include /graphql")
+	ignoreErrorBodies := flag.Bool("ignore-error-bodies", false, "only compare status codes for errors")
+	ignoreFields := flag.String("ignore-fields", "", "comma separated top level json fields to leave out of comparisons")
+	flag.Parse()
+
+	comparer := differential.Comparer{
+		PrimaryURL: strings.TrimSuffix(*primary, "/"),
+		ShadowURL:  strings.TrimSuffix(*shadow, "/"),
+		Options: differential.Options{
+			IgnoreErrorBodies: *ignoreErrorBodies,
+			IgnoreFields:      splitList(*ignoreFields),
+		},
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if *listen != "" {
+		proxy := differential.NewProxy(comparer)
+		proxy.MirrorMethods = splitList(*mirrorMethods)
+		encoder := json.NewEncoder(os.Stdout)
+		proxy.OnDivergence = func(d differential.Divergence) {
+			_ = encoder.Encode(d)
+		}
+		panic(http.ListenAndServe(*listen, proxy))
+	}
+
+	idList, err := expandIDs(*ids)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// ctrl-c stops early but still reports what was compared so far
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	var toCompare []string
+	for _, id := range idList {
+		toCompare = append(toCompare, "/employee/"+id)
+	}
+	toCompare = append(toCompare, splitList(*paths)...)
+	report := comparer.ComparePaths(ctx, toCompare)
+	if err := report.Write(os.Stdout); err != nil {
+		panic(err)
+	}
+	if len(report.Divergences) > 0 || report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func splitList(s string) []string {
+	var ret []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			ret = append(ret, part)
+		}
+	}
+	return ret
+}
+
+// expandIDs turns 1-3,9000,abc into 1,2,3,9000,abc. Anything that isn't a range is passed along as is, malformed ids
+// are worth comparing too.
+func expandIDs(s string) ([]string, error) {
+	var ret []string
+	for _, part := range splitList(s) {
+		bounds := strings.SplitN(part, "-", 2)
+		if len(bounds) != 2 {
+			ret = append(ret, part)
+			continue
+		}
+		from, fromErr := strconv.Atoi(bounds[0])
+		to, toErr := strconv.Atoi(bounds[1])
+		if fromErr != nil || toErr != nil {
+			ret = append(ret, part)
+			continue
+		}
+		if to < from {
+			return nil, fmt.Errorf("backwards range %s", part)
+		}
+		for i := from; i <= to; i++ {
+			ret = append(ret, strconv.Itoa(i))
+		}
+	}
+	return ret, nil
+}
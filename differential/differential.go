@@ -0,0 +1,324 @@
+// Package differential checks that two servers answer the same requests the same way. The unit and integration
+// servers are two implementations of the same API, so anything one does that the other doesn't is a bug in one of
+// them (or a known, deliberate difference that should be written down as an Options setting).
+//
+// It works two ways: Compare replays a list of ids against both servers, which is what the tests use, and Proxy sits in
+// front of a primary server and mirrors live traffic to a shadow, reporting divergences as they happen.
+package differential
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/jonsabados/unit-testing-party/jsondiff"
+	"github.com/pkg/errors"
+)
+
+// Exchange is the part of a response that gets compared
+type Exchange struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+}
+
+type Divergence struct {
+	Path        string   `json:"path"`
+	Primary     Exchange `json:"primary"`
+	Shadow      Exchange `json:"shadow"`
+	Differences []string `json:"differences"`
+}
+
+type Options struct {
+	// IgnoreErrorBodies only compares status codes for 4xx and 5xx, handy when the detail in an error is expected to
+	// differ
+	IgnoreErrorBodies bool
+	// IgnoreFields are top level JSON fields left out of body comparisons
+	IgnoreFields []string
+}
+
+// Diff lists every difference between two responses, nothing means they match. JSON bodies are compared structurally
+// so key order and whitespace don't count. The primary is treated as the right answer, so "missing" means the shadow
+// left something out.
+func Diff(primary Exchange, shadow Exchange, opts Options) []string {
+	var ret []string
+	if primary.Status != shadow.Status {
+		ret = append(ret, fmt.Sprintf("status: %d vs %d", primary.Status, shadow.Status))
+	}
+	if opts.IgnoreErrorBodies && primary.Status >= 400 && shadow.Status >= 400 {
+		return ret
+	}
+
+	primaryJSON, primaryOK := decodeJSON(primary, opts)
+	shadowJSON, shadowOK := decodeJSON(shadow, opts)
+	switch {
+	case primaryOK && shadowOK:
+		ret = append(ret, jsondiff.Diff(primaryJSON, shadowJSON)...)
+	case primaryOK != shadowOK:
+		ret = append(ret, fmt.Sprintf("content type: %q vs %q", primary.ContentType, shadow.ContentType))
+	case primary.Body != shadow.Body:
+		ret = append(ret, fmt.Sprintf("body: %q vs %q", primary.Body, shadow.Body))
+	}
+	return ret
+}
+
+func decodeJSON(e Exchange, opts Options) (interface{}, bool) {
+	mediaType, _, _ := mime.ParseMediaType(e.ContentType)
+	if !strings.HasSuffix(mediaType, "json") {
+		return nil, false
+	}
+	var ret interface{}
+	decoder := json.NewDecoder(strings.NewReader(e.Body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&ret); err != nil {
+		return nil, false
+	}
+	if m, ok := ret.(map[string]interface{}); ok {
+		for _, f := range opts.IgnoreFields {
+			delete(m, f)
+		}
+	}
+	return ret, true
+}
+
+// Report is the outcome of a comparison run
+type Report struct {
+	mu          sync.Mutex
+	Compared    int          `json:"compared"`
+	Failed      int          `json:"failed"`
+	Divergences []Divergence `json:"divergences"`
+}
+
+func (r *Report) record(d *Divergence) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Compared++
+	if d != nil {
+		r.Divergences = append(r.Divergences, *d)
+	}
+}
+
+func (r *Report) recordFailure() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Failed++
+}
+
+// Summary is a copy of the report so far, safe to use while the report is still being added to
+func (r *Report) Summary() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Report{
+		Compared:    r.Compared,
+		Failed:      r.Failed,
+		Divergences: append([]Divergence{}, r.Divergences...),
+	}
+}
+
+func (r *Report) Write(w io.Writer) error {
+	s := r.Summary()
+	lines := []string{fmt.Sprintf("compared %d requests, %d diverged, %d couldn't be compared", s.Compared, len(s.Divergences), s.Failed)}
+	for _, d := range s.Divergences {
+		lines = append(lines, d.Path)
+		for _, diff := range d.Differences {
+			lines = append(lines, "    "+diff)
+		}
+	}
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Comparer sends requests to both servers and compares what comes back
+type Comparer struct {
+	PrimaryURL string
+	ShadowURL  string
+	Options    Options
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+}
+
+func (c *Comparer) client() *http.Client {
+	if c.Client == nil {
+		return http.DefaultClient
+	}
+	return c.Client
+}
+
+// Compare sends GET /employee/{id} for every id to both servers, one at a time and in order
+func (c *Comparer) Compare(ctx context.Context, ids []string) *Report {
+	var paths []string
+	for _, id := range ids {
+		paths = append(paths, "/employee/"+id)
+	}
+	return c.ComparePaths(ctx, paths)
+}
+
+// ComparePaths is Compare for anything that isn't an employee, paths are relative to the base urls, eg /generations
+func (c *Comparer) ComparePaths(ctx context.Context, paths []string) *Report {
+	ret := new(Report)
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		c.compare(ctx, ret, http.MethodGet, path, nil)
+	}
+	return ret
+}
+
+func (c *Comparer) compare(ctx context.Context, report *Report, method string, path string, header http.Header) *Divergence {
+	primary, err := fetch(ctx, c.client(), method, c.PrimaryURL+path, header, nil)
+	if err != nil {
+		report.recordFailure()
+		return nil
+	}
+	return c.compareWith(ctx, report, primary, method, path, header, nil)
+}
+
+func (c *Comparer) compareWith(ctx context.Context, report *Report, primary Exchange, method string, path string, header http.Header, body []byte) *Divergence {
+	shadow, err := fetch(ctx, c.client(), method, c.ShadowURL+path, header, body)
+	if err != nil {
+		report.recordFailure()
+		return nil
+	}
+	var ret *Divergence
+	if diffs := Diff(primary, shadow, c.Options); len(diffs) > 0 {
+		ret = &Divergence{Path: path, Primary: primary, Shadow: shadow, Differences: diffs}
+	}
+	report.record(ret)
+	return ret
+}
+
+// fetch sends a request, body can be nil for requests that don't have one
+func fetch(ctx context.Context, client *http.Client, method string, url string, header http.Header, body []byte) (Exchange, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return Exchange{}, errors.WithStack(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return Exchange{}, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return Exchange{}, errors.WithStack(err)
+	}
+	return Exchange{Status: res.StatusCode, ContentType: res.Header.Get("Content-Type"), Body: string(resBody)}, nil
+}
+
+// Proxy answers every request from the primary and mirrors it to the shadow in the background. Callers only ever see
+// the primary's response, headers and all, so a broken or slow shadow can't hurt anybody. Only GETs are mirrored
+// unless MirrorMethods says otherwise, replaying anything that changes state on a second server is asking for trouble.
+// Streams (server-sent events) and upgraded connections (websockets) go straight through to the primary without being
+// compared, there's no single response to compare and holding onto one until it's done would break it.
+type Proxy struct {
+	Comparer Comparer
+	Report   *Report
+	// OnDivergence gets called as divergences are found, eg to log them
+	OnDivergence func(Divergence)
+	// MirrorMethods are the methods that get sent to the shadow too, with the same body the primary got. Defaults to
+	// GET, add POST for things like /graphql that take their queries in a body.
+	MirrorMethods []string
+
+	wg sync.WaitGroup
+}
+
+func NewProxy(comparer Comparer) *Proxy {
+	return &Proxy{Comparer: comparer, Report: new(Report)}
+}
+
+func (p *Proxy) mirrors(method string) bool {
+	if len(p.MirrorMethods) == 0 {
+		return method == http.MethodGet
+	}
+	for _, m := range p.MirrorMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target, err := url.Parse(p.Comparer.PrimaryURL)
+	if err != nil {
+		http.Error(w, "primary unavailable", http.StatusBadGateway)
+		return
+	}
+	reverseProxy := httputil.NewSingleHostReverseProxy(target)
+	reverseProxy.Transport = p.Comparer.client().Transport
+	// flushing as soon as anything is written is what keeps server-sent events flowing
+	reverseProxy.FlushInterval = -1
+	reverseProxy.ErrorHandler = func(w http.ResponseWriter, _ *http.Request, _ error) {
+		http.Error(w, "primary unavailable", http.StatusBadGateway)
+	}
+
+	// websockets and the like are a conversation with the primary, the reverse proxy knows how to hand those off
+	if r.Header.Get("Upgrade") != "" || !p.mirrors(r.Method) {
+		reverseProxy.ServeHTTP(w, r)
+		return
+	}
+
+	// the body gets read once, the primary and the shadow each get a copy
+	body, err := ioutil.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		http.Error(w, "couldn't read request body", http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	// the comparison needs bodies it can read, and the client's own compression preferences would muddy that
+	r.Header.Del("Accept-Encoding")
+	header := r.Header.Clone()
+	path := r.URL.RequestURI()
+
+	reverseProxy.ModifyResponse = func(res *http.Response) error {
+		if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType == "text/event-stream" {
+			return nil
+		}
+		resBody, err := ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+		primary := Exchange{Status: res.StatusCode, ContentType: res.Header.Get("Content-Type"), Body: string(resBody)}
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			// the client's request context is done as soon as this handler returns
+			d := p.Comparer.compareWith(context.Background(), p.Report, primary, r.Method, path, header, body)
+			if d != nil && p.OnDivergence != nil {
+				p.OnDivergence(*d)
+			}
+		}()
+		return nil
+	}
+	reverseProxy.ServeHTTP(w, r)
+}
+
+// Wait blocks until every mirrored request so far has been compared
+func (p *Proxy) Wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,338 @@
+package differential
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/fakeupstream"
+	"github.com/jonsabados/unit-testing-party/fixturegen"
+	"github.com/jonsabados/unit-testing-party/integration"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+// startServers stands up the unit and integration servers against the same fake upstream, serving a generated dataset
+func startServers(t *testing.T, dataset *fixturegen.Dataset) (string, string) {
+	upstream := httptest.NewServer(fakeupstream.NewServer(fakeupstream.Config{
+		Employees: dataset.Employees(),
+		Payloads:  dataset.Payloads(),
+	}))
+	t.Cleanup(upstream.Close)
+
+	unitServer := httptest.NewServer(kit.NewServer(&unit.SomeServer{
+		EmployeeFetcher: unit.NewRemoteEmployeeFetcher(upstream.URL),
+		EmployeeMapper:  unit.NewEmployeeFactory(unit.MapBirthYear),
+		Codecs:          unit.NewDefaultCodecRegistry(),
+	}))
+	t.Cleanup(unitServer.Close)
+
+	integrationServer := httptest.NewServer(kit.NewServer(&integration.SomeServer{
+		HttpClient: http.DefaultClient,
+		APIURL:     upstream.URL,
+	}))
+	t.Cleanup(integrationServer.Close)
+
+	return unitServer.URL, integrationServer.URL
+}
+
+func TestUnitMatchesIntegration(t *testing.T) {
+	asserter := assert.New(t)
+
+	dataset := fixturegen.Generate(1, 25)
+	unitURL, integrationURL := startServers(t, dataset)
+
+	var ids []string
+	for _, f := range dataset.Fixtures {
+		ids = append(ids, f.ID)
+	}
+	// and some that upstream has never heard of
+	ids = append(ids, "26", "8999", strconv.Itoa(fixturegen.EdgeCaseIDStart+len(dataset.Fixtures)))
+	// ones that parse but upstream only knows by number
+	ids = append(ids, "EMP-0001", "123E4567-E89B-12D3-A456-426614174000", "9223372036854775807")
+	// and ones that were never going to work
+	ids = append(ids, "abc", "-1", "+1", "1.5", "9223372036854775808", "12345678901234567890")
+
+	testInstance := Comparer{
+		PrimaryURL: unitURL,
+		ShadowURL:  integrationURL,
+	}
+	report := testInstance.Compare(context.Background(), ids)
+
+	out := new(bytes.Buffer)
+	asserter.NoError(report.Write(out))
+	asserter.Equal(len(ids), report.Compared)
+	asserter.Zero(report.Failed)
+	asserter.Empty(report.Divergences, out.String())
+}
+
+func TestDiff(t *testing.T) {
+	jsonExchange := func(status int, body string) Exchange {
+		return Exchange{Status: status, ContentType: "application/json; charset=utf-8", Body: body}
+	}
+
+	testCases := []struct {
+		desc     string
+		primary  Exchange
+		shadow   Exchange
+		opts     Options
+		expected []string
+	}{
+		{
+			desc:    "same",
+			primary: jsonExchange(200, `{"id":"1","age":61}`),
+			shadow:  jsonExchange(200, "{\"age\": 61, \"id\": \"1\"}\n"),
+		},
+		{
+			desc:     "different field",
+			primary:  jsonExchange(200, `{"id":"1","age":61}`),
+			shadow:   jsonExchange(200, `{"id":"1","age":62}`),
+			expected: []string{"$.age: expected 61, got 62"},
+		},
+		{
+			desc:     "ignored field",
+			primary:  jsonExchange(200, `{"id":"1","age":61}`),
+			shadow:   jsonExchange(200, `{"id":"1","age":62}`),
+			opts:     Options{IgnoreFields: []string{"age"}},
+			expected: nil,
+		},
+		{
+			desc:     "different status",
+			primary:  jsonExchange(500, `{"message":"boom"}`),
+			shadow:   jsonExchange(502, `{"message":"boom"}`),
+			expected: []string{"status: 500 vs 502"},
+		},
+		{
+			desc:     "error bodies ignored",
+			primary:  jsonExchange(404, `{"title":"Employee not found"}`),
+			shadow:   jsonExchange(404, `{"message":"employee not found"}`),
+			opts:     Options{IgnoreErrorBodies: true},
+			expected: nil,
+		},
+		{
+			desc:     "json vs not",
+			primary:  jsonExchange(200, `{"id":"1"}`),
+			shadow:   Exchange{Status: 200, ContentType: "text/plain", Body: "1"},
+			expected: []string{`content type: "application/json; charset=utf-8" vs "text/plain"`},
+		},
+		{
+			desc:     "plain bodies",
+			primary:  Exchange{Status: 200, ContentType: "text/csv", Body: "1,Tiger Nixon\n"},
+			shadow:   Exchange{Status: 200, ContentType: "text/csv", Body: "1,Tiger\n"},
+			expected: []string{`body: "1,Tiger Nixon\n" vs "1,Tiger\n"`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+			asserter.Equal(tc.expected, Diff(tc.primary, tc.shadow, tc.opts))
+		})
+	}
+}
+
+func TestProxy(t *testing.T) {
+	asserter := assert.New(t)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `","server":"primary"}`))
+	}))
+	defer primary.Close()
+	var shadowHits []string
+	var mu sync.Mutex
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		shadowHits = append(shadowHits, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/employee/2" {
+			_, _ = w.Write([]byte(`{"path":"/employee/2","server":"shadow"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `","server":"primary"}`))
+	}))
+	defer shadow.Close()
+
+	testInstance := NewProxy(Comparer{PrimaryURL: primary.URL, ShadowURL: shadow.URL})
+	var noticed []Divergence
+	testInstance.OnDivergence = func(d Divergence) {
+		mu.Lock()
+		defer mu.Unlock()
+		noticed = append(noticed, d)
+	}
+	proxy := httptest.NewServer(testInstance)
+	defer proxy.Close()
+
+	for _, path := range []string{"/employee/1", "/employee/2", "/employee/3"} {
+		res, err := http.Get(proxy.URL + path)
+		if asserter.NoError(err) {
+			body := new(bytes.Buffer)
+			_, _ = body.ReadFrom(res.Body)
+			_ = res.Body.Close()
+			asserter.Equal(http.StatusOK, res.StatusCode)
+			// callers only ever see the primary
+			asserter.Equal(`{"path":"`+path+`","server":"primary"}`, body.String())
+		}
+	}
+	res, err := http.Post(proxy.URL+"/admin/faults", "application/json", bytes.NewBufferString("{}"))
+	if asserter.NoError(err) {
+		_ = res.Body.Close()
+	}
+	testInstance.Wait()
+
+	report := testInstance.Report.Summary()
+	asserter.Equal(3, report.Compared)
+	if asserter.Len(report.Divergences, 1) {
+		asserter.Equal("/employee/2", report.Divergences[0].Path)
+		asserter.Equal([]string{`$.server: expected "primary", got "shadow"`}, report.Divergences[0].Differences)
+	}
+	asserter.Equal(report.Divergences, noticed)
+	// the POST never made it to the shadow
+	asserter.ElementsMatch([]string{"GET /employee/1", "GET /employee/2", "GET /employee/3"}, shadowHits)
+}
+
+func TestProxy_PrimaryDown(t *testing.T) {
+	asserter := assert.New(t)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	primary.Close()
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("shadow should not be called when the primary is down")
+	}))
+	defer shadow.Close()
+
+	testInstance := NewProxy(Comparer{PrimaryURL: primary.URL, ShadowURL: shadow.URL})
+	w := httptest.NewRecorder()
+	testInstance.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/employee/1", nil))
+	testInstance.Wait()
+
+	asserter.Equal(http.StatusBadGateway, w.Code)
+	asserter.Zero(testInstance.Report.Summary().Compared)
+}
+
+func TestUnitMatchesIntegration_OtherRoutes(t *testing.T) {
+	asserter := assert.New(t)
+
+	unitURL, integrationURL := startServers(t, fixturegen.Generate(1, 1))
+
+	testInstance := Comparer{PrimaryURL: unitURL, ShadowURL: integrationURL}
+	report := testInstance.ComparePaths(context.Background(), []string{"/generations", "/nope"})
+
+	out := new(bytes.Buffer)
+	asserter.NoError(report.Write(out))
+	asserter.Equal(2, report.Compared)
+	asserter.Empty(report.Divergences, out.String())
+}
+
+func TestProxy_ForwardsBodiesAndHeaders(t *testing.T) {
+	asserter := assert.New(t)
+
+	echo := func(server string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body := new(bytes.Buffer)
+			_, _ = body.ReadFrom(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"abc"`)
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Location", "/somewhere")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"method":"` + r.Method + `","got":` + strconv.Quote(body.String()) + `,"server":"` + server + `"}`))
+		}
+	}
+	primary := httptest.NewServer(echo("primary"))
+	defer primary.Close()
+	shadow := httptest.NewServer(echo("shadow"))
+	defer shadow.Close()
+
+	testInstance := NewProxy(Comparer{PrimaryURL: primary.URL, ShadowURL: shadow.URL, Options: Options{IgnoreFields: []string{"server"}}})
+	testInstance.MirrorMethods = []string{"GET", "POST"}
+	proxy := httptest.NewServer(testInstance)
+	defer proxy.Close()
+
+	res, err := http.Post(proxy.URL+"/graphql", "application/json", bytes.NewBufferString(`{"query":"{ generations { code } }"}`))
+	if asserter.NoError(err) {
+		body := new(bytes.Buffer)
+		_, _ = body.ReadFrom(res.Body)
+		_ = res.Body.Close()
+		asserter.Equal(http.StatusCreated, res.StatusCode)
+		asserter.Equal(`"abc"`, res.Header.Get("ETag"))
+		asserter.Equal("max-age=60", res.Header.Get("Cache-Control"))
+		asserter.Equal("/somewhere", res.Header.Get("Location"))
+		asserter.Equal(`{"method":"POST","got":"{\"query\":\"{ generations { code } }\"}","server":"primary"}`, body.String())
+	}
+	testInstance.Wait()
+
+	// the shadow got the same body, or there'd be a divergence
+	report := testInstance.Report.Summary()
+	asserter.Equal(1, report.Compared)
+	asserter.Empty(report.Divergences)
+}
+
+func TestProxy_Streams(t *testing.T) {
+	asserter := assert.New(t)
+
+	done := make(chan struct{})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("id: 1\ndata: {}\n\n"))
+		w.(http.Flusher).Flush()
+		// the stream stays open until the test is done with it
+		<-done
+	}))
+	defer primary.Close()
+	defer close(done)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("streams shouldn't be mirrored")
+	}))
+	defer shadow.Close()
+
+	testInstance := NewProxy(Comparer{PrimaryURL: primary.URL, ShadowURL: shadow.URL})
+	proxy := httptest.NewServer(testInstance)
+	defer proxy.Close()
+
+	res, err := http.Get(proxy.URL + "/employees/changes")
+	if !asserter.NoError(err) {
+		return
+	}
+	defer res.Body.Close()
+	asserter.Equal("text/event-stream", res.Header.Get("Content-Type"))
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	asserter.NoError(err)
+	asserter.Equal("id: 1\n", line)
+}
+
+func TestProxy_Websockets(t *testing.T) {
+	asserter := assert.New(t)
+
+	primary := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		_, _ = io.Copy(conn, conn)
+	}))
+	defer primary.Close()
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("websockets shouldn't be mirrored")
+	}))
+	defer shadow.Close()
+
+	testInstance := NewProxy(Comparer{PrimaryURL: primary.URL, ShadowURL: shadow.URL})
+	proxy := httptest.NewServer(testInstance)
+	defer proxy.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(proxy.URL, "http")+"/employees/live", "", proxy.URL)
+	if !asserter.NoError(err) {
+		return
+	}
+	defer conn.Close()
+	asserter.NoError(websocket.Message.Send(conn, "hello"))
+	var msg string
+	asserter.NoError(websocket.Message.Receive(conn, &msg))
+	asserter.Equal("hello", msg)
+}
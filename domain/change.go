@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// FieldChange is one field of an employee going from one value to another. Values are rendered as strings so every
+// field looks the same on the wire, Field is the json name of the field on Employee.
+type FieldChange struct {
+	Field string `json:"field" xml:"field"`
+	From  string `json:"from" xml:"from"`
+	To    string `json:"to" xml:"to"`
+}
+
+// EmployeeChange is something that happened to an employee between two roster syncs. ID orders changes, it's the
+// version of the snapshot the change was spotted in and a counter within that version, eg 12-3. Before is nil for
+// added employees and After is nil for removed ones.
+type EmployeeChange struct {
+	ID         string        `json:"id" xml:"id"`
+	Type       string        `json:"type" xml:"type"`
+	EmployeeID string        `json:"employee_id" xml:"employee_id"`
+	Version    int64         `json:"version" xml:"version"`
+	At         time.Time     `json:"at" xml:"at"`
+	Before     *Employee     `json:"before,omitempty" xml:"before,omitempty"`
+	After      *Employee     `json:"after,omitempty" xml:"after,omitempty"`
+	Changes    []FieldChange `json:"changes,omitempty" xml:"field_change,omitempty"`
+}
+
+// DiffEmployee lists the fields that differ between two versions of the same employee, in the order Employee declares
+// them. GenerationCode and GenerationLabel follow from Generation so they're left out.
+func DiffEmployee(before Employee, after Employee) []FieldChange {
+	var ret []FieldChange
+	add := func(field string, from string, to string) {
+		if from != to {
+			ret = append(ret, FieldChange{Field: field, From: from, To: to})
+		}
+	}
+	add("employee_name", before.Name, after.Name)
+	add("age", strconv.Itoa(before.Age), strconv.Itoa(after.Age))
+	add("generation", string(before.Generation), string(after.Generation))
+	return ret
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffEmployee(t *testing.T) {
+	before := Employee{ID: "1", Name: "Tiger Nixon", Age: 55, Generation: GenX, GenerationCode: "gen_x"}
+
+	testCases := []struct {
+		desc     string
+		after    func(e Employee) Employee
+		expected []FieldChange
+	}{
+		{"nothing", func(e Employee) Employee { return e }, nil},
+		{
+			"labels don't count",
+			func(e Employee) Employee {
+				e.GenerationLabel = "Generación X"
+				return e
+			},
+			nil,
+		},
+		{
+			"aged into another generation",
+			func(e Employee) Employee {
+				e.Age = 60
+				e.Generation = BabyBoomer
+				return e
+			},
+			[]FieldChange{{"age", "55", "60"}, {"generation", "Generation X", "Baby Boomer"}},
+		},
+		{
+			"renamed",
+			func(e Employee) Employee {
+				e.Name = "Tiger Nixon Jr."
+				return e
+			},
+			[]FieldChange{{"employee_name", "Tiger Nixon", "Tiger Nixon Jr."}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+			asserter.Equal(tc.expected, DiffEmployee(before, tc.after(before)))
+		})
+	}
+}
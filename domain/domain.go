@@ -0,0 +1,4 @@
+// Package domain is the vocabulary both servers speak: the employees they hand out, what upstream hands them and how
+// they describe things going wrong. Keeping it in one place is what keeps the unit and integration servers honest about
+// serving the same API.
+package domain
@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"encoding/xml"
+	"strconv"
+)
+
+// RemoteEmployee is what upstream sends back for GET /api/v1/employee/{id}. Data is nil when there's no such employee.
+type RemoteEmployee struct {
+	Status string              `json:"status"`
+	Data   *RemoteEmployeeData `json:"data"`
+}
+
+type RemoteEmployeeData struct {
+	ID             int    `json:"id"`
+	EmployeeName   string `json:"employee_name"`
+	EmployeeSalary int    `json:"employee_salary"`
+	EmployeeAge    int    `json:"employee_age"`
+	ProfileImage   string `json:"profile_image"`
+}
+
+// RemoteEmployeeList is what upstream sends back for GET /api/v1/employees, everybody at once
+type RemoteEmployeeList struct {
+	Status string               `json:"status"`
+	Data   []RemoteEmployeeData `json:"data"`
+}
+
+// Validate checks the payload holds an employee we can make sense of. Upstream is sloppy enough that the servers don't
+// insist on this, but it's handy for checking fixtures and anything else that should be squeaky clean.
+func (r RemoteEmployee) Validate() error {
+	if r.Data == nil {
+		return ValidationError{{"data", "is required"}}
+	}
+	var ret ValidationError
+	if r.Data.ID < 0 {
+		ret = append(ret, InvalidParam{"data.id", "must not be negative"})
+	}
+	if r.Data.EmployeeName == "" {
+		ret = append(ret, InvalidParam{"data.employee_name", "is required"})
+	}
+	if r.Data.EmployeeSalary < 0 {
+		ret = append(ret, InvalidParam{"data.employee_salary", "must not be negative"})
+	}
+	if r.Data.EmployeeAge < 0 {
+		ret = append(ret, InvalidParam{"data.employee_age", "must not be negative"})
+	}
+	return ret.orNil()
+}
+
+// Employee is what we hand out. Generation is kept as is for the clients that match on it, GenerationCode is the
+// thing to match on going forward and GenerationLabel is for showing people, in their language.
+type Employee struct {
+	ID              string     `json:"id" xml:"id"`
+	Name            string     `json:"employee_name" xml:"employee_name"`
+	Age             int        `json:"age" xml:"age"`
+	Generation      Generation `json:"generation" xml:"generation"`
+	GenerationCode  string     `json:"generation_code,omitempty" xml:"generation_code,omitempty"`
+	GenerationLabel string     `json:"generation_label,omitempty" xml:"generation_label,omitempty"`
+}
+
+func (e Employee) CSVHeader() []string {
+	return []string{"id", "employee_name", "age", "generation", "generation_code", "generation_label"}
+}
+
+func (e Employee) CSVRecord() []string {
+	return []string{e.ID, e.Name, strconv.Itoa(e.Age), string(e.Generation), e.GenerationCode, e.GenerationLabel}
+}
+
+func (e Employee) Validate() error {
+	var ret ValidationError
+	if e.ID == "" {
+		ret = append(ret, InvalidParam{"id", "is required"})
+	}
+	if e.Age < 0 {
+		ret = append(ret, InvalidParam{"age", "must not be negative"})
+	}
+	if err := e.Generation.Validate(); err != nil {
+		ret = append(ret, InvalidParam{"generation", err.Error()})
+	}
+	return ret.orNil()
+}
+
+// EmployeeMatch is an employee that turned up in a search. Score runs from 0 to 1, higher is a better match, and Match
+// says how the name matched: exact, prefix, token or fuzzy.
+type EmployeeMatch struct {
+	Employee
+	Score float64 `json:"score" xml:"score"`
+	Match string  `json:"match" xml:"match"`
+}
+
+func (m EmployeeMatch) CSVHeader() []string {
+	return append(m.Employee.CSVHeader(), "score", "match")
+}
+
+func (m EmployeeMatch) CSVRecord() []string {
+	return append(m.Employee.CSVRecord(), strconv.FormatFloat(m.Score, 'f', -1, 64), m.Match)
+}
+
+// EmployeeMatches are search results, best match first
+type EmployeeMatches []EmployeeMatch
+
+// MarshalXML wraps the matches in a single root element, same deal as GenerationCatalog
+func (m EmployeeMatches) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "employees"}
+	return e.EncodeElement(struct {
+		Items []EmployeeMatch `xml:"employee"`
+	}{m}, start)
+}
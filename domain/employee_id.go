@@ -0,0 +1,64 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EmployeeID identifies an employee. The upstream we talk to today only hands out ints, but we also accept prefixed
+// IDs ("emp-123") and UUIDs so adding other sources later doesn't mean changing every signature that takes an ID.
+// Always go through ParseEmployeeID for anything that came from the outside world, it normalizes things so the
+// same employee can't show up under two different IDs. Both servers parse with it, so they agree on which IDs are
+// malformed and which just don't exist.
+type EmployeeID string
+
+var ErrMalformedEmployeeID = errors.New("malformed employee id")
+
+var (
+	numericIDPattern  = regexp.MustCompile(`^[0-9]{1,19}$`)
+	prefixedIDPattern = regexp.MustCompile(`^([a-zA-Z]{1,16})-([0-9]{1,19})$`)
+	uuidPattern       = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+func ParseEmployeeID(raw string) (EmployeeID, error) {
+	switch {
+	case numericIDPattern.MatchString(raw):
+		digits, err := normalizeDigits(raw)
+		if err != nil {
+			return "", err
+		}
+		return EmployeeID(digits), nil
+	case prefixedIDPattern.MatchString(raw):
+		parts := prefixedIDPattern.FindStringSubmatch(raw)
+		digits, err := normalizeDigits(parts[2])
+		if err != nil {
+			return "", err
+		}
+		return EmployeeID(strings.ToLower(parts[1]) + "-" + digits), nil
+	case uuidPattern.MatchString(raw):
+		return EmployeeID(strings.ToLower(raw)), nil
+	default:
+		return "", ErrMalformedEmployeeID
+	}
+}
+
+// EmployeeIDFromInt is for when we already have a trustworthy int, like the ones upstream sends us
+func EmployeeIDFromInt(id int) EmployeeID {
+	return EmployeeID(strconv.Itoa(id))
+}
+
+func (e EmployeeID) String() string {
+	return string(e)
+}
+
+// normalizeDigits strips leading zeros so 007 and 7 are the same employee. The patterns allow 19 digits so anything
+// EmployeeIDFromInt hands out parses back, which means some of them are past what an int64 holds and get refused here.
+func normalizeDigits(digits string) (string, error) {
+	parsed, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return "", ErrMalformedEmployeeID
+	}
+	return strconv.FormatInt(parsed, 10), nil
+}
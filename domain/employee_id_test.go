@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEmployeeID(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		input         string
+		expectedID    EmployeeID
+		expectedError error
+	}{
+		{
+			"numeric",
+			"123",
+			"123",
+			nil,
+		},
+		{
+			"numeric zero",
+			"0",
+			"0",
+			nil,
+		},
+		{
+			"numeric leading zeros",
+			"007",
+			"7",
+			nil,
+		},
+		{
+			"numeric max length",
+			"1234567890123456789",
+			"1234567890123456789",
+			nil,
+		},
+		{
+			"numeric biggest int64",
+			"9223372036854775807",
+			"9223372036854775807",
+			nil,
+		},
+		{
+			"numeric past int64",
+			"9223372036854775808",
+			"",
+			ErrMalformedEmployeeID,
+		},
+		{
+			"numeric too long",
+			"12345678901234567890",
+			"",
+			ErrMalformedEmployeeID,
+		},
+		{
+			"prefixed past int64",
+			"emp-9999999999999999999",
+			"",
+			ErrMalformedEmployeeID,
+		},
+		{
+			"negative",
+			"-1",
+			"",
+			ErrMalformedEmployeeID,
+		},
+		{
+			"prefixed",
+			"emp-123",
+			"emp-123",
+			nil,
+		},
+		{
+			"prefixed normalized",
+			"EMP-0123",
+			"emp-123",
+			nil,
+		},
+		{
+			"prefixed without number",
+			"emp-",
+			"",
+			ErrMalformedEmployeeID,
+		},
+		{
+			"prefixed with junk",
+			"emp-12a",
+			"",
+			ErrMalformedEmployeeID,
+		},
+		{
+			"uuid",
+			"0f8fad5b-d9cb-469f-a165-70867728950e",
+			"0f8fad5b-d9cb-469f-a165-70867728950e",
+			nil,
+		},
+		{
+			"uuid upper case",
+			"0F8FAD5B-D9CB-469F-A165-70867728950E",
+			"0f8fad5b-d9cb-469f-a165-70867728950e",
+			nil,
+		},
+		{
+			"uuid missing a chunk",
+			"0f8fad5b-d9cb-469f-70867728950e",
+			"",
+			ErrMalformedEmployeeID,
+		},
+		{
+			"empty",
+			"",
+			"",
+			ErrMalformedEmployeeID,
+		},
+		{
+			"words",
+			"BLAH",
+			"",
+			ErrMalformedEmployeeID,
+		},
+		{
+			"path traversal",
+			"../1",
+			"",
+			ErrMalformedEmployeeID,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			id, err := ParseEmployeeID(tc.input)
+			asserter.Equal(tc.expectedError, err)
+			asserter.Equal(tc.expectedID, id)
+		})
+	}
+}
+
+func TestEmployeeIDFromInt(t *testing.T) {
+	asserter := assert.New(t)
+
+	asserter.Equal(EmployeeID("42"), EmployeeIDFromInt(42))
+	asserter.Equal("42", EmployeeIDFromInt(42).String())
+}
@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteEmployee_JSON(t *testing.T) {
+	asserter := assert.New(t)
+
+	raw := `{"status":"success","data":{"id":1,"employee_name":"Tiger Nixon","employee_salary":320800,"employee_age":61,"profile_image":""},"message":"Successfully! Record has been fetched."}`
+	res := new(RemoteEmployee)
+	asserter.NoError(json.Unmarshal([]byte(raw), res))
+	asserter.Equal(&RemoteEmployee{
+		Status: "success",
+		Data: &RemoteEmployeeData{
+			ID:             1,
+			EmployeeName:   "Tiger Nixon",
+			EmployeeSalary: 320800,
+			EmployeeAge:    61,
+		},
+	}, res)
+
+	notFound := new(RemoteEmployee)
+	asserter.NoError(json.Unmarshal([]byte(`{"status":"success","data":null}`), notFound))
+	asserter.Nil(notFound.Data)
+}
+
+func TestRemoteEmployee_Validate(t *testing.T) {
+	valid := func() *RemoteEmployeeData {
+		return &RemoteEmployeeData{ID: 1, EmployeeName: "Tiger Nixon", EmployeeSalary: 320800, EmployeeAge: 61}
+	}
+
+	testCases := []struct {
+		desc     string
+		input    RemoteEmployee
+		expected error
+	}{
+		{"valid", RemoteEmployee{Data: valid()}, nil},
+		{"no data", RemoteEmployee{Status: "success"}, ValidationError{{"data", "is required"}}},
+		{
+			"everything wrong",
+			RemoteEmployee{Data: &RemoteEmployeeData{ID: -1, EmployeeSalary: -2, EmployeeAge: -3}},
+			ValidationError{
+				{"data.id", "must not be negative"},
+				{"data.employee_name", "is required"},
+				{"data.employee_salary", "must not be negative"},
+				{"data.employee_age", "must not be negative"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+			asserter.Equal(tc.expected, tc.input.Validate())
+		})
+	}
+}
+
+func TestEmployee_Validate(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		input       Employee
+		expectedErr string
+	}{
+		{"valid", Employee{ID: "1", Name: "Tiger Nixon", Age: 61, Generation: BabyBoomer}, ""},
+		// upstream does hand out nameless employees, so that alone isn't a problem
+		{"no name", Employee{ID: "1", Age: 61, Generation: BabyBoomer}, ""},
+		{"no id", Employee{Name: "Tiger Nixon", Age: 61, Generation: BabyBoomer}, "id is required"},
+		{"negative age", Employee{ID: "1", Age: -1, Generation: GenZ}, "age must not be negative"},
+		{"bad generation", Employee{ID: "1", Generation: "DrinksRUs"}, `generation "DrinksRUs": unknown generation`},
+		{"zero value", Employee{}, `id is required, generation "": unknown generation`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			err := tc.input.Validate()
+			if tc.expectedErr == "" {
+				asserter.NoError(err)
+			} else {
+				asserter.EqualError(err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestEmployee_CSV(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := Employee{ID: "1", Name: "Tiger Nixon", Age: 61, Generation: BabyBoomer, GenerationCode: "baby_boomer", GenerationLabel: "Babyboomer"}
+	asserter.Equal([]string{"id", "employee_name", "age", "generation", "generation_code", "generation_label"}, testInstance.CSVHeader())
+	asserter.Equal([]string{"1", "Tiger Nixon", "61", "Baby Boomer", "baby_boomer", "Babyboomer"}, testInstance.CSVRecord())
+}
+
+func TestEmployeeMatches(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := EmployeeMatches{
+		{Employee: Employee{ID: "1", Name: "Tiger Nixon", Age: 61, Generation: BabyBoomer}, Score: 0.75, Match: "fuzzy"},
+	}
+	asserter.Equal([]string{"id", "employee_name", "age", "generation", "generation_code", "generation_label", "score", "match"}, testInstance[0].CSVHeader())
+	asserter.Equal([]string{"1", "Tiger Nixon", "61", "Baby Boomer", "", "", "0.75", "fuzzy"}, testInstance[0].CSVRecord())
+
+	asJSON, err := json.Marshal(testInstance)
+	asserter.NoError(err)
+	asserter.JSONEq(`[{"id":"1","employee_name":"Tiger Nixon","age":61,"generation":"Baby Boomer","score":0.75,"match":"fuzzy"}]`, string(asJSON))
+
+	asXML, err := xml.Marshal(testInstance)
+	asserter.NoError(err)
+	asserter.Equal("<employees><employee><id>1</id><employee_name>Tiger Nixon</employee_name><age>61</age><generation>Baby Boomer</generation><score>0.75</score><match>fuzzy</match></employee></employees>", string(asXML))
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Problem types we hand out. They're relative URIs, so they resolve against whatever host served the response.
+const (
+	ProblemTypeEmployeeNotFound     = "/problems/employee-not-found"
+	ProblemTypeInvalidParams        = "/problems/invalid-params"
+	ProblemTypeNotAcceptable        = "/problems/not-acceptable"
+	ProblemTypeRouteNotFound        = "/problems/route-not-found"
+	ProblemTypeSearchUnavailable    = "/problems/search-unavailable"
+	ProblemTypeSubscriptionNotFound = "/problems/subscription-not-found"
+	// ProblemTypeBlank is RFC 7807 speak for "nothing more to say than the status code"
+	ProblemTypeBlank = "about:blank"
+)
+
+// Error is what clients get back when things don't work out. It's an RFC 7807 problem details object, so the content
+// type goes out as application/problem+json (or +xml) when the client negotiated JSON (or XML). It's an error itself
+// too, with the status code riding along, so it can be handed straight back from an endpoint.
+type Error struct {
+	XMLName       xml.Name         `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Type          string           `json:"type" xml:"type"`
+	Title         string           `json:"title" xml:"title"`
+	Status        int              `json:"status" xml:"status"`
+	Detail        string           `json:"detail,omitempty" xml:"detail,omitempty"`
+	Instance      string           `json:"instance,omitempty" xml:"instance,omitempty"`
+	InvalidParams InvalidParamList `json:"invalid-params,omitempty" xml:"invalid-params,omitempty"`
+}
+
+func (e Error) Error() string {
+	if e.Detail == "" {
+		return e.Title
+	}
+	return fmt.Sprintf("%s: %s", e.Title, e.Detail)
+}
+
+func (e Error) StatusCode() int {
+	return e.Status
+}
+
+func (e Error) CSVHeader() []string {
+	return []string{"type", "title", "status", "detail", "instance", "invalid_params"}
+}
+
+func (e Error) CSVRecord() []string {
+	var params []string
+	for _, p := range e.InvalidParams {
+		params = append(params, fmt.Sprintf("%s: %s", p.Name, p.Reason))
+	}
+	return []string{e.Type, e.Title, strconv.Itoa(e.Status), e.Detail, e.Instance, strings.Join(params, "; ")}
+}
+
+func (e Error) Validate() error {
+	var ret ValidationError
+	if e.Type == "" {
+		ret = append(ret, InvalidParam{"type", "is required"})
+	}
+	if e.Title == "" {
+		ret = append(ret, InvalidParam{"title", "is required"})
+	}
+	if e.Status < 400 || e.Status > 599 {
+		ret = append(ret, InvalidParam{"status", "must be a 4xx or 5xx status code"})
+	}
+	return ret.orNil()
+}
+
+// InvalidParam is the extension member from the RFC 7807 validation example, one per input that didn't pass muster
+type InvalidParam struct {
+	Name   string `json:"name" xml:"name"`
+	Reason string `json:"reason" xml:"reason"`
+}
+
+// InvalidParamList only exists to get the XML right, RFC 7807 wants arrays as repeated <i> elements inside the
+// member element, and encoding/xml can't be convinced to leave the wrapper out when the list is empty with tags alone.
+type InvalidParamList []InvalidParam
+
+func (l InvalidParamList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(struct {
+		Items []InvalidParam `xml:"i"`
+	}{l}, start)
+}
+
+// ValidationError is what the Validate methods hand back, every field that's off rather than just the first. They're
+// InvalidParams so they can go straight into a problem.
+type ValidationError []InvalidParam
+
+func (v ValidationError) Error() string {
+	var parts []string
+	for _, p := range v {
+		parts = append(parts, fmt.Sprintf("%s %s", p.Name, p.Reason))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// orNil keeps a nil ValidationError from turning into a non nil error
+func (v ValidationError) orNil() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	asserter := assert.New(t)
+
+	var err error = Error{
+		Type:   ProblemTypeEmployeeNotFound,
+		Title:  "Employee not found",
+		Status: http.StatusNotFound,
+		Detail: "no employee exists with id 7",
+	}
+	asserter.EqualError(err, "Employee not found: no employee exists with id 7")
+	asserter.Equal(http.StatusNotFound, err.(Error).StatusCode())
+
+	asserter.EqualError(Error{Title: "Internal Server Error"}, "Internal Server Error")
+
+	// the xml name shouldn't leak into json
+	asJSON, jsonErr := json.Marshal(err)
+	asserter.NoError(jsonErr)
+	asserter.Equal(`{"type":"/problems/employee-not-found","title":"Employee not found","status":404,"detail":"no employee exists with id 7"}`, string(asJSON))
+}
+
+func TestError_Validate(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		input       Error
+		expectedErr string
+	}{
+		{"valid", Error{Type: ProblemTypeBlank, Title: "Internal Server Error", Status: 500}, ""},
+		{"success status", Error{Type: ProblemTypeBlank, Title: "OK", Status: 200}, "status must be a 4xx or 5xx status code"},
+		{"zero value", Error{}, "type is required, title is required, status must be a 4xx or 5xx status code"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			err := tc.input.Validate()
+			if tc.expectedErr == "" {
+				asserter.NoError(err)
+			} else {
+				asserter.EqualError(err, tc.expectedErr)
+				asserter.IsType(ValidationError{}, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package domain
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+type Generation string
+
+const (
+	// see https://www.cnn.com/2013/11/06/us/baby-boomer-generation-fast-facts/index.html
+	Greatest   Generation = "Greatest"     // 1924 and earlier
+	Silent     Generation = "Silent"       // 1925 - 1945
+	BabyBoomer Generation = "Baby Boomer"  // 1946 - 1964
+	GenX       Generation = "Generation X" // 1965 - 1980
+	Millennial Generation = "Millennial"   // 1981 - 1996
+	GenZ       Generation = "Generation Z" // 1997 +
+)
+
+// YearRange is the birth years a generation covers, inclusive. The first and last generations are open ended, a zero
+// From or To means there's no bound on that side.
+type YearRange struct {
+	From int `json:"from,omitempty" xml:"from,omitempty"`
+	To   int `json:"to,omitempty" xml:"to,omitempty"`
+}
+
+func (r YearRange) Contains(year int) bool {
+	return (r.From == 0 || year >= r.From) && (r.To == 0 || year <= r.To)
+}
+
+type generationInfo struct {
+	generation Generation
+	// code is the stable, never translated, machine friendly name
+	code  string
+	years YearRange
+	// aliases are what people actually type, already normalized (see normalizeGeneration)
+	aliases []string
+}
+
+// generations is every Generation, oldest first
+var generations = []generationInfo{
+	{Greatest, "greatest", YearRange{To: 1924}, []string{"greatest", "greatestgeneration", "gi", "gigeneration"}},
+	{Silent, "silent", YearRange{From: 1925, To: 1945}, []string{"silent", "silentgeneration"}},
+	{BabyBoomer, "baby_boomer", YearRange{From: 1946, To: 1964}, []string{"babyboomer", "babyboomers", "boomer", "boomers"}},
+	{GenX, "gen_x", YearRange{From: 1965, To: 1980}, []string{"generationx", "genx", "x"}},
+	{Millennial, "millennial", YearRange{From: 1981, To: 1996}, []string{"millennial", "millennials", "generationy", "geny", "y"}},
+	{GenZ, "gen_z", YearRange{From: 1997}, []string{"generationz", "genz", "z", "zoomer", "zoomers"}},
+}
+
+var ErrUnknownGeneration = errors.New("unknown generation")
+
+// All is every generation, oldest first
+func All() []Generation {
+	var ret []Generation
+	for _, g := range generations {
+		ret = append(ret, g.generation)
+	}
+	return ret
+}
+
+// GenerationFor is the generation someone born in birthYear is part of. The ranges leave no gaps, so every year has one.
+func GenerationFor(birthYear int) Generation {
+	for _, g := range generations {
+		if g.years.Contains(birthYear) {
+			return g.generation
+		}
+	}
+	// only reachable if somebody opens up a gap in generations, which TestGeneration_YearRange is there to catch
+	return generations[len(generations)-1].generation
+}
+
+// ParseGeneration is forgiving about how a generation gets written, case, spacing and punctuation don't matter and
+// common nicknames ("boomer", "gen z", "millennials") work, as do codes
+func ParseGeneration(raw string) (Generation, error) {
+	normalized := normalizeGeneration(raw)
+	for _, g := range generations {
+		for _, alias := range g.aliases {
+			if normalized == alias {
+				return g.generation, nil
+			}
+		}
+	}
+	return "", errors.Wrapf(ErrUnknownGeneration, "%q", raw)
+}
+
+func normalizeGeneration(raw string) string {
+	var ret strings.Builder
+	for _, r := range strings.ToLower(raw) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			ret.WriteRune(r)
+		}
+	}
+	return ret.String()
+}
+
+func (g Generation) String() string {
+	return string(g)
+}
+
+func (g Generation) Validate() error {
+	if _, ok := g.info(); !ok {
+		return errors.Wrapf(ErrUnknownGeneration, "%q", string(g))
+	}
+	return nil
+}
+
+// Code is a stable identifier for the generation, unlike the name it's never going to be reworded or translated.
+// Unknown generations don't have one.
+func (g Generation) Code() string {
+	info, _ := g.info()
+	return info.code
+}
+
+// YearRange is the birth years the generation covers, unknown generations get an empty range which contains
+// everything so check Validate first if that matters
+func (g Generation) YearRange() YearRange {
+	info, _ := g.info()
+	return info.years
+}
+
+func (g Generation) info() (generationInfo, bool) {
+	for _, info := range generations {
+		if info.generation == g {
+			return info, true
+		}
+	}
+	return generationInfo{}, false
+}
+
+// MarshalText doesn't validate, an employee that hasn't been given a generation yet should still be printable. Use
+// Validate when it matters.
+func (g Generation) MarshalText() ([]byte, error) {
+	return []byte(g), nil
+}
+
+// GenerationEntry is a generation along with the birth years it covers, for handing out to clients. Label is for
+// showing people, it starts out the same as Name but gets translated.
+type GenerationEntry struct {
+	Name  Generation `json:"name" xml:"name"`
+	Code  string     `json:"code" xml:"code"`
+	Label string     `json:"label" xml:"label"`
+	YearRange
+}
+
+func (e GenerationEntry) CSVHeader() []string {
+	return []string{"name", "code", "label", "from", "to"}
+}
+
+func (e GenerationEntry) CSVRecord() []string {
+	bound := func(year int) string {
+		if year == 0 {
+			return ""
+		}
+		return strconv.Itoa(year)
+	}
+	return []string{string(e.Name), e.Code, e.Label, bound(e.From), bound(e.To)}
+}
+
+// GenerationCatalog is every generation with its years, oldest first
+type GenerationCatalog []GenerationEntry
+
+// MarshalXML wraps the entries in a single root element, a bare slice would come out as several documents glued
+// together
+func (c GenerationCatalog) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "generations"}
+	return e.EncodeElement(struct {
+		Items []GenerationEntry `xml:"generation"`
+	}{c}, start)
+}
+
+func Catalog() GenerationCatalog {
+	var ret GenerationCatalog
+	for _, g := range generations {
+		ret = append(ret, GenerationEntry{Name: g.generation, Code: g.code, Label: string(g.generation), YearRange: g.years})
+	}
+	return ret
+}
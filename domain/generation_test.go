@@ -0,0 +1,235 @@
+package domain
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneration_Validate(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		input       Generation
+		expectedErr string
+	}{
+		{"greatest", Greatest, ""},
+		{"silent", Silent, ""},
+		{"boomer", BabyBoomer, ""},
+		{"gen x", GenX, ""},
+		{"millennial", Millennial, ""},
+		{"gen z", GenZ, ""},
+		{"empty", "", `"": unknown generation`},
+		{"wrong case", "millennial", `"millennial": unknown generation`},
+		{"made up", "DrinksRUs", `"DrinksRUs": unknown generation`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			err := tc.input.Validate()
+			if tc.expectedErr == "" {
+				asserter.NoError(err)
+			} else {
+				asserter.EqualError(err, tc.expectedErr)
+				asserter.True(errors.Is(err, ErrUnknownGeneration))
+			}
+		})
+	}
+}
+
+func TestGeneration_Text(t *testing.T) {
+	asserter := assert.New(t)
+
+	asserter.Equal("Generation X", GenX.String())
+
+	text, err := BabyBoomer.MarshalText()
+	asserter.NoError(err)
+	asserter.Equal("Baby Boomer", string(text))
+
+	// the text form is what ends up in map keys and xml, not just json values
+	asJSON, err := json.Marshal(map[Generation]Generation{GenZ: Millennial})
+	asserter.NoError(err)
+	asserter.Equal(`{"Generation Z":"Millennial"}`, string(asJSON))
+
+	asXML, err := xml.Marshal(struct {
+		XMLName    xml.Name   `xml:"thing"`
+		Generation Generation `xml:"generation,attr"`
+	}{Generation: Silent})
+	asserter.NoError(err)
+	asserter.Equal(`<thing generation="Silent"></thing>`, string(asXML))
+}
+
+func TestParseGeneration(t *testing.T) {
+	testCases := []struct {
+		input       string
+		expected    Generation
+		expectedErr string
+	}{
+		{"Greatest", Greatest, ""},
+		{"GI Generation", Greatest, ""},
+		{"silent", Silent, ""},
+		{"The Silent Generation", "", `"The Silent Generation": unknown generation`},
+		{"Baby Boomer", BabyBoomer, ""},
+		{"boomer", BabyBoomer, ""},
+		{"BOOMERS", BabyBoomer, ""},
+		{"baby-boomer", BabyBoomer, ""},
+		{"genx", GenX, ""},
+		{"Gen X", GenX, ""},
+		{"gen-x", GenX, ""},
+		{"Generation X", GenX, ""},
+		{"  x  ", GenX, ""},
+		{"millennials", Millennial, ""},
+		{"Gen Y", Millennial, ""},
+		{"gen z", GenZ, ""},
+		{"Gen_Z", GenZ, ""},
+		{"zoomer", GenZ, ""},
+		{"Generation Alpha", "", `"Generation Alpha": unknown generation`},
+		{"", "", `"": unknown generation`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			res, err := ParseGeneration(tc.input)
+			asserter.Equal(tc.expected, res)
+			if tc.expectedErr == "" {
+				asserter.NoError(err)
+			} else {
+				asserter.EqualError(err, tc.expectedErr)
+				asserter.True(errors.Is(err, ErrUnknownGeneration))
+			}
+		})
+	}
+}
+
+func TestParseGeneration_RoundTrips(t *testing.T) {
+	for _, g := range All() {
+		t.Run(g.String(), func(t *testing.T) {
+			asserter := assert.New(t)
+
+			res, err := ParseGeneration(g.String())
+			asserter.NoError(err)
+			asserter.Equal(g, res)
+		})
+	}
+}
+
+func TestAll(t *testing.T) {
+	asserter := assert.New(t)
+	asserter.Equal([]Generation{Greatest, Silent, BabyBoomer, GenX, Millennial, GenZ}, All())
+
+	// handing out the list shouldn't hand out the ability to change it
+	All()[0] = "nope"
+	asserter.Equal(Greatest, All()[0])
+}
+
+func TestGeneration_Code(t *testing.T) {
+	asserter := assert.New(t)
+
+	asserter.Equal([]string{"greatest", "silent", "baby_boomer", "gen_x", "millennial", "gen_z"}, func() []string {
+		var ret []string
+		for _, g := range All() {
+			ret = append(ret, g.Code())
+		}
+		return ret
+	}())
+	asserter.Equal("", Generation("DrinksRUs").Code())
+
+	// codes are something people will pass around, so they need to parse too
+	for _, g := range All() {
+		res, err := ParseGeneration(g.Code())
+		asserter.NoError(err)
+		asserter.Equal(g, res)
+	}
+}
+
+func TestGeneration_YearRange(t *testing.T) {
+	asserter := assert.New(t)
+
+	asserter.Equal(YearRange{To: 1924}, Greatest.YearRange())
+	asserter.Equal(YearRange{From: 1946, To: 1964}, BabyBoomer.YearRange())
+	asserter.Equal(YearRange{From: 1997}, GenZ.YearRange())
+	asserter.Equal(YearRange{}, Generation("DrinksRUs").YearRange())
+
+	// the ranges need to pick up right where the last one left off, no gaps and no overlap
+	all := All()
+	for i := 1; i < len(all); i++ {
+		asserter.Equal(all[i-1].YearRange().To+1, all[i].YearRange().From, "%s -> %s", all[i-1], all[i])
+	}
+	asserter.Zero(all[0].YearRange().From)
+	asserter.Zero(all[len(all)-1].YearRange().To)
+}
+
+func TestGenerationFor(t *testing.T) {
+	testCases := []struct {
+		birthYear int
+		expected  Generation
+	}{
+		{1900, Greatest},
+		{1924, Greatest},
+		{1925, Silent},
+		{1945, Silent},
+		{1946, BabyBoomer},
+		{1964, BabyBoomer},
+		{1965, GenX},
+		{1980, GenX},
+		{1981, Millennial},
+		{1996, Millennial},
+		{1997, GenZ},
+		{2020, GenZ},
+		{math.MinInt64, Greatest},
+		{math.MaxInt64, GenZ},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprint(tc.birthYear), func(t *testing.T) {
+			asserter := assert.New(t)
+			asserter.Equal(tc.expected, GenerationFor(tc.birthYear))
+		})
+	}
+}
+
+func TestYearRange_Contains(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    YearRange
+		year     int
+		expected bool
+	}{
+		{"inside", YearRange{1946, 1964}, 1950, true},
+		{"first year", YearRange{1946, 1964}, 1946, true},
+		{"last year", YearRange{1946, 1964}, 1964, true},
+		{"before", YearRange{1946, 1964}, 1945, false},
+		{"after", YearRange{1946, 1964}, 1965, false},
+		{"open start", YearRange{To: 1924}, -500, true},
+		{"open end", YearRange{From: 1997}, 3000, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+			asserter.Equal(tc.expected, tc.input.Contains(tc.year))
+		})
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := Catalog()
+
+	asJSON, err := json.Marshal(testInstance)
+	asserter.NoError(err)
+	asserter.Equal(`[{"name":"Greatest","code":"greatest","label":"Greatest","to":1924},{"name":"Silent","code":"silent","label":"Silent","from":1925,"to":1945},{"name":"Baby Boomer","code":"baby_boomer","label":"Baby Boomer","from":1946,"to":1964},{"name":"Generation X","code":"gen_x","label":"Generation X","from":1965,"to":1980},{"name":"Millennial","code":"millennial","label":"Millennial","from":1981,"to":1996},{"name":"Generation Z","code":"gen_z","label":"Generation Z","from":1997}]`, string(asJSON))
+
+	asXML, err := xml.Marshal(testInstance[:2])
+	asserter.NoError(err)
+	asserter.Equal(`<generations><generation><name>Greatest</name><code>greatest</code><label>Greatest</label><to>1924</to></generation><generation><name>Silent</name><code>silent</code><label>Silent</label><from>1925</from><to>1945</to></generation></generations>`, string(asXML))
+
+	asserter.Equal([]string{"name", "code", "label", "from", "to"}, testInstance[0].CSVHeader())
+	asserter.Equal([]string{"Greatest", "greatest", "Greatest", "", "1924"}, testInstance[0].CSVRecord())
+	asserter.Equal([]string{"Generation Z", "gen_z", "Generation Z", "1997", ""}, testInstance[5].CSVRecord())
+}
@@ -0,0 +1,99 @@
+package domain
+
+// Schema is a JSON Schema (draft 2020-12) document, marshal it to get the real thing
+type Schema map[string]interface{}
+
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+func GenerationSchema() Schema {
+	var enum []string
+	for _, g := range All() {
+		enum = append(enum, g.String())
+	}
+	return Schema{
+		"$schema":     schemaDialect,
+		"title":       "Generation",
+		"description": "the generation someone was born into, based on their birth year",
+		"type":        "string",
+		"enum":        enum,
+	}
+}
+
+func EmployeeSchema() Schema {
+	generation := GenerationSchema()
+	delete(generation, "$schema")
+	var codes []string
+	for _, g := range All() {
+		codes = append(codes, g.Code())
+	}
+	return Schema{
+		"$schema": schemaDialect,
+		"title":   "Employee",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"id":            Schema{"type": "string", "minLength": 1},
+			"employee_name": Schema{"type": "string"},
+			"age":           Schema{"type": "integer", "minimum": 0},
+			"generation":    generation,
+			"generation_code": Schema{
+				"type": "string",
+				"enum": codes,
+			},
+			"generation_label": Schema{"type": "string", "description": "the generation for showing people, translated per Accept-Language"},
+		},
+		"required":             []string{"id", "employee_name", "age", "generation"},
+		"additionalProperties": false,
+	}
+}
+
+func RemoteEmployeeSchema() Schema {
+	return Schema{
+		"$schema":     schemaDialect,
+		"title":       "RemoteEmployee",
+		"description": "what upstream sends back for an employee, data is null or missing when there's no such employee",
+		"type":        "object",
+		"properties": map[string]interface{}{
+			"status": Schema{"type": "string"},
+			"data": Schema{
+				"type": []string{"object", "null"},
+				"properties": map[string]interface{}{
+					"id":              Schema{"type": "integer", "minimum": 0},
+					"employee_name":   Schema{"type": "string"},
+					"employee_salary": Schema{"type": "integer", "minimum": 0},
+					"employee_age":    Schema{"type": "integer", "minimum": 0},
+					"profile_image":   Schema{"type": "string"},
+				},
+				"required": []string{"id"},
+			},
+		},
+		"required": []string{"status"},
+	}
+}
+
+func ErrorSchema() Schema {
+	return Schema{
+		"$schema":     schemaDialect,
+		"title":       "Error",
+		"description": "an RFC 7807 problem details object",
+		"type":        "object",
+		"properties": map[string]interface{}{
+			"type":     Schema{"type": "string", "format": "uri-reference"},
+			"title":    Schema{"type": "string", "minLength": 1},
+			"status":   Schema{"type": "integer", "minimum": 400, "maximum": 599},
+			"detail":   Schema{"type": "string"},
+			"instance": Schema{"type": "string", "format": "uri-reference"},
+			"invalid-params": Schema{
+				"type": "array",
+				"items": Schema{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":   Schema{"type": "string"},
+						"reason": Schema{"type": "string"},
+					},
+					"required": []string{"name", "reason"},
+				},
+			},
+		},
+		"required": []string{"type", "title", "status"},
+	}
+}
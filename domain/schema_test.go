@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonFields is every json field name a struct has, the schemas need to stay in step with them
+func jsonFields(t reflect.Type) []string {
+	var ret []string
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func schemaFields(s Schema) []string {
+	var ret []string
+	for name := range s["properties"].(map[string]interface{}) {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestSchemas_MatchTypes(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		schema Schema
+		goType reflect.Type
+	}{
+		{"employee", EmployeeSchema(), reflect.TypeOf(Employee{})},
+		{"remote employee", RemoteEmployeeSchema(), reflect.TypeOf(RemoteEmployee{})},
+		{"remote employee data", RemoteEmployeeSchema()["properties"].(map[string]interface{})["data"].(Schema), reflect.TypeOf(RemoteEmployeeData{})},
+		{"error", ErrorSchema(), reflect.TypeOf(Error{})},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+			asserter.Equal(jsonFields(tc.goType), schemaFields(tc.schema))
+			_, err := json.Marshal(tc.schema)
+			asserter.NoError(err)
+		})
+	}
+}
+
+func TestGenerationSchema(t *testing.T) {
+	asserter := assert.New(t)
+
+	raw, err := json.Marshal(GenerationSchema())
+	asserter.NoError(err)
+	asserter.JSONEq(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title": "Generation",
+		"description": "the generation someone was born into, based on their birth year",
+		"type": "string",
+		"enum": ["Greatest", "Silent", "Baby Boomer", "Generation X", "Millennial", "Generation Z"]
+	}`, string(raw))
+
+	// and employees use the same thing, minus the dialect since it's nested
+	generation := EmployeeSchema()["properties"].(map[string]interface{})["generation"].(Schema)
+	asserter.Nil(generation["$schema"])
+	asserter.Equal(GenerationSchema()["enum"], generation["enum"])
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/fakeupstream"
+	"github.com/jonsabados/unit-testing-party/fixturegen"
+)
+
+func main() {
+	port := flag.Int("port", 8090, "port to listen on")
+	latency := flag.Duration("latency", 0, "latency added to every response")
+	jitter := flag.Duration("jitter", 0, "random extra latency, up to this much")
+	errorRate := flag.Float64("error-rate", 0, "odds (0 - 1) of answering with -error-status")
+	errorStatus := flag.Int("error-status", http.StatusInternalServerError, "status code used for injected errors")
+	rateLimit := flag.Int("rate-limit", 0, "requests allowed per -rate-limit-window, 0 for no limit")
+	rateLimitWindow := flag.Duration("rate-limit-window", time.Second, "window the rate limit applies to")
+	datasetPath := flag.String("dataset", "", "serve a dataset made by fixturegen instead of the usual roster")
+	flag.Parse()
+
+	// without a window every request starts a new one, so the limit would never kick in
+	if *rateLimit > 0 && *rateLimitWindow <= 0 {
+		fmt.Fprintln(os.Stderr, "-rate-limit-window must be positive when -rate-limit is set")
+		os.Exit(2)
+	}
+
+	employees := fakeupstream.SeedEmployees()
+	var payloads map[string]json.RawMessage
+	if *datasetPath != "" {
+		dataset, err := fixturegen.Load(*datasetPath)
+		if err != nil {
+			panic(err)
+		}
+		employees = dataset.Employees()
+		payloads = dataset.Payloads()
+	}
+
+	svr := fakeupstream.NewServer(fakeupstream.Config{
+		Employees:       employees,
+		Payloads:        payloads,
+		Latency:         *latency,
+		LatencyJitter:   *jitter,
+		ErrorRate:       *errorRate,
+		ErrorStatus:     *errorStatus,
+		RateLimit:       *rateLimit,
+		RateLimitWindow: *rateLimitWindow,
+	})
+
+	panic(http.ListenAndServe(fmt.Sprintf("0:%d", *port), svr))
+}
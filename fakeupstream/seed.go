@@ -0,0 +1,33 @@
+package fakeupstream
+
+import "github.com/jonsabados/unit-testing-party/domain"
+
+// SeedEmployees is the roster the public dummy API serves, so anything written against that works against this
+func SeedEmployees() []domain.RemoteEmployeeData {
+	return []domain.RemoteEmployeeData{
+		{ID: 1, EmployeeName: "Tiger Nixon", EmployeeSalary: 320800, EmployeeAge: 61},
+		{ID: 2, EmployeeName: "Garrett Winters", EmployeeSalary: 170750, EmployeeAge: 63},
+		{ID: 3, EmployeeName: "Ashton Cox", EmployeeSalary: 86000, EmployeeAge: 66},
+		{ID: 4, EmployeeName: "Cedric Kelly", EmployeeSalary: 433060, EmployeeAge: 22},
+		{ID: 5, EmployeeName: "Airi Satou", EmployeeSalary: 162700, EmployeeAge: 33},
+		{ID: 6, EmployeeName: "Brielle Williamson", EmployeeSalary: 372000, EmployeeAge: 61},
+		{ID: 7, EmployeeName: "Herrod Chandler", EmployeeSalary: 137500, EmployeeAge: 59},
+		{ID: 8, EmployeeName: "Rhona Davidson", EmployeeSalary: 327900, EmployeeAge: 55},
+		{ID: 9, EmployeeName: "Colleen Hurst", EmployeeSalary: 205500, EmployeeAge: 39},
+		{ID: 10, EmployeeName: "Sonya Frost", EmployeeSalary: 103600, EmployeeAge: 23},
+		{ID: 11, EmployeeName: "Jena Gaines", EmployeeSalary: 90560, EmployeeAge: 30},
+		{ID: 12, EmployeeName: "Quinn Flynn", EmployeeSalary: 342000, EmployeeAge: 22},
+		{ID: 13, EmployeeName: "Charde Marshall", EmployeeSalary: 470600, EmployeeAge: 36},
+		{ID: 14, EmployeeName: "Haley Kennedy", EmployeeSalary: 313500, EmployeeAge: 43},
+		{ID: 15, EmployeeName: "Tatyana Fitzpatrick", EmployeeSalary: 385750, EmployeeAge: 19},
+		{ID: 16, EmployeeName: "Michael Silva", EmployeeSalary: 198500, EmployeeAge: 66},
+		{ID: 17, EmployeeName: "Paul Byrd", EmployeeSalary: 725000, EmployeeAge: 64},
+		{ID: 18, EmployeeName: "Gloria Little", EmployeeSalary: 237500, EmployeeAge: 59},
+		{ID: 19, EmployeeName: "Bradley Greer", EmployeeSalary: 132000, EmployeeAge: 41},
+		{ID: 20, EmployeeName: "Dai Rios", EmployeeSalary: 217500, EmployeeAge: 35},
+		{ID: 21, EmployeeName: "Jenette Caldwell", EmployeeSalary: 345000, EmployeeAge: 30},
+		{ID: 22, EmployeeName: "Yuri Berry", EmployeeSalary: 675000, EmployeeAge: 40},
+		{ID: 23, EmployeeName: "Caesar Vance", EmployeeSalary: 106450, EmployeeAge: 21},
+		{ID: 24, EmployeeName: "Doris Wilder", EmployeeSalary: 85600, EmployeeAge: 23},
+	}
+}
@@ -0,0 +1,201 @@
+// Package fakeupstream is a stand in for the employee REST API at dummy.restapiexample.com, so things can be run and
+// tested without the internet, and so the upstream misbehaving can be done on purpose rather than whenever it feels
+// like it.
+package fakeupstream
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+)
+
+type Config struct {
+	// Employees is the roster served up, SeedEmployees gives the same data the real API has
+	Employees []domain.RemoteEmployeeData
+	// Payloads are raw response bodies keyed by the id in the path, for things that can't be expressed as a domain.RemoteEmployeeData
+	// (null fields, numbers as strings and such). They win over Employees, see the fixturegen package for making them.
+	Payloads map[string]json.RawMessage
+	// Latency is added to every response, plus a random amount up to LatencyJitter
+	Latency       time.Duration
+	LatencyJitter time.Duration
+	// ErrorRate is the odds (0 - 1) of answering with ErrorStatus instead of doing what was asked, ErrorStatus
+	// defaults to 500
+	ErrorRate   float64
+	ErrorStatus int
+	// RateLimit is how many requests are allowed per RateLimitWindow before answering 429, zero means no limit.
+	// RateLimitWindow defaults to a second.
+	RateLimit       int
+	RateLimitWindow time.Duration
+	// Rand and Now are here so tests can make things deterministic, they default to math/rand and time.Now
+	Rand func() float64
+	Now  func() time.Time
+	// Sleep defaults to time.Sleep
+	Sleep func(time.Duration)
+}
+
+type response struct {
+	Status  string      `json:"status"`
+	Data    interface{} `json:"data"`
+	Message string      `json:"message,omitempty"`
+}
+
+type Server struct {
+	mu  sync.Mutex
+	cfg Config
+	mux *http.ServeMux
+
+	windowStart time.Time
+	windowCount int
+}
+
+func NewServer(cfg Config) *Server {
+	ret := &Server{
+		cfg: cfg,
+		mux: http.NewServeMux(),
+	}
+	ret.mux.HandleFunc("/api/v1/employee/", ret.getEmployee)
+	ret.mux.HandleFunc("/api/v1/employees", ret.listEmployees)
+	return ret
+}
+
+// Update allows the config to be changed while the server is running, eg to start failing part way through a test
+func (s *Server) Update(f func(cfg *Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(&s.cfg)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	cfg, limited := s.admit()
+
+	if delay := latency(cfg); delay > 0 {
+		sleep := cfg.Sleep
+		if sleep == nil {
+			sleep = time.Sleep
+		}
+		sleep(delay)
+	}
+
+	if limited {
+		// Retry-After only does whole seconds, rounding down would have clients retrying right into the same window
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rateLimitWindow(cfg).Seconds()))))
+		writeJSON(w, http.StatusTooManyRequests, response{Status: "error", Message: "Too Many Attempts."})
+		return
+	}
+
+	if cfg.ErrorRate > 0 && random(cfg) < cfg.ErrorRate {
+		status := cfg.ErrorStatus
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		writeJSON(w, status, response{Status: "error", Message: "stuff went terribly wrong"})
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, response{Status: "error", Message: "method not allowed"})
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// admit grabs a snapshot of the config and counts the request against the rate limit
+func (s *Server) admit() (Config, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg := s.cfg
+	if cfg.RateLimit <= 0 {
+		return cfg, false
+	}
+
+	now := time.Now()
+	if cfg.Now != nil {
+		now = cfg.Now()
+	}
+	if now.Sub(s.windowStart) >= rateLimitWindow(cfg) {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	s.windowCount++
+	return cfg, s.windowCount > cfg.RateLimit
+}
+
+func (s *Server) getEmployee(w http.ResponseWriter, r *http.Request) {
+	rawID := strings.TrimPrefix(r.URL.Path, "/api/v1/employee/")
+
+	s.mu.Lock()
+	payload, ok := s.cfg.Payloads[rawID]
+	s.mu.Unlock()
+	if ok {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(payload)
+		return
+	}
+
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		// the real thing answers garbage ids the same as ids that don't exist
+		writeJSON(w, http.StatusOK, response{Status: "success", Data: nil, Message: "Successfully! Record has been fetched."})
+		return
+	}
+
+	s.mu.Lock()
+	employees := s.cfg.Employees
+	s.mu.Unlock()
+
+	for _, e := range employees {
+		if e.ID == id {
+			writeJSON(w, http.StatusOK, response{Status: "success", Data: e, Message: "Successfully! Record has been fetched."})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, response{Status: "success", Data: nil, Message: "Successfully! Record has been fetched."})
+}
+
+func (s *Server) listEmployees(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	employees := append([]domain.RemoteEmployeeData{}, s.cfg.Employees...)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, response{Status: "success", Data: employees, Message: "Successfully! All records has been fetched."})
+}
+
+// rateLimitWindow keeps a missing window from starting a new one on every request, which would never limit anything
+func rateLimitWindow(cfg Config) time.Duration {
+	if cfg.RateLimitWindow <= 0 {
+		return time.Second
+	}
+	return cfg.RateLimitWindow
+}
+
+func latency(cfg Config) time.Duration {
+	ret := cfg.Latency
+	if cfg.LatencyJitter > 0 {
+		ret += time.Duration(random(cfg) * float64(cfg.LatencyJitter))
+	}
+	return ret
+}
+
+func random(cfg Config) float64 {
+	if cfg.Rand != nil {
+		return cfg.Rand()
+	}
+	return rand.Float64()
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,266 @@
+package fakeupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+)
+
+func doRequest(method string, url string) (int, http.Header, string) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+
+	defer res.Body.Close()
+	bytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		panic(err)
+	}
+
+	return res.StatusCode, res.Header, string(bytes)
+}
+
+func TestServer_Employee(t *testing.T) {
+	ts := httptest.NewServer(NewServer(Config{Employees: SeedEmployees()}))
+	defer ts.Close()
+
+	testCases := []struct {
+		desc         string
+		path         string
+		wantedStatus int
+		wantedBody   string
+	}{
+		{
+			"found",
+			"/api/v1/employee/1",
+			200,
+			`{"status":"success","data":{"id":1,"employee_name":"Tiger Nixon","employee_salary":320800,"employee_age":61,"profile_image":""},"message":"Successfully! Record has been fetched."}` + "\n",
+		},
+		{
+			"not found",
+			"/api/v1/employee/9999",
+			200,
+			`{"status":"success","data":null,"message":"Successfully! Record has been fetched."}` + "\n",
+		},
+		{
+			"not numeric",
+			"/api/v1/employee/emp-1",
+			200,
+			`{"status":"success","data":null,"message":"Successfully! Record has been fetched."}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			status, headers, body := doRequest(http.MethodGet, ts.URL+tc.path)
+			asserter.Equal(tc.wantedStatus, status)
+			asserter.Equal("application/json", headers.Get("Content-Type"))
+			asserter.Equal(tc.wantedBody, body)
+		})
+	}
+}
+
+func TestServer_Employees(t *testing.T) {
+	asserter := assert.New(t)
+
+	ts := httptest.NewServer(NewServer(Config{Employees: []domain.RemoteEmployeeData{
+		{ID: 1, EmployeeName: "Bob", EmployeeSalary: 100, EmployeeAge: 20},
+		{ID: 2, EmployeeName: "Alice", EmployeeSalary: 200, EmployeeAge: 40, ProfileImage: "alice.png"},
+	}}))
+	defer ts.Close()
+
+	status, _, body := doRequest(http.MethodGet, ts.URL+"/api/v1/employees")
+	asserter.Equal(200, status)
+	asserter.Equal(`{"status":"success","data":[`+
+		`{"id":1,"employee_name":"Bob","employee_salary":100,"employee_age":20,"profile_image":""},`+
+		`{"id":2,"employee_name":"Alice","employee_salary":200,"employee_age":40,"profile_image":"alice.png"}`+
+		`],"message":"Successfully! All records has been fetched."}`+"\n", body)
+}
+
+func TestServer_MethodNotAllowed(t *testing.T) {
+	asserter := assert.New(t)
+
+	ts := httptest.NewServer(NewServer(Config{Employees: SeedEmployees()}))
+	defer ts.Close()
+
+	status, _, _ := doRequest(http.MethodDelete, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(405, status)
+}
+
+func TestServer_ErrorInjection(t *testing.T) {
+	asserter := assert.New(t)
+
+	roll := 0.0
+	ts := httptest.NewServer(NewServer(Config{
+		Employees:   SeedEmployees(),
+		ErrorRate:   0.5,
+		ErrorStatus: http.StatusBadGateway,
+		Rand: func() float64 {
+			return roll
+		},
+	}))
+	defer ts.Close()
+
+	status, _, body := doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(502, status)
+	asserter.Equal(`{"status":"error","data":null,"message":"stuff went terribly wrong"}`+"\n", body)
+
+	roll = 0.5
+	status, _, _ = doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(200, status)
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	asserter := assert.New(t)
+
+	now := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	ts := httptest.NewServer(NewServer(Config{
+		Employees:       SeedEmployees(),
+		RateLimit:       2,
+		RateLimitWindow: time.Minute,
+		Now: func() time.Time {
+			return now
+		},
+	}))
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		status, _, _ := doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+		asserter.Equal(200, status, fmt.Sprintf("request %d", i))
+	}
+	status, headers, body := doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(429, status)
+	asserter.Equal("60", headers.Get("Retry-After"))
+	asserter.Equal(`{"status":"error","data":null,"message":"Too Many Attempts."}`+"\n", body)
+
+	now = now.Add(time.Minute)
+	status, _, _ = doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(200, status)
+}
+
+func TestServer_RateLimit_SubSecondWindow(t *testing.T) {
+	asserter := assert.New(t)
+
+	now := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	ts := httptest.NewServer(NewServer(Config{
+		Employees:       SeedEmployees(),
+		RateLimit:       1,
+		RateLimitWindow: 500 * time.Millisecond,
+		Now: func() time.Time {
+			return now
+		},
+	}))
+	defer ts.Close()
+
+	status, _, _ := doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(200, status)
+	status, headers, _ := doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(429, status)
+	// a retry after 0 seconds would just land in the same window
+	asserter.Equal("1", headers.Get("Retry-After"))
+}
+
+func TestServer_RateLimit_DefaultWindow(t *testing.T) {
+	asserter := assert.New(t)
+
+	now := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	ts := httptest.NewServer(NewServer(Config{
+		Employees: SeedEmployees(),
+		RateLimit: 1,
+		Now: func() time.Time {
+			return now
+		},
+	}))
+	defer ts.Close()
+
+	// without a window every request used to start a new one, and nothing ever got limited
+	status, _, _ := doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(200, status)
+	status, headers, _ := doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(429, status)
+	asserter.Equal("1", headers.Get("Retry-After"))
+
+	now = now.Add(time.Second)
+	status, _, _ = doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(200, status)
+}
+
+func TestServer_Latency(t *testing.T) {
+	asserter := assert.New(t)
+
+	var slept []time.Duration
+	ts := httptest.NewServer(NewServer(Config{
+		Employees:     SeedEmployees(),
+		Latency:       time.Second,
+		LatencyJitter: 200 * time.Millisecond,
+		Rand: func() float64 {
+			return 0.5
+		},
+		Sleep: func(d time.Duration) {
+			slept = append(slept, d)
+		},
+	}))
+	defer ts.Close()
+
+	status, _, _ := doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(200, status)
+	asserter.Equal([]time.Duration{1100 * time.Millisecond}, slept)
+}
+
+func TestServer_Update(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := NewServer(Config{Employees: SeedEmployees()})
+	ts := httptest.NewServer(testInstance)
+	defer ts.Close()
+
+	testInstance.Update(func(cfg *Config) {
+		cfg.Employees = []domain.RemoteEmployeeData{{ID: 99, EmployeeName: "New Hire", EmployeeSalary: 1, EmployeeAge: 18}}
+	})
+
+	status, _, body := doRequest(http.MethodGet, ts.URL+"/api/v1/employee/99")
+	asserter.Equal(200, status)
+	asserter.Contains(body, "New Hire")
+	_, _, body = doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Contains(body, `"data":null`)
+}
+
+func TestServer_Payloads(t *testing.T) {
+	asserter := assert.New(t)
+
+	ts := httptest.NewServer(NewServer(Config{
+		Employees: SeedEmployees(),
+		Payloads: map[string]json.RawMessage{
+			"1":     json.RawMessage(`{"status":"success","data":{"id":1,"employee_age":"61"}}`),
+			"weird": json.RawMessage(`{"status":"success"}`),
+		},
+	}))
+	defer ts.Close()
+
+	status, headers, body := doRequest(http.MethodGet, ts.URL+"/api/v1/employee/1")
+	asserter.Equal(200, status)
+	asserter.Equal("application/json", headers.Get("Content-Type"))
+	asserter.Equal(`{"status":"success","data":{"id":1,"employee_age":"61"}}`, body)
+
+	_, _, body = doRequest(http.MethodGet, ts.URL+"/api/v1/employee/weird")
+	asserter.Equal(`{"status":"success"}`, body)
+
+	// and anything without a payload still comes from the roster
+	_, _, body = doRequest(http.MethodGet, ts.URL+"/api/v1/employee/2")
+	asserter.Contains(body, "Garrett Winters")
+}
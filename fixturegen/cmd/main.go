@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/jonsabados/unit-testing-party/fixturegen"
+)
+
+func main() {
+	seed := flag.Int64("seed", 1, "seed for the dataset, the same seed always gives the same dataset")
+	count := flag.Int("count", 50, "how many typical employees to make, edge cases are always included on top of these")
+	out := flag.String("out", "", "file to write the dataset to, stdout if not set")
+	flag.Parse()
+
+	dataset := fixturegen.Generate(*seed, *count)
+	var err error
+	if *out == "" {
+		err = dataset.Write(os.Stdout)
+	} else {
+		err = dataset.Save(*out)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,254 @@
+// Package fixturegen makes upstream employee payloads, the same shape dummy.restapiexample.com sends back, from a seed.
+// The same seed always gives the same dataset, so a dataset can be checked in, regenerated, or just generated on the
+// fly in a test and still be the same thing the fake upstream is serving.
+package fixturegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/pkg/errors"
+)
+
+// Outcome is what a well behaved fetcher should make of a fixture
+type Outcome string
+
+const (
+	OutcomeFound    Outcome = "found"
+	OutcomeNotFound Outcome = "not_found"
+	OutcomeError    Outcome = "error"
+)
+
+// Fixture is a single upstream response to GET /api/v1/employee/{ID}
+type Fixture struct {
+	ID      string          `json:"id"`
+	Case    string          `json:"case"`
+	Outcome Outcome         `json:"outcome"`
+	Body    json.RawMessage `json:"body"`
+}
+
+type Dataset struct {
+	Seed     int64     `json:"seed"`
+	Fixtures []Fixture `json:"fixtures"`
+}
+
+// EdgeCaseIDStart is where edge case ids start, typical employees get 1 through count so they line up with the ids
+// the real upstream hands out
+const EdgeCaseIDStart = 9000
+
+const fetchedMessage = "Successfully! Record has been fetched."
+
+var firstNames = []string{
+	"Tiger", "Garrett", "Ashton", "Cedric", "Airi", "Brielle", "Herrod", "Rhona", "Colleen", "Sonya", "Jena", "Quinn",
+	"Charde", "Haley", "Tatyana", "Michael", "Paul", "Gloria", "Bradley", "Dai", "Jenette", "Yuri", "Caesar", "Doris",
+	"Angelica", "Gavin", "Jennifer", "Brenden", "Fiona", "Shou", "Michelle", "Suki", "Prescott", "Gavin", "Martena",
+	"Unity", "Howard", "Hope", "Vivian", "Timothy", "Jackson", "Olivia", "Bruno", "Sakura", "Thor", "Finn", "Serge",
+	"Zenaida", "Zorita", "Jennifer", "Cara", "Hermione", "Lael", "Jonas", "Shad", "Michael", "Donna",
+}
+
+var lastNames = []string{
+	"Nixon", "Winters", "Cox", "Kelly", "Satou", "Williamson", "Chandler", "Davidson", "Hurst", "Frost", "Gaines",
+	"Flynn", "Marshall", "Kennedy", "Fitzpatrick", "Silva", "Byrd", "Little", "Greer", "Rios", "Caldwell", "Berry",
+	"Vance", "Wilder", "Ramos", "Joyce", "Chang", "Wagner", "Green", "Itou", "House", "Baker", "Bartlett", "Cortez",
+	"Mcclure", "Butler", "Hatfield", "Mendoza", "Stevens", "Harrell", "Serrano", "Liang", "Nash", "Yamamoto", "Walton",
+	"Camacho", "Baldwin", "Frank", "Serrano", "Acosta", "Stevens", "Butler", "Greer", "Alexander", "Decker", "Bruce",
+	"Snider",
+}
+
+// Generate makes count typical employees followed by every edge case
+func Generate(seed int64, count int) *Dataset {
+	r := rand.New(rand.NewSource(seed))
+	ret := &Dataset{Seed: seed}
+
+	for i := 1; i <= count; i++ {
+		ret.Fixtures = append(ret.Fixtures, Fixture{
+			ID:      strconv.Itoa(i),
+			Case:    "typical",
+			Outcome: OutcomeFound,
+			Body: found(map[string]interface{}{
+				"id":              i,
+				"employee_name":   firstNames[r.Intn(len(firstNames))] + " " + lastNames[r.Intn(len(lastNames))],
+				"employee_salary": 20000 + r.Intn(48)*10000 + r.Intn(20)*50,
+				"employee_age":    18 + r.Intn(53),
+				"profile_image":   profileImage(r),
+			}),
+		})
+	}
+
+	for i, edge := range edgeCases(r) {
+		id := EdgeCaseIDStart + i
+		body := edge.body(id)
+		ret.Fixtures = append(ret.Fixtures, Fixture{
+			ID:      strconv.Itoa(id),
+			Case:    edge.name,
+			Outcome: edge.outcome,
+			Body:    body,
+		})
+	}
+
+	return ret
+}
+
+func profileImage(r *rand.Rand) string {
+	// the real thing almost never has one
+	if r.Intn(4) > 0 {
+		return ""
+	}
+	return fmt.Sprintf("https://example.com/profiles/%08x.png", r.Uint32())
+}
+
+type edgeCase struct {
+	name    string
+	outcome Outcome
+	body    func(id int) json.RawMessage
+}
+
+func employeeData(id int, name string, salary interface{}, age interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              id,
+		"employee_name":   name,
+		"employee_salary": salary,
+		"employee_age":    age,
+		"profile_image":   "",
+	}
+}
+
+func edgeCases(r *rand.Rand) []edgeCase {
+	unicodeNames := []string{"Zoë Ålesund", "山田 太郎", "Björk Guðmundsdóttir", "محمد علي", "Ωmega 😀 Person", "José Nuñez"}
+	name := func() string {
+		return firstNames[r.Intn(len(firstNames))] + " " + lastNames[r.Intn(len(lastNames))]
+	}
+
+	ret := []edgeCase{
+		{"missing data", OutcomeNotFound, func(id int) json.RawMessage {
+			return marshal(map[string]interface{}{"status": "success", "message": fetchedMessage})
+		}},
+		{"null data", OutcomeNotFound, func(id int) json.RawMessage {
+			return marshal(map[string]interface{}{"status": "success", "data": nil, "message": fetchedMessage})
+		}},
+		{"null fields", OutcomeFound, func(id int) json.RawMessage {
+			return found(map[string]interface{}{"id": id, "employee_name": nil, "employee_salary": nil, "employee_age": nil, "profile_image": nil})
+		}},
+		{"missing fields", OutcomeFound, func(id int) json.RawMessage {
+			return found(map[string]interface{}{"id": id})
+		}},
+		{"empty name", OutcomeFound, func(id int) json.RawMessage {
+			return found(employeeData(id, "", 50000, 30))
+		}},
+		{"very long name", OutcomeFound, func(id int) json.RawMessage {
+			return found(employeeData(id, strings.Repeat("Wolfeschlegelsteinhausenbergerdorff ", 30), 50000, 30))
+		}},
+		{"newborn", OutcomeFound, func(id int) json.RawMessage {
+			return found(employeeData(id, name(), 50000, 0))
+		}},
+		{"negative age", OutcomeFound, func(id int) json.RawMessage {
+			return found(employeeData(id, name(), 50000, -5))
+		}},
+		{"ancient", OutcomeFound, func(id int) json.RawMessage {
+			return found(employeeData(id, name(), 50000, 150))
+		}},
+		{"max age", OutcomeFound, func(id int) json.RawMessage {
+			return found(employeeData(id, name(), 50000, math.MaxInt32))
+		}},
+		{"zero salary", OutcomeFound, func(id int) json.RawMessage {
+			return found(employeeData(id, name(), 0, 30))
+		}},
+		{"huge salary", OutcomeFound, func(id int) json.RawMessage {
+			// bigger than a float64 can hold exactly, so anything decoding through float64 will get it wrong
+			return found(employeeData(id, name(), int64(9007199254740993), 30))
+		}},
+		{"max salary", OutcomeFound, func(id int) json.RawMessage {
+			return found(employeeData(id, name(), int64(math.MaxInt64), 30))
+		}},
+		{"salary overflows", OutcomeError, func(id int) json.RawMessage {
+			return found(employeeData(id, name(), json.Number("100000000000000000000"), 30))
+		}},
+		{"stringly typed numbers", OutcomeError, func(id int) json.RawMessage {
+			// older versions of the real thing did this
+			return found(employeeData(id, name(), "320800", "61"))
+		}},
+	}
+	for i, n := range unicodeNames {
+		n := n
+		ret = append(ret, edgeCase{fmt.Sprintf("unicode name %d", i+1), OutcomeFound, func(id int) json.RawMessage {
+			return found(employeeData(id, n, 50000+r.Intn(100000), 18+r.Intn(53)))
+		}})
+	}
+	return ret
+}
+
+func found(data map[string]interface{}) json.RawMessage {
+	return marshal(map[string]interface{}{"status": "success", "data": data, "message": fetchedMessage})
+}
+
+func marshal(v interface{}) json.RawMessage {
+	ret, err := json.Marshal(v)
+	if err != nil {
+		// everything handed in here is built above, so this is a programming error
+		panic(err)
+	}
+	return ret
+}
+
+// Payloads is the dataset keyed by id, ready to hand to fakeupstream.Config.Payloads
+func (d *Dataset) Payloads() map[string]json.RawMessage {
+	ret := make(map[string]json.RawMessage)
+	for _, f := range d.Fixtures {
+		ret[f.ID] = f.Body
+	}
+	return ret
+}
+
+// Employees is every typical employee in the dataset, for the fake upstream's list endpoint. Edge cases are left out
+// since most of them can't be represented as a domain.RemoteEmployeeData.
+func (d *Dataset) Employees() []domain.RemoteEmployeeData {
+	var ret []domain.RemoteEmployeeData
+	for _, f := range d.Fixtures {
+		if f.Case != "typical" {
+			continue
+		}
+		body := struct {
+			Data domain.RemoteEmployeeData `json:"data"`
+		}{}
+		if err := json.Unmarshal(f.Body, &body); err == nil {
+			ret = append(ret, body.Data)
+		}
+	}
+	return ret
+}
+
+func (d *Dataset) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return errors.WithStack(encoder.Encode(d))
+}
+
+func (d *Dataset) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	return d.Write(f)
+}
+
+func Load(path string) (*Dataset, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ret := new(Dataset)
+	if err := json.Unmarshal(raw, ret); err != nil {
+		return nil, errors.Wrapf(err, "reading dataset %s", path)
+	}
+	return ret, nil
+}
@@ -0,0 +1,90 @@
+package fixturegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate_Reproducible(t *testing.T) {
+	asserter := assert.New(t)
+
+	a := new(bytes.Buffer)
+	b := new(bytes.Buffer)
+	asserter.NoError(Generate(42, 25).Write(a))
+	asserter.NoError(Generate(42, 25).Write(b))
+	asserter.Equal(a.String(), b.String())
+
+	c := new(bytes.Buffer)
+	asserter.NoError(Generate(43, 25).Write(c))
+	asserter.NotEqual(a.String(), c.String())
+}
+
+func TestGenerate(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := Generate(7, 10)
+	asserter.Equal(int64(7), testInstance.Seed)
+
+	ids := make(map[string]bool)
+	cases := make(map[string]bool)
+	outcomes := make(map[Outcome]int)
+	for _, f := range testInstance.Fixtures {
+		asserter.False(ids[f.ID], "duplicate id %s", f.ID)
+		ids[f.ID] = true
+		cases[f.Case] = true
+		outcomes[f.Outcome]++
+		asserter.True(json.Valid(f.Body), "%s (%s) isn't valid JSON", f.ID, f.Case)
+	}
+	asserter.Len(testInstance.Fixtures, 10+len(edgeCases(nil)))
+	asserter.Equal(10, len(testInstance.Employees()))
+	for _, c := range []string{"typical", "missing data", "null data", "null fields", "max age", "huge salary", "unicode name 2"} {
+		asserter.True(cases[c], "missing case %s", c)
+	}
+	asserter.NotZero(outcomes[OutcomeFound])
+	asserter.NotZero(outcomes[OutcomeNotFound])
+	asserter.NotZero(outcomes[OutcomeError])
+
+	asserter.Equal(testInstance.Fixtures[0].Body, testInstance.Payloads()["1"])
+}
+
+func TestGenerate_TypicalEmployees(t *testing.T) {
+	asserter := assert.New(t)
+
+	for _, e := range Generate(99, 200).Employees() {
+		asserter.True(e.EmployeeAge >= 18 && e.EmployeeAge <= 70, "age %d", e.EmployeeAge)
+		asserter.True(e.EmployeeSalary >= 20000 && e.EmployeeSalary < 500000, "salary %d", e.EmployeeSalary)
+		asserter.NotEmpty(e.EmployeeName)
+	}
+}
+
+func TestDataset_SaveLoad(t *testing.T) {
+	asserter := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "dataset.json")
+	expected := Generate(3, 5)
+	asserter.NoError(expected.Save(path))
+
+	res, err := Load(path)
+	asserter.NoError(err)
+	asserter.Equal(expected.Seed, res.Seed)
+	asserter.Equal(expected.Payloads(), normalize(t, res.Payloads()))
+
+	_, err = Load(filepath.Join(t.TempDir(), "nope.json"))
+	asserter.Error(err)
+}
+
+// normalize compacts payloads that went through an indented file so they compare equal to freshly generated ones
+func normalize(t *testing.T, payloads map[string]json.RawMessage) map[string]json.RawMessage {
+	for k, v := range payloads {
+		buf := new(bytes.Buffer)
+		if err := json.Compact(buf, v); err != nil {
+			t.Fatal(err)
+		}
+		payloads[k] = buf.Bytes()
+	}
+	return payloads
+}
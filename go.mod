@@ -1,13 +1,43 @@
 module github.com/jonsabados/unit-testing-party
 
-go 1.14
+go 1.18
 
 require (
 	github.com/NYTimes/gizmo v1.3.5
-	github.com/go-errors/errors v1.0.2 // indirect
 	github.com/go-kit/kit v0.9.0
-	github.com/pkg/errors v0.8.1
+	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.3.0
-	golang.org/x/net v0.0.0-20190628185345-da137c7871d7
+	github.com/vmihailenco/msgpack/v4 v4.3.12
+	golang.org/x/net v0.0.0-20200301022130-244492dfa37a
+	golang.org/x/text v0.3.2
 	google.golang.org/grpc v1.22.0
 )
+
+require (
+	cloud.google.com/go v0.38.0 // indirect
+	contrib.go.opencensus.io/exporter/stackdriver v0.12.2 // indirect
+	github.com/aws/aws-sdk-go v1.19.18 // indirect
+	github.com/census-instrumentation/opencensus-proto v0.2.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-logfmt/logfmt v0.4.0 // indirect
+	github.com/golang/protobuf v1.3.4 // indirect
+	github.com/google/go-cmp v0.3.0 // indirect
+	github.com/google/pprof v0.0.0-20181206194817-3ea8567a2e57 // indirect
+	github.com/googleapis/gax-go/v2 v2.0.4 // indirect
+	github.com/gorilla/mux v1.7.0 // indirect
+	github.com/grpc-ecosystem/go-grpc-middleware v1.0.0 // indirect
+	github.com/hashicorp/golang-lru v0.5.1 // indirect
+	github.com/jmespath/go-jmespath v0.0.0-20180206201540-c2b33e8439af // indirect
+	github.com/kelseyhightower/envconfig v1.3.0 // indirect
+	github.com/kr/logfmt v0.0.0-20140226030751-b84e30acd515 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/objx v0.1.1 // indirect
+	github.com/vmihailenco/tagparser v0.1.1 // indirect
+	go.opencensus.io v0.22.0 // indirect
+	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45 // indirect
+	golang.org/x/sync v0.0.0-20190423024810-112230192c58 // indirect
+	golang.org/x/sys v0.0.0-20190507160741-ecd444e8653b // indirect
+	google.golang.org/api v0.7.0 // indirect
+	google.golang.org/appengine v1.6.5 // indirect
+	google.golang.org/genproto v0.0.0-20190716160619-c506a9f90610 // indirect
+)
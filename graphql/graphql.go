@@ -0,0 +1,1155 @@
+// Package graphql runs GraphQL queries over employees and generations, for front ends that want to pick their fields
+// and get employees and generations in one request. It doesn't know anything about http or where employees come
+// from, the service hands it an Employees to look people up with and mounts it at /graphql. The schema, in GraphQL's
+// own terms:
+//
+//	type Query {
+//	  employee(id: ID!): Employee
+//	  employees(ids: [ID!]!): [Employee]!
+//	  generation(name: String!): Generation
+//	  generations: [Generation!]!
+//	  # everybody upstream knows about if ids is left off
+//	  stats(ids: [ID!]): Stats!
+//	}
+//	type Employee { id: ID! name: String! age: Int! generation: Generation! }
+//	type Generation { name: String! code: String! label: String! from: Int to: Int }
+//	type Stats {
+//	  count: Int!
+//	  averageAge: Float
+//	  youngest: Employee
+//	  oldest: Employee
+//	  byGeneration: [GenerationCount!]!
+//	}
+//	type GenerationCount { generation: Generation! count: Int! }
+//
+// Employee lookups are batched per query (see employeeLoader), asking for the same employee five different ways
+// costs one lookup. Queries nested deeper than Executor.MaxDepth, or that add up to more than Executor.MaxComplexity
+// (each field is 1, times however many of it a list is going to hold, and stats over everybody is 50) are turned away
+// before anything gets looked up. Only queries are supported, there's nothing to mutate, and there's no
+// introspection.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+	"sync"
+
+	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/i18n"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMaxDepth      = 8
+	defaultMaxComplexity = 1000
+	// MaxQueryBytes is the biggest query anybody should hand to Execute, the parser doesn't check
+	MaxQueryBytes = 16 << 10
+	// MaxBodyBytes is the query, operation name and variables all together
+	MaxBodyBytes = 64 << 10
+	// fetchConcurrency is how many lookups a batch has going at once
+	fetchConcurrency = 8
+	// rosterCost is what stats over everybody counts for, it's one lookup but a big one
+	rosterCost = 50
+
+	// the error codes in extensions, the same ones Apollo uses
+	gqlParseFailed      = "GRAPHQL_PARSE_FAILED"
+	gqlValidationFailed = "GRAPHQL_VALIDATION_FAILED"
+	gqlQueryTooDeep     = "QUERY_TOO_DEEP"
+	gqlQueryTooComplex  = "QUERY_TOO_COMPLEX"
+	gqlBadUserInput     = "BAD_USER_INPUT"
+	gqlInternalError    = "INTERNAL_SERVER_ERROR"
+)
+
+// Request is a query to run, the same shape as a POST /graphql body
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type Response struct {
+	// Data is left out entirely when the query was turned away without running, and null when running it went badly
+	// enough that nothing could be handed back
+	Data   interface{} `json:"data,omitempty"`
+	Errors []Error     `json:"errors,omitempty"`
+}
+
+// Error is something that went wrong with a query, for the client. It isn't a Go error, Execute hands them back in the
+// Response.
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	// Path is the response keys (and list indexes) leading to the field that failed
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// gqlFieldError is an error a resolver wants the client to see, anything else a resolver returns is logged and
+// reported as an internal error
+type gqlFieldError struct {
+	message string
+	code    string
+}
+
+func (e *gqlFieldError) Error() string {
+	return e.message
+}
+
+func badUserInput(format string, args ...interface{}) error {
+	return &gqlFieldError{message: fmt.Sprintf(format, args...), code: gqlBadUserInput}
+}
+
+// gqlThunk is a value a resolver can't hand back just yet. Resolvers return these to put off waiting on lookups
+// until everything else at the same level has had its chance to ask for some, so they all go out together.
+type gqlThunk func() (interface{}, error)
+
+type gqlResolver func(e *gqlExecution, parent interface{}, args map[string]interface{}) (interface{}, error)
+
+// gqlObjectType is an object type, anything named that isn't one is a scalar
+type gqlObjectType struct {
+	name   string
+	fields map[string]*gqlFieldDef
+}
+
+type gqlFieldDef struct {
+	typ     gqlTypeRef
+	args    map[string]gqlTypeRef
+	resolve gqlResolver
+	// cost is what the field counts for towards a query's complexity, 1 if nil
+	cost func(args map[string]interface{}) int
+	// size is how many items a list field is expected to hold, what's selected under it counts that many times
+	size func(args map[string]interface{}) int
+}
+
+// mustParseTypeRef is for the schema, where types are written the way they would be in a query
+func mustParseTypeRef(raw string) gqlTypeRef {
+	p := &gqlParser{lexer: gqlLexer{source: raw, line: 1}}
+	p.advance()
+	return p.typeRef()
+}
+
+func gqlField(typ string, resolve gqlResolver) *gqlFieldDef {
+	return &gqlFieldDef{typ: mustParseTypeRef(typ), resolve: resolve}
+}
+
+func (f *gqlFieldDef) withArgs(args ...string) *gqlFieldDef {
+	f.args = make(map[string]gqlTypeRef)
+	for i := 0; i < len(args); i += 2 {
+		f.args[args[i]] = mustParseTypeRef(args[i+1])
+	}
+	return f
+}
+
+func (f *gqlFieldDef) sized(size func(args map[string]interface{}) int) *gqlFieldDef {
+	f.cost, f.size = size, size
+	return f
+}
+
+var gqlScalars = map[string]bool{"ID": true, "String": true, "Int": true, "Float": true, "Boolean": true}
+
+var schema = map[string]*gqlObjectType{
+	"Query": {name: "Query", fields: map[string]*gqlFieldDef{
+		"employee": gqlField("Employee", func(e *gqlExecution, _ interface{}, args map[string]interface{}) (interface{}, error) {
+			return e.employee(args["id"].(string))
+		}).withArgs("id", "ID!"),
+		"employees": gqlField("[Employee]!", func(e *gqlExecution, _ interface{}, args map[string]interface{}) (interface{}, error) {
+			return e.employees(args["ids"].([]interface{}))
+		}).withArgs("ids", "[ID!]!").sized(idCount),
+		"generation": gqlField("Generation", func(e *gqlExecution, _ interface{}, args map[string]interface{}) (interface{}, error) {
+			generation, err := domain.ParseGeneration(args["name"].(string))
+			if err != nil {
+				return nil, badUserInput("%s", err)
+			}
+			return e.generation(generation)
+		}).withArgs("name", "String!"),
+		"generations": gqlField("[Generation!]!", func(e *gqlExecution, _ interface{}, _ map[string]interface{}) (interface{}, error) {
+			return e.loc.Catalog(domain.Catalog()), nil
+		}).sized(generationCount),
+		"stats": (&gqlFieldDef{
+			typ: mustParseTypeRef("Stats!"),
+			resolve: func(e *gqlExecution, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				if ids, ok := args["ids"].([]interface{}); ok {
+					return e.statsFor(ids)
+				}
+				return e.rosterStats()
+			},
+			cost: func(args map[string]interface{}) int {
+				if ids, ok := args["ids"].([]interface{}); ok {
+					return len(ids)
+				}
+				return rosterCost
+			},
+		}).withArgs("ids", "[ID!]"),
+	}},
+	"Employee": {name: "Employee", fields: map[string]*gqlFieldDef{
+		"id": gqlField("ID!", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(domain.Employee).ID, nil
+		}),
+		"name": gqlField("String!", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(domain.Employee).Name, nil
+		}),
+		"age": gqlField("Int!", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(domain.Employee).Age, nil
+		}),
+		"generation": gqlField("Generation!", func(e *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return e.generation(parent.(domain.Employee).Generation)
+		}),
+	}},
+	"Generation": {name: "Generation", fields: map[string]*gqlFieldDef{
+		"name": gqlField("String!", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return string(parent.(domain.GenerationEntry).Name), nil
+		}),
+		"code": gqlField("String!", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(domain.GenerationEntry).Code, nil
+		}),
+		"label": gqlField("String!", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(domain.GenerationEntry).Label, nil
+		}),
+		"from": gqlField("Int", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return yearOrNil(parent.(domain.GenerationEntry).From), nil
+		}),
+		"to": gqlField("Int", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return yearOrNil(parent.(domain.GenerationEntry).To), nil
+		}),
+	}},
+	"Stats": {name: "Stats", fields: map[string]*gqlFieldDef{
+		"count": gqlField("Int!", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return len(parent.(gqlStats)), nil
+		}),
+		"averageAge": gqlField("Float", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(gqlStats).averageAge(), nil
+		}),
+		"youngest": gqlField("Employee", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(gqlStats).pick(func(a, b domain.Employee) bool { return a.Age < b.Age }), nil
+		}),
+		"oldest": gqlField("Employee", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(gqlStats).pick(func(a, b domain.Employee) bool { return a.Age > b.Age }), nil
+		}),
+		"byGeneration": gqlField("[GenerationCount!]!", func(e *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(gqlStats).byGeneration(e.loc), nil
+		}).sized(generationCount),
+	}},
+	"GenerationCount": {name: "GenerationCount", fields: map[string]*gqlFieldDef{
+		"generation": gqlField("Generation!", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(gqlGenerationCount).generation, nil
+		}),
+		"count": gqlField("Int!", func(_ *gqlExecution, parent interface{}, _ map[string]interface{}) (interface{}, error) {
+			return parent.(gqlGenerationCount).count, nil
+		}),
+	}},
+}
+
+func idCount(args map[string]interface{}) int {
+	ids, _ := args["ids"].([]interface{})
+	return len(ids)
+}
+
+func generationCount(map[string]interface{}) int {
+	return len(domain.All())
+}
+
+func yearOrNil(year int) interface{} {
+	if year == 0 {
+		return nil
+	}
+	return year
+}
+
+// gqlStats is who the stats are about
+type gqlStats []domain.Employee
+
+type gqlGenerationCount struct {
+	generation domain.GenerationEntry
+	count      int
+}
+
+func (s gqlStats) averageAge() interface{} {
+	if len(s) == 0 {
+		return nil
+	}
+	total := 0
+	for _, employee := range s {
+		total += employee.Age
+	}
+	return float64(total) / float64(len(s))
+}
+
+// pick is the employee that beats everybody else, the first of them if there's a tie
+func (s gqlStats) pick(beats func(a, b domain.Employee) bool) interface{} {
+	if len(s) == 0 {
+		return nil
+	}
+	ret := s[0]
+	for _, employee := range s[1:] {
+		if beats(employee, ret) {
+			ret = employee
+		}
+	}
+	return ret
+}
+
+// byGeneration has every generation, oldest first, even the ones nobody is in
+func (s gqlStats) byGeneration(loc *i18n.Localizer) []interface{} {
+	var ret []interface{}
+	for _, entry := range loc.Catalog(domain.Catalog()) {
+		count := 0
+		for _, employee := range s {
+			if employee.Generation == entry.Name {
+				count++
+			}
+		}
+		ret = append(ret, gqlGenerationCount{generation: entry, count: count})
+	}
+	return ret
+}
+
+// gqlObject is an object in the response, fields stay in the order they were asked for
+type gqlObject []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value interface{}
+}
+
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for i, entry := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(entry.key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		value, err := json.Marshal(entry.value)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Employees is where queries get employees from
+type Employees interface {
+	// Employee looks up one employee, nil with no error for somebody that doesn't exist
+	Employee(ctx context.Context, employeeID domain.EmployeeID) (*domain.Employee, error)
+	// All is everybody there is, for stats over the whole roster
+	All(ctx context.Context) ([]domain.Employee, error)
+}
+
+// Executor runs queries. Anything that's a query at all gets a Response, ones that don't parse or validate included,
+// with what went wrong in its errors.
+type Executor struct {
+	Employees Employees
+	// MaxDepth and MaxComplexity are the biggest queries that will be run, 8 levels deep and a complexity of 1000 if
+	// left zero
+	MaxDepth      int
+	MaxComplexity int
+}
+
+func (x *Executor) maxDepth() int {
+	if x.MaxDepth <= 0 {
+		return defaultMaxDepth
+	}
+	return x.MaxDepth
+}
+
+func (x *Executor) maxComplexity() int {
+	if x.MaxComplexity <= 0 {
+		return defaultMaxComplexity
+	}
+	return x.MaxComplexity
+}
+
+// Execute runs a query, with generation labels in whatever language loc speaks
+func (x *Executor) Execute(ctx context.Context, loc *i18n.Localizer, req *Request) Response {
+	doc, parseErr := parseDocument(req.Query)
+	if parseErr != nil {
+		return Response{Errors: []Error{*parseErr}}
+	}
+
+	planner := &gqlPlanner{doc: doc, fragmentsSeen: make(map[string]bool), maxSelected: x.maxComplexity()}
+	fields := planner.plan(req)
+	if planner.tooComplex {
+		return Response{Errors: []Error{{
+			Message:    fmt.Sprintf("Query selects more than %d fields, the most allowed complexity is %d", planner.maxSelected, x.maxComplexity()),
+			Extensions: map[string]interface{}{"code": gqlQueryTooComplex},
+		}}}
+	}
+	if len(planner.errors) > 0 {
+		return Response{Errors: planner.errors}
+	}
+	if depth := gqlDepth(fields); depth > x.maxDepth() {
+		return Response{Errors: []Error{{
+			Message:    fmt.Sprintf("Query is nested %d levels deep, the most allowed is %d", depth, x.maxDepth()),
+			Extensions: map[string]interface{}{"code": gqlQueryTooDeep},
+		}}}
+	}
+	if complexity := gqlComplexity(fields); complexity > x.maxComplexity() {
+		return Response{Errors: []Error{{
+			Message:    fmt.Sprintf("Query has a complexity of %d, the most allowed is %d", complexity, x.maxComplexity()),
+			Extensions: map[string]interface{}{"code": gqlQueryTooComplex},
+		}}}
+	}
+
+	e := &gqlExecution{
+		ctx:    ctx,
+		source: x.Employees,
+		loc:    loc,
+		loader: &employeeLoader{
+			ctx:         ctx,
+			employees:   x.Employees,
+			loc:         loc,
+			concurrency: fetchConcurrency,
+			loads:       make(map[domain.EmployeeID]*employeeLoad),
+		},
+	}
+	data, ok := e.executeObject(schema["Query"], nil, fields, nil)
+	ret := Response{Errors: e.errors}
+	if ok {
+		ret.Data = data
+	} else {
+		// as opposed to a nil interface, which would leave data out
+		ret.Data = json.RawMessage("null")
+	}
+	return ret
+}
+
+// gqlPlannedField is a field to resolve, with fragments worked out, arguments checked and filled in, and repeats of
+// the same response key merged
+type gqlPlannedField struct {
+	key  string
+	name string
+	// def is nil for __typename
+	def      *gqlFieldDef
+	args     map[string]interface{}
+	children []*gqlPlannedField
+	loc      Location
+}
+
+// gqlPlanner validates a query while working out what to resolve, so there's one walk over the query rather than a
+// validation pass and an execution pass that have to agree with each other
+type gqlPlanner struct {
+	doc           *gqlDocument
+	variables     map[string]interface{}
+	errors        []Error
+	fragmentsSeen map[string]bool
+	// every field selection counts towards maxSelected as it's collected, repeats and what fragments bring in
+	// included. Complexity only gets worked out once planning is done, and a query can be small and still take a
+	// long time to plan, so this stops planning once there's no way the query is getting run anyways.
+	maxSelected int
+	selected    int
+	tooComplex  bool
+}
+
+func (p *gqlPlanner) fail(loc *Location, format string, args ...interface{}) {
+	err := Error{Message: fmt.Sprintf(format, args...), Extensions: map[string]interface{}{"code": gqlValidationFailed}}
+	if loc != nil {
+		err.Locations = []Location{*loc}
+	}
+	p.errors = append(p.errors, err)
+}
+
+func (p *gqlPlanner) plan(req *Request) []*gqlPlannedField {
+	op := p.operation(req.OperationName)
+	if op == nil {
+		return nil
+	}
+	if op.kind != "query" {
+		p.fail(&op.loc, "Only queries are supported, not %ss", op.kind)
+		return nil
+	}
+	for _, directive := range op.directives {
+		p.fail(&directive.loc, "Unknown directive \"@%s\" on operations", directive.name)
+	}
+	p.coerceVariables(op, req.Variables)
+	if len(p.errors) > 0 {
+		return nil
+	}
+	return p.selections(schema["Query"], op.selections)
+}
+
+func (p *gqlPlanner) operation(name string) *gqlOperation {
+	if name == "" {
+		if len(p.doc.operations) != 1 {
+			p.fail(nil, "Must provide operation name if query contains %d operations", len(p.doc.operations))
+			return nil
+		}
+		return p.doc.operations[0]
+	}
+	for _, op := range p.doc.operations {
+		if op.name == name {
+			return op
+		}
+	}
+	p.fail(nil, "Unknown operation named %q", name)
+	return nil
+}
+
+func (p *gqlPlanner) coerceVariables(op *gqlOperation, provided map[string]interface{}) {
+	p.variables = make(map[string]interface{})
+	for _, def := range op.variables {
+		if !gqlIsInputType(def.typ) {
+			p.fail(&def.loc, "Variable \"$%s\" can't be of type %q", def.name, def.typ)
+			continue
+		}
+		raw, ok := provided[def.name]
+		if !ok && def.defaultValue != nil {
+			// default values can't refer to variables, so there's nothing for this to fail on
+			raw, _ = gqlLiteral(*def.defaultValue, nil)
+			ok = true
+		}
+		if !ok {
+			if def.typ.nonNull {
+				p.fail(&def.loc, "Variable \"$%s\" of required type %q was not provided", def.name, def.typ)
+			}
+			p.variables[def.name] = nil
+			continue
+		}
+		value, err := gqlCoerce(raw, def.typ)
+		if err != nil {
+			p.fail(&def.loc, "Variable \"$%s\" got an invalid value: %s", def.name, err)
+			continue
+		}
+		p.variables[def.name] = value
+	}
+}
+
+// gqlIsInputType is the types arguments can be, there aren't any input objects or enums
+func gqlIsInputType(t gqlTypeRef) bool {
+	if t.list != nil {
+		return gqlIsInputType(*t.list)
+	}
+	return gqlScalars[t.name]
+}
+
+// gqlCollected is a response key and every field selected under it, a key can be selected more than once (directly and
+// through fragments) and the selections all get merged
+type gqlCollected struct {
+	key    string
+	fields []gqlSelection
+}
+
+func (p *gqlPlanner) selections(typ *gqlObjectType, selections []gqlSelection) []*gqlPlannedField {
+	var order []*gqlCollected
+	byKey := make(map[string]*gqlCollected)
+	p.collect(typ, selections, &order, byKey, make(map[string]bool))
+
+	var ret []*gqlPlannedField
+	for _, c := range order {
+		if p.tooComplex {
+			return nil
+		}
+		if field := p.field(typ, c.fields); field != nil {
+			ret = append(ret, field)
+		}
+	}
+	return ret
+}
+
+// collect gathers up the fields in a selection set by response key, working through fragments. spread is the fragments
+// already spread into the selection set, spreading one again can't add anything and each time doubles the work.
+func (p *gqlPlanner) collect(typ *gqlObjectType, selections []gqlSelection, order *[]*gqlCollected, byKey map[string]*gqlCollected, spread map[string]bool) {
+	for _, selection := range selections {
+		if p.tooComplex {
+			return
+		}
+		if !p.included(selection.directives) {
+			continue
+		}
+		switch selection.kind {
+		case gqlFieldSelection:
+			p.selected++
+			if p.selected > p.maxSelected {
+				p.tooComplex = true
+				return
+			}
+			c, ok := byKey[selection.responseKey()]
+			if !ok {
+				c = &gqlCollected{key: selection.responseKey()}
+				byKey[c.key] = c
+				*order = append(*order, c)
+			}
+			c.fields = append(c.fields, selection)
+		case gqlInlineFragment:
+			if p.appliesTo(typ, selection.typeCondition, selection.loc) {
+				p.collect(typ, selection.selections, order, byKey, spread)
+			}
+		case gqlFragmentSpread:
+			fragment, ok := p.doc.fragments[selection.name]
+			if !ok {
+				p.fail(&selection.loc, "Unknown fragment %q", selection.name)
+				continue
+			}
+			if p.fragmentsSeen[fragment.name] {
+				p.fail(&selection.loc, "Cannot spread fragment %q within itself", fragment.name)
+				continue
+			}
+			if spread[fragment.name] {
+				continue
+			}
+			if !p.included(fragment.directives) || !p.appliesTo(typ, fragment.typeCondition, fragment.loc) {
+				continue
+			}
+			spread[fragment.name] = true
+			p.fragmentsSeen[fragment.name] = true
+			p.collect(typ, fragment.selections, order, byKey, spread)
+			delete(p.fragmentsSeen, fragment.name)
+		}
+	}
+}
+
+// appliesTo checks a fragment's type condition, with no interfaces or unions it has to be the type itself
+func (p *gqlPlanner) appliesTo(typ *gqlObjectType, condition string, loc Location) bool {
+	if condition == "" || condition == typ.name {
+		return true
+	}
+	if _, known := schema[condition]; !known {
+		p.fail(&loc, "Unknown type %q", condition)
+	} else {
+		p.fail(&loc, "Fragment on %q can't be spread where the type is %q", condition, typ.name)
+	}
+	return false
+}
+
+// included works out @skip and @include, the only directives there are
+func (p *gqlPlanner) included(directives []gqlDirective) bool {
+	ret := true
+	for _, directive := range directives {
+		if directive.name != "skip" && directive.name != "include" {
+			p.fail(&directive.loc, "Unknown directive \"@%s\"", directive.name)
+			continue
+		}
+		args := p.arguments(fmt.Sprintf("@%s", directive.name), map[string]gqlTypeRef{"if": mustParseTypeRef("Boolean!")}, directive.arguments, directive.loc)
+		condition, _ := args["if"].(bool)
+		if directive.name == "skip" && condition || directive.name == "include" && !condition {
+			ret = false
+		}
+	}
+	return ret
+}
+
+func (p *gqlPlanner) field(parent *gqlObjectType, fields []gqlSelection) *gqlPlannedField {
+	first := fields[0]
+	ret := &gqlPlannedField{key: first.responseKey(), name: first.name, loc: first.loc}
+	for _, other := range fields[1:] {
+		if other.name != first.name || !p.sameArguments(other.arguments, first.arguments) {
+			p.fail(&other.loc, "Fields %q conflict because they are different fields or have different arguments, use different aliases", ret.key)
+			return nil
+		}
+	}
+
+	if first.name == "__typename" {
+		if len(first.arguments) > 0 || len(first.selections) > 0 {
+			p.fail(&first.loc, "Field \"__typename\" takes no arguments or selections")
+		}
+		return ret
+	}
+	def, ok := parent.fields[first.name]
+	if !ok {
+		p.fail(&first.loc, "Cannot query field %q on type %q", first.name, parent.name)
+		return nil
+	}
+	ret.def = def
+	ret.args = p.arguments(parent.name+"."+first.name, def.args, first.arguments, first.loc)
+
+	var childSelections []gqlSelection
+	for _, f := range fields {
+		childSelections = append(childSelections, f.selections...)
+	}
+	named := def.typ
+	for named.list != nil {
+		named = *named.list
+	}
+	if child, isObject := schema[named.name]; isObject {
+		if len(childSelections) == 0 {
+			p.fail(&first.loc, "Field %q of type %q must have a selection of subfields", first.name, def.typ)
+			return nil
+		}
+		ret.children = p.selections(child, childSelections)
+	} else if len(childSelections) > 0 {
+		p.fail(&first.loc, "Field %q must not have a selection since type %q has no subfields", first.name, def.typ)
+		return nil
+	}
+	return ret
+}
+
+// arguments checks the arguments given against what's expected, and hands them back with variables filled in and
+// values coerced to the types they're meant to be
+func (p *gqlPlanner) arguments(what string, expected map[string]gqlTypeRef, given []gqlArgument, loc Location) map[string]interface{} {
+	ret := make(map[string]interface{})
+	for _, arg := range given {
+		typ, ok := expected[arg.name]
+		if !ok {
+			p.fail(&arg.loc, "Unknown argument %q on %s", arg.name, what)
+			continue
+		}
+		raw, err := gqlLiteral(arg.value, p.variables)
+		if err != nil {
+			p.fail(&arg.loc, "%s", err)
+			continue
+		}
+		value, err := gqlCoerce(raw, typ)
+		if err != nil {
+			p.fail(&arg.loc, "Argument %q on %s has an invalid value: %s", arg.name, what, err)
+			continue
+		}
+		ret[arg.name] = value
+	}
+	for name, typ := range expected {
+		if _, ok := ret[name]; !ok && typ.nonNull && !gqlGiven(given, name) {
+			p.fail(&loc, "Argument %q of type %q is required on %s, but it was not provided", name, typ, what)
+		}
+	}
+	return ret
+}
+
+// sameArguments compares what arguments come out to, rather than how they were written
+func (p *gqlPlanner) sameArguments(a []gqlArgument, b []gqlArgument) bool {
+	values := func(args []gqlArgument) map[string]interface{} {
+		ret := make(map[string]interface{})
+		for _, arg := range args {
+			ret[arg.name], _ = gqlLiteral(arg.value, p.variables)
+		}
+		return ret
+	}
+	return reflect.DeepEqual(values(a), values(b))
+}
+
+func gqlGiven(given []gqlArgument, name string) bool {
+	for _, arg := range given {
+		if arg.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// gqlEnumLiteral keeps enum values apart from strings, nothing takes an enum so they're always a mistake
+type gqlEnumLiteral string
+
+// gqlLiteral turns a value as written in a query into the same sort of thing decoding JSON variables gives, with
+// variables filled in from variables. Anything declared is in there, as nil if it wasn't given.
+func gqlLiteral(value gqlValue, variables map[string]interface{}) (interface{}, error) {
+	switch value.kind {
+	case gqlVariableValue:
+		ret, declared := variables[value.raw]
+		if !declared {
+			return nil, errors.Errorf("Variable \"$%s\" is not defined", value.raw)
+		}
+		return ret, nil
+	case gqlIntValue, gqlFloatValue:
+		return json.Number(value.raw), nil
+	case gqlStringValue:
+		return value.raw, nil
+	case gqlBooleanValue:
+		return value.raw == "true", nil
+	case gqlNullValue:
+		return nil, nil
+	case gqlEnumValue:
+		return gqlEnumLiteral(value.raw), nil
+	case gqlListValue:
+		ret := []interface{}{}
+		for _, item := range value.list {
+			v, err := gqlLiteral(item, variables)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	default:
+		ret := make(map[string]interface{})
+		for _, field := range value.fields {
+			v, err := gqlLiteral(field.value, variables)
+			if err != nil {
+				return nil, err
+			}
+			ret[field.name] = v
+		}
+		return ret, nil
+	}
+}
+
+// gqlCoerce checks value against an input type, handing back what resolvers get: strings for IDs and Strings, ints,
+// float64s, bools and []interface{} for lists
+func gqlCoerce(value interface{}, typ gqlTypeRef) (interface{}, error) {
+	if value == nil {
+		if typ.nonNull {
+			return nil, errors.Errorf("expected %s, found null", typ)
+		}
+		return nil, nil
+	}
+	if typ.list != nil {
+		items, ok := value.([]interface{})
+		if !ok {
+			// a single value where a list is expected is a list of one
+			items = []interface{}{value}
+		}
+		ret := make([]interface{}, len(items))
+		for i, item := range items {
+			coerced, err := gqlCoerce(item, *typ.list)
+			if err != nil {
+				return nil, errors.Errorf("at index %d, %s", i, err)
+			}
+			ret[i] = coerced
+		}
+		return ret, nil
+	}
+
+	switch v := value.(type) {
+	case string:
+		if typ.name == "ID" || typ.name == "String" {
+			return v, nil
+		}
+	case json.Number:
+		switch typ.name {
+		case "ID":
+			if _, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+				return v.String(), nil
+			}
+		case "Int":
+			if i, err := strconv.ParseInt(v.String(), 10, 32); err == nil {
+				return int(i), nil
+			}
+		case "Float":
+			if f, err := v.Float64(); err == nil {
+				return f, nil
+			}
+		}
+	case bool:
+		if typ.name == "Boolean" {
+			return v, nil
+		}
+	}
+	return nil, errors.Errorf("expected %s, found %s", typ, gqlDescribe(value))
+}
+
+func gqlDescribe(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case gqlEnumLiteral:
+		return string(v)
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "an object"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func gqlDepth(fields []*gqlPlannedField) int {
+	ret := 0
+	for _, f := range fields {
+		if depth := 1 + gqlDepth(f.children); depth > ret {
+			ret = depth
+		}
+	}
+	return ret
+}
+
+func gqlComplexity(fields []*gqlPlannedField) int {
+	ret := 0
+	for _, f := range fields {
+		if f.def == nil {
+			continue
+		}
+		cost, size := 1, 1
+		if f.def.cost != nil {
+			cost = f.def.cost(f.args)
+		}
+		if f.def.size != nil {
+			size = f.def.size(f.args)
+		}
+		ret += cost + size*gqlComplexity(f.children)
+	}
+	return ret
+}
+
+// gqlExecution is one query being run
+type gqlExecution struct {
+	ctx    context.Context
+	source Employees
+	loc    *i18n.Localizer
+	loader *employeeLoader
+	errors []Error
+}
+
+// executeObject resolves fields on an object, every one of them before waiting on any, so all the lookups the object's
+// fields need go out in one batch. ok is false when a non null field came out null, which nulls the object.
+func (e *gqlExecution) executeObject(typ *gqlObjectType, value interface{}, fields []*gqlPlannedField, path []interface{}) (gqlObject, bool) {
+	resolved := make([]interface{}, len(fields))
+	errs := make([]error, len(fields))
+	for i, f := range fields {
+		if f.def == nil {
+			resolved[i] = typ.name
+			continue
+		}
+		resolved[i], errs[i] = e.resolve(f, value)
+	}
+
+	ret := make(gqlObject, 0, len(fields))
+	for i, f := range fields {
+		fieldPath := append(append([]interface{}{}, path...), f.key)
+		value, err := resolved[i], errs[i]
+		if thunk, ok := value.(gqlThunk); ok && err == nil {
+			value, err = thunk()
+		}
+		if f.def == nil {
+			ret = append(ret, gqlEntry{f.key, value})
+			continue
+		}
+		completed, ok := e.complete(f, f.def.typ, value, err, fieldPath)
+		if !ok {
+			return nil, false
+		}
+		ret = append(ret, gqlEntry{f.key, completed})
+	}
+	return ret, true
+}
+
+// resolve turns panics into errors, the same as HTTPMiddleware would for the request as a whole, but taking out only
+// the one field
+func (e *gqlExecution) resolve(f *gqlPlannedField, parent interface{}) (ret interface{}, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			ret, err = nil, errors.Errorf("panic resolving %s: %v\n%s", f.name, x, debug.Stack())
+		}
+	}()
+	return f.def.resolve(e, parent, f.args)
+}
+
+// complete checks a resolved value against the field's type and works out what goes in the response for it. ok is
+// false when it came out null and isn't allowed to be.
+func (e *gqlExecution) complete(f *gqlPlannedField, typ gqlTypeRef, value interface{}, err error, path []interface{}) (interface{}, bool) {
+	if err != nil {
+		e.fail(f, path, err)
+		return nil, !typ.nonNull
+	}
+	if gqlIsNull(value) {
+		if typ.nonNull {
+			e.fail(f, path, errors.Errorf("Cannot return null for non-nullable field %s", f.name))
+			return nil, false
+		}
+		return nil, true
+	}
+
+	if typ.list != nil {
+		items := reflect.ValueOf(value)
+		ret := make([]interface{}, items.Len())
+		for i := range ret {
+			item, ok := e.complete(f, *typ.list, items.Index(i).Interface(), nil, append(append([]interface{}{}, path...), i))
+			if !ok {
+				return nil, !typ.nonNull
+			}
+			ret[i] = item
+		}
+		return ret, true
+	}
+	if objType, isObject := schema[typ.name]; isObject {
+		obj, ok := e.executeObject(objType, value, f.children, path)
+		if !ok {
+			return nil, !typ.nonNull
+		}
+		return obj, true
+	}
+	return value, true
+}
+
+func gqlIsNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// fail records a field's error, errors meant for the client go as is and anything else gets logged and hidden behind
+// a generic message
+func (e *gqlExecution) fail(f *gqlPlannedField, path []interface{}, err error) {
+	ret := Error{Locations: []Location{f.loc}, Path: path}
+	if fieldErr, ok := err.(*gqlFieldError); ok {
+		ret.Message = fieldErr.message
+		ret.Extensions = map[string]interface{}{"code": fieldErr.code}
+	} else {
+		_ = kit.LogErrorf(e.ctx, "error resolving graphql field %v: %+v", path, err)
+		ret.Message = "something terrible happened"
+		ret.Extensions = map[string]interface{}{"code": gqlInternalError}
+	}
+	e.errors = append(e.errors, ret)
+}
+
+func (e *gqlExecution) employee(rawID string) (interface{}, error) {
+	employeeID, err := domain.ParseEmployeeID(rawID)
+	if err != nil {
+		return nil, badUserInput("%q isn't an employee id: %s", rawID, err)
+	}
+	load := e.loader.load(employeeID)
+	return gqlThunk(func() (interface{}, error) {
+		employee, err := load()
+		if err != nil || employee == nil {
+			return nil, err
+		}
+		return *employee, nil
+	}), nil
+}
+
+// employees keeps the order the ids came in, with nulls for anybody that doesn't exist
+func (e *gqlExecution) employees(rawIDs []interface{}) (interface{}, error) {
+	thunks := make([]gqlThunk, len(rawIDs))
+	for i, raw := range rawIDs {
+		thunk, err := e.employee(raw.(string))
+		if err != nil {
+			return nil, err
+		}
+		thunks[i] = thunk.(gqlThunk)
+	}
+	return gqlThunk(func() (interface{}, error) {
+		ret := make([]interface{}, len(thunks))
+		for i, thunk := range thunks {
+			employee, err := thunk()
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = employee
+		}
+		return ret, nil
+	}), nil
+}
+
+func (e *gqlExecution) generation(generation domain.Generation) (interface{}, error) {
+	for _, entry := range e.loc.Catalog(domain.Catalog()) {
+		if entry.Name == generation {
+			return entry, nil
+		}
+	}
+	return nil, errors.Errorf("no catalog entry for generation %q", generation)
+}
+
+func (e *gqlExecution) statsFor(rawIDs []interface{}) (interface{}, error) {
+	employees, err := e.employees(rawIDs)
+	if err != nil {
+		return nil, err
+	}
+	return gqlThunk(func() (interface{}, error) {
+		found, err := employees.(gqlThunk)()
+		if err != nil {
+			return nil, err
+		}
+		// each employee only counts once, however many times they were asked about, and nobody is still stats
+		ret := make(gqlStats, 0, len(rawIDs))
+		seen := make(map[string]bool)
+		for _, employee := range found.([]interface{}) {
+			if employee == nil || seen[employee.(domain.Employee).ID] {
+				continue
+			}
+			seen[employee.(domain.Employee).ID] = true
+			ret = append(ret, employee.(domain.Employee))
+		}
+		return ret, nil
+	}), nil
+}
+
+func (e *gqlExecution) rosterStats() (interface{}, error) {
+	everybody, err := e.source.All(e.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up everybody")
+	}
+	ret := make(gqlStats, 0, len(everybody))
+	for _, employee := range everybody {
+		ret = append(ret, e.loc.Employee(employee))
+	}
+	return ret, nil
+}
+
+// employeeLoader is a per query cache of employee lookups that go out in batches, DataLoader style. load queues an
+// id up and hands back a function to get the employee with. The first of those called sends everything queued so
+// far at once (each id once, a few at a time, Employees has no way to ask for several), everything after is answered
+// from what came back.
+type employeeLoader struct {
+	ctx         context.Context
+	employees   Employees
+	loc         *i18n.Localizer
+	concurrency int
+
+	pending []domain.EmployeeID
+	loads   map[domain.EmployeeID]*employeeLoad
+}
+
+type employeeLoad struct {
+	done     bool
+	employee *domain.Employee
+	err      error
+}
+
+func (l *employeeLoader) load(employeeID domain.EmployeeID) func() (*domain.Employee, error) {
+	if _, queued := l.loads[employeeID]; !queued {
+		l.loads[employeeID] = new(employeeLoad)
+		l.pending = append(l.pending, employeeID)
+	}
+	return func() (*domain.Employee, error) {
+		ret := l.loads[employeeID]
+		if !ret.done {
+			l.dispatch()
+		}
+		return ret.employee, ret.err
+	}
+}
+
+func (l *employeeLoader) dispatch() {
+	batch := l.pending
+	l.pending = nil
+
+	slots := make(chan struct{}, l.concurrency)
+	var wg sync.WaitGroup
+	for _, employeeID := range batch {
+		// each goroutine has a load all to itself, nothing else touches them until they're all done
+		load := l.loads[employeeID]
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(employeeID domain.EmployeeID) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			load.employee, load.err = l.fetch(employeeID)
+		}(employeeID)
+	}
+	wg.Wait()
+	for _, employeeID := range batch {
+		l.loads[employeeID].done = true
+	}
+}
+
+func (l *employeeLoader) fetch(employeeID domain.EmployeeID) (ret *domain.Employee, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			ret, err = nil, errors.Errorf("panic looking up employee %s: %v\n%s", employeeID, x, debug.Stack())
+		}
+	}()
+
+	employee, err := l.employees.Employee(l.ctx, employeeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "looking up employee %s", employeeID)
+	}
+	if employee == nil {
+		return nil, nil
+	}
+	localized := l.loc.Employee(*employee)
+	return &localized, nil
+}
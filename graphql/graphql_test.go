@@ -0,0 +1,141 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/go-kit/kit/log"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/i18n"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestContext has somewhere for errors to be logged to, unit/testutil has one of these too but it imports unit,
+// which imports us
+func newTestContext() context.Context {
+	return kit.SetLogger(context.Background(), log.NewNopLogger())
+}
+
+// fakeEmployees answers from a map and counts how many times each id got looked up
+type fakeEmployees struct {
+	employees map[domain.EmployeeID]domain.Employee
+	err       error
+
+	mu      sync.Mutex
+	lookups map[domain.EmployeeID]int
+}
+
+func (f *fakeEmployees) Employee(_ context.Context, employeeID domain.EmployeeID) (*domain.Employee, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lookups == nil {
+		f.lookups = make(map[domain.EmployeeID]int)
+	}
+	f.lookups[employeeID]++
+	if f.err != nil {
+		return nil, f.err
+	}
+	employee, ok := f.employees[employeeID]
+	if !ok {
+		return nil, nil
+	}
+	return &employee, nil
+}
+
+func (f *fakeEmployees) All(context.Context) ([]domain.Employee, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var ret []domain.Employee
+	for _, employee := range f.employees {
+		ret = append(ret, employee)
+	}
+	return ret, nil
+}
+
+func TestExecutor_Execute(t *testing.T) {
+	bob := domain.Employee{ID: "1", Name: "Bob", Age: 30, Generation: domain.Millennial}
+	testCases := []struct {
+		desc          string
+		query         string
+		err           error
+		maxDepth      int
+		maxComplexity int
+		expected      string
+	}{
+		{
+			desc:     "employee",
+			query:    `{ employee(id: "1") { name generation { code label } } }`,
+			expected: `{"data":{"employee":{"name":"Bob","generation":{"code":"millennial","label":"Millennial"}}}}`,
+		},
+		{
+			desc:     "nobody",
+			query:    `{ employee(id: "2") { name } }`,
+			expected: `{"data":{"employee":null}}`,
+		},
+		{
+			desc:     "stats over everybody",
+			query:    `{ stats { count oldest { id } } }`,
+			expected: `{"data":{"stats":{"count":1,"oldest":{"id":"1"}}}}`,
+		},
+		{
+			desc:     "lookup failing",
+			query:    `{ employee(id: "1") { name } }`,
+			err:      errors.New("upstream is down"),
+			expected: `{"data":{"employee":null},"errors":[{"message":"something terrible happened","path":["employee"],"locations":[{"line":1,"column":3}],"extensions":{"code":"INTERNAL_SERVER_ERROR"}}]}`,
+		},
+		{
+			desc:     "too deep",
+			query:    `{ employee(id: "1") { generation { name } } }`,
+			maxDepth: 2,
+			expected: `{"errors":[{"message":"Query is nested 3 levels deep, the most allowed is 2","extensions":{"code":"QUERY_TOO_DEEP"}}]}`,
+		},
+		{
+			desc:          "too complex",
+			query:         `{ employees(ids: ["1", "2", "3"]) { id name } }`,
+			maxComplexity: 5,
+			expected:      `{"errors":[{"message":"Query has a complexity of 9, the most allowed is 5","extensions":{"code":"QUERY_TOO_COMPLEX"}}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			executor := &Executor{
+				Employees:     &fakeEmployees{employees: map[domain.EmployeeID]domain.Employee{"1": bob}, err: tc.err},
+				MaxDepth:      tc.maxDepth,
+				MaxComplexity: tc.maxComplexity,
+			}
+			res := executor.Execute(newTestContext(), i18n.NewCatalog().Localizer(""), &Request{Query: tc.query})
+
+			raw, err := json.Marshal(res)
+			if asserter.NoError(err) {
+				asserter.JSONEq(tc.expected, string(raw))
+			}
+		})
+	}
+}
+
+func TestExecutor_Execute_LooksEachEmployeeUpOnce(t *testing.T) {
+	asserter := assert.New(t)
+
+	employees := &fakeEmployees{employees: map[domain.EmployeeID]domain.Employee{
+		"1": {ID: "1", Name: "Bob", Age: 30, Generation: domain.Millennial},
+		"2": {ID: "2", Name: "Sue", Age: 50, Generation: domain.GenX},
+	}}
+	executor := &Executor{Employees: employees}
+	res := executor.Execute(newTestContext(), i18n.NewCatalog().Localizer(""), &Request{Query: `{
+		a: employee(id: "1") { name }
+		b: employee(id: "2") { name }
+		employees(ids: ["1", "2", "1"]) { id }
+		stats(ids: ["2"]) { count }
+	}`})
+
+	asserter.Empty(res.Errors)
+	asserter.Equal(map[domain.EmployeeID]int{"1": 1, "2": 1}, employees.lookups)
+}
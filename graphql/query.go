@@ -0,0 +1,625 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A parser for the executable half of the GraphQL language (https://spec.graphql.org/June2018/#sec-Language):
+// operations, fields, arguments, variables, fragments and directives. There's no type system language, the schema is
+// defined in code (see graphql.go), so nothing here needs to parse one.
+
+// Location is where in the query something is, both counting from 1
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+type gqlOperation struct {
+	// kind is query, mutation or subscription
+	kind       string
+	name       string
+	variables  []gqlVariableDefinition
+	directives []gqlDirective
+	selections []gqlSelection
+	loc        Location
+}
+
+type gqlVariableDefinition struct {
+	name         string
+	typ          gqlTypeRef
+	defaultValue *gqlValue
+	loc          Location
+}
+
+// gqlTypeRef is a type as written in a variable definition, eg [ID!]! is a non null list of non null IDs
+type gqlTypeRef struct {
+	name    string
+	list    *gqlTypeRef
+	nonNull bool
+}
+
+func (t gqlTypeRef) String() string {
+	ret := t.name
+	if t.list != nil {
+		ret = "[" + t.list.String() + "]"
+	}
+	if t.nonNull {
+		ret += "!"
+	}
+	return ret
+}
+
+type gqlFragment struct {
+	name          string
+	typeCondition string
+	directives    []gqlDirective
+	selections    []gqlSelection
+	loc           Location
+}
+
+type gqlSelectionKind int
+
+const (
+	gqlFieldSelection gqlSelectionKind = iota
+	gqlFragmentSpread
+	gqlInlineFragment
+)
+
+// gqlSelection is a field, a fragment spread (name is the fragment's) or an inline fragment (typeCondition may be
+// empty)
+type gqlSelection struct {
+	kind          gqlSelectionKind
+	alias         string
+	name          string
+	arguments     []gqlArgument
+	directives    []gqlDirective
+	typeCondition string
+	selections    []gqlSelection
+	loc           Location
+}
+
+// responseKey is what the field's value goes under in the response
+func (s gqlSelection) responseKey() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+type gqlArgument struct {
+	name  string
+	value gqlValue
+	loc   Location
+}
+
+type gqlDirective struct {
+	name      string
+	arguments []gqlArgument
+	loc       Location
+}
+
+type gqlValueKind int
+
+const (
+	gqlVariableValue gqlValueKind = iota
+	gqlIntValue
+	gqlFloatValue
+	gqlStringValue
+	gqlBooleanValue
+	gqlNullValue
+	gqlEnumValue
+	gqlListValue
+	gqlObjectValue
+)
+
+// gqlValue is a literal or variable as written in the query. raw is the variable's name, the number or enum as
+// written, or the string with escapes worked out.
+type gqlValue struct {
+	kind   gqlValueKind
+	raw    string
+	list   []gqlValue
+	fields []gqlArgument
+	loc    Location
+}
+
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunctuator
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind  gqlTokenKind
+	value string
+	loc   Location
+}
+
+func (t gqlToken) String() string {
+	switch t.kind {
+	case gqlEOF:
+		return "<EOF>"
+	case gqlString:
+		return strconv.Quote(t.value)
+	default:
+		return t.value
+	}
+}
+
+// gqlSyntaxError is what the parser panics with, parseDocument recovers it. Passing errors back up through every level
+// of a recursive descent parser would bury the grammar.
+type gqlSyntaxError struct {
+	message string
+	loc     Location
+}
+
+func parseDocument(source string) (doc *gqlDocument, err *Error) {
+	defer func() {
+		if x := recover(); x != nil {
+			syntaxErr, ok := x.(gqlSyntaxError)
+			if !ok {
+				panic(x)
+			}
+			doc, err = nil, &Error{
+				Message:    "Syntax Error: " + syntaxErr.message,
+				Locations:  []Location{syntaxErr.loc},
+				Extensions: map[string]interface{}{"code": gqlParseFailed},
+			}
+		}
+	}()
+
+	p := &gqlParser{lexer: gqlLexer{source: source, line: 1, lineStart: 0}}
+	p.advance()
+	return p.document(), nil
+}
+
+type gqlParser struct {
+	lexer gqlLexer
+	token gqlToken
+}
+
+func (p *gqlParser) fail(loc Location, format string, args ...interface{}) {
+	panic(gqlSyntaxError{message: fmt.Sprintf(format, args...), loc: loc})
+}
+
+func (p *gqlParser) advance() gqlToken {
+	ret := p.token
+	p.token = p.lexer.next()
+	return ret
+}
+
+func (p *gqlParser) peek(punctuator string) bool {
+	return p.token.kind == gqlPunctuator && p.token.value == punctuator
+}
+
+func (p *gqlParser) skip(punctuator string) bool {
+	if p.peek(punctuator) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) expect(punctuator string) gqlToken {
+	if !p.peek(punctuator) {
+		p.fail(p.token.loc, "Expected %q, found %s", punctuator, p.token)
+	}
+	return p.advance()
+}
+
+func (p *gqlParser) name() gqlToken {
+	if p.token.kind != gqlName {
+		p.fail(p.token.loc, "Expected Name, found %s", p.token)
+	}
+	return p.advance()
+}
+
+func (p *gqlParser) keyword(word string) {
+	if p.token.kind != gqlName || p.token.value != word {
+		p.fail(p.token.loc, "Expected %q, found %s", word, p.token)
+	}
+	p.advance()
+}
+
+func (p *gqlParser) document() *gqlDocument {
+	ret := &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	for {
+		switch {
+		case p.token.kind == gqlEOF:
+			if len(ret.operations) == 0 && len(ret.fragments) == 0 {
+				p.fail(p.token.loc, "Unexpected <EOF>")
+			}
+			return ret
+		case p.peek("{"):
+			loc := p.token.loc
+			ret.operations = append(ret.operations, &gqlOperation{kind: "query", selections: p.selectionSet(), loc: loc})
+		case p.token.kind == gqlName && (p.token.value == "query" || p.token.value == "mutation" || p.token.value == "subscription"):
+			ret.operations = append(ret.operations, p.operation())
+		case p.token.kind == gqlName && p.token.value == "fragment":
+			fragment := p.fragment()
+			if _, dupe := ret.fragments[fragment.name]; dupe {
+				p.fail(fragment.loc, "There can be only one fragment named %q", fragment.name)
+			}
+			ret.fragments[fragment.name] = fragment
+		default:
+			p.fail(p.token.loc, "Unexpected %s", p.token)
+		}
+	}
+}
+
+func (p *gqlParser) operation() *gqlOperation {
+	start := p.advance()
+	ret := &gqlOperation{kind: start.value, loc: start.loc}
+	if p.token.kind == gqlName {
+		ret.name = p.advance().value
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			loc := p.expect("$").loc
+			def := gqlVariableDefinition{name: p.name().value, loc: loc}
+			p.expect(":")
+			def.typ = p.typeRef()
+			if p.skip("=") {
+				value := p.value(true)
+				def.defaultValue = &value
+			}
+			ret.variables = append(ret.variables, def)
+		}
+	}
+	ret.directives = p.directives()
+	ret.selections = p.selectionSet()
+	return ret
+}
+
+func (p *gqlParser) typeRef() gqlTypeRef {
+	var ret gqlTypeRef
+	if p.skip("[") {
+		inner := p.typeRef()
+		p.expect("]")
+		ret.list = &inner
+	} else {
+		ret.name = p.name().value
+	}
+	ret.nonNull = p.skip("!")
+	return ret
+}
+
+func (p *gqlParser) fragment() *gqlFragment {
+	loc := p.advance().loc
+	name := p.name()
+	if name.value == "on" {
+		p.fail(name.loc, "Unexpected Name \"on\"")
+	}
+	p.keyword("on")
+	return &gqlFragment{
+		name:          name.value,
+		typeCondition: p.name().value,
+		directives:    p.directives(),
+		selections:    p.selectionSet(),
+		loc:           loc,
+	}
+}
+
+func (p *gqlParser) selectionSet() []gqlSelection {
+	p.expect("{")
+	var ret []gqlSelection
+	for !p.skip("}") {
+		ret = append(ret, p.selection())
+	}
+	if len(ret) == 0 {
+		p.fail(p.token.loc, "Expected Name, found }")
+	}
+	return ret
+}
+
+func (p *gqlParser) selection() gqlSelection {
+	if p.peek("...") {
+		loc := p.advance().loc
+		if p.token.kind == gqlName && p.token.value != "on" {
+			return gqlSelection{kind: gqlFragmentSpread, name: p.advance().value, directives: p.directives(), loc: loc}
+		}
+		ret := gqlSelection{kind: gqlInlineFragment, loc: loc}
+		if p.token.kind == gqlName {
+			p.advance()
+			ret.typeCondition = p.name().value
+		}
+		ret.directives = p.directives()
+		ret.selections = p.selectionSet()
+		return ret
+	}
+
+	name := p.name()
+	ret := gqlSelection{kind: gqlFieldSelection, name: name.value, loc: name.loc}
+	if p.skip(":") {
+		ret.alias = ret.name
+		ret.name = p.name().value
+	}
+	ret.arguments = p.arguments(false)
+	ret.directives = p.directives()
+	if p.peek("{") {
+		ret.selections = p.selectionSet()
+	}
+	return ret
+}
+
+func (p *gqlParser) arguments(constant bool) []gqlArgument {
+	if !p.skip("(") {
+		return nil
+	}
+	var ret []gqlArgument
+	for !p.skip(")") {
+		name := p.name()
+		p.expect(":")
+		ret = append(ret, gqlArgument{name: name.value, value: p.value(constant), loc: name.loc})
+	}
+	return ret
+}
+
+func (p *gqlParser) directives() []gqlDirective {
+	var ret []gqlDirective
+	for p.peek("@") {
+		loc := p.advance().loc
+		ret = append(ret, gqlDirective{name: p.name().value, arguments: p.arguments(false), loc: loc})
+	}
+	return ret
+}
+
+// value parses a literal, constant being for default values which can't refer to variables
+func (p *gqlParser) value(constant bool) gqlValue {
+	token := p.token
+	switch {
+	case p.peek("$") && !constant:
+		p.advance()
+		return gqlValue{kind: gqlVariableValue, raw: p.name().value, loc: token.loc}
+	case p.peek("["):
+		p.advance()
+		ret := gqlValue{kind: gqlListValue, loc: token.loc}
+		for !p.skip("]") {
+			ret.list = append(ret.list, p.value(constant))
+		}
+		return ret
+	case p.peek("{"):
+		p.advance()
+		ret := gqlValue{kind: gqlObjectValue, loc: token.loc}
+		for !p.skip("}") {
+			name := p.name()
+			p.expect(":")
+			ret.fields = append(ret.fields, gqlArgument{name: name.value, value: p.value(constant), loc: name.loc})
+		}
+		return ret
+	case token.kind == gqlInt:
+		p.advance()
+		return gqlValue{kind: gqlIntValue, raw: token.value, loc: token.loc}
+	case token.kind == gqlFloat:
+		p.advance()
+		return gqlValue{kind: gqlFloatValue, raw: token.value, loc: token.loc}
+	case token.kind == gqlString:
+		p.advance()
+		return gqlValue{kind: gqlStringValue, raw: token.value, loc: token.loc}
+	case token.kind == gqlName:
+		p.advance()
+		switch token.value {
+		case "true", "false":
+			return gqlValue{kind: gqlBooleanValue, raw: token.value, loc: token.loc}
+		case "null":
+			return gqlValue{kind: gqlNullValue, loc: token.loc}
+		default:
+			return gqlValue{kind: gqlEnumValue, raw: token.value, loc: token.loc}
+		}
+	}
+	p.fail(token.loc, "Unexpected %s", token)
+	return gqlValue{}
+}
+
+type gqlLexer struct {
+	source    string
+	pos       int
+	line      int
+	lineStart int
+}
+
+func (l *gqlLexer) loc() Location {
+	return Location{Line: l.line, Column: utf8.RuneCountInString(l.source[l.lineStart:l.pos]) + 1}
+}
+
+func (l *gqlLexer) fail(format string, args ...interface{}) {
+	panic(gqlSyntaxError{message: fmt.Sprintf(format, args...), loc: l.loc()})
+}
+
+func (l *gqlLexer) newline() {
+	l.line++
+	l.lineStart = l.pos
+}
+
+// next skips anything insignificant (whitespace, commas, comments and a byte order mark) and hands back the token after
+func (l *gqlLexer) next() gqlToken {
+	for l.pos < len(l.source) {
+		switch c := l.source[l.pos]; {
+		case c == '\n':
+			l.pos++
+			l.newline()
+		case c == '\r':
+			l.pos++
+			if l.pos < len(l.source) && l.source[l.pos] == '\n' {
+				l.pos++
+			}
+			l.newline()
+		case c == ' ' || c == '\t' || c == ',':
+			l.pos++
+		case strings.HasPrefix(l.source[l.pos:], "\uFEFF"):
+			l.pos += len("\uFEFF")
+		case c == '#':
+			for l.pos < len(l.source) && l.source[l.pos] != '\n' && l.source[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return l.token()
+		}
+	}
+	return gqlToken{kind: gqlEOF, loc: l.loc()}
+}
+
+func (l *gqlLexer) token() gqlToken {
+	loc := l.loc()
+	c := l.source[l.pos]
+	switch {
+	case strings.HasPrefix(l.source[l.pos:], "..."):
+		l.pos += 3
+		return gqlToken{kind: gqlPunctuator, value: "...", loc: loc}
+	case strings.IndexByte("!$():=@[]{|}", c) >= 0:
+		l.pos++
+		return gqlToken{kind: gqlPunctuator, value: string(c), loc: loc}
+	case c == '_' || isGraphQLLetter(c):
+		start := l.pos
+		for l.pos < len(l.source) && (l.source[l.pos] == '_' || isGraphQLLetter(l.source[l.pos]) || isGraphQLDigit(l.source[l.pos])) {
+			l.pos++
+		}
+		return gqlToken{kind: gqlName, value: l.source[start:l.pos], loc: loc}
+	case c == '-' || isGraphQLDigit(c):
+		return l.number(loc)
+	case strings.HasPrefix(l.source[l.pos:], `"""`):
+		return l.blockString(loc)
+	case c == '"':
+		return l.string(loc)
+	}
+	r, _ := utf8.DecodeRuneInString(l.source[l.pos:])
+	l.fail("Unexpected character %q", r)
+	return gqlToken{}
+}
+
+func isGraphQLLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isGraphQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (l *gqlLexer) digits() {
+	if l.pos >= len(l.source) || !isGraphQLDigit(l.source[l.pos]) {
+		l.fail("Invalid number, expected digit")
+	}
+	for l.pos < len(l.source) && isGraphQLDigit(l.source[l.pos]) {
+		l.pos++
+	}
+}
+
+func (l *gqlLexer) number(loc Location) gqlToken {
+	start := l.pos
+	kind := gqlInt
+	if l.source[l.pos] == '-' {
+		l.pos++
+	}
+	if l.pos < len(l.source) && l.source[l.pos] == '0' {
+		l.pos++
+		if l.pos < len(l.source) && isGraphQLDigit(l.source[l.pos]) {
+			l.fail("Invalid number, unexpected digit after 0")
+		}
+	} else {
+		l.digits()
+	}
+	if l.pos < len(l.source) && l.source[l.pos] == '.' {
+		kind = gqlFloat
+		l.pos++
+		l.digits()
+	}
+	if l.pos < len(l.source) && (l.source[l.pos] == 'e' || l.source[l.pos] == 'E') {
+		kind = gqlFloat
+		l.pos++
+		if l.pos < len(l.source) && (l.source[l.pos] == '+' || l.source[l.pos] == '-') {
+			l.pos++
+		}
+		l.digits()
+	}
+	// 123abc is a mistake, not the number 123 followed by the name abc
+	if l.pos < len(l.source) && (l.source[l.pos] == '_' || l.source[l.pos] == '.' || isGraphQLLetter(l.source[l.pos])) {
+		l.fail("Invalid number, unexpected %q", l.source[l.pos])
+	}
+	return gqlToken{kind: kind, value: l.source[start:l.pos], loc: loc}
+}
+
+func (l *gqlLexer) string(loc Location) gqlToken {
+	l.pos++
+	var ret strings.Builder
+	for {
+		if l.pos >= len(l.source) || l.source[l.pos] == '\n' || l.source[l.pos] == '\r' {
+			l.fail("Unterminated string")
+		}
+		c := l.source[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return gqlToken{kind: gqlString, value: ret.String(), loc: loc}
+		case c == '\\' && l.pos+1 < len(l.source):
+			escape := l.source[l.pos+1]
+			l.pos += 2
+			switch escape {
+			case '"', '\\', '/':
+				ret.WriteByte(escape)
+			case 'b':
+				ret.WriteByte('\b')
+			case 'f':
+				ret.WriteByte('\f')
+			case 'n':
+				ret.WriteByte('\n')
+			case 'r':
+				ret.WriteByte('\r')
+			case 't':
+				ret.WriteByte('\t')
+			case 'u':
+				if l.pos+4 > len(l.source) {
+					l.fail("Invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(l.source[l.pos:l.pos+4], 16, 32)
+				if err != nil {
+					l.fail("Invalid unicode escape \\u%s", l.source[l.pos:l.pos+4])
+				}
+				ret.WriteRune(rune(code))
+				l.pos += 4
+			default:
+				l.fail("Invalid escape \\%c", escape)
+			}
+		default:
+			ret.WriteByte(c)
+			l.pos++
+		}
+	}
+}
+
+// blockString doesn't strip indentation the way the spec says to, nothing in this schema takes text long enough for
+// anyone to bother with block strings beyond a line or two
+func (l *gqlLexer) blockString(loc Location) gqlToken {
+	l.pos += 3
+	var ret strings.Builder
+	for {
+		switch {
+		case l.pos >= len(l.source):
+			l.fail("Unterminated string")
+		case strings.HasPrefix(l.source[l.pos:], `\"""`):
+			ret.WriteString(`"""`)
+			l.pos += 4
+		case strings.HasPrefix(l.source[l.pos:], `"""`):
+			l.pos += 3
+			return gqlToken{kind: gqlString, value: ret.String(), loc: loc}
+		case l.source[l.pos] == '\n':
+			ret.WriteByte('\n')
+			l.pos++
+			l.newline()
+		default:
+			ret.WriteByte(l.source[l.pos])
+			l.pos++
+		}
+	}
+}
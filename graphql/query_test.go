@@ -0,0 +1,113 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDocument(t *testing.T) {
+	asserter := assert.New(t)
+
+	doc, err := parseDocument(`
+		# comments and commas are just whitespace
+		query Lookup($id: ID! = "1", $ids: [ID!]!, $withAge: Boolean) @nope {
+			boss: employee(id: $id) {
+				...basics
+				age @include(if: $withAge)
+			}
+			employees(ids: $ids) { ... on Employee { name }, ... @skip(if: true) { id } }
+			stats(ids: [1, "two", 3.5, -4e2, true, null, ENUM, {a: "\"q\"é"}]) { count }
+		}
+
+		fragment basics on Employee { id name }
+		{ generations { code } }
+	`)
+	if !asserter.Nil(err) {
+		return
+	}
+
+	if asserter.Len(doc.operations, 2) {
+		op := doc.operations[0]
+		asserter.Equal("query", op.kind)
+		asserter.Equal("Lookup", op.name)
+		asserter.Equal(Location{Line: 3, Column: 3}, op.loc)
+		if asserter.Len(op.variables, 3) {
+			asserter.Equal("id", op.variables[0].name)
+			asserter.Equal("ID!", op.variables[0].typ.String())
+			asserter.Equal(&gqlValue{kind: gqlStringValue, raw: "1", loc: Location{Line: 3, Column: 27}}, op.variables[0].defaultValue)
+			asserter.Equal("[ID!]!", op.variables[1].typ.String())
+			asserter.Equal("Boolean", op.variables[2].typ.String())
+		}
+		asserter.Equal("nope", op.directives[0].name)
+
+		if asserter.Len(op.selections, 3) {
+			boss := op.selections[0]
+			asserter.Equal("boss", boss.responseKey())
+			asserter.Equal("employee", boss.name)
+			asserter.Equal(gqlValue{kind: gqlVariableValue, raw: "id", loc: Location{Line: 4, Column: 23}}, boss.arguments[0].value)
+			asserter.Equal(gqlFragmentSpread, boss.selections[0].kind)
+			asserter.Equal("basics", boss.selections[0].name)
+			asserter.Equal("include", boss.selections[1].directives[0].name)
+
+			employees := op.selections[1]
+			asserter.Equal("employees", employees.responseKey())
+			asserter.Equal(gqlInlineFragment, employees.selections[0].kind)
+			asserter.Equal("Employee", employees.selections[0].typeCondition)
+			asserter.Equal("", employees.selections[1].typeCondition)
+			asserter.Equal("skip", employees.selections[1].directives[0].name)
+
+			var kinds []gqlValueKind
+			var raws []string
+			for _, v := range op.selections[2].arguments[0].value.list {
+				kinds = append(kinds, v.kind)
+				raws = append(raws, v.raw)
+			}
+			asserter.Equal([]gqlValueKind{gqlIntValue, gqlStringValue, gqlFloatValue, gqlFloatValue, gqlBooleanValue, gqlNullValue, gqlEnumValue, gqlObjectValue}, kinds)
+			asserter.Equal([]string{"1", "two", "3.5", "-4e2", "true", "", "ENUM", ""}, raws)
+			asserter.Equal(`"q"é`, op.selections[2].arguments[0].value.list[7].fields[0].value.raw)
+		}
+		asserter.Equal("", doc.operations[1].name)
+		asserter.Equal("generations", doc.operations[1].selections[0].name)
+	}
+	if asserter.Contains(doc.fragments, "basics") {
+		asserter.Equal("Employee", doc.fragments["basics"].typeCondition)
+		asserter.Len(doc.fragments["basics"].selections, 2)
+	}
+}
+
+func TestParseDocument_SyntaxErrors(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		input            string
+		expectedMessage  string
+		expectedLocation Location
+	}{
+		{"empty", "  ", "Syntax Error: Unexpected <EOF>", Location{Line: 1, Column: 3}},
+		{"unclosed", "{ employee(id: 1) { name }", `Syntax Error: Expected Name, found <EOF>`, Location{Line: 1, Column: 27}},
+		{"empty selection", "{ employee(id: 1) {} }", "Syntax Error: Expected Name, found }", Location{Line: 1, Column: 22}},
+		{"missing colon", "{ employee(id 1) { name } }", `Syntax Error: Expected ":", found 1`, Location{Line: 1, Column: 15}},
+		{"bad character", "{\n  employee(id: 1) { name ? } }", `Syntax Error: Unexpected character '?'`, Location{Line: 2, Column: 26}},
+		{"unterminated string", `{ generation(name: "boom) { code } }`, "Syntax Error: Unterminated string", Location{Line: 1, Column: 37}},
+		{"bad escape", `{ generation(name: "\q") { code } }`, `Syntax Error: Invalid escape \q`, Location{Line: 1, Column: 23}},
+		{"leading zero", "{ employee(id: 007) { name } }", "Syntax Error: Invalid number, unexpected digit after 0", Location{Line: 1, Column: 17}},
+		{"number glued to a name", "{ employee(id: 7up) { name } }", `Syntax Error: Invalid number, unexpected 'u'`, Location{Line: 1, Column: 17}},
+		{"variable in a default", "query ($a: ID = $b) { employee(id: $a) { name } }", "Syntax Error: Unexpected $", Location{Line: 1, Column: 17}},
+		{"duplicate fragment", "fragment a on Employee { id } fragment a on Employee { name }", `Syntax Error: There can be only one fragment named "a"`, Location{Line: 1, Column: 31}},
+		{"fragment named on", "fragment on on Employee { id }", `Syntax Error: Unexpected Name "on"`, Location{Line: 1, Column: 10}},
+		{"junk at the top", "employee { name }", "Syntax Error: Unexpected employee", Location{Line: 1, Column: 1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			doc, err := parseDocument(tc.input)
+			asserter.Nil(doc)
+			if asserter.NotNil(err) {
+				asserter.Equal(tc.expectedMessage, err.Message)
+				asserter.Equal([]Location{tc.expectedLocation}, err.Locations)
+				asserter.Equal(map[string]interface{}{"code": "GRAPHQL_PARSE_FAILED"}, err.Extensions)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Package i18n translates the things we say to people, generation labels and error messages, into whatever language
+// they asked for with Accept-Language. Every language is a json file of message id -> message, see locales/ for the
+// ones we ship. English is what everything falls back to, locales/en.json gets built in so there's always something
+// to fall back to even without a locales directory.
+package i18n
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+)
+
+//go:embed locales/en.json
+var englishJSON []byte
+
+// english is the source of truth for which messages exist, translations may only use these ids. Messages with
+// arguments use fmt verbs, translations need to keep the same verbs in the same order.
+var english = func() map[string]string {
+	ret := make(map[string]string)
+	if err := json.Unmarshal(englishJSON, &ret); err != nil {
+		panic(errors.Wrap(err, "reading built in locales/en.json"))
+	}
+	return ret
+}()
+
+// Catalog holds every language we can speak. Add everything before serving requests, there is no locking in here.
+type Catalog struct {
+	tags     []language.Tag
+	messages []map[string]string
+	matcher  language.Matcher
+}
+
+// NewCatalog gives back a catalog that only speaks English
+func NewCatalog() *Catalog {
+	ret := &Catalog{}
+	ret.Add(language.English, english)
+	return ret
+}
+
+// Add registers translations for a language, replacing any that were already there. Messages it doesn't have fall
+// back to English.
+func (c *Catalog) Add(tag language.Tag, messages map[string]string) {
+	for i, existing := range c.tags {
+		if existing == tag {
+			c.messages[i] = messages
+			return
+		}
+	}
+	c.tags = append(c.tags, tag)
+	c.messages = append(c.messages, messages)
+	c.matcher = language.NewMatcher(c.tags)
+}
+
+// Languages is every language in the catalog, English first
+func (c *Catalog) Languages() []language.Tag {
+	return append([]language.Tag{}, c.tags...)
+}
+
+// LoadDir gives back a catalog with a language per <tag>.json file in dir, eg es.json or pt-BR.json. An en.json in dir
+// replaces the built in English, and since everything else falls back to it it has to have every message. dir not
+// being there is an error, it's most likely a relative path that got run from somewhere else, and quietly
+// speaking nothing but English would be worse than not starting.
+func LoadDir(dir string) (*Catalog, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading locales")
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("loading locales: %s isn't a directory", dir)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ret := NewCatalog()
+	for _, f := range files {
+		tag, messages, err := loadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if tag == language.English {
+			for id := range english {
+				if _, ok := messages[id]; !ok {
+					return nil, errors.Errorf("%s is missing %q, English is what everything falls back to so it needs them all", f, id)
+				}
+			}
+		}
+		ret.Add(tag, messages)
+	}
+	return ret, nil
+}
+
+func loadFile(path string) (language.Tag, map[string]string, error) {
+	tag, err := language.Parse(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	if err != nil {
+		return language.Und, nil, errors.Wrapf(err, "%s isn't named after a language", path)
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return language.Und, nil, errors.WithStack(err)
+	}
+	messages := make(map[string]string)
+	if err := json.Unmarshal(raw, &messages); err != nil {
+		return language.Und, nil, errors.Wrapf(err, "reading %s", path)
+	}
+	for id, translated := range messages {
+		source, ok := english[id]
+		if !ok {
+			return language.Und, nil, errors.Errorf("%s has a translation for %q, which isn't a message we have", path, id)
+		}
+		// a mangled verb turns into %!s(MISSING) in front of a customer
+		if expected, got := verbPattern.FindAllString(source, -1), verbPattern.FindAllString(translated, -1); !reflect.DeepEqual(expected, got) {
+			return language.Und, nil, errors.Errorf("%s has %q for %q, it needs the same format verbs as the English %q", path, translated, id, source)
+		}
+	}
+	return tag, messages, nil
+}
+
+// verbPattern finds fmt verbs, translations need the same ones in the same order as the English
+var verbPattern = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// Localizer picks the best language we have for an Accept-Language header, anything unparseable or that we don't
+// speak gets English
+func (c *Catalog) Localizer(acceptLanguage string) *Localizer {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return &Localizer{tag: c.tags[0], messages: c.messages[0], fallback: c.messages[0]}
+	}
+	_, i, confidence := c.matcher.Match(tags...)
+	if confidence == language.No {
+		i = 0
+	}
+	return &Localizer{tag: c.tags[i], messages: c.messages[i], fallback: c.messages[0]}
+}
+
+type Localizer struct {
+	tag      language.Tag
+	messages map[string]string
+	// fallback is the catalog's English
+	fallback map[string]string
+}
+
+// Language is what to put in Content-Language
+func (l *Localizer) Language() string {
+	return l.tag.String()
+}
+
+// Message formats a message with args, falling back to the catalog's English if this language doesn't have it, then
+// the built in English, and to the id itself if nobody does
+func (l *Localizer) Message(id string, args ...interface{}) string {
+	msg, ok := l.messages[id]
+	if !ok {
+		msg, ok = l.fallback[id]
+	}
+	if !ok {
+		msg, ok = english[id]
+	}
+	if !ok {
+		return id
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Generation is the label to show people for a generation, ones we've never heard of are shown as is
+func (l *Localizer) Generation(g domain.Generation) string {
+	id := "generation." + g.Code()
+	if !Has(id) {
+		return string(g)
+	}
+	return l.Message(id)
+}
+
+// Employee fills in the generation code and label on a copy of e
+func (l *Localizer) Employee(e domain.Employee) domain.Employee {
+	e.GenerationCode = e.Generation.Code()
+	e.GenerationLabel = l.Generation(e.Generation)
+	return e
+}
+
+// Catalog translates the labels on a copy of c
+func (l *Localizer) Catalog(c domain.GenerationCatalog) domain.GenerationCatalog {
+	ret := make(domain.GenerationCatalog, len(c))
+	for i, entry := range c {
+		entry.Label = l.Generation(entry.Name)
+		ret[i] = entry
+	}
+	return ret
+}
+
+// Has says if a message exists at all, in any language
+func Has(id string) bool {
+	_, ok := english[id]
+	return ok
+}
+
+type contextKey int
+
+const acceptLanguageKey contextKey = iota
+
+// PopulateAcceptLanguage stashes the Accept-Language header in the context, it fits kithttp.ServerBefore
+func PopulateAcceptLanguage(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, acceptLanguageKey, r.Header.Get("Accept-Language"))
+}
+
+func AcceptLanguage(ctx context.Context) string {
+	ret, _ := ctx.Value(acceptLanguageKey).(string)
+	return ret
+}
@@ -0,0 +1,219 @@
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+// TestLocales keeps the translations we ship complete, a missing message quietly falls back to English and a mangled
+// verb turns into %!s(MISSING) in front of a customer, so neither should make it past CI
+func TestLocales(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("locales", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, files)
+
+	for _, f := range files {
+		t.Run(filepath.Base(f), func(t *testing.T) {
+			asserter := assert.New(t)
+
+			_, messages, err := loadFile(f)
+			if !asserter.NoError(err) {
+				return
+			}
+			for id, msg := range english {
+				translated, ok := messages[id]
+				if asserter.True(ok, "missing %s", id) {
+					asserter.NotEmpty(translated, id)
+					asserter.Equal(verbPattern.FindAllString(msg, -1), verbPattern.FindAllString(translated, -1), id)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalizer(t *testing.T) {
+	catalog, err := LoadDir("locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc             string
+		acceptLanguage   string
+		expectedLanguage string
+		expectedTitle    string
+	}{
+		{"nothing", "", "en", "Employee not found"},
+		{"english", "en-US", "en", "Employee not found"},
+		{"spanish", "es", "es", "Empleado no encontrado"},
+		{"regional spanish", "es-MX,es;q=0.9", "es", "Empleado no encontrado"},
+		{"german", "de-DE", "de", "Mitarbeiter nicht gefunden"},
+		{"preference order", "fr;q=0.9, de;q=0.5, es;q=0.8", "es", "Empleado no encontrado"},
+		{"nothing we speak", "ja, zh", "en", "Employee not found"},
+		{"garbage", ";;;q=abc", "en", "Employee not found"},
+		{"anything", "*", "en", "Employee not found"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			testInstance := catalog.Localizer(tc.acceptLanguage)
+			asserter.Equal(tc.expectedLanguage, testInstance.Language())
+			asserter.Equal(tc.expectedTitle, testInstance.Message("problem.employee_not_found.title"))
+		})
+	}
+}
+
+func TestLocalizer_Message(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := NewCatalog()
+	testInstance.Add(language.Spanish, map[string]string{"problem.employee_not_found.detail": "no existe ningún empleado con el id %s"})
+	spanish := testInstance.Localizer("es")
+
+	asserter.Equal("no existe ningún empleado con el id 7", spanish.Message("problem.employee_not_found.detail", "7"))
+	// not translated, so English
+	asserter.Equal("there is nothing here", spanish.Message("problem.route_not_found.detail"))
+	// doesn't exist at all
+	asserter.Equal("problem.nope", spanish.Message("problem.nope"))
+
+	asserter.Equal([]language.Tag{language.English, language.Spanish}, testInstance.Languages())
+}
+
+func TestLocalizer_Generations(t *testing.T) {
+	asserter := assert.New(t)
+
+	catalog, err := LoadDir("locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	german := catalog.Localizer("de")
+
+	asserter.Equal("Babyboomer", german.Generation(domain.BabyBoomer))
+	asserter.Equal("DrinksRUs", german.Generation("DrinksRUs"))
+
+	employee := domain.Employee{ID: "1", Name: "Tiger Nixon", Age: 61, Generation: domain.BabyBoomer}
+	asserter.Equal(domain.Employee{
+		ID:              "1",
+		Name:            "Tiger Nixon",
+		Age:             61,
+		Generation:      domain.BabyBoomer,
+		GenerationCode:  "baby_boomer",
+		GenerationLabel: "Babyboomer",
+	}, german.Employee(employee))
+	asserter.Empty(employee.GenerationLabel, "the original should be left alone")
+
+	original := domain.Catalog()
+	translated := german.Catalog(original)
+	asserter.Equal("Stille Generation", translated[1].Label)
+	asserter.Equal(domain.Silent, translated[1].Name)
+	asserter.Equal("Silent", original[1].Label, "the original should be left alone")
+}
+
+func TestLoadDir_Bad(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		file        string
+		contents    string
+		expectedErr string
+	}{
+		{"not a language", "nope-nope-nope.json", `{}`, "isn't named after a language"},
+		{"not json", "es.json", `{`, "reading"},
+		{"unknown message", "es.json", `{"problem.nope": "no"}`, `has a translation for "problem.nope", which isn't a message we have`},
+		{"missing a verb", "es.json", `{"problem.employee_not_found.detail": "no existe ese empleado"}`, `it needs the same format verbs as the English "no employee exists with id %s"`},
+		{"wrong verb", "es.json", `{"problem.employee_not_found.detail": "no existe ningún empleado con el id %d"}`, `it needs the same format verbs`},
+		{"incomplete english", "en.json", `{"problem.internal.title": "Oops"}`, `is missing`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			dir, err := ioutil.TempDir("", "locales")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			if err := ioutil.WriteFile(filepath.Join(dir, tc.file), []byte(tc.contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := LoadDir(dir)
+			asserter.Nil(res)
+			if asserter.Error(err) {
+				asserter.Contains(err.Error(), tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestLoadDir_English(t *testing.T) {
+	asserter := assert.New(t)
+
+	shipped, err := ioutil.ReadFile(filepath.Join("locales", "en.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asserter.Equal(string(englishJSON), string(shipped), "the built in English should be locales/en.json")
+
+	// an en.json in the directory is what gets used, the built in one is only for when there isn't one
+	messages := make(map[string]string)
+	for id, msg := range english {
+		messages[id] = msg
+	}
+	messages["problem.internal.detail"] = "something went sideways"
+	raw, err := json.Marshal(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	asserter.NoError(ioutil.WriteFile(filepath.Join(dir, "en.json"), raw, 0600))
+	asserter.NoError(ioutil.WriteFile(filepath.Join(dir, "es.json"), []byte(`{"problem.internal.title": "Error interno del servidor"}`), 0600))
+
+	catalog, err := LoadDir(dir)
+	if !asserter.NoError(err) {
+		return
+	}
+	asserter.Equal([]language.Tag{language.English, language.Spanish}, catalog.Languages())
+	asserter.Equal("something went sideways", catalog.Localizer("en").Message("problem.internal.detail"))
+	asserter.Equal("something went sideways", catalog.Localizer("es").Message("problem.internal.detail"))
+	asserter.Equal("Error interno del servidor", catalog.Localizer("es").Message("problem.internal.title"))
+}
+
+func TestLoadDir_Missing(t *testing.T) {
+	asserter := assert.New(t)
+
+	res, err := LoadDir(filepath.Join(t.TempDir(), "nope"))
+	asserter.Nil(res)
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "loading locales")
+	}
+
+	file := filepath.Join(t.TempDir(), "es.json")
+	asserter.NoError(ioutil.WriteFile(file, []byte(`{}`), 0600))
+	res, err = LoadDir(file)
+	asserter.Nil(res)
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "isn't a directory")
+	}
+}
+
+func TestPopulateAcceptLanguage(t *testing.T) {
+	asserter := assert.New(t)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "de-CH")
+	ctx := PopulateAcceptLanguage(context.Background(), req)
+	asserter.Equal("de-CH", AcceptLanguage(ctx))
+	asserter.Equal("", AcceptLanguage(context.Background()))
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/i18n"
 	"github.com/jonsabados/unit-testing-party/integration"
 	"golang.org/x/net/publicsuffix"
 	"net/http"
 	"net/http/cookiejar"
+	"os"
 )
 
 func main() {
@@ -14,6 +16,11 @@ func main() {
 		panic(err)
 	}
 
+	apiURL := os.Getenv("UPSTREAM_URL")
+	if apiURL == "" {
+		apiURL = "http://dummy.restapiexample.com"
+	}
+
 	svc := integration.SomeServer{
 		HttpClient: &http.Client{
 			Transport:     nil,
@@ -21,7 +28,20 @@ func main() {
 			Jar:           cookieJar, // the sample api were using always errors on the first request....
 			Timeout:       0,
 		},
+		APIURL: apiURL,
 	}
+	// translations for generation labels and problems, anything missing falls back to English. The default only works
+	// from the repo root, LoadDir refuses a directory that isn't there rather than quietly going English only.
+	localesDir := os.Getenv("LOCALES_DIR")
+	if localesDir == "" {
+		localesDir = "i18n/locales"
+	}
+	messages, err := i18n.LoadDir(localesDir)
+	if err != nil {
+		panic(err)
+	}
+	svc.Messages = messages
+
 	svr := kit.NewServer(&svc)
 
 	panic(http.ListenAndServe("0:8080", svr))
@@ -7,116 +7,170 @@ import (
 	"github.com/NYTimes/gizmo/server/kit"
 	"github.com/go-kit/kit/endpoint"
 	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/i18n"
 	"google.golang.org/grpc"
 	"io/ioutil"
 	"net/http"
+	neturl "net/url"
 	"strconv"
 	"time"
 )
 
-type Generation string
-
-const (
-	// see https://www.cnn.com/2013/11/06/us/baby-boomer-generation-fast-facts/index.html
-	Greatest   Generation = "Greatest"     // 1924 and earlier
-	Silent     Generation = "Silent"       // 1925 - 1945
-	BabyBoomer Generation = "Baby Boomer"  // 1946 - 1964
-	GenX       Generation = "Generation X" // 1965 - 1980
-	Millennial Generation = "Millennial"   // 1981 - 1996
-	GenZ       Generation = "Generation Z" // 1997 +
-)
+// these need to stay in line with the problems unit hands out, the differential tests will complain if they don't
+func internalError(loc *i18n.Localizer) *domain.Error {
+	return &domain.Error{
+		Type:   domain.ProblemTypeBlank,
+		Title:  loc.Message("problem.internal.title"),
+		Status: http.StatusInternalServerError,
+		Detail: loc.Message("problem.internal.detail"),
+	}
+}
 
-type RemoteEmployee struct {
-	Status string `json:"status"`
-	Data   *struct {
-		ID             int    `json:"id"`
-		EmployeeName   string `json:"employee_name"`
-		EmployeeSalary int    `json:"employee_salary"`
-		EmployeeAge    int    `json:"employee_age"`
-		ProfileImage   string `json:"profile_image"`
-	} `json:"data"`
+func employeeNotFound(loc *i18n.Localizer, employeeID domain.EmployeeID) *domain.Error {
+	return &domain.Error{
+		Type:   domain.ProblemTypeEmployeeNotFound,
+		Title:  loc.Message("problem.employee_not_found.title"),
+		Status: http.StatusNotFound,
+		Detail: loc.Message("problem.employee_not_found.detail", employeeID.String()),
+	}
 }
 
-type Employee struct {
-	ID         string     `json:"id"`
-	Name       string     `json:"employee_name"`
-	Age        int        `json:"age"`
-	Generation Generation `json:"generation"`
+func invalidParams(loc *i18n.Localizer, params ...domain.InvalidParam) *domain.Error {
+	return &domain.Error{
+		Type:          domain.ProblemTypeInvalidParams,
+		Title:         loc.Message("problem.invalid_params.title"),
+		Status:        http.StatusBadRequest,
+		InvalidParams: params,
+	}
 }
 
-type Error struct {
-	Message string `json:"message"`
+func routeNotFound(loc *i18n.Localizer) *domain.Error {
+	return &domain.Error{
+		Type:   domain.ProblemTypeRouteNotFound,
+		Title:  loc.Message("problem.route_not_found.title"),
+		Status: http.StatusNotFound,
+		Detail: loc.Message("problem.route_not_found.detail"),
+	}
 }
 
 type SomeServer struct {
+	// HttpClient is used to talk to upstream, if left nil http.DefaultClient is used
 	HttpClient *http.Client
+	// APIURL is where the upstream employee API lives, eg http://dummy.restapiexample.com
+	APIURL string
+	// Now is here so tests can control time, if left nil time.Now is used
+	Now func() time.Time
+	// Messages are the languages generation labels and problems can be rendered in, if left nil everything is English
+	Messages *i18n.Catalog
 }
 
 func (s *SomeServer) EmployeeEndpoint(ctx context.Context, req interface{}) (interface{}, error) {
-	employeeID := req.(int)
+	employeeID := req.(domain.EmployeeID)
+	loc := s.localizer(ctx)
+
+	remote, err := s.fetchEmployee(ctx, employeeID)
+	if err != nil {
+		_ = kit.LogErrorf(ctx, "error reading employee %s", err)
+		return nil, internalError(loc)
+	}
+	if remote.Data == nil {
+		return nil, employeeNotFound(loc, employeeID)
+	}
+
+	return loc.Employee(domain.Employee{
+		ID:         strconv.Itoa(remote.Data.ID),
+		Name:       remote.Data.EmployeeName,
+		Age:        remote.Data.EmployeeAge,
+		Generation: domain.GenerationFor(s.now().Year() - remote.Data.EmployeeAge),
+	}), nil
+}
+
+func (s *SomeServer) GenerationsEndpoint(ctx context.Context, _ interface{}) (interface{}, error) {
+	return s.localizer(ctx).Catalog(domain.Catalog()), nil
+}
 
-	url := fmt.Sprintf("http://dummy.restapiexample.com/api/v1/employee/%d", employeeID)
+func (s *SomeServer) fetchEmployee(ctx context.Context, employeeID domain.EmployeeID) (*domain.RemoteEmployee, error) {
+	url := fmt.Sprintf("%s/api/v1/employee/%s", s.APIURL, neturl.PathEscape(employeeID.String()))
 	_ = kit.LogDebugf(ctx, "fetching url %s", url)
 	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, kit.NewJSONStatusResponse(Error{err.Error()}, http.StatusInternalServerError)
+		return nil, err
 	}
-	res, err := s.HttpClient.Do(r)
+	res, err := s.httpClient().Do(r)
 	if err != nil {
-		// this is going to be nearly impossible to test without black magic. What if we needed to do something
-		// important in the error case?
-		return nil, kit.NewJSONStatusResponse(Error{err.Error()}, http.StatusInternalServerError)
+		return nil, err
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(res.Body)
-		_ = kit.LogErrorf(ctx, "unexpected response code, got %d with body %s", res.StatusCode, string(body))
-		return nil, kit.NewJSONStatusResponse(Error{"remote error encountered"}, http.StatusInternalServerError)
+		return nil, fmt.Errorf("unexpected response code, got %d with body %s", res.StatusCode, string(body))
+	}
+
+	ret := new(domain.RemoteEmployee)
+	if err := json.NewDecoder(res.Body).Decode(ret); err != nil {
+		return nil, err
 	}
+	return ret, nil
+}
 
-	remote := new(RemoteEmployee)
-	err = json.NewDecoder(res.Body).Decode(remote)
+func (s *SomeServer) getRequestID(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := domain.ParseEmployeeID(kit.Vars(r)["id"])
 	if err != nil {
-		return nil, kit.NewJSONStatusResponse(Error{err.Error()}, http.StatusInternalServerError)
+		loc := s.localizer(ctx)
+		return nil, invalidParams(loc, domain.InvalidParam{Name: "id", Reason: loc.Message("reason.malformed_employee_id")})
 	}
 
-	if remote.Data == nil {
-		return nil, kit.NewJSONStatusResponse(Error{"employee not found"}, http.StatusNotFound)
+	return id, nil
+}
+
+func (s *SomeServer) httpClient() *http.Client {
+	if s.HttpClient == nil {
+		return http.DefaultClient
 	}
+	return s.HttpClient
+}
 
-	ret := Employee{
-		ID:   strconv.Itoa(remote.Data.ID),
-		Name: remote.Data.EmployeeName,
-		Age:  remote.Data.EmployeeAge,
+func (s *SomeServer) localizer(ctx context.Context) *i18n.Localizer {
+	messages := s.Messages
+	if messages == nil {
+		messages = defaultMessages
 	}
+	return messages.Localizer(i18n.AcceptLanguage(ctx))
+}
 
-	birthYear := time.Now().Year() - remote.Data.EmployeeAge
+var defaultMessages = i18n.NewCatalog()
 
-	// this is gonna -suck- test test, so it probably won't happen
-	if birthYear <= 1924 {
-		ret.Generation = Greatest
-	} else if birthYear <= 1945 {
-		ret.Generation = Silent
-	} else if birthYear <= 1964 {
-		ret.Generation = BabyBoomer
-	} else if birthYear <= 1980 {
-		ret.Generation = GenX
-	} else if birthYear <= 1996 {
-		ret.Generation = Millennial
-	} else {
-		ret.Generation = GenZ
+func (s *SomeServer) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
 	}
-
-	return ret, nil
+	return s.Now()
 }
 
-func getRequestID(_ context.Context, r *http.Request) (request interface{}, err error) {
-	id, err := strconv.Atoi(kit.Vars(r)["id"])
-	if err != nil {
-		return nil, kit.NewJSONStatusResponse(Error{"employee not found"}, http.StatusNotFound)
+// encodeError writes problems as application/problem+json, anything that isn't one becomes a generic 500
+func (s *SomeServer) encodeError(ctx context.Context, err error, w http.ResponseWriter) {
+	loc := s.localizer(ctx)
+	problem, ok := err.(*domain.Error)
+	if !ok {
+		problem = internalError(loc)
+	}
+	body := *problem
+	if body.Instance == "" {
+		body.Instance, _ = ctx.Value(kithttp.ContextKeyRequestPath).(string)
 	}
 
-	return id, nil
+	w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+	w.Header().Set("Content-Language", loc.Language())
+	w.WriteHeader(body.Status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		_ = kit.LogErrorf(ctx, "error encoding error response: %s", err)
+	}
+}
+
+func (s *SomeServer) encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Language", s.localizer(ctx).Language())
+	return kithttp.EncodeJSONResponse(ctx, w, response)
 }
 
 func (s *SomeServer) Middleware(next endpoint.Endpoint) endpoint.Endpoint {
@@ -128,11 +182,20 @@ func (s *SomeServer) HTTPMiddleware(next http.Handler) http.Handler {
 }
 
 func (s *SomeServer) HTTPOptions() []kithttp.ServerOption {
-	return []kithttp.ServerOption{}
+	return []kithttp.ServerOption{
+		kithttp.ServerErrorEncoder(s.encodeError),
+		kithttp.ServerBefore(i18n.PopulateAcceptLanguage),
+	}
 }
 
 func (s *SomeServer) HTTPRouterOptions() []kit.RouterOption {
-	return []kit.RouterOption{}
+	return []kit.RouterOption{
+		kit.RouterSelect("gorilla"),
+		kit.RouterNotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := i18n.PopulateAcceptLanguage(r.Context(), r)
+			s.encodeError(ctx, routeNotFound(s.localizer(ctx)), w)
+		})),
+	}
 }
 
 func (s *SomeServer) HTTPEndpoints() map[string]map[string]kit.HTTPEndpoint {
@@ -140,7 +203,14 @@ func (s *SomeServer) HTTPEndpoints() map[string]map[string]kit.HTTPEndpoint {
 		"/employee/{id}": {
 			http.MethodGet: {
 				Endpoint: s.EmployeeEndpoint,
-				Decoder:  getRequestID,
+				Decoder:  s.getRequestID,
+				Encoder:  s.encodeResponse,
+			},
+		},
+		"/generations": {
+			http.MethodGet: {
+				Endpoint: s.GenerationsEndpoint,
+				Encoder:  s.encodeResponse,
 			},
 		},
 	}
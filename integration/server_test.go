@@ -8,8 +8,12 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/fakeupstream"
+	"github.com/jonsabados/unit-testing-party/i18n"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/publicsuffix"
 )
@@ -20,6 +24,22 @@ func TestEmployeeEndpoint(t *testing.T) {
 		panic(err)
 	}
 
+	messages, err := i18n.LoadDir("../i18n/locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the clock is pinned so generations stay put no matter when this runs
+	upstream := httptest.NewServer(fakeupstream.NewServer(fakeupstream.Config{
+		Employees: []domain.RemoteEmployeeData{
+			{ID: 1, EmployeeName: "Tiger Nixon", EmployeeSalary: 320800, EmployeeAge: 61},
+			{ID: 5, EmployeeName: "Airi Satou", EmployeeSalary: 162700, EmployeeAge: 33},
+		},
+	}))
+	defer upstream.Close()
+	failingUpstream := httptest.NewServer(fakeupstream.NewServer(fakeupstream.Config{ErrorRate: 1}))
+	defer failingUpstream.Close()
+
 	svc := SomeServer{
 		HttpClient: &http.Client{
 			Transport:     nil,
@@ -27,16 +47,26 @@ func TestEmployeeEndpoint(t *testing.T) {
 			Jar:           cookieJar, // at one point in time the sample api were using always errored on the first request. Seems fixed now but retain cookies in case it resurrects itself.
 			Timeout:       0,
 		},
+		APIURL: upstream.URL,
+		Now: func() time.Time {
+			return time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+		},
+		Messages: messages,
 	}
 	svr := kit.NewServer(&svc)
 	ts := httptest.NewServer(svr)
 	defer ts.Close()
 
-	doRequest := func(path string) (int, string) {
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", ts.URL, path), nil)
+	failingSvc := SomeServer{APIURL: failingUpstream.URL}
+	failingTS := httptest.NewServer(kit.NewServer(&failingSvc))
+	defer failingTS.Close()
+
+	doRequest := func(baseURL string, path string, acceptLanguage string) (int, string, string) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", baseURL, path), nil)
 		if err != nil {
 			panic(err)
 		}
+		req.Header.Set("Accept-Language", acceptLanguage)
 
 		res, err := http.DefaultClient.Do(req)
 		if err != nil {
@@ -49,38 +79,152 @@ func TestEmployeeEndpoint(t *testing.T) {
 			panic(err)
 		}
 
-		return res.StatusCode, string(bytes)
+		return res.StatusCode, res.Header.Get("Content-Type"), string(bytes)
 	}
 
 	testCases := []struct {
-		desc         string
-		toFetch      string
-		wantedStatus int
-		wantedBody   string
+		desc              string
+		baseURL           string
+		toFetch           string
+		acceptLanguage    string
+		wantedStatus      int
+		wantedContentType string
+		wantedBody        string
 	}{
 		{
 			"happy path baby boomer",
+			ts.URL,
 			"/employee/1",
+			"",
 			200,
-			`{"id":"1","employee_name":"Tiger Nixon","age":61,"generation":"Baby Boomer"}`,
+			"application/json; charset=utf-8",
+			`{"id":"1","employee_name":"Tiger Nixon","age":61,"generation":"Baby Boomer","generation_code":"baby_boomer","generation_label":"Baby Boomer"}`,
 		},
 		{
 			"happy path baby millennial",
+			ts.URL,
 			"/employee/5",
+			"",
 			200,
-			`{"id":"5","employee_name":"Airi Satou","age":33,"generation":"Millennial"}`,
+			"application/json; charset=utf-8",
+			`{"id":"5","employee_name":"Airi Satou","age":33,"generation":"Millennial","generation_code":"millennial","generation_label":"Millennial"}`,
+		},
+		{
+			"leading zeros",
+			ts.URL,
+			"/employee/005",
+			"",
+			200,
+			"application/json; charset=utf-8",
+			`{"id":"5","employee_name":"Airi Satou","age":33,"generation":"Millennial","generation_code":"millennial","generation_label":"Millennial"}`,
 		},
 		{
 			"non numeric",
+			ts.URL,
 			"/employee/BLAH",
+			"",
+			400,
+			"application/problem+json; charset=utf-8",
+			`{"type":"/problems/invalid-params","title":"Your request parameters didn't validate","status":400,"instance":"/employee/BLAH","invalid-params":[{"name":"id","reason":"malformed employee id"}]}`,
+		},
+		{
+			"signed",
+			ts.URL,
+			"/employee/+5",
+			"",
+			400,
+			"application/problem+json; charset=utf-8",
+			`{"type":"/problems/invalid-params","title":"Your request parameters didn't validate","status":400,"instance":"/employee/+5","invalid-params":[{"name":"id","reason":"malformed employee id"}]}`,
+		},
+		{
+			"prefixed not found",
+			ts.URL,
+			"/employee/EMP-0001",
+			"",
+			404,
+			"application/problem+json; charset=utf-8",
+			`{"type":"/problems/employee-not-found","title":"Employee not found","status":404,"detail":"no employee exists with id emp-1","instance":"/employee/EMP-0001"}`,
+		},
+		{
+			"uuid not found",
+			ts.URL,
+			"/employee/123E4567-E89B-12D3-A456-426614174000",
+			"",
 			404,
-			`{"message":"employee not found"}`,
+			"application/problem+json; charset=utf-8",
+			`{"type":"/problems/employee-not-found","title":"Employee not found","status":404,"detail":"no employee exists with id 123e4567-e89b-12d3-a456-426614174000","instance":"/employee/123E4567-E89B-12D3-A456-426614174000"}`,
 		},
 		{
 			"not found",
+			ts.URL,
 			"/employee/9999",
+			"",
 			404,
-			`{"message":"employee not found"}`,
+			"application/problem+json; charset=utf-8",
+			`{"type":"/problems/employee-not-found","title":"Employee not found","status":404,"detail":"no employee exists with id 9999","instance":"/employee/9999"}`,
+		},
+		{
+			"upstream failure",
+			failingTS.URL,
+			"/employee/1",
+			"",
+			500,
+			"application/problem+json; charset=utf-8",
+			`{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"something terrible happened","instance":"/employee/1"}`,
+		},
+		{
+			"generations",
+			ts.URL,
+			"/generations",
+			"",
+			200,
+			"application/json; charset=utf-8",
+			`[{"name":"Greatest","code":"greatest","label":"Greatest","to":1924},{"name":"Silent","code":"silent","label":"Silent","from":1925,"to":1945},{"name":"Baby Boomer","code":"baby_boomer","label":"Baby Boomer","from":1946,"to":1964},{"name":"Generation X","code":"gen_x","label":"Generation X","from":1965,"to":1980},{"name":"Millennial","code":"millennial","label":"Millennial","from":1981,"to":1996},{"name":"Generation Z","code":"gen_z","label":"Generation Z","from":1997}]`,
+		},
+		{
+			"unknown route",
+			ts.URL,
+			"/nope",
+			"",
+			404,
+			"application/problem+json; charset=utf-8",
+			`{"type":"/problems/route-not-found","title":"Not Found","status":404,"detail":"there is nothing here","instance":"/nope"}`,
+		},
+		{
+			"german",
+			ts.URL,
+			"/employee/1",
+			"de-DE",
+			200,
+			"application/json; charset=utf-8",
+			`{"id":"1","employee_name":"Tiger Nixon","age":61,"generation":"Baby Boomer","generation_code":"baby_boomer","generation_label":"Babyboomer"}`,
+		},
+		{
+			"spanish not found",
+			ts.URL,
+			"/employee/9999",
+			"es",
+			404,
+			"application/problem+json; charset=utf-8",
+			`{"type":"/problems/employee-not-found","title":"Empleado no encontrado","status":404,"detail":"no existe ningún empleado con el id 9999","instance":"/employee/9999"}`,
+		},
+		{
+			"spanish unknown route",
+			ts.URL,
+			"/nope",
+			"es",
+			404,
+			"application/problem+json; charset=utf-8",
+			`{"type":"/problems/route-not-found","title":"No encontrado","status":404,"detail":"aquí no hay nada","instance":"/nope"}`,
+		},
+		{
+			"language we don't speak",
+			ts.URL,
+			"/employee/1",
+			"fr",
+			200,
+			"application/json; charset=utf-8",
+			`{"id":"1","employee_name":"Tiger Nixon","age":61,"generation":"Baby Boomer","generation_code":"baby_boomer","generation_label":"Baby Boomer"}`,
 		},
 	}
 
@@ -88,8 +232,9 @@ func TestEmployeeEndpoint(t *testing.T) {
 		t.Run(tc.desc, func(t *testing.T) {
 			asserter := assert.New(t)
 
-			status, content := doRequest(tc.toFetch)
+			status, contentType, content := doRequest(tc.baseURL, tc.toFetch, tc.acceptLanguage)
 			asserter.Equal(tc.wantedStatus, status)
+			asserter.Equal(tc.wantedContentType, contentType)
 			asserter.Equal(tc.wantedBody, strings.Trim(content, "\n"))
 		})
 	}
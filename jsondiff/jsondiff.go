@@ -0,0 +1,85 @@
+// Package jsondiff compares decoded JSON documents and says where they differ, for golden files and for comparing
+// servers against each other.
+package jsondiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Diff lists the differences between two decoded JSON values, one line per path. Paths are written like $.a.b[2],
+// and nothing means they match.
+func Diff(expected interface{}, actual interface{}) []string {
+	return diffJSON("$", expected, actual)
+}
+
+func diffJSON(path string, expected interface{}, actual interface{}) []string {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]bool)
+		for k := range e {
+			keys[k] = true
+		}
+		for k := range a {
+			keys[k] = true
+		}
+		var sorted []string
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		var ret []string
+		for _, k := range sorted {
+			childPath := path + "." + k
+			ev, inExpected := e[k]
+			av, inActual := a[k]
+			switch {
+			case !inActual:
+				ret = append(ret, fmt.Sprintf("%s: missing, expected %s", childPath, describe(ev)))
+			case !inExpected:
+				ret = append(ret, fmt.Sprintf("%s: unexpected %s", childPath, describe(av)))
+			default:
+				ret = append(ret, diffJSON(childPath, ev, av)...)
+			}
+		}
+		return ret
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+		var ret []string
+		for i := 0; i < len(e) || i < len(a); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(a):
+				ret = append(ret, fmt.Sprintf("%s: missing, expected %s", childPath, describe(e[i])))
+			case i >= len(e):
+				ret = append(ret, fmt.Sprintf("%s: unexpected %s", childPath, describe(a[i])))
+			default:
+				ret = append(ret, diffJSON(childPath, e[i], a[i])...)
+			}
+		}
+		return ret
+	}
+
+	if reflect.DeepEqual(expected, actual) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: expected %s, got %s", path, describe(expected), describe(actual))}
+}
+
+func describe(v interface{}) string {
+	ret, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(ret)
+}
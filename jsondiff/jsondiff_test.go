@@ -0,0 +1,58 @@
+package jsondiff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		expected string
+		actual   string
+		diff     []string
+	}{
+		{
+			"same",
+			`{"a":1,"b":[true,null]}`,
+			`{"b":[true,null],"a":1}`,
+			nil,
+		},
+		{
+			"changed value",
+			`{"a":{"b":"x"}}`,
+			`{"a":{"b":"y"}}`,
+			[]string{`$.a.b: expected "x", got "y"`},
+		},
+		{
+			"added and removed fields",
+			`{"a":1,"gone":2}`,
+			`{"a":1,"new":{"x":3}}`,
+			[]string{`$.gone: missing, expected 2`, `$.new: unexpected {"x":3}`},
+		},
+		{
+			"arrays",
+			`{"a":[1,2,3]}`,
+			`{"a":[1,5]}`,
+			[]string{`$.a[1]: expected 2, got 5`, `$.a[2]: missing, expected 3`},
+		},
+		{
+			"type change",
+			`{"a":[1]}`,
+			`{"a":{"0":1}}`,
+			[]string{`$.a: expected [1], got {"0":1}`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			var expected, actual interface{}
+			asserter.NoError(json.Unmarshal([]byte(tc.expected), &expected))
+			asserter.NoError(json.Unmarshal([]byte(tc.actual), &actual))
+			asserter.Equal(tc.diff, Diff(expected, actual))
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/loadtest"
+)
+
+func main() {
+	url := flag.String("url", "http://localhost:8080", "base url of the server under test, the unit and integration servers both work")
+	concurrency := flag.Int("concurrency", 10, "requests in flight at once")
+	duration := flag.Duration("duration", 10*time.Second, "how long to run for")
+	rate := flag.Int("rate", 0, "requests per second to aim for, 0 for as fast as possible")
+	distribution := flag.String("distribution", "uniform", "how ids are picked, uniform or zipf")
+	maxID := flag.Int("max-id", 24, "ids are picked from 1 through this")
+	zipfS := flag.Float64("zipf-s", 1.1, "skew for the zipf distribution, must be > 1")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed for picking ids")
+	flag.Parse()
+
+	// the pickers panic on these rather than pick something nonsensical
+	if *maxID < 1 {
+		fmt.Fprintln(os.Stderr, "-max-id must be at least 1")
+		os.Exit(2)
+	}
+	if *distribution == "zipf" && *zipfS <= 1 {
+		fmt.Fprintln(os.Stderr, "-zipf-s must be greater than 1")
+		os.Exit(2)
+	}
+
+	var picker loadtest.IDPicker
+	switch *distribution {
+	case "uniform":
+		picker = loadtest.Uniform(*seed, *maxID)
+	case "zipf":
+		picker = loadtest.Zipf(*seed, *zipfS, *maxID)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown distribution %q\n", *distribution)
+		os.Exit(2)
+	}
+
+	// ctrl-c stops early but still reports what happened so far
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	res, err := loadtest.Run(ctx, loadtest.Config{
+		BaseURL:     *url,
+		Concurrency: *concurrency,
+		Duration:    *duration,
+		Rate:        *rate,
+		NextID:      picker,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := res.Report(os.Stdout); err != nil {
+		panic(err)
+	}
+}
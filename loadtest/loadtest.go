@@ -0,0 +1,237 @@
+// Package loadtest hammers /employee/{id} and reports how it held up. Both the unit and integration servers serve the
+// same route, so either can be pointed at.
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IDPicker hands out the next employee id to ask for. They get called from several goroutines at once, the ones made
+// here take care of locking.
+type IDPicker func() int
+
+// Uniform picks ids from 1 through max with equal odds, max must be at least 1
+func Uniform(seed int64, max int) IDPicker {
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(seed))
+	return func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return r.Intn(max) + 1
+	}
+}
+
+// Zipf picks ids from 1 through max with a long tail, so a handful of employees get most of the traffic like they
+// would in real life. s must be greater than 1, the bigger it is the hotter the hot ids are.
+func Zipf(seed int64, s float64, max int) IDPicker {
+	var mu sync.Mutex
+	z := rand.NewZipf(rand.New(rand.NewSource(seed)), s, 1, uint64(max-1))
+	return func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return int(z.Uint64()) + 1
+	}
+}
+
+type Config struct {
+	// BaseURL is where the server lives, eg http://localhost:8080
+	BaseURL string
+	// Concurrency is how many requests can be in flight at once
+	Concurrency int
+	// Duration is how long to keep going
+	Duration time.Duration
+	// Rate caps requests per second across all workers, zero means as fast as the server will go
+	Rate int
+	// NextID picks the employee for each request
+	NextID IDPicker
+	// Client defaults to one with a 10 second timeout and enough idle connections for Concurrency
+	Client *http.Client
+}
+
+type Result struct {
+	Requests int
+	// Errors are requests that didn't get a response at all, timeouts and refused connections and such
+	Errors   int
+	Statuses map[int]int
+	Elapsed  time.Duration
+	// Latencies is every request's latency, sorted
+	Latencies []time.Duration
+}
+
+// Percentile gives back the latency p percent of requests came in under, p being 0 - 100
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latencies))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(r.Latencies) {
+		i = len(r.Latencies) - 1
+	}
+	return r.Latencies[i]
+}
+
+// Throughput is completed requests per second
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+// ErrorRate is the share of requests that failed outright or got a 5xx. 404s are a perfectly good answer for an
+// employee that doesn't exist so they don't count.
+func (r *Result) ErrorRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	failed := r.Errors
+	for status, count := range r.Statuses {
+		if status >= 500 {
+			failed += count
+		}
+	}
+	return float64(failed) / float64(r.Requests)
+}
+
+func (r *Result) Report(w io.Writer) error {
+	var statuses []int
+	for status := range r.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+
+	lines := []string{
+		fmt.Sprintf("requests:    %d in %s", r.Requests, r.Elapsed.Round(time.Millisecond)),
+		fmt.Sprintf("throughput:  %.1f req/s", r.Throughput()),
+		fmt.Sprintf("error rate:  %.2f%% (%d without a response)", r.ErrorRate()*100, r.Errors),
+		fmt.Sprintf("latency:     p50 %s  p90 %s  p95 %s  p99 %s  max %s",
+			r.Percentile(50), r.Percentile(90), r.Percentile(95), r.Percentile(99), r.Percentile(100)),
+	}
+	for _, status := range statuses {
+		lines = append(lines, fmt.Sprintf("status %d:  %d", status, r.Statuses[status]))
+	}
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+type sample struct {
+	status  int
+	latency time.Duration
+	err     error
+}
+
+// Run sends requests until Duration is up or ctx is cancelled, whichever comes first
+func Run(ctx context.Context, cfg Config) (*Result, error) {
+	if cfg.Concurrency < 1 {
+		return nil, errors.New("concurrency must be at least 1")
+	}
+	if cfg.Duration <= 0 {
+		return nil, errors.New("duration must be positive")
+	}
+	if cfg.NextID == nil {
+		return nil, errors.New("an id picker is required")
+	}
+	// the ticker below gets a tick every second / Rate, past a billion that rounds down to nothing
+	if cfg.Rate > int(time.Second) {
+		return nil, errors.Errorf("rate can't be more than %d a second", int(time.Second))
+	}
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{MaxIdleConnsPerHost: cfg.Concurrency},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	// with a rate set workers wait their turn on a ticker, otherwise they just go
+	var tokens <-chan time.Time
+	if cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(cfg.Rate))
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+
+	samples := make(chan sample, cfg.Concurrency*2)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if tokens != nil {
+					select {
+					case <-tokens:
+					case <-ctx.Done():
+						return
+					}
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				s := fetch(ctx, client, fmt.Sprintf("%s/employee/%d", cfg.BaseURL, cfg.NextID()))
+				// requests cut off by the end of the run say nothing about the server
+				if ctx.Err() != nil {
+					return
+				}
+				samples <- s
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(samples)
+	}()
+
+	ret := &Result{Statuses: make(map[int]int)}
+	for s := range samples {
+		ret.Requests++
+		ret.Latencies = append(ret.Latencies, s.latency)
+		if s.err != nil {
+			ret.Errors++
+			continue
+		}
+		ret.Statuses[s.status]++
+	}
+	ret.Elapsed = time.Since(start)
+	sort.Slice(ret.Latencies, func(i, j int) bool {
+		return ret.Latencies[i] < ret.Latencies[j]
+	})
+	return ret, nil
+}
+
+func fetch(ctx context.Context, client *http.Client, url string) sample {
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return sample{err: err}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return sample{latency: time.Since(start), err: err}
+	}
+	// read the whole thing so the connection can be reused, and so latency includes the body
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	_ = res.Body.Close()
+	return sample{status: res.StatusCode, latency: time.Since(start)}
+}
@@ -0,0 +1,185 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUniform(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := Uniform(1, 10)
+	seen := make(map[int]int)
+	for i := 0; i < 10000; i++ {
+		seen[testInstance()]++
+	}
+	asserter.Len(seen, 10)
+	for id, count := range seen {
+		asserter.True(id >= 1 && id <= 10, "id %d", id)
+		asserter.InDelta(1000, count, 200, "id %d", id)
+	}
+}
+
+func TestZipf(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := Zipf(1, 1.5, 100)
+	seen := make(map[int]int)
+	for i := 0; i < 10000; i++ {
+		seen[testInstance()]++
+	}
+	for id := range seen {
+		asserter.True(id >= 1 && id <= 100, "id %d", id)
+	}
+	// the hot ids should be way hotter than the tail
+	asserter.True(seen[1] > seen[2], "%d vs %d", seen[1], seen[2])
+	asserter.True(seen[1] > 10*seen[50], "%d vs %d", seen[1], seen[50])
+}
+
+func TestResult(t *testing.T) {
+	asserter := assert.New(t)
+
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	testInstance := &Result{
+		Requests:  100,
+		Errors:    2,
+		Statuses:  map[int]int{200: 80, 404: 10, 500: 5, 503: 3},
+		Elapsed:   2 * time.Second,
+		Latencies: latencies,
+	}
+
+	asserter.Equal(time.Millisecond, testInstance.Percentile(0))
+	asserter.Equal(50*time.Millisecond, testInstance.Percentile(50))
+	asserter.Equal(99*time.Millisecond, testInstance.Percentile(99))
+	asserter.Equal(100*time.Millisecond, testInstance.Percentile(100))
+	asserter.Equal(50.0, testInstance.Throughput())
+	asserter.InDelta(0.1, testInstance.ErrorRate(), 0.0001)
+
+	out := new(bytes.Buffer)
+	asserter.NoError(testInstance.Report(out))
+	asserter.Equal(`requests:    100 in 2s
+throughput:  50.0 req/s
+error rate:  10.00% (2 without a response)
+latency:     p50 50ms  p90 90ms  p95 95ms  p99 99ms  max 100ms
+status 200:  80
+status 404:  10
+status 500:  5
+status 503:  3
+`, out.String())
+
+	empty := &Result{}
+	asserter.Equal(time.Duration(0), empty.Percentile(50))
+	asserter.Equal(0.0, empty.Throughput())
+	asserter.Equal(0.0, empty.ErrorRate())
+}
+
+func TestRun(t *testing.T) {
+	asserter := assert.New(t)
+
+	var mu sync.Mutex
+	requested := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path]++
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/3") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer ts.Close()
+
+	res, err := Run(context.Background(), Config{
+		BaseURL:     ts.URL,
+		Concurrency: 4,
+		Duration:    200 * time.Millisecond,
+		NextID:      Uniform(1, 3),
+	})
+	asserter.NoError(err)
+	asserter.NotZero(res.Requests)
+	asserter.Equal(res.Requests, res.Statuses[200]+res.Statuses[500])
+	asserter.Len(res.Latencies, res.Requests)
+	asserter.Zero(res.Errors)
+	asserter.InDelta(1.0/3, res.ErrorRate(), 0.15)
+	asserter.True(res.Elapsed >= 200*time.Millisecond, "elapsed %s", res.Elapsed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for path := range requested {
+		id, err := strconv.Atoi(strings.TrimPrefix(path, "/employee/"))
+		asserter.NoError(err, path)
+		asserter.True(id >= 1 && id <= 3, path)
+	}
+}
+
+func TestRun_Rate(t *testing.T) {
+	asserter := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	res, err := Run(context.Background(), Config{
+		BaseURL:     ts.URL,
+		Concurrency: 8,
+		Duration:    500 * time.Millisecond,
+		Rate:        40,
+		NextID:      Uniform(1, 3),
+	})
+	asserter.NoError(err)
+	// 40 a second for half a second, give or take a tick
+	asserter.InDelta(20, res.Requests, 3)
+}
+
+func TestRun_ServerDown(t *testing.T) {
+	asserter := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+
+	res, err := Run(context.Background(), Config{
+		BaseURL:     ts.URL,
+		Concurrency: 2,
+		Duration:    100 * time.Millisecond,
+		Rate:        50,
+		NextID:      Uniform(1, 3),
+	})
+	asserter.NoError(err)
+	asserter.NotZero(res.Requests)
+	asserter.Equal(res.Requests, res.Errors)
+	asserter.Equal(1.0, res.ErrorRate())
+}
+
+func TestRun_BadConfig(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		cfg         Config
+		expectedErr string
+	}{
+		{"no concurrency", Config{Duration: time.Second, NextID: Uniform(1, 1)}, "concurrency must be at least 1"},
+		{"no duration", Config{Concurrency: 1, NextID: Uniform(1, 1)}, "duration must be positive"},
+		{"no picker", Config{Concurrency: 1, Duration: time.Second}, "an id picker is required"},
+		{"rate too high", Config{Concurrency: 1, Duration: time.Second, NextID: Uniform(1, 1), Rate: int(time.Second) + 1}, "rate can't be more than 1000000000 a second"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			res, err := Run(context.Background(), tc.cfg)
+			asserter.EqualError(err, tc.expectedErr)
+			asserter.Nil(res)
+		})
+	}
+}
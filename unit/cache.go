@@ -0,0 +1,137 @@
+package unit
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+)
+
+type contextKey int
+
+const (
+	contextKeyIfNoneMatch contextKey = iota
+	contextKeyIfModifiedSince
+)
+
+// populateConditionalHeaders is a kit ServerBefore func, go-kit doesn't stash the conditional request headers in the
+// context for us and encoders only get the context, not the request
+func populateConditionalHeaders(ctx context.Context, r *http.Request) context.Context {
+	ctx = context.WithValue(ctx, contextKeyIfNoneMatch, r.Header.Get("If-None-Match"))
+	return context.WithValue(ctx, contextKeyIfModifiedSince, r.Header.Get("If-Modified-Since"))
+}
+
+// EmployeeETag computes a weak ETag for an employee. It's weak because the same employee can be rendered as JSON, XML
+// etc, and those are all semantically the same thing even though the bytes differ.
+func EmployeeETag(employee *domain.Employee) string {
+	// json.Marshal of a struct is deterministic, so this is stable for the same data
+	bytes, err := json.Marshal(employee)
+	if err != nil {
+		// can't happen with the fields Employee has, but if it ever does no ETag beats a bogus one
+		return ""
+	}
+	sum := sha256.Sum256(bytes)
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(sum[:16]))
+}
+
+// etagMatches does the weak comparison from RFC 7232 against an If-None-Match header value
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified decides if a 304 is in order. If-Modified-Since is only looked at when If-None-Match is absent, per
+// RFC 7232 section 6.
+func notModified(ctx context.Context, etag string, lastModified time.Time) bool {
+	if ifNoneMatch, _ := ctx.Value(contextKeyIfNoneMatch).(string); ifNoneMatch != "" {
+		return etag != "" && etagMatches(ifNoneMatch, etag)
+	}
+	if ifModifiedSince, _ := ctx.Value(contextKeyIfModifiedSince).(string); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// lastModifiedTrackerMaxEntries is how many employee representations lastModifiedTracker remembers by default. An
+// entry is a few dozen bytes, so this is a couple of MB at worst.
+const lastModifiedTrackerMaxEntries = 50000
+
+// lastModifiedTracker remembers when we first saw each version of an employee. The upstream doesn't tell us when
+// anything changed, so the best we can do for Last-Modified is "the first time this server saw this ETag". It only
+// holds on to the most recently used entries, anything pushed out just gets a fresh Last-Modified next time it's
+// seen, which costs clients a full response rather than being wrong. The zero value is ready to use.
+type lastModifiedTracker struct {
+	// maxEntries defaults to lastModifiedTrackerMaxEntries
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// recent has the most recently observed entry at the front, and what to forget next at the back
+	recent *list.List
+}
+
+type lastModifiedEntry struct {
+	key  string
+	etag string
+	at   time.Time
+}
+
+// observe records the etag for the given key, and returns when it was first seen. Keys should only ever be for
+// employees that actually exist, so made up ids can't push real employees out.
+func (l *lastModifiedTracker) observe(key string, etag string, now time.Time) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.entries == nil {
+		l.entries = make(map[string]*list.Element)
+		l.recent = list.New()
+	}
+	if element, ok := l.entries[key]; ok {
+		l.recent.MoveToFront(element)
+		existing := element.Value.(*lastModifiedEntry)
+		if existing.etag != etag {
+			existing.etag = etag
+			existing.at = now
+		}
+		return existing.at
+	}
+
+	l.entries[key] = l.recent.PushFront(&lastModifiedEntry{key, etag, now})
+	maxEntries := l.maxEntries
+	if maxEntries <= 0 {
+		maxEntries = lastModifiedTrackerMaxEntries
+	}
+	for l.recent.Len() > maxEntries {
+		oldest := l.recent.Back()
+		l.recent.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lastModifiedEntry).key)
+	}
+	return now
+}
+
+func cacheControl(maxAge time.Duration) string {
+	if maxAge <= 0 {
+		// still cacheable, but clients need to check back with us (which is cheap thanks to the ETag)
+		return "no-cache"
+	}
+	return fmt.Sprintf("max-age=%d", int(maxAge.Seconds()))
+}
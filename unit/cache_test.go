@@ -0,0 +1,159 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmployeeETag(t *testing.T) {
+	asserter := assert.New(t)
+
+	bob := &domain.Employee{ID: "1", Name: "Bob", Age: 20, Generation: domain.GenZ}
+	sameBob := &domain.Employee{ID: "1", Name: "Bob", Age: 20, Generation: domain.GenZ}
+	olderBob := &domain.Employee{ID: "1", Name: "Bob", Age: 21, Generation: domain.GenZ}
+
+	asserter.Regexp(`^W/"[0-9a-f]{32}"$`, EmployeeETag(bob))
+	asserter.Equal(EmployeeETag(bob), EmployeeETag(sameBob))
+	asserter.NotEqual(EmployeeETag(bob), EmployeeETag(olderBob))
+}
+
+func TestNotModified(t *testing.T) {
+	lastModified := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	etag := `W/"abc"`
+
+	testCases := []struct {
+		desc            string
+		ifNoneMatch     string
+		ifModifiedSince string
+		expected        bool
+	}{
+		{
+			"no conditional headers",
+			"",
+			"",
+			false,
+		},
+		{
+			"etag match",
+			`W/"abc"`,
+			"",
+			true,
+		},
+		{
+			"strong form of weak etag",
+			`"abc"`,
+			"",
+			true,
+		},
+		{
+			"etag in list",
+			`"nope", W/"abc"`,
+			"",
+			true,
+		},
+		{
+			"wildcard",
+			"*",
+			"",
+			true,
+		},
+		{
+			"etag mismatch",
+			`W/"xyz"`,
+			"",
+			false,
+		},
+		{
+			"etag mismatch wins over matching date",
+			`W/"xyz"`,
+			lastModified.Format(http.TimeFormat),
+			false,
+		},
+		{
+			"modified since exact",
+			"",
+			lastModified.Format(http.TimeFormat),
+			true,
+		},
+		{
+			"modified since later",
+			"",
+			lastModified.Add(time.Hour).Format(http.TimeFormat),
+			true,
+		},
+		{
+			"modified since earlier",
+			"",
+			lastModified.Add(-time.Second).Format(http.TimeFormat),
+			false,
+		},
+		{
+			"garbage date",
+			"",
+			"last tuesday",
+			false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			asserter.NoError(err)
+			if tc.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			if tc.ifModifiedSince != "" {
+				r.Header.Set("If-Modified-Since", tc.ifModifiedSince)
+			}
+			ctx := populateConditionalHeaders(context.Background(), r)
+
+			asserter.Equal(tc.expected, notModified(ctx, etag, lastModified.Add(500*time.Millisecond)))
+		})
+	}
+}
+
+func TestLastModifiedTracker(t *testing.T) {
+	asserter := assert.New(t)
+
+	first := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	second := first.Add(time.Hour)
+	third := second.Add(time.Hour)
+
+	testInstance := lastModifiedTracker{}
+	asserter.Equal(first, testInstance.observe("1", "a", first))
+	asserter.Equal(first, testInstance.observe("1", "a", second))
+	asserter.Equal(second, testInstance.observe("2", "a", second))
+	asserter.Equal(third, testInstance.observe("1", "b", third))
+}
+
+func TestLastModifiedTracker_ForgetsLeastRecentlyUsed(t *testing.T) {
+	asserter := assert.New(t)
+
+	first := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	testInstance := lastModifiedTracker{maxEntries: 2}
+	testInstance.observe("1", "a", first)
+	testInstance.observe("2", "a", first)
+	// 1 gets used again, so 2 is the one to go when 3 shows up
+	asserter.Equal(first, testInstance.observe("1", "a", second))
+	asserter.Equal(second, testInstance.observe("3", "a", second))
+
+	asserter.Len(testInstance.entries, 2)
+	asserter.Equal(first, testInstance.observe("1", "a", second))
+	asserter.Equal(second, testInstance.observe("2", "a", second))
+	asserter.Len(testInstance.entries, 2)
+}
+
+func TestCacheControl(t *testing.T) {
+	asserter := assert.New(t)
+
+	asserter.Equal("no-cache", cacheControl(0))
+	asserter.Equal("max-age=90", cacheControl(90*time.Second))
+}
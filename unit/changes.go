@@ -0,0 +1,336 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/i18n"
+	"github.com/pkg/errors"
+)
+
+// The service is pull only, so anybody wanting to know when somebody moves into another generation has to keep asking.
+// The change feed diffs each roster snapshot the syncer pulls against the one before it, and hands what changed to
+// whoever is listening: server-sent event streams at /employees/changes and webhook dispatchers. Changes are only
+// spotted as often as the syncer runs, and only the most recent ones are kept around for clients catching up.
+
+const (
+	defaultChangeHistory = 1000
+	// subscriberBuffer is how many snapshots' worth of changes a subscriber can fall behind by before it gets cut off,
+	// it can pick back up from the history with the id of the last change it saw
+	subscriberBuffer      = 16
+	changeStreamHeartbeat = 15 * time.Second
+)
+
+type ChangeFeed struct {
+	mapper  EmployeeConverter
+	history int
+	// Now is here so tests can control time, if left nil time.Now is used
+	Now func() time.Time
+
+	mu sync.Mutex
+	// known is everybody as of the last snapshot, nil until the first one shows up
+	known       map[string]domain.Employee
+	knownOrder  []string
+	recent      []domain.EmployeeChange
+	subscribers map[*ChangeSubscription]struct{}
+}
+
+// NewChangeFeed diffs snapshots using mapper, remembering the most recent history changes for clients catching up. A
+// history of zero or less gets the default of 1000.
+func NewChangeFeed(mapper EmployeeConverter, history int) *ChangeFeed {
+	if history <= 0 {
+		history = defaultChangeHistory
+	}
+	return &ChangeFeed{
+		mapper:      mapper,
+		history:     history,
+		subscribers: make(map[*ChangeSubscription]struct{}),
+	}
+}
+
+func (f *ChangeFeed) now() time.Time {
+	if f.Now == nil {
+		return time.Now()
+	}
+	return f.Now()
+}
+
+// Observe diffs a snapshot against the last one seen and publishes the changes. The first snapshot is the baseline,
+// there's nothing to compare it to so it doesn't publish anything. It fits Syncer.OnSnapshot.
+func (f *ChangeFeed) Observe(snapshot *Snapshot) error {
+	current := make(map[string]domain.Employee, len(snapshot.Employees))
+	order := make([]string, 0, len(snapshot.Employees))
+	for i := range snapshot.Employees {
+		employee, err := f.mapper(&domain.RemoteEmployee{Status: "success", Data: &snapshot.Employees[i]})
+		if err != nil {
+			// publishing half a diff would announce everybody after this as removed, better to wait for the next one
+			return errors.Wrapf(err, "mapping employee %d", snapshot.Employees[i].ID)
+		}
+		if _, dupe := current[employee.ID]; !dupe {
+			order = append(order, employee.ID)
+		}
+		current[employee.ID] = *employee
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	previous, previousOrder := f.known, f.knownOrder
+	f.known, f.knownOrder = current, order
+	if previous == nil {
+		return nil
+	}
+
+	at := f.now()
+	var changes []domain.EmployeeChange
+	add := func(change domain.EmployeeChange) {
+		change.ID = changeCursor{snapshot.Version, len(changes) + 1}.String()
+		change.Version = snapshot.Version
+		change.At = at
+		changes = append(changes, change)
+	}
+	for _, id := range order {
+		after := current[id]
+		before, existed := previous[id]
+		if !existed {
+			add(domain.EmployeeChange{Type: domain.ChangeAdded, EmployeeID: id, After: &after})
+		} else if diff := domain.DiffEmployee(before, after); len(diff) > 0 {
+			add(domain.EmployeeChange{Type: domain.ChangeChanged, EmployeeID: id, Before: &before, After: &after, Changes: diff})
+		}
+	}
+	for _, id := range previousOrder {
+		if _, stillHere := current[id]; !stillHere {
+			before := previous[id]
+			add(domain.EmployeeChange{Type: domain.ChangeRemoved, EmployeeID: id, Before: &before})
+		}
+	}
+
+	f.recent = append(f.recent, changes...)
+	if over := len(f.recent) - f.history; over > 0 {
+		f.recent = append([]domain.EmployeeChange{}, f.recent[over:]...)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	for sub := range f.subscribers {
+		select {
+		case sub.ch <- changes:
+		default:
+			// fell too far behind, cutting it off beats holding everybody else up
+			f.drop(sub)
+		}
+	}
+	return nil
+}
+
+// Latest is the id of the most recent change, or 0-0 if there hasn't been one. Subscribing from it picks up everything
+// published after this call, even if it happens before Subscribe gets called.
+func (f *ChangeFeed) Latest() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.recent) == 0 {
+		return changeCursor{}.String()
+	}
+	return f.recent[len(f.recent)-1].ID
+}
+
+// Subscribe starts listening for changes. With an empty lastID that's changes from here on, otherwise anything still
+// in the history that came after lastID gets replayed first. Close the subscription when done with it.
+func (f *ChangeFeed) Subscribe(lastID string) (*ChangeSubscription, error) {
+	var since *changeCursor
+	if lastID != "" {
+		c, err := parseChangeCursor(lastID)
+		if err != nil {
+			return nil, err
+		}
+		since = &c
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ret := &ChangeSubscription{feed: f, ch: make(chan []domain.EmployeeChange, subscriberBuffer)}
+	ret.C = ret.ch
+	if since != nil {
+		for _, change := range f.recent {
+			// ids in the history are ours, they parse
+			if c, _ := parseChangeCursor(change.ID); since.before(c) {
+				ret.Replay = append(ret.Replay, change)
+			}
+		}
+	}
+	f.subscribers[ret] = struct{}{}
+	return ret, nil
+}
+
+// drop cuts off a subscriber, callers need to hold the lock
+func (f *ChangeFeed) drop(sub *ChangeSubscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.ch)
+	delete(f.subscribers, sub)
+}
+
+type ChangeSubscription struct {
+	// Replay is what was missed since the id subscribed from, oldest first
+	Replay []domain.EmployeeChange
+	// C gets the changes from each snapshot as they're published, oldest first. It gets closed if the subscriber falls
+	// too far behind, resubscribe with the id of the last change seen to pick back up.
+	C <-chan []domain.EmployeeChange
+
+	feed   *ChangeFeed
+	ch     chan []domain.EmployeeChange
+	closed bool
+}
+
+func (s *ChangeSubscription) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	s.feed.drop(s)
+}
+
+// changeCursor is a change id picked apart, version is the snapshot the change was spotted in and n counts up from 1
+// within it. Snapshot versions survive restarts, so ids from before one still mean something after it.
+type changeCursor struct {
+	version int64
+	n       int
+}
+
+func parseChangeCursor(id string) (changeCursor, error) {
+	parts := strings.Split(id, "-")
+	if len(parts) == 2 {
+		version, vErr := strconv.ParseInt(parts[0], 10, 64)
+		n, nErr := strconv.Atoi(parts[1])
+		if vErr == nil && nErr == nil && version >= 0 && n >= 0 {
+			return changeCursor{version, n}, nil
+		}
+	}
+	return changeCursor{}, errors.Errorf("%q isn't a change id, they look like 12-3", id)
+}
+
+func (c changeCursor) String() string {
+	return fmt.Sprintf("%d-%d", c.version, c.n)
+}
+
+func (c changeCursor) before(other changeCursor) bool {
+	if c.version != other.version {
+		return c.version < other.version
+	}
+	return c.n < other.n
+}
+
+func (s *SomeServer) decodeChanges(ctx context.Context, r *http.Request) (interface{}, error) {
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID != "" {
+		if _, err := parseChangeCursor(lastID); err != nil {
+			return nil, invalidParamsProblem(invalidParam(s.localizer(ctx), "Last-Event-ID", "change_id", lastID))
+		}
+	}
+	return lastID, nil
+}
+
+// ChangesEndpoint subscribes to the change feed, encodeChanges does the actual streaming
+func (s *SomeServer) ChangesEndpoint(ctx context.Context, req interface{}) (interface{}, error) {
+	sub, err := s.Changes.Subscribe(req.(string))
+	if err != nil {
+		// decodeChanges already turned away anything that doesn't parse, so this shouldn't happen
+		return nil, invalidParamsProblem(invalidParam(s.localizer(ctx), "Last-Event-ID", "change_id", req))
+	}
+	return sub, nil
+}
+
+// encodeChanges streams changes as server-sent events until the client goes away. A client that falls too far behind
+// gets disconnected, EventSource reconnects on its own with Last-Event-ID set and picks up where it left off.
+func (s *SomeServer) encodeChanges(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	sub := response.(*ChangeSubscription)
+	defer sub.Close()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("response writer can't flush, unable to stream changes")
+	}
+	loc := s.localizer(ctx)
+	setContentLanguage(w, loc)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx and friends buffer responses unless told not to, which would hold events up indefinitely
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// a comment, so clients know they're subscribed before anything has changed
+	if err := writeSSE(w, flusher, ": subscribed\n\n"); err != nil {
+		return nil
+	}
+	for _, change := range sub.Replay {
+		if err := writeChangeEvent(w, flusher, loc, change); err != nil {
+			return nil
+		}
+	}
+
+	heartbeat := time.NewTicker(changeStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case changes, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			for _, change := range changes {
+				if err := writeChangeEvent(w, flusher, loc, change); err != nil {
+					return nil
+				}
+			}
+		case <-heartbeat.C:
+			// keeps proxies from deciding the connection is idle
+			if err := writeSSE(w, flusher, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func writeChangeEvent(w http.ResponseWriter, flusher http.Flusher, loc *i18n.Localizer, change domain.EmployeeChange) error {
+	raw, err := json.Marshal(localizeChange(loc, change))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return writeSSE(w, flusher, fmt.Sprintf("id: %s\nevent: %s\ndata: %s\n\n", change.ID, change.Type, raw))
+}
+
+func writeSSE(w http.ResponseWriter, flusher http.Flusher, s string) error {
+	if _, err := w.Write([]byte(s)); err != nil {
+		return errors.WithStack(err)
+	}
+	flusher.Flush()
+	return nil
+}
+
+// localizeChange fills in generation codes and labels on copies of the employees, the originals are shared with every
+// other subscriber
+func localizeChange(loc *i18n.Localizer, change domain.EmployeeChange) domain.EmployeeChange {
+	if change.Before != nil {
+		before := loc.Employee(*change.Before)
+		change.Before = &before
+	}
+	if change.After != nil {
+		after := loc.Employee(*change.After)
+		change.After = &after
+	}
+	return change
+}
+
+// encodeStreamError sends problems as JSON whatever the client asked for, an event stream has no way of carrying one
+// and negotiating would turn every error into a 406
+func (s *SomeServer) encodeStreamError(ctx context.Context, err error, w http.ResponseWriter) {
+	s.encodeError(context.WithValue(ctx, kithttp.ContextKeyRequestAccept, "application/json"), err, w)
+}
@@ -0,0 +1,369 @@
+package unit_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/fakeupstream"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// ageMapper puts everybody 60 and up in the boomers and everybody else in gen x, so tests don't change as years go by
+func ageMapper(employee *domain.RemoteEmployee) (*domain.Employee, error) {
+	generation := domain.GenX
+	if employee.Data.EmployeeAge >= 60 {
+		generation = domain.BabyBoomer
+	}
+	return &domain.Employee{
+		ID:         strconv.Itoa(employee.Data.ID),
+		Name:       employee.Data.EmployeeName,
+		Age:        employee.Data.EmployeeAge,
+		Generation: generation,
+	}, nil
+}
+
+func rosterSnapshot(version int64, employees ...domain.RemoteEmployeeData) *unit.Snapshot {
+	return &unit.Snapshot{Format: 1, Version: version, TakenAt: syncTime, Employees: employees}
+}
+
+func rosterEmployee(id int, name string, age int) domain.RemoteEmployeeData {
+	return domain.RemoteEmployeeData{ID: id, EmployeeName: name, EmployeeAge: age}
+}
+
+// newChangeFeed has seen a baseline at version 1 and then version 2, where Tiger Nixon turned 60, Cedric Kelly was
+// hired and Ashton Cox left
+func newChangeFeed(t *testing.T, history int) *unit.ChangeFeed {
+	ret := unit.NewChangeFeed(ageMapper, history)
+	ret.Now = func() time.Time {
+		return syncTime
+	}
+	for _, snapshot := range []*unit.Snapshot{
+		rosterSnapshot(1, rosterEmployee(1, "Tiger Nixon", 59), rosterEmployee(2, "Garrett Winters", 40), rosterEmployee(3, "Ashton Cox", 30)),
+		rosterSnapshot(2, rosterEmployee(1, "Tiger Nixon", 60), rosterEmployee(2, "Garrett Winters", 40), rosterEmployee(4, "Cedric Kelly", 22)),
+	} {
+		if err := ret.Observe(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ret
+}
+
+func changeIDs(changes []domain.EmployeeChange) []string {
+	ret := []string{}
+	for _, c := range changes {
+		ret = append(ret, c.ID)
+	}
+	return ret
+}
+
+func TestChangeFeed_Observe(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := unit.NewChangeFeed(ageMapper, 0)
+	testInstance.Now = func() time.Time {
+		return syncTime
+	}
+	sub, err := testInstance.Subscribe("")
+	asserter.NoError(err)
+	defer sub.Close()
+
+	asserter.NoError(testInstance.Observe(rosterSnapshot(1, rosterEmployee(1, "Tiger Nixon", 59), rosterEmployee(2, "Garrett Winters", 40), rosterEmployee(3, "Ashton Cox", 30))))
+	asserter.Len(sub.C, 0, "the first snapshot is the baseline, nothing changed")
+	asserter.Equal("0-0", testInstance.Latest())
+
+	asserter.NoError(testInstance.Observe(rosterSnapshot(2, rosterEmployee(1, "Tiger Nixon", 60), rosterEmployee(2, "Garrett Winters", 40), rosterEmployee(4, "Cedric Kelly", 22))))
+	var actual []domain.EmployeeChange
+	for len(sub.C) > 0 {
+		actual = append(actual, <-sub.C...)
+	}
+	asserter.Equal([]domain.EmployeeChange{
+		{
+			ID:         "2-1",
+			Type:       domain.ChangeChanged,
+			EmployeeID: "1",
+			Version:    2,
+			At:         syncTime,
+			Before:     &domain.Employee{ID: "1", Name: "Tiger Nixon", Age: 59, Generation: domain.GenX},
+			After:      &domain.Employee{ID: "1", Name: "Tiger Nixon", Age: 60, Generation: domain.BabyBoomer},
+			Changes: []domain.FieldChange{
+				{Field: "age", From: "59", To: "60"},
+				{Field: "generation", From: "Generation X", To: "Baby Boomer"},
+			},
+		},
+		{
+			ID:         "2-2",
+			Type:       domain.ChangeAdded,
+			EmployeeID: "4",
+			Version:    2,
+			At:         syncTime,
+			After:      &domain.Employee{ID: "4", Name: "Cedric Kelly", Age: 22, Generation: domain.GenX},
+		},
+		{
+			ID:         "2-3",
+			Type:       domain.ChangeRemoved,
+			EmployeeID: "3",
+			Version:    2,
+			At:         syncTime,
+			Before:     &domain.Employee{ID: "3", Name: "Ashton Cox", Age: 30, Generation: domain.GenX},
+		},
+	}, actual)
+	asserter.Equal("2-3", testInstance.Latest())
+
+	// same again is no news
+	asserter.NoError(testInstance.Observe(rosterSnapshot(3, rosterEmployee(1, "Tiger Nixon", 60), rosterEmployee(2, "Garrett Winters", 40), rosterEmployee(4, "Cedric Kelly", 22))))
+	asserter.Len(sub.C, 0)
+}
+
+func TestChangeFeed_MappingFailure(t *testing.T) {
+	asserter := assert.New(t)
+
+	fail := false
+	testInstance := unit.NewChangeFeed(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
+		if fail && employee.Data.ID == 2 {
+			return nil, assert.AnError
+		}
+		return ageMapper(employee)
+	}, 0)
+	asserter.NoError(testInstance.Observe(rosterSnapshot(1, rosterEmployee(1, "Tiger Nixon", 59), rosterEmployee(2, "Garrett Winters", 40))))
+
+	fail = true
+	asserter.Error(testInstance.Observe(rosterSnapshot(2, rosterEmployee(1, "Tiger Nixon", 60), rosterEmployee(2, "Garrett Winters", 40))))
+	asserter.Equal("0-0", testInstance.Latest(), "nobody should have been announced as removed")
+
+	// the next one that works gets diffed against the last one that did
+	fail = false
+	asserter.NoError(testInstance.Observe(rosterSnapshot(3, rosterEmployee(1, "Tiger Nixon", 60), rosterEmployee(2, "Garrett Winters", 40))))
+	asserter.Equal("3-1", testInstance.Latest())
+}
+
+func TestChangeFeed_Subscribe(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		history  int
+		lastID   string
+		expected []string
+	}{
+		{"from now", 0, "", []string{}},
+		{"from the start", 0, "0-0", []string{"2-1", "2-2", "2-3", "3-1"}},
+		{"part way through a version", 0, "2-1", []string{"2-2", "2-3", "3-1"}},
+		{"end of a version", 0, "2-3", []string{"3-1"}},
+		{"up to date", 0, "3-1", []string{}},
+		{"from the future", 0, "9-1", []string{}},
+		{"history only goes back so far", 2, "0-0", []string{"2-3", "3-1"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			testInstance := newChangeFeed(t, tc.history)
+			asserter.NoError(testInstance.Observe(rosterSnapshot(3, rosterEmployee(1, "Tiger Nixon", 60), rosterEmployee(2, "Garrett Winters", 41), rosterEmployee(4, "Cedric Kelly", 22))))
+
+			sub, err := testInstance.Subscribe(tc.lastID)
+			asserter.NoError(err)
+			defer sub.Close()
+			asserter.Equal(tc.expected, changeIDs(sub.Replay))
+		})
+	}
+
+	_, err := unit.NewChangeFeed(ageMapper, 0).Subscribe("nope")
+	assert.Error(t, err)
+}
+
+func TestChangeFeed_SlowSubscriber(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := unit.NewChangeFeed(ageMapper, 0)
+	asserter.NoError(testInstance.Observe(rosterSnapshot(1, rosterEmployee(1, "Tiger Nixon", 20))))
+	sub, err := testInstance.Subscribe("")
+	asserter.NoError(err)
+	keepingUp, err := testInstance.Subscribe("")
+	asserter.NoError(err)
+	defer keepingUp.Close()
+
+	// Tiger has a birthday every sync, keepingUp reads each one as it comes in and sub doesn't read at all
+	for version := 2; version <= 30; version++ {
+		asserter.NoError(testInstance.Observe(rosterSnapshot(int64(version), rosterEmployee(1, "Tiger Nixon", 20+version))))
+		select {
+		case changes, ok := <-keepingUp.C:
+			if asserter.True(ok, "the subscriber keeping up got cut off at version %d", version) {
+				asserter.Equal(strconv.Itoa(version)+"-1", changes[0].ID)
+			}
+		default:
+			asserter.Fail("nothing published", "version %d", version)
+		}
+	}
+
+	var got []domain.EmployeeChange
+	for changes := range sub.C {
+		got = append(got, changes...)
+	}
+	asserter.True(len(got) < 29, "should have been cut off, got all %d", len(got))
+
+	// and it can pick back up where it left off
+	resumed, err := testInstance.Subscribe(got[len(got)-1].ID)
+	asserter.NoError(err)
+	defer resumed.Close()
+	asserter.Len(append(got, resumed.Replay...), 29)
+}
+
+func TestChangeFeed_FromSyncer(t *testing.T) {
+	asserter := assert.New(t)
+
+	upstream, fetcher := newSyncUpstream(t)
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	syncer := newSyncer(fetcher, path)
+	testInstance := unit.NewChangeFeed(ageMapper, 0)
+	syncer.OnSnapshot = testInstance.Observe
+
+	asserter.NoError(syncer.Sync(testutil.NewTestContext()))
+	upstream.Update(func(cfg *fakeupstream.Config) {
+		cfg.Employees[1].EmployeeAge = 70
+	})
+	asserter.NoError(syncer.Sync(testutil.NewTestContext()))
+	sub, err := testInstance.Subscribe("0-0")
+	asserter.NoError(err)
+	defer sub.Close()
+	if asserter.Len(sub.Replay, 1) {
+		asserter.Equal("2-1", sub.Replay[0].ID)
+		asserter.Equal("2", sub.Replay[0].EmployeeID)
+		asserter.Equal(domain.BabyBoomer, sub.Replay[0].After.Generation)
+	}
+
+	// after a restart the snapshot on disk is the baseline, so changes made while we were down still get noticed
+	upstream.Update(func(cfg *fakeupstream.Config) {
+		cfg.Employees = cfg.Employees[1:]
+	})
+	restarted := newSyncer(fetcher, path)
+	restartedFeed := unit.NewChangeFeed(ageMapper, 0)
+	restarted.OnSnapshot = restartedFeed.Observe
+	asserter.NoError(restarted.Load(testutil.NewTestContext()))
+	asserter.NoError(restarted.Sync(testutil.NewTestContext()))
+	sub, err = restartedFeed.Subscribe("2-1")
+	asserter.NoError(err)
+	defer sub.Close()
+	if asserter.Len(sub.Replay, 1) {
+		asserter.Equal("3-1", sub.Replay[0].ID)
+		asserter.Equal(domain.ChangeRemoved, sub.Replay[0].Type)
+		asserter.Equal("1", sub.Replay[0].EmployeeID)
+	}
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readEvents reads server-sent events off a stream until it has count of them, comments are skipped
+func readEvents(t *testing.T, r *bufio.Reader, count int) []sseEvent {
+	var ret []sseEvent
+	current := sseEvent{}
+	for len(ret) < count {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading events: %s", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if current != (sseEvent{}) {
+				ret = append(ret, current)
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "id: "):
+			current.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			current.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		default:
+			t.Fatalf("unexpected line in event stream: %q", line)
+		}
+	}
+	return ret
+}
+
+func TestChangesEndpoint(t *testing.T) {
+	asserter := assert.New(t)
+
+	feed := newChangeFeed(t, 0)
+	client := testutil.NewServerBuilder(t).WithChanges(feed).WithMessages(loadLocales(t)).Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, client.BaseURL+"/employees/changes", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Accept-Language", "es")
+	req.Header.Set("Last-Event-ID", "2-1")
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	asserter.Equal(200, res.StatusCode)
+	asserter.Equal("text/event-stream", res.Header.Get("Content-Type"))
+	asserter.Equal("no-cache", res.Header.Get("Cache-Control"))
+	asserter.Equal("es", res.Header.Get("Content-Language"))
+
+	body := bufio.NewReader(res.Body)
+	// the subscribed comment comes before anything else, once it's here new changes will make it to us
+	line, err := body.ReadString('\n')
+	asserter.NoError(err)
+	asserter.Equal(": subscribed\n", line)
+
+	replayed := readEvents(t, body, 2)
+	asserter.Equal("2-2", replayed[0].id)
+	asserter.Equal(domain.ChangeAdded, replayed[0].event)
+	asserter.Equal("2-3", replayed[1].id)
+	asserter.Equal(domain.ChangeRemoved, replayed[1].event)
+
+	asserter.NoError(feed.Observe(rosterSnapshot(3, rosterEmployee(1, "Tiger Nixon", 60), rosterEmployee(2, "Garrett Winters", 41), rosterEmployee(4, "Cedric Kelly", 22))))
+	live := readEvents(t, body, 1)[0]
+	asserter.Equal("3-1", live.id)
+	asserter.Equal(domain.ChangeChanged, live.event)
+	change := new(domain.EmployeeChange)
+	asserter.NoError(json.Unmarshal([]byte(live.data), change))
+	asserter.Equal("3-1", change.ID)
+	asserter.Equal([]domain.FieldChange{{Field: "age", From: "40", To: "41"}}, change.Changes)
+	if asserter.NotNil(change.After) {
+		asserter.Equal("gen_x", change.After.GenerationCode)
+		asserter.Equal("Generación X", change.After.GenerationLabel)
+	}
+}
+
+func TestChangesEndpoint_BadLastEventID(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).WithChanges(newChangeFeed(t, 0)).Start()
+
+	// an event stream can't carry a problem, so it comes back as JSON rather than a 406
+	res := client.Get("/employees/changes", map[string]string{"Accept": "text/event-stream", "Last-Event-ID": "yesterday"})
+	asserter.Equal(400, res.Status)
+	asserter.Equal("application/problem+json; charset=utf-8", res.Header.Get("Content-Type"))
+	testutil.AssertGolden(t, res)
+}
+
+func TestChangesEndpoint_Disabled(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).Start()
+
+	res := client.Get("/employees/changes", nil)
+	asserter.Equal(404, res.Status)
+	asserter.Equal(domain.ProblemTypeRouteNotFound, res.Problem().Type)
+}
@@ -1,17 +1,128 @@
 package main
 
 import (
+	"context"
 	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/go-kit/kit/log"
+	"github.com/jonsabados/unit-testing-party/i18n"
 	"github.com/jonsabados/unit-testing-party/unit"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func main() {
+	apiURL := os.Getenv("UPSTREAM_URL")
+	if apiURL == "" {
+		apiURL = "http://dummy.restapiexample.com"
+	}
+
 	svc := unit.SomeServer{
-		EmployeeFetcher: unit.NewRemoteEmployeeFetcher("http://dummy.restapiexample.com"),
-		EmployeeMapper: unit.NewEmployeeFactory(unit.MapBirthYear),
+		EmployeeFetcher: unit.NewRemoteEmployeeFetcher(apiURL),
+		EmployeeMapper:  unit.NewEmployeeFactory(unit.MapBirthYear),
+		Codecs:          unit.NewDefaultCodecRegistry(),
+	}
+	// chaos testing, faults start out disabled and get turned on via PUT /admin/faults
+	if os.Getenv("ENABLE_FAULT_INJECTION") == "true" {
+		faults := unit.NewFaultInjector(unit.FaultConfig{})
+		svc.EmployeeFetcher = unit.NewRemoteEmployeeFetcher(apiURL, unit.WithTransport(unit.NewFaultInjectingTransport(http.DefaultTransport, faults)))
+		svc.Faults = faults
+	}
+	// how many lookups each /employees/live websocket can have going at once
+	svc.LiveConcurrency = intFromEnv("LIVE_CONCURRENCY", 8)
+	// and which other sites' pages can open one, comma separated, eg https://dashboard.example.com
+	for _, origin := range strings.Split(os.Getenv("LIVE_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			svc.LiveOrigins = append(svc.LiveOrigins, origin)
+		}
+	}
+	// how big a query /graphql will take on
+	svc.GraphQLMaxDepth = intFromEnv("GRAPHQL_MAX_DEPTH", 8)
+	svc.GraphQLMaxComplexity = intFromEnv("GRAPHQL_MAX_COMPLEXITY", 1000)
+	// background work has no request to hang a logger off of, so it gets its own
+	ctx := kit.SetLogger(context.Background(), log.NewJSONLogger(log.NewSyncWriter(os.Stdout)))
+
+	// with SNAPSHOT_PATH set the roster gets synced to disk every SYNC_INTERVAL (10m by default, 0 to only sync at
+	// startup), and lookups get answered from there when upstream is down. Each sync gets diffed against the last,
+	// changes are streamed from /employees/changes and POSTed to every url in WEBHOOK_URLS (comma separated), signed
+	// with WEBHOOK_SECRET.
+	if snapshotPath := os.Getenv("SNAPSHOT_PATH"); snapshotPath != "" {
+		syncer := unit.NewSyncer(svc.EmployeeFetcher, snapshotPath)
+		svc.Changes = unit.NewChangeFeed(svc.EmployeeMapper, 0)
+		syncer.OnSnapshot = svc.Changes.Observe
+		if err := syncer.Load(ctx); err != nil {
+			panic(err)
+		}
+		svc.EmployeeFetcher = unit.NewSnapshotFallbackFetcher(svc.EmployeeFetcher, syncer)
+		svc.Sync = syncer
+		for _, url := range strings.Split(os.Getenv("WEBHOOK_URLS"), ",") {
+			if url = strings.TrimSpace(url); url == "" {
+				continue
+			}
+			// unsigned webhooks would have receivers trusting anybody who can reach them
+			if os.Getenv("WEBHOOK_SECRET") == "" {
+				panic("WEBHOOK_SECRET is required to send webhooks")
+			}
+			go unit.NewWebhookDispatcher(svc.Changes, url, os.Getenv("WEBHOOK_SECRET")).Run(ctx)
+		}
+		// webhooks can also be signed up for via /subscriptions, those are kept in SUBSCRIPTIONS_PATH (next to the
+		// snapshot by default) and delivered by WEBHOOK_WORKERS workers (4 by default)
+		subscriptionsPath := os.Getenv("SUBSCRIPTIONS_PATH")
+		if subscriptionsPath == "" {
+			subscriptionsPath = snapshotPath + ".subscriptions"
+		}
+		subscriptions := unit.NewSubscriptionStore(subscriptionsPath)
+		if err := subscriptions.Load(); err != nil {
+			panic(err)
+		}
+		svc.Subscriptions = unit.NewSubscriptionDispatcher(svc.Changes, subscriptions, intFromEnv("WEBHOOK_WORKERS", 4))
+		go svc.Subscriptions.Run(ctx)
+		go syncer.Run(ctx, durationFromEnv("SYNC_INTERVAL", 10*time.Minute))
+	}
+	// search keeps its own copy of everybody, refreshed in the background every SEARCH_REFRESH_INTERVAL (5m by default,
+	// 0 to only load it at startup)
+	svc.Search = unit.NewSearchIndex(svc.EmployeeFetcher, svc.EmployeeMapper)
+	go svc.Search.Run(ctx, durationFromEnv("SEARCH_REFRESH_INTERVAL", 5*time.Minute))
+
+	// translations for generation labels and problems, anything missing falls back to English. The default only works
+	// from the repo root, LoadDir refuses a directory that isn't there rather than quietly going English only.
+	localesDir := os.Getenv("LOCALES_DIR")
+	if localesDir == "" {
+		localesDir = "i18n/locales"
+	}
+	messages, err := i18n.LoadDir(localesDir)
+	if err != nil {
+		panic(err)
 	}
+	svc.Messages = messages
+
 	svr := kit.NewServer(&svc)
 
 	panic(http.ListenAndServe("0:8080", svr))
 }
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	ret, err := time.ParseDuration(raw)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+func intFromEnv(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	ret, err := strconv.Atoi(raw)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
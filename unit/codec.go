@@ -0,0 +1,273 @@
+package unit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+// Encoder writes v to w in whatever format it is responsible for
+type Encoder func(w io.Writer, v interface{}) error
+
+// Codec ties an Encoder to the media types it can produce. MediaTypes are matched against the Accept header of a
+// request, ContentType is what gets sent back in the Content-Type header when the codec is picked. Formats that have
+// an RFC 7807 flavor (JSON & XML) set ProblemContentType for error responses, otherwise ContentType is used for those
+// too. Flat formats (CSV) can only render rows, endpoints answering with anything that nests leave them out.
+type Codec struct {
+	MediaTypes         []string
+	ContentType        string
+	ProblemContentType string
+	Flat               bool
+	Encode             Encoder
+}
+
+func (c Codec) problemContentType() string {
+	if c.ProblemContentType == "" {
+		return c.ContentType
+	}
+	return c.ProblemContentType
+}
+
+// CodecRegistry holds the codecs a server is able to respond with, in order of preference. The first registered codec
+// is what clients get if they don't send an Accept header (or send */*). Register everything before serving requests,
+// there is no locking in here.
+type CodecRegistry struct {
+	codecs []Codec
+}
+
+func NewCodecRegistry(codecs ...Codec) *CodecRegistry {
+	ret := &CodecRegistry{}
+	for _, c := range codecs {
+		ret.Register(c)
+	}
+	return ret
+}
+
+// NewDefaultCodecRegistry gives back a registry with everything we know how to speak, JSON first.
+func NewDefaultCodecRegistry() *CodecRegistry {
+	return NewCodecRegistry(JSONCodec(), XMLCodec(), CSVCodec(), MessagePackCodec())
+}
+
+func (r *CodecRegistry) Register(codec Codec) {
+	r.codecs = append(r.codecs, codec)
+}
+
+// Structured gives back a registry without the flat codecs, for things that nest
+func (r *CodecRegistry) Structured() *CodecRegistry {
+	ret := &CodecRegistry{}
+	for _, c := range r.codecs {
+		if !c.Flat {
+			ret.Register(c)
+		}
+	}
+	return ret
+}
+
+// MediaTypes lists every media type the registry can produce, in order of preference
+func (r *CodecRegistry) MediaTypes() []string {
+	var ret []string
+	for _, c := range r.codecs {
+		ret = append(ret, c.MediaTypes...)
+	}
+	return ret
+}
+
+// Negotiate picks the codec that best satisfies the given Accept header value. The bool will be false if nothing
+// registered is acceptable to the client.
+func (r *CodecRegistry) Negotiate(accept string) (Codec, bool) {
+	if len(r.codecs) == 0 {
+		return Codec{}, false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return r.codecs[0], true
+	}
+
+	ranges := parseAccept(accept)
+	for _, mr := range ranges {
+		if mr.q <= 0 {
+			// everything with a q of 0 is sorted to the end, so nothing left is acceptable
+			break
+		}
+		for _, c := range r.codecs {
+			for _, mt := range c.MediaTypes {
+				// a more specific range can knock the q down, eg "*/*, text/*;q=0" matches text/csv with */* but
+				// text/* is what decides it. Ranges go best first, so one that's been knocked down gets picked up
+				// again further along if it's acceptable at all.
+				if mr.matches(mt) && quality(ranges, mt) >= mr.q {
+					return c, true
+				}
+			}
+		}
+	}
+	return Codec{}, false
+}
+
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+func (m mediaRange) matches(mediaType string) bool {
+	if m.mediaType == "*/*" || m.mediaType == mediaType {
+		return true
+	}
+	if strings.HasSuffix(m.mediaType, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(m.mediaType, "*"))
+	}
+	return false
+}
+
+// specificity ranks how closely a range pins down a media type, exact beats type/* beats */*
+func (m mediaRange) specificity() int {
+	switch {
+	case m.mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(m.mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// quality is the q a client gave a media type. RFC 7231 says the most specific range that matches is the one that
+// counts, so "*/*, text/*;q=0" means anything but text and "text/*;q=0, text/csv" still takes csv.
+func quality(ranges []mediaRange, mediaType string) float64 {
+	best := -1
+	q := 0.0
+	for _, mr := range ranges {
+		if mr.matches(mediaType) && mr.specificity() > best {
+			best = mr.specificity()
+			q = mr.q
+		}
+	}
+	return q
+}
+
+// parseAccept turns an Accept header value into media ranges sorted by preference. Anything unparsable for q gets
+// treated as q=1 since being lenient beats 406ing someone over a typo.
+func parseAccept(accept string) []mediaRange {
+	var ret []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		pieces := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(pieces[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range pieces[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				if parsed, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		ret = append(ret, mediaRange{mediaType, q})
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].q > ret[j].q
+	})
+	return ret
+}
+
+func JSONCodec() Codec {
+	return Codec{
+		MediaTypes:         []string{"application/json"},
+		ContentType:        "application/json; charset=utf-8",
+		ProblemContentType: "application/problem+json; charset=utf-8",
+		Encode: func(w io.Writer, v interface{}) error {
+			return json.NewEncoder(w).Encode(v)
+		},
+	}
+}
+
+func XMLCodec() Codec {
+	return Codec{
+		MediaTypes:         []string{"application/xml", "text/xml"},
+		ContentType:        "application/xml; charset=utf-8",
+		ProblemContentType: "application/problem+xml; charset=utf-8",
+		Encode: func(w io.Writer, v interface{}) error {
+			if _, err := io.WriteString(w, xml.Header); err != nil {
+				return err
+			}
+			return xml.NewEncoder(w).Encode(v)
+		},
+	}
+}
+
+// MessagePackCodec uses the json tags on things so we don't have to double up on struct tags for every type we render
+func MessagePackCodec() Codec {
+	return Codec{
+		MediaTypes:  []string{"application/msgpack", "application/x-msgpack"},
+		ContentType: "application/msgpack",
+		Encode: func(w io.Writer, v interface{}) error {
+			return msgpack.NewEncoder(w).UseJSONTag(true).UseCompactEncoding(true).Encode(v)
+		},
+	}
+}
+
+// CSVMarshaler is implemented by anything that knows how to flatten itself into a csv row. CSV has no way to
+// represent nesting, so rather than guess with reflection types opt in by implementing this.
+type CSVMarshaler interface {
+	CSVHeader() []string
+	CSVRecord() []string
+}
+
+// CSVCodec renders a CSVMarshaler as a header plus a single row, or a slice of them as a header plus a row apiece
+func CSVCodec() Codec {
+	return Codec{
+		MediaTypes:  []string{"text/csv"},
+		ContentType: "text/csv; charset=utf-8",
+		Flat:        true,
+		Encode:      encodeCSV,
+	}
+}
+
+var csvMarshalerType = reflect.TypeOf((*CSVMarshaler)(nil)).Elem()
+
+func encodeCSV(w io.Writer, v interface{}) error {
+	out := csv.NewWriter(w)
+
+	if m, ok := v.(CSVMarshaler); ok {
+		if err := out.Write(m.CSVHeader()); err != nil {
+			return err
+		}
+		if err := out.Write(m.CSVRecord()); err != nil {
+			return err
+		}
+		out.Flush()
+		return out.Error()
+	}
+
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Slice || !val.Type().Elem().Implements(csvMarshalerType) {
+		return fmt.Errorf("unable to render %T as csv", v)
+	}
+
+	// grab the header from a fresh element so empty slices still get a header row
+	elemType := val.Type().Elem()
+	var zero reflect.Value
+	if elemType.Kind() == reflect.Ptr {
+		zero = reflect.New(elemType.Elem())
+	} else {
+		zero = reflect.New(elemType).Elem()
+	}
+	if err := out.Write(zero.Interface().(CSVMarshaler).CSVHeader()); err != nil {
+		return err
+	}
+	for i := 0; i < val.Len(); i++ {
+		if err := out.Write(val.Index(i).Interface().(CSVMarshaler).CSVRecord()); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
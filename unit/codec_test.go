@@ -0,0 +1,217 @@
+package unit
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+func TestCodecRegistry_Negotiate(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		accept        string
+		expectedOK    bool
+		expectedCodec string
+	}{
+		{
+			"no accept header",
+			"",
+			true,
+			"application/json; charset=utf-8",
+		},
+		{
+			"wildcard",
+			"*/*",
+			true,
+			"application/json; charset=utf-8",
+		},
+		{
+			"exact match",
+			"application/xml",
+			true,
+			"application/xml; charset=utf-8",
+		},
+		{
+			"alias",
+			"application/x-msgpack",
+			true,
+			"application/msgpack",
+		},
+		{
+			"case insensitive",
+			"TEXT/CSV",
+			true,
+			"text/csv; charset=utf-8",
+		},
+		{
+			"subtype wildcard",
+			"text/*",
+			true,
+			"application/xml; charset=utf-8", // text/xml is registered before text/csv
+		},
+		{
+			"q values respected",
+			"application/json;q=0.5, text/csv;q=0.9",
+			true,
+			"text/csv; charset=utf-8",
+		},
+		{
+			"browser style",
+			"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			true,
+			"application/xml; charset=utf-8",
+		},
+		{
+			"explicit exclusion",
+			"*/*, application/json;q=0",
+			true,
+			"application/xml; charset=utf-8",
+		},
+		{
+			"wildcard exclusion",
+			"*/*, application/*;q=0",
+			true,
+			"application/xml; charset=utf-8", // by way of text/xml
+		},
+		{
+			"wildcard and exact exclusions",
+			"*/*, application/*;q=0, text/xml;q=0",
+			true,
+			"text/csv; charset=utf-8",
+		},
+		{
+			"more specific range wins",
+			"text/*;q=0, text/csv",
+			true,
+			"text/csv; charset=utf-8",
+		},
+		{
+			"lowered by a more specific range",
+			"*/*, application/json;q=0.1",
+			true,
+			"application/xml; charset=utf-8",
+		},
+		{
+			"garbage q treated as 1",
+			"text/csv;q=lots",
+			true,
+			"text/csv; charset=utf-8",
+		},
+		{
+			"nothing acceptable",
+			"text/html",
+			false,
+			"",
+		},
+		{
+			"everything refused",
+			"application/json;q=0",
+			false,
+			"",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			codec, ok := NewDefaultCodecRegistry().Negotiate(tc.accept)
+			asserter.Equal(tc.expectedOK, ok)
+			asserter.Equal(tc.expectedCodec, codec.ContentType)
+		})
+	}
+}
+
+func TestCodecRegistry_NegotiateEmptyRegistry(t *testing.T) {
+	asserter := assert.New(t)
+
+	_, ok := NewCodecRegistry().Negotiate("")
+	asserter.False(ok)
+}
+
+func TestCodecRegistry_MediaTypes(t *testing.T) {
+	asserter := assert.New(t)
+
+	asserter.Equal([]string{
+		"application/json",
+		"application/xml",
+		"text/xml",
+		"text/csv",
+		"application/msgpack",
+		"application/x-msgpack",
+	}, NewDefaultCodecRegistry().MediaTypes())
+}
+
+func TestXMLCodec(t *testing.T) {
+	asserter := assert.New(t)
+
+	buf := new(bytes.Buffer)
+	err := XMLCodec().Encode(buf, domain.Employee{ID: "1", Name: "Bob", Age: 20, Generation: domain.GenZ})
+	asserter.NoError(err)
+	asserter.Equal(`<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<Employee><id>1</id><employee_name>Bob</employee_name><age>20</age><generation>Generation Z</generation></Employee>`,
+		buf.String())
+}
+
+func TestMessagePackCodec(t *testing.T) {
+	asserter := assert.New(t)
+
+	buf := new(bytes.Buffer)
+	err := MessagePackCodec().Encode(buf, domain.Employee{ID: "1", Name: "Bob", Age: 20, Generation: domain.GenZ})
+	asserter.NoError(err)
+
+	decoded := make(map[string]interface{})
+	asserter.NoError(msgpack.Unmarshal(buf.Bytes(), &decoded))
+	asserter.Equal("1", decoded["id"])
+	asserter.Equal("Bob", decoded["employee_name"])
+	asserter.EqualValues(20, decoded["age"])
+	asserter.Equal("Generation Z", decoded["generation"])
+}
+
+func TestCSVCodec(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		input    interface{}
+		expected string
+	}{
+		{
+			"single value",
+			domain.Employee{ID: "1", Name: "Bob, Jr.", Age: 20, Generation: domain.GenZ, GenerationCode: "gen_z", GenerationLabel: "Generación Z"},
+			"id,employee_name,age,generation,generation_code,generation_label\n1,\"Bob, Jr.\",20,Generation Z,gen_z,Generación Z\n",
+		},
+		{
+			"slice",
+			[]domain.Employee{{ID: "1", Name: "Bob", Age: 20, Generation: domain.GenZ}, {ID: "2", Name: "Alice", Age: 40, Generation: domain.Millennial}},
+			"id,employee_name,age,generation,generation_code,generation_label\n1,Bob,20,Generation Z,,\n2,Alice,40,Millennial,,\n",
+		},
+		{
+			"slice of pointers",
+			[]*domain.Employee{{ID: "1", Name: "Bob", Age: 20, Generation: domain.GenZ}},
+			"id,employee_name,age,generation,generation_code,generation_label\n1,Bob,20,Generation Z,,\n",
+		},
+		{
+			"empty slice",
+			[]*domain.Employee{},
+			"id,employee_name,age,generation,generation_code,generation_label\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			buf := new(bytes.Buffer)
+			err := CSVCodec().Encode(buf, tc.input)
+			asserter.NoError(err)
+			asserter.Equal(tc.expected, buf.String())
+		})
+	}
+}
+
+func TestCSVCodec_Unsupported(t *testing.T) {
+	asserter := assert.New(t)
+
+	err := CSVCodec().Encode(new(bytes.Buffer), map[string]string{"foo": "bar"})
+	asserter.EqualError(err, "unable to render map[string]string as csv")
+}
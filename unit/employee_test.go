@@ -1,8 +1,11 @@
 package unit
 
 import (
+	"github.com/jonsabados/unit-testing-party/domain"
 	"github.com/stretchr/testify/assert"
+	"math"
 	"testing"
+	"testing/quick"
 	"time"
 )
 
@@ -10,67 +13,67 @@ func TestMapBirthYear(t *testing.T) {
 	testCases := []struct {
 		desc           string
 		input          int
-		expectedResult Generation
+		expectedResult domain.Generation
 	}{
 		{
 			"really old",
 			1890,
-			Greatest,
+			domain.Greatest,
 		},
 		{
 			"Greatest Edge",
-			1294,
-			Greatest,
+			1924,
+			domain.Greatest,
 		},
 		{
 			"Silent start",
 			1925,
-			Silent,
+			domain.Silent,
 		},
 		{
 			"Silent end",
 			1945,
-			Silent,
+			domain.Silent,
 		},
 		{
 			"Baby Boomer start",
-			1956,
-			BabyBoomer,
+			1946,
+			domain.BabyBoomer,
 		},
 		{
 			"Baby Boomer end",
 			1964,
-			BabyBoomer,
+			domain.BabyBoomer,
 		},
 		{
 			"GenX start",
 			1965,
-			GenX,
+			domain.GenX,
 		},
 		{
 			"GenX end",
 			1980,
-			GenX,
+			domain.GenX,
 		},
 		{
 			"Millennial start",
 			1981,
-			Millennial,
+			domain.Millennial,
 		},
 		{
 			"Millennial end",
 			1996,
-			Millennial,
+			domain.Millennial,
 		},
 		{
 			"GenZ start",
 			1997,
-			GenZ,
+			domain.GenZ,
 		},
 		{
 			"Young GenZ end",
 			2015,
-			GenZ,
+			domain.GenZ,
 		},
 	}
 	for _, tc := range testCases {
@@ -86,35 +89,190 @@ func TestNewEmployeeFactoryHappyPath(t *testing.T) {
 	asserter := assert.New(t)
 
 	expectedBirthYear := time.Now().Year() - 20
-	expectedGeneration := GenZ
-	mapBirthYear := func(birthYear int) Generation {
+	expectedGeneration := domain.GenZ
+	mapBirthYear := func(birthYear int) domain.Generation {
 		asserter.Equal(expectedBirthYear, birthYear)
 		return expectedGeneration
 	}
 
-	input := RemoteEmployee{
+	input := domain.RemoteEmployee{
 		Status: "blah",
-		Data: &struct {
-			ID             int    `json:"id"`
-			EmployeeName   string `json:"employee_name"`
-			EmployeeSalary int    `json:"employee_salary"`
-			EmployeeAge    int    `json:"employee_age"`
-			ProfileImage   string `json:"profile_image"`
-		}{
-			1,
-			"Bob",
-			123,
-			20,
-			"foo",
+		Data: &domain.RemoteEmployeeData{
+			ID:             1,
+			EmployeeName:   "Bob",
+			EmployeeSalary: 123,
+			EmployeeAge:    20,
+			ProfileImage:   "foo",
 		},
 	}
 
 	res, err := NewEmployeeFactory(mapBirthYear)(&input)
 	asserter.NoError(err)
-	asserter.Equal(&Employee{
+	asserter.Equal(&domain.Employee{
 		ID:         "1",
 		Name:       "Bob",
 		Age:        20,
 		Generation: expectedGeneration,
 	}, res)
 }
+
+type generationRange struct {
+	generation domain.Generation
+	from       int
+	to         int
+}
+
+// generationRanges is the domain's year ranges with the open ends filled in, so the properties below have something to
+// check against other than MapBirthYear itself. Oldest first.
+var generationRanges = func() []generationRange {
+	var ret []generationRange
+	for _, g := range domain.All() {
+		r := generationRange{generation: g, from: g.YearRange().From, to: g.YearRange().To}
+		if r.from == 0 {
+			r.from = math.MinInt32
+		}
+		if r.to == 0 {
+			r.to = math.MaxInt32
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}()
+
+// expectedGeneration gives back the generation a birth year falls into along with how far down the list it is
+func expectedGeneration(birthYear int) (domain.Generation, int) {
+	for i, r := range generationRanges {
+		if birthYear <= r.to {
+			return r.generation, i
+		}
+	}
+	last := len(generationRanges) - 1
+	return generationRanges[last].generation, last
+}
+
+func generationRank(generation domain.Generation) int {
+	for i, r := range generationRanges {
+		if r.generation == generation {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestMapBirthYear_CoversEveryYear(t *testing.T) {
+	asserter := assert.New(t)
+
+	seen := make(map[domain.Generation]int)
+	for year := 1800; year <= 2100; year++ {
+		expected, _ := expectedGeneration(year)
+		if !asserter.Equal(expected, MapBirthYear(year), "birth year %d", year) {
+			return
+		}
+		seen[expected]++
+	}
+	// every generation should actually come up, and for the ones with both ends in range, for exactly as many years as
+	// the range says
+	for _, r := range generationRanges {
+		asserter.NotZero(seen[r.generation], "%s never came up", r.generation)
+		if r.from >= 1800 && r.to <= 2100 {
+			asserter.Equal(r.to-r.from+1, seen[r.generation], "%s", r.generation)
+		}
+	}
+}
+
+func TestMapBirthYear_Edges(t *testing.T) {
+	asserter := assert.New(t)
+
+	for i, r := range generationRanges {
+		if i > 0 {
+			asserter.Equal(r.generation, MapBirthYear(r.from), "start of %s", r.generation)
+			asserter.Equal(generationRanges[i-1].generation, MapBirthYear(r.from-1), "year before %s", r.generation)
+		}
+		if i < len(generationRanges)-1 {
+			asserter.Equal(r.generation, MapBirthYear(r.to), "end of %s", r.generation)
+			asserter.Equal(generationRanges[i+1].generation, MapBirthYear(r.to+1), "year after %s", r.generation)
+		}
+	}
+	asserter.Equal(domain.Greatest, MapBirthYear(math.MinInt64))
+	asserter.Equal(domain.GenZ, MapBirthYear(math.MaxInt64))
+}
+
+func TestMapBirthYear_Monotonic(t *testing.T) {
+	// being born later never puts someone in an older generation
+	property := func(a int, b int) bool {
+		if a > b {
+			a, b = b, a
+		}
+		return generationRank(MapBirthYear(a)) <= generationRank(MapBirthYear(b))
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+
+	// quick hands out ints from all over the place, so also hammer the years that actually matter
+	nearby := func(year int16, gap uint8) bool {
+		return property(int(year), int(year)+int(gap))
+	}
+	if err := quick.Check(nearby, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func FuzzMapBirthYear(f *testing.F) {
+	for _, r := range generationRanges {
+		f.Add(r.from)
+		f.Add(r.to)
+	}
+	f.Add(0)
+	f.Add(2020)
+
+	f.Fuzz(func(t *testing.T, birthYear int) {
+		asserter := assert.New(t)
+
+		res := MapBirthYear(birthYear)
+		expected, rank := expectedGeneration(birthYear)
+		asserter.Equal(expected, res)
+		if birthYear < math.MaxInt64 {
+			asserter.True(rank <= generationRank(MapBirthYear(birthYear+1)), "birth year %d", birthYear)
+		}
+	})
+}
+
+func FuzzNewEmployeeFactory(f *testing.F) {
+	f.Add(1, "Tiger Nixon", 320800, 61, "")
+	f.Add(0, "", 0, 0, "")
+	f.Add(-1, "Zoë 山田", -1, -1, "https://example.com/a.png")
+	f.Add(math.MaxInt32, "x", math.MaxInt32, 200, "")
+
+	f.Fuzz(func(t *testing.T, id int, name string, salary int, age int, image string) {
+		asserter := assert.New(t)
+
+		var gotBirthYear int
+		mapBirthYear := func(birthYear int) domain.Generation {
+			gotBirthYear = birthYear
+			return MapBirthYear(birthYear)
+		}
+
+		input := domain.RemoteEmployee{
+			Status: "success",
+			Data:   &domain.RemoteEmployeeData{ID: id, EmployeeName: name, EmployeeSalary: salary, EmployeeAge: age, ProfileImage: image},
+		}
+
+		year := time.Now().Year()
+		res, err := NewEmployeeFactory(mapBirthYear)(&input)
+		if !asserter.NoError(err) {
+			return
+		}
+		asserter.Equal(domain.EmployeeIDFromInt(id).String(), res.ID)
+		asserter.Equal(name, res.Name)
+		asserter.Equal(age, res.Age)
+		asserter.Equal(year-age, gotBirthYear)
+		asserter.Equal(MapBirthYear(gotBirthYear), res.Generation)
+		if id >= 0 {
+			// ids from upstream need to survive a trip through a url and back
+			parsed, err := domain.ParseEmployeeID(res.ID)
+			asserter.NoError(err)
+			asserter.Equal(res.ID, parsed.String())
+		}
+	})
+}
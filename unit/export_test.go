@@ -0,0 +1,5 @@
+package unit
+
+// Hooks into unexported bits for the tests in unit_test, which can't live in this package because testutil imports it.
+
+var SchemaFor = schemaFor
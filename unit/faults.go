@@ -0,0 +1,299 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/i18n"
+	"github.com/pkg/errors"
+)
+
+// Fault injection, for seeing how things hold up when the upstream is slow or flaky without having to wait for it to
+// actually be slow or flaky. Faults can be injected at the RemoteEmployeeFetcher level, or at the http level where
+// more interesting breakage (truncated bodies, bogus content types) is possible.
+
+type FaultKind string
+
+const (
+	FaultLatency FaultKind = "latency"
+	FaultError   FaultKind = "error"
+	// the rest only make sense at the http level, the fetcher decorator ignores them
+	FaultTruncatedBody    FaultKind = "truncated_body"
+	FaultWrongContentType FaultKind = "wrong_content_type"
+	FaultStatus           FaultKind = "status"
+)
+
+var ErrInjectedFault = errors.New("injected fault")
+
+type FaultRule struct {
+	Kind FaultKind `json:"kind" xml:"kind"`
+	// Probability is the odds (0 - 1) of the fault happening on any given request
+	Probability float64 `json:"probability" xml:"probability"`
+	// EmployeeIDs limits the rule to lookups of specific employees, empty means everybody. They need to be normalized
+	// (see domain.ParseEmployeeID) to match anything, the admin endpoint takes care of that.
+	EmployeeIDs []domain.EmployeeID `json:"employee_ids,omitempty" xml:"employee_id,omitempty"`
+	// LatencyMS is how long to stall for latency faults
+	LatencyMS int `json:"latency_ms,omitempty" xml:"latency_ms,omitempty"`
+	// Status is what status faults answer with, defaults to 503
+	Status int `json:"status,omitempty" xml:"status,omitempty"`
+}
+
+type FaultConfig struct {
+	XMLName xml.Name    `json:"-" xml:"faults"`
+	Enabled bool        `json:"enabled" xml:"enabled"`
+	Rules   []FaultRule `json:"rules" xml:"rules>rule"`
+}
+
+// Validate checks the config makes sense, reasons come out in whatever language loc speaks
+func (c FaultConfig) Validate(loc *i18n.Localizer) []domain.InvalidParam {
+	var ret []domain.InvalidParam
+	for i, r := range c.Rules {
+		name := fmt.Sprintf("rules[%d]", i)
+		switch r.Kind {
+		case FaultLatency, FaultError, FaultTruncatedBody, FaultWrongContentType, FaultStatus:
+		default:
+			ret = append(ret, invalidParam(loc, name+".kind", "unknown_fault_kind", r.Kind))
+		}
+		if r.Probability < 0 || r.Probability > 1 {
+			ret = append(ret, invalidParam(loc, name+".probability", "between", 0, 1))
+		}
+		if r.LatencyMS < 0 {
+			ret = append(ret, invalidParam(loc, name+".latency_ms", "not_negative"))
+		}
+		if r.Status != 0 && (r.Status < 100 || r.Status > 599) {
+			ret = append(ret, invalidParam(loc, name+".status", "http_status"))
+		}
+		for j, id := range r.EmployeeIDs {
+			if _, err := domain.ParseEmployeeID(string(id)); err != nil {
+				ret = append(ret, invalidParam(loc, fmt.Sprintf("%s.employee_ids[%d]", name, j), "malformed_employee_id"))
+			}
+		}
+	}
+	return ret
+}
+
+// FaultInjector holds the fault config, which can be changed at runtime. It's shared by the fetcher decorator and the
+// transport so one admin endpoint controls both.
+type FaultInjector struct {
+	mu  sync.RWMutex
+	cfg FaultConfig
+
+	// Rand and Sleep are here so tests can take the randomness and waiting out of things
+	Rand  func() float64
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewFaultInjector(cfg FaultConfig) *FaultInjector {
+	return &FaultInjector{
+		cfg:   cfg,
+		Rand:  rand.Float64,
+		Sleep: sleepContext,
+	}
+}
+
+func (f *FaultInjector) Config() FaultConfig {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.cfg
+}
+
+func (f *FaultInjector) SetConfig(cfg FaultConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cfg = cfg
+}
+
+// roll figures out which faults fire for this particular request
+func (f *FaultInjector) roll(employeeID domain.EmployeeID) []FaultRule {
+	cfg := f.Config()
+	if !cfg.Enabled {
+		return nil
+	}
+
+	var ret []FaultRule
+	for _, r := range cfg.Rules {
+		if !r.appliesTo(employeeID) {
+			continue
+		}
+		if f.Rand() < r.Probability {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+func (r FaultRule) appliesTo(employeeID domain.EmployeeID) bool {
+	if len(r.EmployeeIDs) == 0 {
+		return true
+	}
+	for _, id := range r.EmployeeIDs {
+		if id == employeeID {
+			return true
+		}
+	}
+	return false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type faultInjectingFetcher struct {
+	next     RemoteEmployeeFetcher
+	injector *FaultInjector
+}
+
+func (f *faultInjectingFetcher) FetchEmployee(ctx context.Context, employeeID domain.EmployeeID) (*domain.RemoteEmployee, error) {
+	for _, fault := range f.injector.roll(employeeID) {
+		switch fault.Kind {
+		case FaultLatency:
+			if err := f.injector.Sleep(ctx, time.Duration(fault.LatencyMS)*time.Millisecond); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		case FaultError:
+			return nil, errors.WithStack(ErrInjectedFault)
+		}
+	}
+	return f.next.FetchEmployee(ctx, employeeID)
+}
+
+func (f *faultInjectingFetcher) FetchEmployees(ctx context.Context) ([]domain.RemoteEmployeeData, error) {
+	// no employee id, so only the rules that apply to everybody come into play
+	for _, fault := range f.injector.roll("") {
+		switch fault.Kind {
+		case FaultLatency:
+			if err := f.injector.Sleep(ctx, time.Duration(fault.LatencyMS)*time.Millisecond); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		case FaultError:
+			return nil, errors.WithStack(ErrInjectedFault)
+		}
+	}
+	return f.next.FetchEmployees(ctx)
+}
+
+// NewFaultInjectingFetcher decorates a RemoteEmployeeFetcher with latency and error faults
+func NewFaultInjectingFetcher(next RemoteEmployeeFetcher, injector *FaultInjector) RemoteEmployeeFetcher {
+	return &faultInjectingFetcher{next, injector}
+}
+
+type faultInjectingTransport struct {
+	next     http.RoundTripper
+	injector *FaultInjector
+}
+
+func (f *faultInjectingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// upstream urls end with the employee id, which is all the per employee rules need
+	faults := f.injector.roll(domain.EmployeeID(path.Base(req.URL.Path)))
+
+	for _, fault := range faults {
+		switch fault.Kind {
+		case FaultLatency:
+			if err := f.injector.Sleep(req.Context(), time.Duration(fault.LatencyMS)*time.Millisecond); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		case FaultError:
+			return nil, errors.WithStack(ErrInjectedFault)
+		case FaultStatus:
+			status := fault.Status
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			return fakeResponse(req, status, "text/plain", []byte("injected fault")), nil
+		}
+	}
+
+	res, err := f.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fault := range faults {
+		switch fault.Kind {
+		case FaultWrongContentType:
+			_ = res.Body.Close()
+			return fakeResponse(req, res.StatusCode, "text/html", []byte("<html><body><h1>Service Unavailable</h1></body></html>")), nil
+		case FaultTruncatedBody:
+			body, err := ioutil.ReadAll(res.Body)
+			_ = res.Body.Close()
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			res.Body = ioutil.NopCloser(bytes.NewReader(body[:len(body)/2]))
+			res.ContentLength = int64(len(body) / 2)
+			return res, nil
+		}
+	}
+	return res, nil
+}
+
+func fakeResponse(req *http.Request, status int, contentType string, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{contentType}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// NewFaultInjectingTransport decorates an http.RoundTripper with every kind of fault. Hand it to
+// NewRemoteEmployeeFetcher via WithTransport.
+func NewFaultInjectingTransport(next http.RoundTripper, injector *FaultInjector) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &faultInjectingTransport{next, injector}
+}
+
+func (s *SomeServer) decodeFaultConfig(ctx context.Context, r *http.Request) (interface{}, error) {
+	cfg := FaultConfig{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, invalidParamsProblem(domain.InvalidParam{Name: "body", Reason: err.Error()})
+	}
+	if invalid := cfg.Validate(s.localizer(ctx)); len(invalid) > 0 {
+		return nil, invalidParamsProblem(invalid...)
+	}
+	// lookups get normalized ids, so the rules need them too or "007" would never match employee 7
+	for i := range cfg.Rules {
+		for j, id := range cfg.Rules[i].EmployeeIDs {
+			cfg.Rules[i].EmployeeIDs[j], _ = domain.ParseEmployeeID(string(id))
+		}
+	}
+	return cfg, nil
+}
+
+func (s *SomeServer) GetFaultsEndpoint(_ context.Context, _ interface{}) (interface{}, error) {
+	return s.Faults.Config(), nil
+}
+
+func (s *SomeServer) PutFaultsEndpoint(ctx context.Context, req interface{}) (interface{}, error) {
+	cfg := req.(FaultConfig)
+	_ = kit.Logger(ctx).Log("message", "fault injection config changed", "enabled", cfg.Enabled, "rules", len(cfg.Rules))
+	s.Faults.SetConfig(cfg)
+	return s.Faults.Config(), nil
+}
@@ -0,0 +1,408 @@
+package unit_test
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/jonsabados/unit-testing-party/unit/testutil/cassette"
+	"github.com/jonsabados/unit-testing-party/unit/testutil/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// newTestFaultInjector gives back an injector where every roll comes up 0.5, so rules with a probability above that
+// always fire and ones below never do. Sleeps get recorded rather than waited out.
+func newTestFaultInjector(cfg unit.FaultConfig, slept *[]time.Duration) *unit.FaultInjector {
+	ret := unit.NewFaultInjector(cfg)
+	ret.Rand = func() float64 {
+		return 0.5
+	}
+	ret.Sleep = func(ctx context.Context, d time.Duration) error {
+		*slept = append(*slept, d)
+		return nil
+	}
+	return ret
+}
+
+func TestFaultInjectingFetcher(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		cfg           unit.FaultConfig
+		employeeID    domain.EmployeeID
+		expectedSleep []time.Duration
+		expectedErr   bool
+	}{
+		{
+			desc: "disabled",
+			cfg: unit.FaultConfig{
+				Enabled: false,
+				Rules:   []unit.FaultRule{{Kind: unit.FaultError, Probability: 1}},
+			},
+			employeeID: "1",
+		},
+		{
+			desc: "error",
+			cfg: unit.FaultConfig{
+				Enabled: true,
+				Rules:   []unit.FaultRule{{Kind: unit.FaultError, Probability: 1}},
+			},
+			employeeID:  "1",
+			expectedErr: true,
+		},
+		{
+			desc: "unlucky roll",
+			cfg: unit.FaultConfig{
+				Enabled: true,
+				Rules:   []unit.FaultRule{{Kind: unit.FaultError, Probability: 0.25}},
+			},
+			employeeID: "1",
+		},
+		{
+			desc: "latency",
+			cfg: unit.FaultConfig{
+				Enabled: true,
+				Rules:   []unit.FaultRule{{Kind: unit.FaultLatency, Probability: 0.75, LatencyMS: 1500}},
+			},
+			employeeID:    "1",
+			expectedSleep: []time.Duration{1500 * time.Millisecond},
+		},
+		{
+			desc: "latency then error",
+			cfg: unit.FaultConfig{
+				Enabled: true,
+				Rules: []unit.FaultRule{
+					{Kind: unit.FaultLatency, Probability: 1, LatencyMS: 10},
+					{Kind: unit.FaultError, Probability: 1},
+				},
+			},
+			employeeID:    "1",
+			expectedSleep: []time.Duration{10 * time.Millisecond},
+			expectedErr:   true,
+		},
+		{
+			desc: "per id rule matching",
+			cfg: unit.FaultConfig{
+				Enabled: true,
+				Rules:   []unit.FaultRule{{Kind: unit.FaultError, Probability: 1, EmployeeIDs: []domain.EmployeeID{"2", "emp-7"}}},
+			},
+			employeeID:  "emp-7",
+			expectedErr: true,
+		},
+		{
+			desc: "per id rule not matching",
+			cfg: unit.FaultConfig{
+				Enabled: true,
+				Rules:   []unit.FaultRule{{Kind: unit.FaultError, Probability: 1, EmployeeIDs: []domain.EmployeeID{"2", "emp-7"}}},
+			},
+			employeeID: "1",
+		},
+		{
+			desc: "http only faults are ignored",
+			cfg: unit.FaultConfig{
+				Enabled: true,
+				Rules:   []unit.FaultRule{{Kind: unit.FaultTruncatedBody, Probability: 1}, {Kind: unit.FaultStatus, Probability: 1}},
+			},
+			employeeID: "1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			expected := &domain.RemoteEmployee{Status: "success"}
+			fetcher := mocks.NewRemoteEmployeeFetcher(t)
+			fetcher.EXPECT().FetchEmployee(mock.Anything, tc.employeeID).Return(expected, nil).Maybe()
+
+			var slept []time.Duration
+			testInstance := unit.NewFaultInjectingFetcher(fetcher, newTestFaultInjector(tc.cfg, &slept))
+			res, err := testInstance.FetchEmployee(testutil.NewTestContext(), tc.employeeID)
+
+			asserter.Equal(tc.expectedSleep, slept)
+			if tc.expectedErr {
+				asserter.EqualError(err, unit.ErrInjectedFault.Error())
+				asserter.Nil(res)
+				fetcher.AssertNotCalled(t, "FetchEmployee", mock.Anything, mock.Anything)
+			} else {
+				asserter.NoError(err)
+				asserter.Equal(expected, res)
+			}
+		})
+	}
+}
+
+func TestFaultInjectingFetcher_LatencyHonorsContext(t *testing.T) {
+	asserter := assert.New(t)
+
+	fetcher := mocks.NewRemoteEmployeeFetcher(t)
+	injector := unit.NewFaultInjector(unit.FaultConfig{
+		Enabled: true,
+		Rules:   []unit.FaultRule{{Kind: unit.FaultLatency, Probability: 1, LatencyMS: 60000}},
+	})
+
+	ctx, cancel := context.WithCancel(testutil.NewTestContext())
+	cancel()
+	res, err := unit.NewFaultInjectingFetcher(fetcher, injector).FetchEmployee(ctx, "1")
+	asserter.EqualError(err, context.Canceled.Error())
+	asserter.Nil(res)
+	fetcher.AssertNotCalled(t, "FetchEmployee", mock.Anything, mock.Anything)
+}
+
+func TestFaultInjectingTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"id":1,"employee_name":"Tiger Nixon"}}`))
+	}))
+	defer upstream.Close()
+
+	testCases := []struct {
+		desc                string
+		rules               []unit.FaultRule
+		path                string
+		expectedErr         bool
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			desc:                "no faults",
+			path:                "/api/v1/employee/1",
+			expectedStatus:      200,
+			expectedContentType: "application/json",
+			expectedBody:        `{"status":"success","data":{"id":1,"employee_name":"Tiger Nixon"}}`,
+		},
+		{
+			desc:        "error",
+			rules:       []unit.FaultRule{{Kind: unit.FaultError, Probability: 1}},
+			path:        "/api/v1/employee/1",
+			expectedErr: true,
+		},
+		{
+			desc:                "status defaults to 503",
+			rules:               []unit.FaultRule{{Kind: unit.FaultStatus, Probability: 1}},
+			path:                "/api/v1/employee/1",
+			expectedStatus:      503,
+			expectedContentType: "text/plain",
+			expectedBody:        "injected fault",
+		},
+		{
+			desc:                "explicit status",
+			rules:               []unit.FaultRule{{Kind: unit.FaultStatus, Probability: 1, Status: 429}},
+			path:                "/api/v1/employee/1",
+			expectedStatus:      429,
+			expectedContentType: "text/plain",
+			expectedBody:        "injected fault",
+		},
+		{
+			desc:                "wrong content type",
+			rules:               []unit.FaultRule{{Kind: unit.FaultWrongContentType, Probability: 1}},
+			path:                "/api/v1/employee/1",
+			expectedStatus:      200,
+			expectedContentType: "text/html",
+			expectedBody:        "<html><body><h1>Service Unavailable</h1></body></html>",
+		},
+		{
+			desc:                "truncated body",
+			rules:               []unit.FaultRule{{Kind: unit.FaultTruncatedBody, Probability: 1}},
+			path:                "/api/v1/employee/1",
+			expectedStatus:      200,
+			expectedContentType: "application/json",
+			expectedBody:        `{"status":"success","data":{"id":`,
+		},
+		{
+			desc:                "per id rule for someone else",
+			rules:               []unit.FaultRule{{Kind: unit.FaultError, Probability: 1, EmployeeIDs: []domain.EmployeeID{"2"}}},
+			path:                "/api/v1/employee/1",
+			expectedStatus:      200,
+			expectedContentType: "application/json",
+			expectedBody:        `{"status":"success","data":{"id":1,"employee_name":"Tiger Nixon"}}`,
+		},
+		{
+			desc:        "per id rule matching",
+			rules:       []unit.FaultRule{{Kind: unit.FaultError, Probability: 1, EmployeeIDs: []domain.EmployeeID{"2"}}},
+			path:        "/api/v1/employee/2",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			var slept []time.Duration
+			injector := newTestFaultInjector(unit.FaultConfig{Enabled: true, Rules: tc.rules}, &slept)
+			client := &http.Client{Transport: unit.NewFaultInjectingTransport(nil, injector)}
+
+			res, err := client.Get(upstream.URL + tc.path)
+			if tc.expectedErr {
+				asserter.Error(err)
+				asserter.Contains(err.Error(), unit.ErrInjectedFault.Error())
+				return
+			}
+			if !asserter.NoError(err) {
+				return
+			}
+			defer res.Body.Close()
+			body, err := ioutil.ReadAll(res.Body)
+			asserter.NoError(err)
+			asserter.Equal(tc.expectedStatus, res.StatusCode)
+			asserter.Equal(tc.expectedContentType, res.Header.Get("Content-Type"))
+			asserter.Equal(tc.expectedBody, string(body))
+		})
+	}
+}
+
+func TestFaultInjectingTransport_BreaksTheFetcher(t *testing.T) {
+	asserter := assert.New(t)
+
+	var slept []time.Duration
+	injector := newTestFaultInjector(unit.FaultConfig{
+		Enabled: true,
+		Rules:   []unit.FaultRule{{Kind: unit.FaultLatency, Probability: 1, LatencyMS: 250}, {Kind: unit.FaultTruncatedBody, Probability: 1}},
+	}, &slept)
+	recorder, err := cassette.New(filepath.Join("fixture", "cassettes", "employee_found.json"), cassette.ModeStrict, nil)
+	asserter.NoError(err)
+	testInstance := unit.NewRemoteEmployeeFetcher("http://dummy.restapiexample.com", unit.WithTransport(unit.NewFaultInjectingTransport(recorder, injector)))
+
+	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), "1")
+	asserter.Error(err)
+	asserter.Nil(res)
+	asserter.Equal([]time.Duration{250 * time.Millisecond}, slept)
+}
+
+func TestAdminFaults(t *testing.T) {
+	asserter := assert.New(t)
+
+	var slept []time.Duration
+	injector := newTestFaultInjector(unit.FaultConfig{}, &slept)
+
+	builder := testutil.NewServerBuilder(t).ExpectEmployee("1", testutil.NewRemoteEmployee().Build())
+	client := builder.
+		WithFetcher(unit.NewFaultInjectingFetcher(builder.Fetcher(), injector)).
+		WithFaults(injector).
+		Start()
+
+	res := client.Get("/admin/faults", nil)
+	asserter.Equal(200, res.Status)
+	asserter.Equal("{\"enabled\":false,\"rules\":null}\n", res.Body)
+
+	_, _, res = client.GetEmployee("1", nil)
+	asserter.Equal(200, res.Status)
+
+	res = client.PutJSON("/admin/faults", `{"enabled":true,"rules":[{"kind":"error","probability":1}]}`)
+	asserter.Equal(200, res.Status)
+	asserter.Equal("{\"enabled\":true,\"rules\":[{\"kind\":\"error\",\"probability\":1}]}\n", res.Body)
+	asserter.Equal(unit.FaultConfig{Enabled: true, Rules: []unit.FaultRule{{Kind: unit.FaultError, Probability: 1}}}, injector.Config())
+
+	_, problem, res := client.GetEmployee("1", nil)
+	asserter.Equal(500, res.Status)
+	asserter.Equal("something terrible happened", problem.Detail)
+
+	// ids get normalized the same way the employee endpoint does it
+	res = client.PutJSON("/admin/faults", `{"enabled":true,"rules":[{"kind":"error","probability":1,"employee_ids":["001","EMP-007"]}]}`)
+	asserter.Equal(200, res.Status)
+	asserter.Equal("{\"enabled\":true,\"rules\":[{\"kind\":\"error\",\"probability\":1,\"employee_ids\":[\"1\",\"emp-7\"]}]}\n", res.Body)
+
+	_, problem, res = client.GetEmployee("1", nil)
+	asserter.Equal(500, res.Status)
+	asserter.Equal("something terrible happened", problem.Detail)
+
+	res = client.PutJSON("/admin/faults", `{"enabled":false}`)
+	asserter.Equal(200, res.Status)
+
+	_, _, res = client.GetEmployee("1", nil)
+	asserter.Equal(200, res.Status)
+}
+
+func TestAdminFaults_ContentNegotiation(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).
+		WithFaults(unit.NewFaultInjector(unit.FaultConfig{Enabled: true, Rules: []unit.FaultRule{
+			{Kind: unit.FaultError, Probability: 0.5, EmployeeIDs: []domain.EmployeeID{"2", "emp-7"}},
+			{Kind: unit.FaultLatency, Probability: 1, LatencyMS: 250},
+		}})).
+		Start()
+
+	res := client.Get("/admin/faults", map[string]string{"Accept": "application/xml"})
+	asserter.Equal(200, res.Status)
+	asserter.Equal("application/xml; charset=utf-8", res.Header.Get("Content-Type"))
+	asserter.Equal(xml.Header+"<faults><enabled>true</enabled><rules>"+
+		"<rule><kind>error</kind><probability>0.5</probability><employee_id>2</employee_id><employee_id>emp-7</employee_id></rule>"+
+		"<rule><kind>latency</kind><probability>1</probability><latency_ms>250</latency_ms></rule>"+
+		"</rules></faults>", res.Body)
+
+	res = client.Get("/admin/faults", map[string]string{"Accept": "text/csv"})
+	asserter.Equal(406, res.Status)
+}
+
+func TestAdminFaults_Invalid(t *testing.T) {
+	testCases := []struct {
+		desc string
+		body string
+	}{
+		{
+			desc: "not json",
+			body: `nope`,
+		},
+		{
+			desc: "unknown field",
+			body: `{"enabled":true,"chaos":"maximum"}`,
+		},
+		{
+			desc: "bad rules",
+			body: `{"enabled":true,"rules":[{"kind":"gremlins","probability":2},{"kind":"status","probability":1,"status":42,"latency_ms":-1}]}`,
+		},
+		{
+			desc: "bad employee ids",
+			body: `{"enabled":true,"rules":[{"kind":"error","probability":1,"employee_ids":["1","abc","-5"]}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			injector := unit.NewFaultInjector(unit.FaultConfig{})
+			client := testutil.NewServerBuilder(t).WithFaults(injector).Start()
+
+			res := client.PutJSON("/admin/faults", tc.body)
+			asserter.Equal(400, res.Status)
+			testutil.AssertGolden(t, res)
+			asserter.Equal(unit.FaultConfig{}, injector.Config())
+		})
+	}
+}
+
+func TestAdminFaults_NotServedWithoutInjector(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).Start()
+
+	res := client.Get("/admin/faults", nil)
+	asserter.Equal(404, res.Status)
+}
+
+func TestOpenAPI_DocumentsAdminFaults(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := testutil.NewServerBuilder(t).WithFaults(unit.NewFaultInjector(unit.FaultConfig{})).Build()
+	spec, err := testInstance.OpenAPI()
+	asserter.NoError(err)
+	asserter.Equal("putFaults", spec.Paths["/admin/faults"]["put"].OperationID)
+	asserter.Equal(&unit.RequestBody{
+		Required: true,
+		Content:  map[string]unit.MediaType{"application/json": {&unit.Schema{Ref: "#/components/schemas/FaultConfig"}}},
+	}, spec.Paths["/admin/faults"]["put"].RequestBody)
+	asserter.Contains(spec.Components.Schemas, "FaultRule")
+}
@@ -0,0 +1,17 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+)
+
+// GenerationsEndpoint hands out every generation and the birth years it covers, so clients don't have to hardcode them
+func (s *SomeServer) GenerationsEndpoint(ctx context.Context, _ interface{}) (interface{}, error) {
+	return s.localizer(ctx).Catalog(domain.Catalog()), nil
+}
+
+func decodeNothing(_ context.Context, _ *http.Request) (interface{}, error) {
+	return nil, nil
+}
@@ -0,0 +1,59 @@
+package unit_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerationsEndpoint(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		accept         string
+		expectedStatus int
+	}{
+		{"json", "application/json", 200},
+		{"xml", "application/xml", 200},
+		{"csv", "text/csv", 200},
+		{"not acceptable", "text/html", 406},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			client := testutil.NewServerBuilder(t).Start()
+
+			res := client.Get("/generations", map[string]string{"Accept": tc.accept})
+			asserter.Equal(tc.expectedStatus, res.Status)
+			testutil.AssertGolden(t, res)
+		})
+	}
+}
+
+func TestGenerationsEndpoint_MatchesMapBirthYear(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).Start()
+	res := client.Get("/generations", nil)
+	catalog := domain.GenerationCatalog{}
+	asserter.NoError(json.Unmarshal([]byte(res.Body), &catalog))
+	asserter.Len(catalog, len(domain.All()))
+
+	// what we tell clients had better be what we actually do
+	for _, entry := range catalog {
+		from, to := entry.From, entry.To
+		if from == 0 {
+			from = to - 100
+		}
+		if to == 0 {
+			to = from + 100
+		}
+		for year := from; year <= to; year++ {
+			asserter.Equal(entry.Name, unit.MapBirthYear(year), "%d", year)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/graphql"
+	"github.com/pkg/errors"
+)
+
+// GraphQL at /graphql, the graphql package does the actual work. All that's in here is getting requests in and out
+// over http, and handing it upstream to look employees up in.
+
+func (s *SomeServer) decodeGraphQL(ctx context.Context, r *http.Request) (interface{}, error) {
+	loc := s.localizer(ctx)
+	ret := new(graphql.Request)
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		ret.Query = query.Get("query")
+		ret.OperationName = query.Get("operationName")
+		if raw := query.Get("variables"); len(raw) > graphql.MaxBodyBytes {
+			return nil, invalidParamsProblem(invalidParam(loc, "variables", "max_bytes", graphql.MaxBodyBytes))
+		} else if raw != "" {
+			decoder := json.NewDecoder(strings.NewReader(raw))
+			decoder.UseNumber()
+			if err := decoder.Decode(&ret.Variables); err != nil {
+				return nil, invalidParamsProblem(domain.InvalidParam{Name: "variables", Reason: err.Error()})
+			}
+		}
+	} else {
+		// the whole thing gets read in before the query's size can be checked, so there's a cap on that too
+		body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, graphql.MaxBodyBytes))
+		if err != nil {
+			return nil, invalidParamsProblem(invalidParam(loc, "body", "max_bytes", graphql.MaxBodyBytes))
+		}
+		// numbers as they were written, so an Int that's too big gets caught rather than rounded
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(ret); err != nil {
+			return nil, invalidParamsProblem(domain.InvalidParam{Name: "body", Reason: err.Error()})
+		}
+	}
+
+	switch {
+	case ret.Query == "":
+		return nil, invalidParamsProblem(invalidParam(loc, "query", "required"))
+	case len(ret.Query) > graphql.MaxQueryBytes:
+		return nil, invalidParamsProblem(invalidParam(loc, "query", "max_bytes", graphql.MaxQueryBytes))
+	}
+	return ret, nil
+}
+
+// GraphQLEndpoint answers anything that's a GraphQL request at all with a GraphQL response, queries that don't parse
+// or validate included. Only requests that aren't one (no query, a body that isn't JSON) get a problem.
+func (s *SomeServer) GraphQLEndpoint(ctx context.Context, req interface{}) (interface{}, error) {
+	executor := &graphql.Executor{
+		Employees:     graphQLEmployees{fetcher: s.EmployeeFetcher, mapper: s.EmployeeMapper},
+		MaxDepth:      s.GraphQLMaxDepth,
+		MaxComplexity: s.GraphQLMaxComplexity,
+	}
+	return executor.Execute(ctx, s.localizer(ctx), req.(*graphql.Request)), nil
+}
+
+// encodeGraphQL is always JSON, GraphQL clients don't know what to do with anything else
+func (s *SomeServer) encodeGraphQL(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	setContentLanguage(w, s.localizer(ctx))
+	return kithttp.EncodeJSONResponse(ctx, w, response)
+}
+
+// graphQLEmployees looks employees up for queries the same way the rest of the service does
+type graphQLEmployees struct {
+	fetcher RemoteEmployeeFetcher
+	mapper  EmployeeConverter
+}
+
+func (g graphQLEmployees) Employee(ctx context.Context, employeeID domain.EmployeeID) (*domain.Employee, error) {
+	remote, err := g.fetcher.FetchEmployee(ctx, employeeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching employee %s", employeeID)
+	}
+	if remote == nil {
+		return nil, nil
+	}
+	employee, err := g.mapper(remote)
+	if err != nil {
+		return nil, errors.Wrapf(err, "mapping employee %s", employeeID)
+	}
+	return employee, nil
+}
+
+func (g graphQLEmployees) All(ctx context.Context) ([]domain.Employee, error) {
+	remote, err := g.fetcher.FetchEmployees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]domain.Employee, 0, len(remote))
+	for i := range remote {
+		employee, err := g.mapper(&domain.RemoteEmployee{Status: "success", Data: &remote[i]})
+		if err != nil {
+			return nil, errors.Wrapf(err, "mapping employee %d", remote[i].ID)
+		}
+		ret = append(ret, *employee)
+	}
+	return ret, nil
+}
@@ -0,0 +1,308 @@
+package unit_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/graphql"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func postGraphQL(client *testutil.Client, query string, variables map[string]interface{}, headers map[string]string) *testutil.Response {
+	body, err := json.Marshal(graphql.Request{Query: query, Variables: variables})
+	if err != nil {
+		panic(err)
+	}
+	allHeaders := map[string]string{"Content-Type": "application/json"}
+	for k, v := range headers {
+		allHeaders[k] = v
+	}
+	return client.Do("POST", "/graphql", strings.NewReader(string(body)), allHeaders)
+}
+
+func TestGraphQL(t *testing.T) {
+	tiger := testutil.NewRemoteEmployee().WithID(1).WithName("Tiger Nixon").WithAge(61).Build()
+	garrett := testutil.NewRemoteEmployee().WithID(2).WithName("Garrett Winters").WithAge(41).Build()
+
+	testCases := []struct {
+		desc      string
+		query     string
+		variables map[string]interface{}
+		headers   map[string]string
+		setup     func(b *testutil.ServerBuilder)
+	}{
+		{
+			desc:  "employee",
+			query: `{ employee(id: "1") { id name age generation { name code label from to } } }`,
+			setup: func(b *testutil.ServerBuilder) {
+				b.ExpectEmployee("1", tiger)
+			},
+		},
+		{
+			desc: "same employees asked for different ways",
+			query: `{
+				a: employee(id: "1") { name }
+				b: employee(id: 1) { age }
+				everybody: employees(ids: ["01", "2", "404"]) { id name }
+			}`,
+			setup: func(b *testutil.ServerBuilder) {
+				// each only once, the mock fails the test otherwise
+				b.Fetcher().EXPECT().FetchEmployee(mock.Anything, domain.EmployeeID("1")).Return(tiger, nil).Once()
+				b.Fetcher().EXPECT().FetchEmployee(mock.Anything, domain.EmployeeID("2")).Return(garrett, nil).Once()
+				b.Fetcher().EXPECT().FetchEmployee(mock.Anything, domain.EmployeeID("404")).Return(nil, nil).Once()
+			},
+		},
+		{
+			desc: "fragments, directives and variables",
+			query: `query Lookup($id: ID!, $withAge: Boolean = false) {
+				employee(id: $id) {
+					...basics
+					age @include(if: $withAge)
+					... on Employee { generation { code } }
+					__typename
+				}
+			}
+			fragment basics on Employee { id name }`,
+			variables: map[string]interface{}{"id": 2},
+			setup: func(b *testutil.ServerBuilder) {
+				b.ExpectEmployee("2", garrett)
+			},
+		},
+		{
+			desc:      "generations in spanish",
+			query:     `query ($name: String!) { generation(name: $name) { code label } generations { code label from to } }`,
+			variables: map[string]interface{}{"name": "boomers"},
+			headers:   map[string]string{"Accept-Language": "es"},
+		},
+		{
+			desc:  "stats over everybody",
+			query: `{ stats { count averageAge youngest { name } oldest { name } byGeneration { generation { code } count } } }`,
+			setup: func(b *testutil.ServerBuilder) {
+				b.Fetcher().EXPECT().FetchEmployees(mock.Anything).Return([]domain.RemoteEmployeeData{*tiger.Data, *garrett.Data, {ID: 3, EmployeeName: "Ashton Cox", EmployeeAge: 66}}, nil)
+			},
+		},
+		{
+			desc:  "stats for some",
+			query: `{ stats(ids: ["1", "1", "404"]) { count averageAge oldest { name } } nobody: stats(ids: []) { count averageAge oldest { name } } }`,
+			setup: func(b *testutil.ServerBuilder) {
+				b.ExpectEmployee("1", tiger)
+				b.ExpectEmployee("404", nil)
+			},
+		},
+		{
+			desc:  "field errors",
+			query: `{ broken: employee(id: "3") { name } bad: employee(id: "abc") { name } fine: employee(id: "1") { name } generation(name: "gen alpha") { code } }`,
+			setup: func(b *testutil.ServerBuilder) {
+				b.ExpectEmployee("1", tiger)
+				b.ExpectFetchError("3", errors.New("upstream is having a bad day"))
+			},
+		},
+		{
+			desc:  "errors in non null fields take out their parent",
+			query: `{ employees(ids: ["3"]) { name } }`,
+			setup: func(b *testutil.ServerBuilder) {
+				b.ExpectFetchError("3", errors.New("upstream is having a bad day"))
+			},
+		},
+		{
+			desc:  "syntax error",
+			query: `{ employee(id: "1") { name }`,
+		},
+		{
+			desc: "validation errors",
+			query: `query ($unused: Int) {
+				employee(id: "1") { salary generation }
+				employees { name }
+				generations(limit: 2) { code { nope } }
+				stats(ids: [true]) { count }
+				generation(name: $nope) { code }
+				conflict: employee(id: "1") { name }
+				conflict: employee(id: "2") { name }
+				...missing
+				... on Generation { code }
+				name @deprecated
+			}`,
+		},
+		{
+			desc:  "missing variables",
+			query: `query ($id: ID!, $name: String = "boomers") { employee(id: $id) { name } generation(name: $name) { code } }`,
+		},
+		{
+			desc:  "mutations",
+			query: `mutation { fire(id: "1") }`,
+		},
+		{
+			desc:  "several operations without a name",
+			query: `query A { generations { code } } query B { generations { label } }`,
+		},
+		{
+			desc:      "bad variables",
+			query:     `query ($ids: [ID!]!, $name: String!) { employees(ids: $ids) { name } generation(name: $name) { code } }`,
+			variables: map[string]interface{}{"ids": []interface{}{"1", 2.5}, "name": 12},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			builder := testutil.NewServerBuilder(t).
+				WithMapper(ageMapper).
+				WithMessages(loadLocales(t))
+			if tc.setup != nil {
+				tc.setup(builder)
+			}
+			client := builder.Start()
+
+			res := postGraphQL(client, tc.query, tc.variables, tc.headers)
+			asserter.Equal(200, res.Status)
+			testutil.AssertGolden(t, res)
+		})
+	}
+}
+
+func TestGraphQL_Get(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).
+		ExpectEmployee("1", testutil.NewRemoteEmployee().WithID(1).WithName("Tiger Nixon").WithAge(61).Build()).
+		WithMapper(ageMapper).
+		Start()
+
+	query := url.Values{
+		"query":     {`query ($id: ID!) { employee(id: $id) { name generation { code } } }`},
+		"variables": {`{"id": "1"}`},
+	}
+	res := client.Get("/graphql?"+query.Encode(), nil)
+	asserter.Equal(200, res.Status)
+	asserter.JSONEq(`{"data": {"employee": {"name": "Tiger Nixon", "generation": {"code": "baby_boomer"}}}}`, res.Body)
+}
+
+func TestGraphQL_NotGraphQL(t *testing.T) {
+	testCases := []struct {
+		desc string
+		do   func(client *testutil.Client) *testutil.Response
+	}{
+		{"body isn't json", func(client *testutil.Client) *testutil.Response {
+			return client.Do("POST", "/graphql", strings.NewReader("{ generations { code } }"), map[string]string{"Content-Type": "application/graphql"})
+		}},
+		{"no query", func(client *testutil.Client) *testutil.Response {
+			return client.Do("POST", "/graphql", strings.NewReader(`{"variables": {}}`), nil)
+		}},
+		{"query too big", func(client *testutil.Client) *testutil.Response {
+			return postGraphQL(client, "{ generations { code } }"+strings.Repeat(" ", 16<<10), nil, nil)
+		}},
+		{"body too big", func(client *testutil.Client) *testutil.Response {
+			return postGraphQL(client, "{ generations { code } }", map[string]interface{}{"padding": strings.Repeat("x", 64<<10)}, nil)
+		}},
+		{"variables too big", func(client *testutil.Client) *testutil.Response {
+			return client.Get("/graphql?query="+url.QueryEscape("{ generations { code } }")+"&variables="+strings.Repeat("1", 64<<10+1), nil)
+		}},
+		{"variables aren't json", func(client *testutil.Client) *testutil.Response {
+			return client.Get("/graphql?query="+url.QueryEscape("{ generations { code } }")+"&variables=nope", nil)
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			res := tc.do(testutil.NewServerBuilder(t).Start())
+			asserter.Equal(400, res.Status)
+			testutil.AssertGolden(t, res)
+		})
+	}
+}
+
+// doublingFragments is a query where every fragment spreads the next one twice, planning it by expanding every spread
+// as it comes up takes twice as long for each fragment
+func doublingFragments(count int) string {
+	query := new(strings.Builder)
+	query.WriteString("{ ...f0 }")
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(query, " fragment f%d on Query { f%d: __typename ...f%d ...f%d }", i, i, i+1, i+1)
+	}
+	fmt.Fprintf(query, " fragment f%d on Query { __typename }", count)
+	return query.String()
+}
+
+func TestGraphQL_Limits(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		maxDepth      int
+		maxComplexity int
+		query         string
+		expectedError string
+	}{
+		{"deep enough", 3, 0, `{ stats(ids: []) { oldest { name } } }`, ""},
+		{"too deep", 3, 0, `{ stats(ids: []) { oldest { generation { code } } } }`, `{"message": "Query is nested 4 levels deep, the most allowed is 3", "extensions": {"code": "QUERY_TOO_DEEP"}}`},
+		{"fragments count towards depth", 2, 0, `{ stats(ids: []) { ...f } } fragment f on Stats { oldest { name } }`, `{"message": "Query is nested 3 levels deep, the most allowed is 2", "extensions": {"code": "QUERY_TOO_DEEP"}}`},
+		// 6 generations x 3 fields, plus generations itself
+		{"simple enough", 0, 24, `{ generations { code label from } }`, ""},
+		{"too complex", 0, 23, `{ generations { code label from } __typename }`, `{"message": "Query has a complexity of 24, the most allowed is 23", "extensions": {"code": "QUERY_TOO_COMPLEX"}}`},
+		// 3 ids, and a name for each
+		{"lists multiply", 0, 5, `{ employees(ids: ["1", "2", "3"]) { name } }`, `{"message": "Query has a complexity of 6, the most allowed is 5", "extensions": {"code": "QUERY_TOO_COMPLEX"}}`},
+		{"stats over everybody is expensive", 0, 50, `{ stats { count } }`, `{"message": "Query has a complexity of 51, the most allowed is 50", "extensions": {"code": "QUERY_TOO_COMPLEX"}}`},
+		{"fragments spread more than once only get planned once", 0, 0, doublingFragments(40), ""},
+		{"fragments count towards complexity while planning", 0, 10, doublingFragments(40), `{"message": "Query selects more than 10 fields, the most allowed complexity is 10", "extensions": {"code": "QUERY_TOO_COMPLEX"}}`},
+		{"repeats count towards complexity while planning", 0, 3, `{ ...f } fragment f on Query { a: __typename a: __typename a: __typename a: __typename }`, `{"message": "Query selects more than 3 fields, the most allowed complexity is 3", "extensions": {"code": "QUERY_TOO_COMPLEX"}}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			// nothing should get looked up for queries that are turned away, and the ones that aren't don't need to
+			client := testutil.NewServerBuilder(t).
+				WithGraphQLLimits(tc.maxDepth, tc.maxComplexity).
+				Start()
+
+			res := postGraphQL(client, tc.query, nil, nil)
+			asserter.Equal(200, res.Status)
+			body := new(struct {
+				Data   json.RawMessage   `json:"data"`
+				Errors []json.RawMessage `json:"errors"`
+			})
+			asserter.NoError(json.Unmarshal([]byte(res.Body), body))
+			if tc.expectedError == "" {
+				asserter.Empty(body.Errors)
+				asserter.NotEmpty(body.Data)
+				return
+			}
+			asserter.Empty(body.Data)
+			if asserter.Len(body.Errors, 1) {
+				asserter.JSONEq(tc.expectedError, string(body.Errors[0]))
+			}
+		})
+	}
+}
+
+// TestGraphQL_BatchesLookups makes sure the lookups for a batch go out together, rather than one after another
+func TestGraphQL_BatchesLookups(t *testing.T) {
+	asserter := assert.New(t)
+
+	fetcher := &blockingFetcher{release: make(chan struct{})}
+	client := testutil.NewServerBuilder(t).
+		WithFetcher(fetcher).
+		Start()
+
+	done := make(chan *testutil.Response)
+	go func() {
+		done <- postGraphQL(client, `{ a: employee(id: "1") { id } rest: employees(ids: ["2", "3", "1"]) { id } }`, nil, nil)
+	}()
+	waitUntil(t, func() bool {
+		inFlight, _ := fetcher.counts()
+		return inFlight == 3
+	})
+	close(fetcher.release)
+
+	res := <-done
+	asserter.Equal(200, res.Status)
+	_, most := fetcher.counts()
+	asserter.Equal(3, most)
+	asserter.NotContains(res.Body, "errors")
+}
@@ -0,0 +1,124 @@
+package unit_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/i18n"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadLocales(t *testing.T) *i18n.Catalog {
+	ret, err := i18n.LoadDir("../i18n/locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestEmployeeEndpoint_Localized(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		acceptLanguage   string
+		expectedLanguage string
+		expectedLabel    string
+	}{
+		{"no preference", "", "en", "Generation X"},
+		{"spanish", "es-MX", "es", "Generación X"},
+		{"german", "de", "de", "Generation X"},
+		{"something we don't speak", "fr-CA", "en", "Generation X"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			client := testutil.NewServerBuilder(t).
+				WithMessages(loadLocales(t)).
+				WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
+					return &domain.Employee{ID: "1", Name: "Tiger Nixon", Age: 45, Generation: domain.GenX}, nil
+				}).
+				ExpectEmployee("1", &domain.RemoteEmployee{}).
+				Start()
+
+			employee, _, res := client.GetEmployee("1", map[string]string{"Accept-Language": tc.acceptLanguage})
+			asserter.Equal(200, res.Status)
+			asserter.Equal(tc.expectedLanguage, res.Header.Get("Content-Language"))
+			asserter.Contains(res.Header["Vary"], "Accept-Language")
+			// the generation itself stays put no matter the language, so clients have something stable to key off of
+			asserter.Equal(domain.GenX, employee.Generation)
+			asserter.Equal("gen_x", employee.GenerationCode)
+			asserter.Equal(tc.expectedLabel, employee.GenerationLabel)
+		})
+	}
+}
+
+func TestEmployeeEndpoint_LocalizedETags(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).
+		WithMessages(loadLocales(t)).
+		WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
+			return &domain.Employee{ID: "1", Name: "Tiger Nixon", Age: 61, Generation: domain.BabyBoomer}, nil
+		}).
+		ExpectEmployee("1", &domain.RemoteEmployee{}).
+		Start()
+
+	english := client.Get("/employee/1", nil)
+	german := client.Get("/employee/1", map[string]string{"Accept-Language": "de"})
+	asserter.NotEqual(english.Header.Get("ETag"), german.Header.Get("ETag"))
+
+	// an English copy is no good to someone asking in German
+	res := client.Get("/employee/1", map[string]string{"Accept-Language": "de", "If-None-Match": english.Header.Get("ETag")})
+	asserter.Equal(200, res.Status)
+	res = client.Get("/employee/1", map[string]string{"Accept-Language": "de", "If-None-Match": german.Header.Get("ETag")})
+	asserter.Equal(304, res.Status)
+}
+
+func TestProblems_Localized(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		path           string
+		headers        map[string]string
+		fetchErr       error
+		expectedStatus int
+	}{
+		{"not found", "/employee/2", map[string]string{"Accept-Language": "es"}, nil, 404},
+		{"invalid params", "/employee/BLAH", map[string]string{"Accept-Language": "de"}, nil, 400},
+		{"internal error", "/employee/2", map[string]string{"Accept-Language": "de"}, errors.New("KaBOOM"), 500},
+		{"not acceptable", "/employee/2", map[string]string{"Accept-Language": "es", "Accept": "text/html"}, nil, 406},
+		{"unknown route", "/nope", map[string]string{"Accept-Language": "de-AT"}, nil, 404},
+		{"xml", "/employee/2", map[string]string{"Accept-Language": "es", "Accept": "application/xml"}, nil, 404},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			builder := testutil.NewServerBuilder(t).WithMessages(loadLocales(t))
+			if tc.expectedStatus == 404 && tc.path == "/employee/2" {
+				builder.ExpectEmployee("2", nil)
+			}
+			if tc.fetchErr != nil {
+				builder.ExpectFetchError("2", tc.fetchErr)
+			}
+			client := builder.Start()
+
+			res := client.Get(tc.path, tc.headers)
+			asserter.Equal(tc.expectedStatus, res.Status)
+			asserter.NotEqual("en", res.Header.Get("Content-Language"))
+			testutil.AssertGolden(t, res)
+		})
+	}
+}
+
+func TestGenerationsEndpoint_Localized(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).WithMessages(loadLocales(t)).Start()
+
+	res := client.Get("/generations", map[string]string{"Accept-Language": "es"})
+	asserter.Equal(200, res.Status)
+	asserter.Equal("es", res.Header.Get("Content-Language"))
+	testutil.AssertGolden(t, res)
+}
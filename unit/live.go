@@ -0,0 +1,215 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NYTimes/gizmo/server/kit"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+)
+
+// The dashboard looks up hundreds of employees a session, which is a lot of round trips as individual GETs. Over a
+// websocket at /employees/live it can send ids as fast as it likes and get each employee (or problem) back as soon as
+// it's ready, in whatever order they finish in. Each message is tagged with a ref of the client's choosing so the
+// answers can be matched up.
+//
+// Each connection gets a handful of lookups going at once. When they're all busy we stop reading until one finishes,
+// and lookups that are done wait their turn to be written, so a client sending faster than it reads gets pushed back
+// on by TCP instead of us piling up work and results on its behalf.
+
+const (
+	defaultLiveConcurrency = 8
+	// liveMaxMessageBytes is plenty for an id and a ref, anything bigger isn't a lookup
+	liveMaxMessageBytes = 4 << 10
+	// liveWriteTimeout is how long a client gets to take a message before it's assumed to be gone
+	liveWriteTimeout = 10 * time.Second
+)
+
+// LiveLookupRequest is what clients send, Ref is handed back untouched with the answer
+type LiveLookupRequest struct {
+	Ref        string `json:"ref"`
+	EmployeeID string `json:"employee_id"`
+}
+
+// LiveLookupResult is the answer to a LiveLookupRequest, with either the employee or a problem saying why there isn't
+// one. Messages that couldn't be made sense of get an answer with an empty ref.
+type LiveLookupResult struct {
+	Ref      string           `json:"ref"`
+	Employee *domain.Employee `json:"employee,omitempty"`
+	Error    *domain.Error    `json:"error,omitempty"`
+}
+
+// decodeLiveLookups turns away anything that isn't a websocket handshake with a problem, rather than the plain text
+// 400 the websocket package would give it
+func (s *SomeServer) decodeLiveLookups(ctx context.Context, r *http.Request) (interface{}, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return nil, invalidParamsProblem(invalidParam(s.localizer(ctx), "Upgrade", "websocket"))
+	}
+	return r, nil
+}
+
+// LiveLookupsEndpoint has nothing to do, the connection doesn't exist until the handshake happens in the encoder
+func (s *SomeServer) LiveLookupsEndpoint(_ context.Context, req interface{}) (interface{}, error) {
+	return req, nil
+}
+
+// encodeLiveLookups does the handshake and then serves lookups until the client goes away
+func (s *SomeServer) encodeLiveLookups(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	r := response.(*http.Request)
+	websocket.Server{
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			return s.checkLiveOrigin(r)
+		},
+		Handler: func(conn *websocket.Conn) {
+			s.serveLiveLookups(ctx, conn)
+		},
+	}.ServeHTTP(w, r)
+	return nil
+}
+
+// checkLiveOrigin keeps other sites' pages out. Nothing here is behind a login, but it is behind the network, and
+// browsers don't apply the same origin policy to websockets, so without this any page someone on the network visits
+// could read employees through them. Pages from the server's own origin and LiveOrigins are let in, as is anything
+// that doesn't send an Origin, which browsers always do.
+func (s *SomeServer) checkLiveOrigin(r *http.Request) error {
+	raw := r.Header.Get("Origin")
+	if raw == "" {
+		return nil
+	}
+	origin, err := url.Parse(raw)
+	if err != nil {
+		return errors.Wrapf(err, "bad origin %q", raw)
+	}
+	if strings.EqualFold(origin.Host, r.Host) {
+		return nil
+	}
+	for _, allowed := range s.LiveOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin.Scheme+"://"+origin.Host) {
+			return nil
+		}
+	}
+	return errors.Errorf("origin %s isn't allowed", raw)
+}
+
+func (s *SomeServer) liveConcurrency() int {
+	if s.LiveConcurrency <= 0 {
+		return defaultLiveConcurrency
+	}
+	return s.LiveConcurrency
+}
+
+func (s *SomeServer) serveLiveLookups(ctx context.Context, conn *websocket.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer conn.Close()
+	conn.MaxPayloadBytes = liveMaxMessageBytes
+	// the server's read timeout is meant for requests, and can still be set on the hijacked connection. The dashboard
+	// can sit there as long as it wants between lookups.
+	_ = conn.SetReadDeadline(time.Time{})
+	// picked once, from the handshake's Accept-Language
+	loc := s.localizer(ctx)
+	instance, _ := ctx.Value(kithttp.ContextKeyRequestPath).(string)
+
+	// unbuffered, the backpressure is lookups holding on to their slot until the writer takes their result
+	results := make(chan LiveLookupResult)
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for result := range results {
+			_ = conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+			if err := websocket.JSON.Send(conn, result); err != nil {
+				// gone or stuck, either way nothing else is getting through. Closing gets the reader unstuck.
+				_ = kit.LogWarningf(ctx, "error writing live lookup result, closing connection: %s", err)
+				cancel()
+				_ = conn.Close()
+				return
+			}
+		}
+	}()
+	send := func(result LiveLookupResult) {
+		select {
+		case results <- result:
+		case <-ctx.Done():
+		}
+	}
+	sendProblem := func(ref string, problem *statusResponse) {
+		body := problem.localize(loc).res.(domain.Error)
+		body.Instance = instance
+		send(LiveLookupResult{Ref: ref, Error: &body})
+	}
+
+	slots := make(chan struct{}, s.liveConcurrency())
+	var lookups sync.WaitGroup
+	for ctx.Err() == nil {
+		var msg []byte
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			if err == websocket.ErrFrameTooLarge {
+				// the rest of the frame is still sitting on the wire, there's no carrying on after this
+				sendProblem("", invalidParamsProblem(invalidParam(loc, "message", "max_bytes", liveMaxMessageBytes)))
+			}
+			break
+		}
+		req := new(LiveLookupRequest)
+		if err := json.Unmarshal(msg, req); err != nil {
+			sendProblem("", invalidParamsProblem(domain.InvalidParam{Name: "message", Reason: err.Error()}))
+			continue
+		}
+		employeeID, err := domain.ParseEmployeeID(req.EmployeeID)
+		if err != nil {
+			sendProblem(req.Ref, invalidParamsProblem(invalidParam(loc, "employee_id", "malformed_employee_id")))
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+		lookups.Add(1)
+		go func(ref string) {
+			defer lookups.Done()
+			defer func() { <-slots }()
+			employee, problem := s.liveLookup(ctx, employeeID)
+			if problem != nil {
+				sendProblem(ref, problem)
+				return
+			}
+			send(LiveLookupResult{Ref: ref, Employee: employee})
+		}(req.Ref)
+	}
+
+	// the client hung up or the connection broke, whatever is still being looked up has nobody to go to
+	cancel()
+	lookups.Wait()
+	close(results)
+	<-writerDone
+}
+
+// liveLookup is EmployeeEndpoint, with panics turned into problems since they'd otherwise take out the whole process
+// rather than just the request
+func (s *SomeServer) liveLookup(ctx context.Context, employeeID domain.EmployeeID) (employee *domain.Employee, problem *statusResponse) {
+	defer func() {
+		if x := recover(); x != nil {
+			_ = kit.LogErrorf(ctx, "panic looking up employee %s: %v\n%s", employeeID, x, debug.Stack())
+			employee, problem = nil, internalErrorProblem()
+		}
+	}()
+
+	res, err := s.EmployeeEndpoint(ctx, employeeID)
+	if err != nil {
+		if problem, ok := err.(*statusResponse); ok {
+			return nil, problem
+		}
+		return nil, internalErrorProblem()
+	}
+	return res.(*domain.Employee), nil
+}
@@ -0,0 +1,248 @@
+package unit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func dialLive(t *testing.T, client *testutil.Client, header http.Header) *websocket.Conn {
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(client.BaseURL, "http")+"/employees/live", client.BaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header != nil {
+		config.Header = header
+	}
+	ret, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = ret.Close()
+	})
+	return ret
+}
+
+// readLive reads count results, keyed by ref since they can show up in any order
+func readLive(t *testing.T, conn *websocket.Conn, count int) map[string]unit.LiveLookupResult {
+	ret := make(map[string]unit.LiveLookupResult)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < count; i++ {
+		var result unit.LiveLookupResult
+		if err := websocket.JSON.Receive(conn, &result); err != nil {
+			t.Fatalf("only got %d of %d results: %s", i, count, err)
+		}
+		ret[result.Ref] = result
+	}
+	return ret
+}
+
+func TestLiveLookups(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).
+		ExpectEmployee("1", testutil.NewRemoteEmployee().WithID(1).WithName("Tiger Nixon").WithAge(61).Build()).
+		ExpectEmployee("emp-2", nil).
+		ExpectFetchError("3", errors.New("upstream is having a bad day")).
+		WithMapper(ageMapper).
+		WithMessages(loadLocales(t)).
+		Start()
+	conn := dialLive(t, client, http.Header{"Accept-Language": {"es"}})
+
+	for _, msg := range []string{
+		`{"ref": "a", "employee_id": "1"}`,
+		`{"ref": "b", "employee_id": "EMP-0002"}`,
+		`{"ref": "c", "employee_id": "3"}`,
+		`{"ref": "d", "employee_id": "abc"}`,
+	} {
+		asserter.NoError(websocket.Message.Send(conn, msg))
+	}
+	results := readLive(t, conn, 4)
+
+	if asserter.NotNil(results["a"].Employee) {
+		asserter.Equal("1", results["a"].Employee.ID)
+		asserter.Equal("Tiger Nixon", results["a"].Employee.Name)
+		asserter.Equal("baby_boomer", results["a"].Employee.GenerationCode)
+	}
+	asserter.Nil(results["a"].Error)
+
+	expectedProblems := map[string]*domain.Error{
+		"b": {
+			Type:     domain.ProblemTypeEmployeeNotFound,
+			Title:    "Empleado no encontrado",
+			Status:   404,
+			Detail:   "no existe ningún empleado con el id emp-2",
+			Instance: "/employees/live",
+		},
+		"c": {
+			Type:     domain.ProblemTypeBlank,
+			Title:    "Error interno del servidor",
+			Status:   500,
+			Detail:   "algo terrible ha ocurrido",
+			Instance: "/employees/live",
+		},
+	}
+	for ref, expected := range expectedProblems {
+		asserter.Nil(results[ref].Employee, ref)
+		asserter.Equal(expected, results[ref].Error, ref)
+	}
+	if asserter.NotNil(results["d"].Error) {
+		asserter.Equal(domain.ProblemTypeInvalidParams, results["d"].Error.Type)
+		asserter.Equal(domain.InvalidParamList{{Name: "employee_id", Reason: "id de empleado mal formado"}}, results["d"].Error.InvalidParams)
+	}
+
+	// junk doesn't cost the connection
+	asserter.NoError(websocket.Message.Send(conn, `{"ref": `))
+	junk := readLive(t, conn, 1)[""]
+	if asserter.NotNil(junk.Error) {
+		asserter.Equal(domain.ProblemTypeInvalidParams, junk.Error.Type)
+		asserter.Equal("message", junk.Error.InvalidParams[0].Name)
+	}
+	asserter.NoError(websocket.Message.Send(conn, `{"ref": "e", "employee_id": "emp-2"}`))
+	asserter.Equal(domain.ProblemTypeEmployeeNotFound, readLive(t, conn, 1)["e"].Error.Type)
+}
+
+func TestLiveLookups_MessageTooLarge(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).Start()
+	conn := dialLive(t, client, nil)
+
+	asserter.NoError(websocket.Message.Send(conn, `{"ref": "`+strings.Repeat("x", 5000)+`", "employee_id": "1"}`))
+	result := readLive(t, conn, 1)[""]
+	if asserter.NotNil(result.Error) {
+		asserter.Equal(domain.InvalidParamList{{Name: "message", Reason: "must be at most 4096 bytes"}}, result.Error.InvalidParams)
+	}
+	var msg string
+	asserter.Error(websocket.Message.Receive(conn, &msg), "the connection should have been closed")
+}
+
+func TestLiveLookups_NotWebsocket(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).Start()
+
+	res := client.Get("/employees/live", nil)
+	asserter.Equal(400, res.Status)
+	testutil.AssertGolden(t, res)
+}
+
+// blockingFetcher holds every lookup until released, keeping track of how many it's holding at once
+type blockingFetcher struct {
+	release chan struct{}
+
+	mu       sync.Mutex
+	inFlight int
+	most     int
+}
+
+func (f *blockingFetcher) FetchEmployee(ctx context.Context, employeeID domain.EmployeeID) (*domain.RemoteEmployee, error) {
+	f.mu.Lock()
+	f.inFlight++
+	if f.inFlight > f.most {
+		f.most = f.inFlight
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	select {
+	case <-f.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return testutil.NewRemoteEmployee().Build(), nil
+}
+
+func (f *blockingFetcher) FetchEmployees(context.Context) ([]domain.RemoteEmployeeData, error) {
+	return nil, errors.New("not used here")
+}
+
+func (f *blockingFetcher) counts() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.inFlight, f.most
+}
+
+func TestLiveLookups_ConcurrencyLimit(t *testing.T) {
+	asserter := assert.New(t)
+
+	fetcher := &blockingFetcher{release: make(chan struct{})}
+	client := testutil.NewServerBuilder(t).
+		WithFetcher(fetcher).
+		WithLiveConcurrency(2).
+		Start()
+	conn := dialLive(t, client, nil)
+
+	refs := []string{"a", "b", "c", "d", "e"}
+	for _, ref := range refs {
+		asserter.NoError(websocket.JSON.Send(conn, unit.LiveLookupRequest{Ref: ref, EmployeeID: "1"}))
+	}
+	waitUntil(t, func() bool {
+		inFlight, _ := fetcher.counts()
+		return inFlight == 2
+	})
+	// give anything that shouldn't be starting a chance to
+	time.Sleep(50 * time.Millisecond)
+	inFlight, _ := fetcher.counts()
+	asserter.Equal(2, inFlight)
+
+	close(fetcher.release)
+	results := readLive(t, conn, len(refs))
+	for _, ref := range refs {
+		asserter.NotNil(results[ref].Employee, ref)
+	}
+	_, most := fetcher.counts()
+	asserter.Equal(2, most)
+}
+
+func TestLiveLookups_Origin(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		origin   string
+		expectOK bool
+	}{
+		{"same origin", "", true},
+		{"allowed", "https://dashboard.example.com", true},
+		{"allowed, any case", "HTTPS://Dashboard.Example.com", true},
+		{"some other site", "https://evil.example.com", false},
+		{"allowed host but not scheme", "http://dashboard.example.com", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			client := testutil.NewServerBuilder(t).
+				WithLiveOrigins("https://dashboard.example.com/").
+				Start()
+			origin := tc.origin
+			if origin == "" {
+				origin = client.BaseURL
+			}
+			conn, err := websocket.Dial("ws"+strings.TrimPrefix(client.BaseURL, "http")+"/employees/live", "", origin)
+			if tc.expectOK {
+				if asserter.NoError(err) {
+					_ = conn.Close()
+				}
+				return
+			}
+			if asserter.Error(err) {
+				asserter.Contains(err.Error(), "bad status")
+			}
+		})
+	}
+}
@@ -0,0 +1,540 @@
+package unit
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/graphql"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This is a deliberately small slice of OpenAPI 3, just enough to describe what we serve. If this ever needs to grow
+// much it's probably time to pull in a library rather than keep hand rolling the document types.
+
+type OpenAPIDocument struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       OpenAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components OpenAPIComponents                `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// operationDoc is everything HTTPEndpoints doesn't already tell us about a route
+type operationDoc struct {
+	OperationID string
+	Summary     string
+	Parameters  []Parameter
+	// Request is a value of whatever type the endpoint expects as a JSON body, nil for endpoints without one
+	Request interface{}
+	// Response is a value of whatever type the endpoint returns on success, nil for endpoints with no body
+	Response interface{}
+	// Status is what the endpoint answers with on success, 200 if left zero
+	Status int
+	// RawJSON marks endpoints that skip content negotiation and always answer with JSON
+	RawJSON bool
+	// Structured marks endpoints that negotiate between everything but the flat codecs, see encodeStructured
+	Structured bool
+	// ContentType, when set, is the only thing the endpoint answers successfully with, eg an event stream of Response
+	ContentType string
+	// Errors are the status codes the endpoint can answer with, beyond 200
+	Errors []int
+}
+
+// apiDocs is the companion to HTTPEndpoints, every route served needs an entry in here or the spec won't generate
+func (s *SomeServer) apiDocs() map[string]map[string]operationDoc {
+	ret := map[string]map[string]operationDoc{
+		"/employee/{id}": {
+			http.MethodGet: {
+				OperationID: "getEmployee",
+				Summary:     "Look up an employee and the generation they belong to",
+				Parameters: []Parameter{
+					{
+						Name:        "id",
+						In:          "path",
+						Description: "a numeric id, prefixed id (emp-123) or UUID",
+						Required:    true,
+						Schema:      &Schema{Type: "string"},
+					},
+				},
+				Response: domain.Employee{},
+				Errors: []int{
+					http.StatusNotModified,
+					http.StatusBadRequest,
+					http.StatusNotFound,
+					http.StatusNotAcceptable,
+					http.StatusInternalServerError,
+				},
+			},
+		},
+		"/employees/live": {
+			http.MethodGet: {
+				OperationID: "liveEmployeeLookups",
+				Summary: "A websocket for looking up lots of employees over one connection. Send " +
+					`{"ref": "...", "employee_id": "..."}` + " messages, each one gets back a message with the same ref " +
+					"and either an employee or an error (a problem), in whatever order the lookups finish in.",
+				Status: http.StatusSwitchingProtocols,
+				Errors: []int{http.StatusBadRequest, http.StatusNotAcceptable},
+			},
+		},
+		"/generations": {
+			http.MethodGet: {
+				OperationID: "listGenerations",
+				Summary:     "Every generation and the birth years it covers, oldest first",
+				Response:    domain.GenerationCatalog{},
+				Errors:      []int{http.StatusNotAcceptable, http.StatusInternalServerError},
+			},
+		},
+		"/graphql": {
+			http.MethodGet: {
+				OperationID: "graphQLQuery",
+				Summary: "Run a GraphQL query, for when POSTing is awkward. Queries that don't parse or validate still " +
+					"get a 200, with what was wrong in errors.",
+				Parameters: []Parameter{
+					{Name: "query", In: "query", Required: true, Schema: &Schema{Type: "string"}},
+					{Name: "operationName", In: "query", Schema: &Schema{Type: "string"}},
+					{Name: "variables", In: "query", Description: "a JSON object", Schema: &Schema{Type: "string"}},
+				},
+				Response: graphql.Response{},
+				RawJSON:  true,
+				Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+			},
+			http.MethodPost: {
+				OperationID: "graphQL",
+				Summary: "Run a GraphQL query over employees and generations. Queries that don't parse or validate " +
+					"still get a 200, with what was wrong in errors.",
+				Request:  graphql.Request{},
+				Response: graphql.Response{},
+				RawJSON:  true,
+				Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+			},
+		},
+		"/openapi.json": {
+			http.MethodGet: {
+				OperationID: "getOpenAPI",
+				Summary:     "This document",
+				Response:    map[string]interface{}{},
+				RawJSON:     true,
+				Errors:      []int{http.StatusInternalServerError},
+			},
+		},
+	}
+	if s.Search != nil {
+		ret["/employees/search"] = map[string]operationDoc{
+			http.MethodGet: {
+				OperationID: "searchEmployees",
+				Summary:     "Find employees by name, best matches first. Matches are exact, prefix, token or fuzzy (typos).",
+				Parameters: []Parameter{
+					{
+						Name:        "q",
+						In:          "query",
+						Description: "the name, or part of it, to look for",
+						Required:    true,
+						Schema:      &Schema{Type: "string"},
+					},
+					{
+						Name:        "limit",
+						In:          "query",
+						Description: "how many results at most, 1 to 100, defaults to 10",
+						Schema:      &Schema{Type: "integer", Format: "int32"},
+					},
+				},
+				Response: domain.EmployeeMatches{},
+				Errors: []int{
+					http.StatusBadRequest,
+					http.StatusNotAcceptable,
+					http.StatusInternalServerError,
+					http.StatusServiceUnavailable,
+				},
+			},
+		}
+	}
+	if s.Changes != nil {
+		ret["/employees/changes"] = map[string]operationDoc{
+			http.MethodGet: {
+				OperationID: "streamEmployeeChanges",
+				Summary: "Server-sent events for employees being added, removed or changed, as spotted by the roster sync. " +
+					"Send Last-Event-ID to catch up on what was missed.",
+				Parameters: []Parameter{
+					{
+						Name:        "Last-Event-ID",
+						In:          "header",
+						Description: "the id of the last change seen, changes after it still in the history get sent first",
+						Schema:      &Schema{Type: "string"},
+					},
+				},
+				Response:    domain.EmployeeChange{},
+				ContentType: "text/event-stream",
+				RawJSON:     true,
+				Errors:      []int{http.StatusBadRequest, http.StatusInternalServerError},
+			},
+		}
+	}
+	if s.Subscriptions != nil {
+		subscriptionID := Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string"}}
+		ret["/subscriptions"] = map[string]operationDoc{
+			http.MethodGet: {
+				OperationID: "listSubscriptions",
+				Summary:     "Every webhook subscription, oldest first, without their secrets",
+				Response:    SubscriptionList{},
+				Structured:  true,
+				Errors:      []int{http.StatusNotAcceptable, http.StatusInternalServerError},
+			},
+			http.MethodPost: {
+				OperationID: "createSubscription",
+				Summary: "Sign up for employee changes to be POSTed to a url. Leave the secret out to have one generated, " +
+					"either way this is the only time it's handed back.",
+				Request:    SubscriptionRequest{},
+				Response:   Subscription{},
+				Status:     http.StatusCreated,
+				Structured: true,
+				Errors:     []int{http.StatusBadRequest, http.StatusNotAcceptable, http.StatusInternalServerError},
+			},
+		}
+		ret["/subscriptions/{id}"] = map[string]operationDoc{
+			http.MethodGet: {
+				OperationID: "getSubscription",
+				Summary:     "A webhook subscription, without its secret",
+				Parameters:  []Parameter{subscriptionID},
+				Response:    Subscription{},
+				Structured:  true,
+				Errors:      []int{http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError},
+			},
+			http.MethodDelete: {
+				OperationID: "deleteSubscription",
+				Summary:     "Stop sending changes to a webhook, its dead letters go with it",
+				Parameters:  []Parameter{subscriptionID},
+				Status:      http.StatusNoContent,
+				Structured:  true,
+				Errors:      []int{http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError},
+			},
+		}
+		ret["/subscriptions/{id}/dead-letters"] = map[string]operationDoc{
+			http.MethodGet: {
+				OperationID: "listDeadLetters",
+				Summary:     "Changes that couldn't be delivered to a webhook, oldest first",
+				Parameters:  []Parameter{subscriptionID},
+				Response:    DeadLetterList{},
+				Structured:  true,
+				Errors:      []int{http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError},
+			},
+		}
+		ret["/subscriptions/{id}/dead-letters/replay"] = map[string]operationDoc{
+			http.MethodPost: {
+				OperationID: "replayDeadLetters",
+				Summary:     "Try delivering a webhook's dead letters again, in the background. Ones that fail again come back.",
+				Parameters:  []Parameter{subscriptionID},
+				Response:    ReplayResult{},
+				Status:      http.StatusAccepted,
+				Structured:  true,
+				Errors:      []int{http.StatusNotFound, http.StatusNotAcceptable, http.StatusInternalServerError},
+			},
+		}
+	}
+	if s.Sync != nil {
+		ret["/admin/sync"] = map[string]operationDoc{
+			http.MethodGet: {
+				OperationID: "getSync",
+				Summary:     "How syncing the upstream roster into the local snapshot is going",
+				Response:    SyncStatus{},
+				Structured:  true,
+				Errors:      []int{http.StatusNotAcceptable, http.StatusInternalServerError},
+			},
+			http.MethodPost: {
+				OperationID: "postSync",
+				Summary:     "Sync the snapshot now, whether it worked is in the status that comes back",
+				Response:    SyncStatus{},
+				Structured:  true,
+				Errors:      []int{http.StatusNotAcceptable, http.StatusInternalServerError},
+			},
+		}
+	}
+	if s.Faults != nil {
+		ret["/admin/faults"] = map[string]operationDoc{
+			http.MethodGet: {
+				OperationID: "getFaults",
+				Summary:     "Current fault injection config",
+				Response:    FaultConfig{},
+				Structured:  true,
+				Errors:      []int{http.StatusNotAcceptable, http.StatusInternalServerError},
+			},
+			http.MethodPut: {
+				OperationID: "putFaults",
+				Summary:     "Replace the fault injection config",
+				Request:     FaultConfig{},
+				Response:    FaultConfig{},
+				Structured:  true,
+				Errors:      []int{http.StatusBadRequest, http.StatusNotAcceptable, http.StatusInternalServerError},
+			},
+		}
+	}
+	return ret
+}
+
+// OpenAPI builds the spec for everything in HTTPEndpoints. It errors out rather than guessing if a route is missing
+// docs, or if docs exist for a route that isn't served, so the two can't quietly drift apart.
+func (s *SomeServer) OpenAPI() (*OpenAPIDocument, error) {
+	docs := s.apiDocs()
+	schemas := make(map[string]*Schema)
+	ret := &OpenAPIDocument{
+		OpenAPI:    "3.0.3",
+		Info:       OpenAPIInfo{Title: "Employee Service", Version: "1.0.0"},
+		Paths:      make(map[string]map[string]*Operation),
+		Components: OpenAPIComponents{Schemas: schemas},
+	}
+
+	errorSchema := schemaFor(reflect.TypeOf(domain.Error{}), schemas)
+	for path, methods := range s.HTTPEndpoints() {
+		for method := range methods {
+			doc, ok := docs[path][method]
+			if !ok {
+				return nil, fmt.Errorf("no api docs for %s %s", method, path)
+			}
+
+			op := &Operation{
+				OperationID: doc.OperationID,
+				Summary:     doc.Summary,
+				Parameters:  doc.Parameters,
+				Responses:   make(map[string]*Response),
+			}
+			if doc.Request != nil {
+				op.RequestBody = &RequestBody{
+					Required: true,
+					Content:  map[string]MediaType{"application/json": {schemaFor(reflect.TypeOf(doc.Request), schemas)}},
+				}
+			}
+			status := doc.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			success := &Response{Description: http.StatusText(status)}
+			switch {
+			case doc.Response == nil:
+			case doc.ContentType != "":
+				success.Content = map[string]MediaType{doc.ContentType: {schemaFor(reflect.TypeOf(doc.Response), schemas)}}
+			default:
+				success.Content = s.contentFor(schemaFor(reflect.TypeOf(doc.Response), schemas), doc, false)
+			}
+			op.Responses[strconv.Itoa(status)] = success
+			for _, code := range doc.Errors {
+				res := &Response{Description: http.StatusText(code)}
+				if code != http.StatusNotModified {
+					res.Content = s.contentFor(errorSchema, doc, true)
+				}
+				op.Responses[strconv.Itoa(code)] = res
+			}
+
+			if ret.Paths[path] == nil {
+				ret.Paths[path] = make(map[string]*Operation)
+			}
+			ret.Paths[path][strings.ToLower(method)] = op
+		}
+	}
+
+	for path, methods := range docs {
+		for method := range methods {
+			if _, ok := ret.Paths[path][strings.ToLower(method)]; !ok {
+				return nil, fmt.Errorf("api docs exist for %s %s but nothing is served there", method, path)
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// contentFor lists the schema under every media type the endpoint can respond with
+func (s *SomeServer) contentFor(schema *Schema, doc operationDoc, problem bool) map[string]MediaType {
+	codecs := s.codecs().codecs
+	switch {
+	case doc.RawJSON:
+		codecs = []Codec{JSONCodec()}
+	case doc.Structured:
+		codecs = s.codecs().Structured().codecs
+	}
+	ret := make(map[string]MediaType)
+	for _, c := range codecs {
+		contentType := c.ContentType
+		if problem {
+			contentType = c.problemContentType()
+		}
+		ret[strings.Split(contentType, ";")[0]] = MediaType{Schema: schema}
+	}
+	return ret
+}
+
+func (s *SomeServer) OpenAPIEndpoint(ctx context.Context, _ interface{}) (interface{}, error) {
+	ret, err := s.OpenAPI()
+	if err != nil {
+		_ = kit.LogErrorf(ctx, "error generating openapi spec: %+v", err)
+		return nil, internalErrorProblem()
+	}
+	return ret, nil
+}
+
+// schemaFor reflects over a type using its json tags, the same way encoding/json sees it. Named structs end up in
+// components and get referenced so they aren't repeated all over the spec.
+func schemaFor(t reflect.Type, components map[string]*Schema) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	// types that marshal themselves don't look anything like their fields. time.Time is a MarshalJSON that we know
+	// the shape of, other MarshalJSONs could be anything, and MarshalText always comes out a string.
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case implements(t, jsonMarshalerType):
+		return &Schema{}
+	case implements(t, textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: schemaFor(t.Elem(), components)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaFor(t.Elem(), components)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, components)
+		}
+		name := componentName(t)
+		if _, ok := components[name]; !ok {
+			// placeholder first so self referencing types don't recurse forever
+			components[name] = &Schema{}
+			*components[name] = *structSchema(t, components)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+// componentName is what a named struct goes by in components. The graphql package's names (Request, Error) only make
+// sense inside it, so they get GraphQL in front, which also keeps graphql.Error from landing on top of domain.Error.
+func componentName(t reflect.Type) string {
+	if t.PkgPath() == graphQLPkgPath {
+		return "GraphQL" + t.Name()
+	}
+	return t.Name()
+}
+
+var (
+	graphQLPkgPath    = reflect.TypeOf(graphql.Request{}).PkgPath()
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// implements checks pointer receivers too, encoding/json uses those for anything addressable
+func implements(t reflect.Type, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+func structSchema(t reflect.Type, components map[string]*Schema) *Schema {
+	ret := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		omitEmpty := false
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				omitEmpty = omitEmpty || opt == "omitempty"
+			}
+		}
+		// encoding/json hoists the fields of untagged embedded structs up into the parent, so we do too
+		if field.Anonymous && name == field.Name && field.Type.Kind() == reflect.Struct {
+			embedded := structSchema(field.Type, components)
+			for k, v := range embedded.Properties {
+				ret.Properties[k] = v
+			}
+			ret.Required = append(ret.Required, embedded.Required...)
+			continue
+		}
+		ret.Properties[name] = schemaFor(field.Type, components)
+		if !omitEmpty {
+			ret.Required = append(ret.Required, name)
+		}
+	}
+	sort.Strings(ret.Required)
+	return ret
+}
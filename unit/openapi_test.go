@@ -0,0 +1,192 @@
+package unit_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestOpenAPI_MatchesServedRoutes is the drift check, if someone adds a route without docs (or removes one and leaves
+// the docs behind) this is what should catch it
+func TestOpenAPI_MatchesServedRoutes(t *testing.T) {
+	asserter := assert.New(t)
+
+	changes := unit.NewChangeFeed(unit.NewEmployeeFactory(unit.MapBirthYear), 0)
+	builder := testutil.NewServerBuilder(t).
+		WithFaults(unit.NewFaultInjector(unit.FaultConfig{})).
+		WithSearch(unit.NewSearchIndex(nil, nil)).
+		WithChanges(changes).
+		WithSubscriptions(unit.NewSubscriptionDispatcher(changes, unit.NewSubscriptionStore(""), 0))
+	builder.WithSync(unit.NewSyncer(builder.Fetcher(), filepath.Join(t.TempDir(), "snapshot.json")))
+	builder.Fetcher().EXPECT().FetchEmployee(mock.Anything, mock.Anything).Return(nil, nil).Maybe()
+	builder.Fetcher().EXPECT().FetchEmployees(mock.Anything).Return(nil, nil).Maybe()
+	testInstance := builder.Build()
+	client := builder.Start()
+
+	res := client.Get("/openapi.json", nil)
+	asserter.Equal(200, res.Status)
+	asserter.Equal("application/json; charset=utf-8", res.Header.Get("Content-Type"))
+
+	spec := new(unit.OpenAPIDocument)
+	asserter.NoError(json.Unmarshal([]byte(res.Body), spec))
+
+	var served []string
+	for path, methods := range testInstance.HTTPEndpoints() {
+		for method := range methods {
+			served = append(served, method+" "+path)
+		}
+	}
+	var documented []string
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(served)
+	sort.Strings(documented)
+	asserter.Equal(served, documented)
+
+	// and make sure everything in the spec actually answers, rather than falling through to the router's not found
+	pathParam := regexp.MustCompile(`{[^}]+}`)
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			var headers map[string]string
+			if success := methods[method].Responses["200"]; success != nil {
+				if _, streams := success.Content["text/event-stream"]; streams {
+					// streams never end, a bad Last-Event-ID gets an answer out of it that still shows it's routed
+					headers = map[string]string{"Last-Event-ID": "nope"}
+				}
+			}
+			res := client.Do(strings.ToUpper(method), pathParam.ReplaceAllString(path, "1"), nil, headers)
+			problem := res.Problem()
+			if problem == nil {
+				problem = new(domain.Error)
+			}
+			asserter.NotEqual(http.StatusMethodNotAllowed, res.Status, "%s %s", method, path)
+			asserter.NotEqual(domain.ProblemTypeRouteNotFound, problem.Type, "%s %s", method, path)
+		}
+	}
+}
+
+func TestOpenAPI_ErrorResponsesDocumented(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := unit.SomeServer{Codecs: unit.NewCodecRegistry(unit.JSONCodec(), unit.XMLCodec())}
+	spec, err := testInstance.OpenAPI()
+	asserter.NoError(err)
+
+	responses := spec.Paths["/employee/{id}"]["get"].Responses
+	asserter.Equal(&unit.Response{
+		Description: "OK",
+		Content: map[string]unit.MediaType{
+			"application/json": {&unit.Schema{Ref: "#/components/schemas/Employee"}},
+			"application/xml":  {&unit.Schema{Ref: "#/components/schemas/Employee"}},
+		},
+	}, responses["200"])
+	asserter.Equal(&unit.Response{Description: "Not Modified"}, responses["304"])
+	asserter.Equal(&unit.Response{
+		Description: "Not Found",
+		Content: map[string]unit.MediaType{
+			"application/problem+json": {&unit.Schema{Ref: "#/components/schemas/Error"}},
+			"application/problem+xml":  {&unit.Schema{Ref: "#/components/schemas/Error"}},
+		},
+	}, responses["404"])
+}
+
+func TestSchemaFor(t *testing.T) {
+	asserter := assert.New(t)
+
+	type Leaf struct {
+		Name string `json:"name"`
+	}
+	type Extra struct {
+		Depth int `json:"depth,omitempty"`
+	}
+	type Tree struct {
+		Extra
+		Hidden   string `json:"-"`
+		Untagged bool
+		Count    int64            `json:"count,omitempty"`
+		Ratio    float64          `json:"ratio"`
+		Leaves   []Leaf           `json:"leaves"`
+		ByName   map[string]*Leaf `json:"by_name"`
+		Children []*Tree          `json:"children,omitempty"`
+		Inline   struct{ X int }  `json:"inline"`
+		internal string
+	}
+
+	components := make(map[string]*unit.Schema)
+	asserter.Equal(&unit.Schema{Ref: "#/components/schemas/Tree"}, unit.SchemaFor(reflect.TypeOf(&Tree{}), components))
+	asserter.Equal(map[string]*unit.Schema{
+		"Leaf": {
+			Type:       "object",
+			Properties: map[string]*unit.Schema{"name": {Type: "string"}},
+			Required:   []string{"name"},
+		},
+		"Tree": {
+			Type: "object",
+			Properties: map[string]*unit.Schema{
+				"depth":    {Type: "integer", Format: "int32"},
+				"Untagged": {Type: "boolean"},
+				"count":    {Type: "integer", Format: "int64"},
+				"ratio":    {Type: "number"},
+				"leaves":   {Type: "array", Items: &unit.Schema{Ref: "#/components/schemas/Leaf"}},
+				"by_name":  {Type: "object", AdditionalProperties: &unit.Schema{Ref: "#/components/schemas/Leaf"}},
+				"children": {Type: "array", Items: &unit.Schema{Ref: "#/components/schemas/Tree"}},
+				"inline": {
+					Type:       "object",
+					Properties: map[string]*unit.Schema{"X": {Type: "integer", Format: "int32"}},
+					Required:   []string{"X"},
+				},
+			},
+			Required: []string{"Untagged", "by_name", "inline", "leaves", "ratio"},
+		},
+	}, components)
+}
+
+// stamped marshals itself, so its fields don't mean anything to a client
+type stamped struct {
+	Secret string
+}
+
+func (stamped) MarshalJSON() ([]byte, error) {
+	return []byte(`"stamped"`), nil
+}
+
+func TestSchemaFor_Marshalers(t *testing.T) {
+	asserter := assert.New(t)
+
+	type Event struct {
+		At       time.Time         `json:"at"`
+		Finished *time.Time        `json:"finished,omitempty"`
+		Gen      domain.Generation `json:"generation"`
+		Stamp    stamped           `json:"stamp"`
+	}
+
+	components := make(map[string]*unit.Schema)
+	unit.SchemaFor(reflect.TypeOf(Event{}), components)
+	asserter.Equal(map[string]*unit.Schema{
+		"Event": {
+			Type: "object",
+			Properties: map[string]*unit.Schema{
+				"at":         {Type: "string", Format: "date-time"},
+				"finished":   {Type: "string", Format: "date-time"},
+				"generation": {Type: "string"},
+				"stamp":      {},
+			},
+			Required: []string{"at", "generation", "stamp"},
+		},
+	}, components)
+}
@@ -0,0 +1,59 @@
+package unit
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/i18n"
+)
+
+// english is what problems say until encodeError gets a chance to translate them for whoever asked
+var english = i18n.NewCatalog().Localizer("")
+
+// newProblem builds a problem from the messages under problem.<message>, args are for the detail message
+func newProblem(code int, problemType string, message string, args ...interface{}) *statusResponse {
+	ret := newStatusResponse(domain.Error{Type: problemType, Status: code}, code)
+	ret.message = message
+	ret.args = args
+	return ret.localize(english)
+}
+
+func internalErrorProblem() *statusResponse {
+	return newProblem(http.StatusInternalServerError, domain.ProblemTypeBlank, "internal")
+}
+
+func employeeNotFoundProblem(employeeID domain.EmployeeID) *statusResponse {
+	return newProblem(http.StatusNotFound, domain.ProblemTypeEmployeeNotFound, "employee_not_found", employeeID)
+}
+
+// invalidParam renders a reason from the messages under reason.<message>. Unlike titles and details reasons can't be
+// put off until encodeError, there's one per param, so they're rendered in the request's language up front. The one
+// exception is json that won't decode, the decoder's error is about exactly what was sent and is passed on as is.
+func invalidParam(loc *i18n.Localizer, name string, message string, args ...interface{}) domain.InvalidParam {
+	return domain.InvalidParam{Name: name, Reason: loc.Message("reason."+message, args...)}
+}
+
+func invalidParamsProblem(params ...domain.InvalidParam) *statusResponse {
+	ret := newProblem(http.StatusBadRequest, domain.ProblemTypeInvalidParams, "invalid_params")
+	body := ret.res.(domain.Error)
+	body.InvalidParams = params
+	ret.res = body
+	return ret
+}
+
+func notAcceptableProblem(available []string) *statusResponse {
+	return newProblem(http.StatusNotAcceptable, domain.ProblemTypeNotAcceptable, "not_acceptable", strings.Join(available, ", "))
+}
+
+func routeNotFoundProblem() *statusResponse {
+	return newProblem(http.StatusNotFound, domain.ProblemTypeRouteNotFound, "route_not_found")
+}
+
+func searchUnavailableProblem() *statusResponse {
+	return newProblem(http.StatusServiceUnavailable, domain.ProblemTypeSearchUnavailable, "search_unavailable")
+}
+
+func subscriptionNotFoundProblem(subscriptionID string) *statusResponse {
+	return newProblem(http.StatusNotFound, domain.ProblemTypeSubscriptionNotFound, "subscription_not_found", subscriptionID)
+}
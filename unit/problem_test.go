@@ -0,0 +1,32 @@
+package unit
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError_XMLInvalidParams(t *testing.T) {
+	asserter := assert.New(t)
+
+	buf := new(bytes.Buffer)
+	err := XMLCodec().Encode(buf, invalidParamsProblem(domain.InvalidParam{Name: "id", Reason: "bad"}, domain.InvalidParam{Name: "q", Reason: "worse"}).res)
+	asserter.NoError(err)
+	asserter.Equal(`<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<problem xmlns="urn:ietf:rfc:7807"><type>/problems/invalid-params</type><title>Your request parameters didn&#39;t validate</title><status>400</status>`+
+		`<invalid-params><i><name>id</name><reason>bad</reason></i><i><name>q</name><reason>worse</reason></i></invalid-params></problem>`,
+		buf.String())
+}
+
+func TestError_CSV(t *testing.T) {
+	asserter := assert.New(t)
+
+	buf := new(bytes.Buffer)
+	err := CSVCodec().Encode(buf, invalidParamsProblem(domain.InvalidParam{Name: "id", Reason: "bad"}, domain.InvalidParam{Name: "q", Reason: "worse"}).res)
+	asserter.NoError(err)
+	asserter.Equal("type,title,status,detail,instance,invalid_params\n"+
+		"/problems/invalid-params,Your request parameters didn't validate,400,,,id: bad; q: worse\n",
+		buf.String())
+}
@@ -5,18 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
 	"github.com/pkg/errors"
 	"golang.org/x/net/publicsuffix"
 	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
+	neturl "net/url"
 )
 
+//go:generate go run github.com/vektra/mockery/v2@v2.53.7 --name RemoteEmployeeFetcher --output testutil/mocks --with-expecter
+
 // Note, I would prefer just to do a type that is a function for this since were really just passing behavior around,
 // but structs containing dependencies is way more familiar for OO folks and this will give us a good thing to
 // demonstrate mocking interfaces with testify
 type RemoteEmployeeFetcher interface {
-	FetchEmployee(ctx context.Context, employeeID int) (*RemoteEmployee, error)
+	FetchEmployee(ctx context.Context, employeeID domain.EmployeeID) (*domain.RemoteEmployee, error)
+	RemoteEmployeeLister
+}
+
+// RemoteEmployeeLister is the part of RemoteEmployeeFetcher for things that need everybody at once rather than one
+// employee at a time, like search and the snapshot syncer
+type RemoteEmployeeLister interface {
+	FetchEmployees(ctx context.Context) ([]domain.RemoteEmployeeData, error)
 }
 
 type restEmployeeFetcher struct {
@@ -24,8 +35,8 @@ type restEmployeeFetcher struct {
 	client *http.Client
 }
 
-func (r *restEmployeeFetcher) FetchEmployee(ctx context.Context, employeeID int) (*RemoteEmployee, error) {
-	url := fmt.Sprintf("%s/api/v1/employee/%d", r.apiURL, employeeID)
+func (r *restEmployeeFetcher) FetchEmployee(ctx context.Context, employeeID domain.EmployeeID) (*domain.RemoteEmployee, error) {
+	url := fmt.Sprintf("%s/api/v1/employee/%s", r.apiURL, neturl.PathEscape(employeeID.String()))
 	_ = kit.LogDebugf(ctx, "fetching url %s", url)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
@@ -43,7 +54,7 @@ func (r *restEmployeeFetcher) FetchEmployee(ctx context.Context, employeeID int)
 		return nil, errors.New(fmt.Sprintf("unexpected response code, got %d with body %s", res.StatusCode, string(body)))
 	}
 
-	remote := new(RemoteEmployee)
+	remote := new(domain.RemoteEmployee)
 	err = json.NewDecoder(res.Body).Decode(remote)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -54,7 +65,43 @@ func (r *restEmployeeFetcher) FetchEmployee(ctx context.Context, employeeID int)
 	return remote, nil
 }
 
-func NewRemoteEmployeeFetcher(apiURL string) RemoteEmployeeFetcher {
+func (r *restEmployeeFetcher) FetchEmployees(ctx context.Context) ([]domain.RemoteEmployeeData, error) {
+	url := fmt.Sprintf("%s/api/v1/employees", r.apiURL)
+	_ = kit.LogDebugf(ctx, "fetching url %s", url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return nil, errors.New(fmt.Sprintf("unexpected response code, got %d with body %s", res.StatusCode, string(body)))
+	}
+
+	remote := new(domain.RemoteEmployeeList)
+	if err := json.NewDecoder(res.Body).Decode(remote); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return remote.Data, nil
+}
+
+// FetcherOption tweaks the http client used by NewRemoteEmployeeFetcher
+type FetcherOption func(client *http.Client)
+
+// WithTransport swaps out how requests actually get made, handy for recording/replaying upstream traffic in tests
+func WithTransport(transport http.RoundTripper) FetcherOption {
+	return func(client *http.Client) {
+		client.Transport = transport
+	}
+}
+
+func NewRemoteEmployeeFetcher(apiURL string, opts ...FetcherOption) RemoteEmployeeFetcher {
 	cookieJar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
 	if err != nil {
 		panic(err)
@@ -69,6 +116,9 @@ func NewRemoteEmployeeFetcher(apiURL string) RemoteEmployeeFetcher {
 			Timeout:       0,
 		},
 	}
+	for _, opt := range opts {
+		opt(ret.client)
+	}
 
 	return ret
 }
@@ -1,14 +1,35 @@
-package unit
+package unit_test
 
 import (
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/fakeupstream"
+	"github.com/jonsabados/unit-testing-party/fixturegen"
+	"github.com/jonsabados/unit-testing-party/unit"
 	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/jonsabados/unit-testing-party/unit/testutil/cassette"
+	"github.com/jonsabados/unit-testing-party/unit/testutil/fetchercontract"
 	"github.com/stretchr/testify/assert"
-	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 )
 
+// newCassetteFetcher gives back a fetcher whose upstream traffic comes from fixture/cassettes/<name>.json. By default
+// anything not on the cassette is an error, run with CASSETTE_MODE=record to re-record against the real upstream.
+func newCassetteFetcher(t *testing.T, name string) unit.RemoteEmployeeFetcher {
+	recorder, err := cassette.New(filepath.Join("fixture", "cassettes", name+".json"), cassette.ModeFromEnv(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := recorder.Save(); err != nil {
+			t.Error(err)
+		}
+	})
+	return unit.NewRemoteEmployeeFetcher("http://dummy.restapiexample.com", unit.WithTransport(recorder))
+}
+
 func TestRemoteEmployeeFetcher_HttpError(t *testing.T) {
 	asserter := assert.New(t)
 
@@ -17,25 +38,16 @@ func TestRemoteEmployeeFetcher_HttpError(t *testing.T) {
 	}))
 	ts.Close()
 
-	testInstance := NewRemoteEmployeeFetcher(ts.URL)
-	_, err := testInstance.FetchEmployee(testutil.NewTestContext(), 1)
+	testInstance := unit.NewRemoteEmployeeFetcher(ts.URL)
+	_, err := testInstance.FetchEmployee(testutil.NewTestContext(), "1")
 	asserter.Error(err) // message will contain a random port so not gonna fuss with matching exact error
 }
 
 func TestRemoteEmployeeFetcher_NotFound(t *testing.T) {
 	asserter := assert.New(t)
 
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer r.Body.Close()
-		asserter.Equal("/api/v1/employee/1", r.RequestURI)
-		bytes, err := ioutil.ReadFile("fixture/remote_employee_not_found.json")
-		asserter.NoError(err)
-		_, _ = w.Write(bytes)
-	}))
-	defer ts.Close()
-
-	testInstance := NewRemoteEmployeeFetcher(ts.URL)
-	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), 1)
+	testInstance := newCassetteFetcher(t, "employee_not_found")
+	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), "1")
 	asserter.NoError(err)
 	asserter.Nil(res)
 }
@@ -43,16 +55,8 @@ func TestRemoteEmployeeFetcher_NotFound(t *testing.T) {
 func TestRemoteEmployeeFetcher_Non200(t *testing.T) {
 	asserter := assert.New(t)
 
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer r.Body.Close()
-		asserter.Equal("/api/v1/employee/1", r.RequestURI)
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write([]byte("stuff went terribly wrong"))
-	}))
-	defer ts.Close()
-
-	testInstance := NewRemoteEmployeeFetcher(ts.URL)
-	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), 1)
+	testInstance := newCassetteFetcher(t, "upstream_error")
+	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), "1")
 	asserter.EqualError(err, "unexpected response code, got 500 with body stuff went terribly wrong")
 	asserter.Nil(res)
 }
@@ -60,15 +64,8 @@ func TestRemoteEmployeeFetcher_Non200(t *testing.T) {
 func TestRemoteEmployeeFetcher_GarbageRendered(t *testing.T) {
 	asserter := assert.New(t)
 
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer r.Body.Close()
-		asserter.Equal("/api/v1/employee/1", r.RequestURI)
-		_, _ = w.Write([]byte("this isn't json, HA-HA!"))
-	}))
-	defer ts.Close()
-
-	testInstance := NewRemoteEmployeeFetcher(ts.URL)
-	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), 1)
+	testInstance := newCassetteFetcher(t, "upstream_garbage")
+	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), "1")
 	asserter.Error(err)
 	asserter.Nil(res)
 }
@@ -76,32 +73,115 @@ func TestRemoteEmployeeFetcher_GarbageRendered(t *testing.T) {
 func TestRemoteEmployeeFetcher_HappyPath(t *testing.T) {
 	asserter := assert.New(t)
 
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		defer r.Body.Close()
-		asserter.Equal("/api/v1/employee/1", r.RequestURI)
-		bytes, err := ioutil.ReadFile("fixture/remote_employee.json")
-		asserter.NoError(err)
-		_, _ = w.Write(bytes)
-	}))
+	testInstance := newCassetteFetcher(t, "employee_found")
+	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), "1")
+	asserter.NoError(err)
+	asserter.Equal(testutil.NewRemoteEmployee().WithID(1).WithName("Tiger Nixon").WithSalary(320800).WithAge(61).Build(), res)
+}
+
+func TestRemoteEmployeeFetcher_NonNumericID(t *testing.T) {
+	asserter := assert.New(t)
+
+	testInstance := newCassetteFetcher(t, "employee_not_found")
+	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), "emp-1")
+	asserter.NoError(err)
+	asserter.Nil(res)
+}
+
+func TestRemoteEmployeeFetcher_UnexpectedRequest(t *testing.T) {
+	asserter := assert.New(t)
+
+	// strict replay means asking for something that was never recorded is an error, rather than a trip to the internet
+	recorder, err := cassette.New(filepath.Join("fixture", "cassettes", "employee_found.json"), cassette.ModeStrict, nil)
+	asserter.NoError(err)
+	testInstance := unit.NewRemoteEmployeeFetcher("http://dummy.restapiexample.com", unit.WithTransport(recorder))
+	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), "2")
+	asserter.Error(err)
+	asserter.Contains(err.Error(), cassette.ErrNoMatch.Error())
+	asserter.Nil(res)
+}
+
+func TestRemoteEmployeeFetcher_Contract(t *testing.T) {
+	fetchercontract.Run(t, func(t *testing.T, upstream *fetchercontract.Upstream) unit.RemoteEmployeeFetcher {
+		return unit.NewRemoteEmployeeFetcher(upstream.URL)
+	})
+}
+
+// with faults switched off the fault injecting wrappers had better be invisible
+func TestFaultInjectingFetcher_Contract(t *testing.T) {
+	fetchercontract.Run(t, func(t *testing.T, upstream *fetchercontract.Upstream) unit.RemoteEmployeeFetcher {
+		injector := unit.NewFaultInjector(unit.FaultConfig{Enabled: false, Rules: []unit.FaultRule{{Kind: unit.FaultError, Probability: 1}}})
+		return unit.NewFaultInjectingFetcher(unit.NewRemoteEmployeeFetcher(upstream.URL), injector)
+	})
+}
+
+func TestFaultInjectingTransport_Contract(t *testing.T) {
+	fetchercontract.Run(t, func(t *testing.T, upstream *fetchercontract.Upstream) unit.RemoteEmployeeFetcher {
+		injector := unit.NewFaultInjector(unit.FaultConfig{Enabled: false, Rules: []unit.FaultRule{{Kind: unit.FaultTruncatedBody, Probability: 1}}})
+		return unit.NewRemoteEmployeeFetcher(upstream.URL, unit.WithTransport(unit.NewFaultInjectingTransport(nil, injector)))
+	})
+}
+
+func TestRemoteEmployeeFetcher_GeneratedFixtures(t *testing.T) {
+	dataset := fixturegen.Generate(1, 25)
+	ts := httptest.NewServer(fakeupstream.NewServer(fakeupstream.Config{Payloads: dataset.Payloads()}))
 	defer ts.Close()
 
-	testInstance := NewRemoteEmployeeFetcher(ts.URL)
-	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), 1)
+	testInstance := unit.NewRemoteEmployeeFetcher(ts.URL)
+	convert := unit.NewEmployeeFactory(unit.MapBirthYear)
+
+	for _, f := range dataset.Fixtures {
+		f := f
+		t.Run(f.ID+" "+f.Case, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			id, err := domain.ParseEmployeeID(f.ID)
+			asserter.NoError(err)
+			res, err := testInstance.FetchEmployee(testutil.NewTestContext(), id)
+			switch f.Outcome {
+			case fixturegen.OutcomeFound:
+				if !asserter.NoError(err) || !asserter.NotNil(res) {
+					return
+				}
+				employee, err := convert(res)
+				asserter.NoError(err)
+				asserter.Equal(f.ID, employee.ID)
+			case fixturegen.OutcomeNotFound:
+				asserter.NoError(err)
+				asserter.Nil(res)
+			case fixturegen.OutcomeError:
+				asserter.Error(err)
+				asserter.Nil(res)
+			}
+		})
+	}
+}
+
+func TestRemoteEmployeeFetcher_FetchEmployees(t *testing.T) {
+	asserter := assert.New(t)
+
+	ts := httptest.NewServer(fakeupstream.NewServer(fakeupstream.Config{Employees: fakeupstream.SeedEmployees()[:2]}))
+	defer ts.Close()
+
+	testInstance := unit.NewRemoteEmployeeFetcher(ts.URL)
+	res, err := testInstance.FetchEmployees(testutil.NewTestContext())
 	asserter.NoError(err)
-	asserter.Equal(&RemoteEmployee{
-		Status: "success",
-		Data: &struct {
-			ID             int    `json:"id"`
-			EmployeeName   string `json:"employee_name"`
-			EmployeeSalary int    `json:"employee_salary"`
-			EmployeeAge    int    `json:"employee_age"`
-			ProfileImage   string `json:"profile_image"`
-		}{
-			ID:             1,
-			EmployeeName:   "Tiger Nixon",
-			EmployeeSalary: 320800,
-			EmployeeAge:    61,
-			ProfileImage:   "",
-		},
+	asserter.Equal([]domain.RemoteEmployeeData{
+		{ID: 1, EmployeeName: "Tiger Nixon", EmployeeSalary: 320800, EmployeeAge: 61},
+		{ID: 2, EmployeeName: "Garrett Winters", EmployeeSalary: 170750, EmployeeAge: 63},
 	}, res)
 }
+
+func TestRemoteEmployeeFetcher_FetchEmployeesNon200(t *testing.T) {
+	asserter := assert.New(t)
+
+	ts := httptest.NewServer(fakeupstream.NewServer(fakeupstream.Config{ErrorRate: 1, ErrorStatus: http.StatusBadGateway}))
+	defer ts.Close()
+
+	testInstance := unit.NewRemoteEmployeeFetcher(ts.URL)
+	res, err := testInstance.FetchEmployees(testutil.NewTestContext())
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "unexpected response code, got 502")
+	}
+	asserter.Nil(res)
+}
@@ -0,0 +1,54 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func FuzzGetRequestID(f *testing.F) {
+	for _, seed := range []string{"123", "007", "EMP-0123", "0F8FAD5B-D9CB-469F-A165-70867728950E", "", "BLAH", "../1", "emp-", "1234567890123456789", "9223372036854775807", "9223372036854775808", "\x00", "é-1"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		asserter := assert.New(t)
+
+		r := kit.SetRouteVars(httptest.NewRequest(http.MethodGet, "/", nil), map[string]string{"id": raw})
+		req, err := new(SomeServer).getRequestID(context.Background(), r)
+		// anything we render from an upstream int has to come back as the same employee when a client hands it to us
+		if n, convErr := strconv.Atoi(raw); convErr == nil && n >= 0 && domain.EmployeeIDFromInt(n).String() == raw {
+			asserter.NoError(err)
+			asserter.Equal(domain.EmployeeIDFromInt(n), req)
+		}
+		if err != nil {
+			// anything that doesn't parse is the client's fault, never a 500
+			problem, ok := err.(*statusResponse)
+			if !asserter.True(ok, "unexpected error type %T", err) {
+				return
+			}
+			asserter.Equal(http.StatusBadRequest, problem.StatusCode())
+			asserter.Equal([]domain.InvalidParam{{Name: "id", Reason: domain.ErrMalformedEmployeeID.Error()}}, []domain.InvalidParam(problem.res.(domain.Error).InvalidParams))
+			asserter.Nil(req)
+			return
+		}
+
+		id, ok := req.(domain.EmployeeID)
+		if !asserter.True(ok, "unexpected request type %T", req) {
+			return
+		}
+		// parsing is normalizing, so doing it again shouldn't change anything
+		again, err := domain.ParseEmployeeID(id.String())
+		asserter.NoError(err)
+		asserter.Equal(id, again)
+		// and what comes out needs to be safe to drop in a url path as-is
+		asserter.NotContains(id.String(), "/")
+		asserter.NotEmpty(id.String())
+	})
+}
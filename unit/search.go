@@ -0,0 +1,328 @@
+package unit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/pkg/errors"
+)
+
+// People know names, not ids. The upstream has no way to search, so we keep our own copy of everybody and search
+// that, refreshing it every so often. It's a slice we walk through on every search, which is plenty fast for the
+// handful of employees the upstream has. If that ever stops being true it's time for a real index.
+
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchToken  = "token"
+	MatchFuzzy  = "fuzzy"
+
+	defaultSearchLimit = 10
+	maxSearchLimit     = 100
+	// fuzzy matching is a levenshtein per query token per name token, so queries are kept to something a person
+	// would actually type
+	maxSearchQueryBytes  = 256
+	maxSearchQueryTokens = 10
+)
+
+type searchEntry struct {
+	employee domain.Employee
+	tokens   []string
+}
+
+type SearchIndex struct {
+	// Now is here so tests can control time, if left nil time.Now is used
+	Now func() time.Time
+
+	lister RemoteEmployeeLister
+	mapper EmployeeConverter
+
+	mu        sync.RWMutex
+	entries   []searchEntry
+	refreshed time.Time
+}
+
+func NewSearchIndex(lister RemoteEmployeeLister, mapper EmployeeConverter) *SearchIndex {
+	return &SearchIndex{lister: lister, mapper: mapper}
+}
+
+func (s *SearchIndex) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+// Refresh reloads everybody from upstream. If that fails the index keeps what it had, stale results beat no results.
+func (s *SearchIndex) Refresh(ctx context.Context) error {
+	remote, err := s.lister.FetchEmployees(ctx)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]searchEntry, 0, len(remote))
+	for i := range remote {
+		employee, err := s.mapper(&domain.RemoteEmployee{Status: "success", Data: &remote[i]})
+		if err != nil {
+			return errors.Wrapf(err, "mapping employee %d", remote[i].ID)
+		}
+		entries = append(entries, searchEntry{employee: *employee, tokens: tokenize(employee.Name)})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = entries
+	s.refreshed = s.now()
+	return nil
+}
+
+// Run refreshes right away, and then every interval until ctx is done. Failures get logged and retried next time
+// around. An interval of zero or less means refreshing just the once, there's no sensible way to tick that often.
+func (s *SearchIndex) Run(ctx context.Context, interval time.Duration) {
+	var ticks <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			_ = kit.LogErrorf(ctx, "error refreshing search index: %+v", err)
+		}
+		select {
+		case <-ticks:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Ready is false until the first successful refresh
+func (s *SearchIndex) Ready() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !s.refreshed.IsZero()
+}
+
+// Search finds employees by name, best matches first. Ties go alphabetically so results don't shuffle around
+// between refreshes.
+func (s *SearchIndex) Search(query string, limit int) domain.EmployeeMatches {
+	queryTokens := tokenize(query)
+	if len(queryTokens) == 0 {
+		return domain.EmployeeMatches{}
+	}
+
+	s.mu.RLock()
+	entries := s.entries
+	s.mu.RUnlock()
+
+	ret := domain.EmployeeMatches{}
+	for _, e := range entries {
+		if score, kind, ok := matchName(queryTokens, e.tokens); ok {
+			ret = append(ret, domain.EmployeeMatch{Employee: e.employee, Score: score, Match: kind})
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Score != ret[j].Score {
+			return ret[i].Score > ret[j].Score
+		}
+		if ret[i].Name != ret[j].Name {
+			return ret[i].Name < ret[j].Name
+		}
+		return ret[i].ID < ret[j].ID
+	})
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret
+}
+
+// tokenize lower cases a name and splits it on anything that isn't a letter or number, so "O'Brien-Smith, Jr." is
+// o, brien, smith and jr
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// matchName scores a query against a name, trying the strictest kind of match first. Scores are banded by kind so an
+// exact match always beats a prefix match, which always beats a token match, which always beats a fuzzy one.
+func matchName(query []string, name []string) (float64, string, bool) {
+	q := strings.Join(query, " ")
+	n := strings.Join(name, " ")
+	if q == n {
+		return 1, MatchExact, true
+	}
+	// within a band, the more of the name the query covers the better
+	if strings.HasPrefix(n, q) {
+		return round(0.8 + 0.1*float64(len(q))/float64(len(n))), MatchPrefix, true
+	}
+	if exact, ok := matchTokens(query, name, 0); ok {
+		return round(0.6 + 0.19*float64(exact)/float64(len(query))), MatchToken, true
+	}
+	if edits, ok := matchTokens(query, name, -1); ok {
+		return round(0.59 * (1 - float64(edits)/float64(len([]rune(q))))), MatchFuzzy, true
+	}
+	return 0, "", false
+}
+
+// matchTokens pairs each query token up with a different name token. With maxEdits of 0 query tokens have to be
+// prefixes of name tokens, and it gives back how many were whole tokens. With maxEdits of -1 typos are allowed,
+// based on how long the query token is, and it gives back how many edits it took in total.
+func matchTokens(query []string, name []string, maxEdits int) (int, bool) {
+	used := make([]bool, len(name))
+	total := 0
+	for _, q := range query {
+		allowed := maxEdits
+		if allowed < 0 {
+			allowed = allowedEdits(q)
+		}
+
+		best, bestCost := -1, 0
+		for i, n := range name {
+			if used[i] {
+				continue
+			}
+			cost, ok := tokenCost(q, n, allowed)
+			if ok && (best < 0 || cost < bestCost) {
+				best, bestCost = i, cost
+			}
+		}
+		if best < 0 {
+			return 0, false
+		}
+		used[best] = true
+		total += bestCost
+	}
+
+	if maxEdits == 0 {
+		// for prefix matching the cost counted the partial tokens, flip it around to count the whole ones
+		return len(query) - total, true
+	}
+	return total, true
+}
+
+// tokenCost compares a query token to a name token. Without edits it's 0 for the same token and 1 for a prefix, with
+// them it's the edit distance to the name token or to the start of it, whichever is smaller.
+func tokenCost(q string, n string, allowed int) (int, bool) {
+	if allowed == 0 {
+		switch {
+		case q == n:
+			return 0, true
+		case strings.HasPrefix(n, q):
+			return 1, true
+		default:
+			return 0, false
+		}
+	}
+
+	distance := levenshtein([]rune(q), []rune(n))
+	if nr := []rune(n); len(nr) > len([]rune(q)) {
+		if d := levenshtein([]rune(q), nr[:len([]rune(q))]); d < distance {
+			distance = d
+		}
+	}
+	return distance, distance <= allowed
+}
+
+// allowedEdits is how many typos we'll put up with, short tokens get none since one edit turns "jen" into the start of
+// half the names out there
+func allowedEdits(token string) int {
+	switch n := len([]rune(token)); {
+	case n <= 3:
+		return 0
+	case n <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func levenshtein(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	ret := a
+	if b < ret {
+		ret = b
+	}
+	if c < ret {
+		ret = c
+	}
+	return ret
+}
+
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
+
+type searchRequest struct {
+	query string
+	limit int
+}
+
+func (s *SomeServer) decodeSearch(ctx context.Context, r *http.Request) (interface{}, error) {
+	loc := s.localizer(ctx)
+	var invalid []domain.InvalidParam
+	ret := searchRequest{query: r.URL.Query().Get("q"), limit: defaultSearchLimit}
+	switch tokens := len(tokenize(ret.query)); {
+	case len(ret.query) > maxSearchQueryBytes:
+		invalid = append(invalid, invalidParam(loc, "q", "max_bytes", maxSearchQueryBytes))
+	case tokens == 0:
+		invalid = append(invalid, invalidParam(loc, "q", "letter_or_number"))
+	case tokens > maxSearchQueryTokens:
+		invalid = append(invalid, invalidParam(loc, "q", "max_words", maxSearchQueryTokens))
+	}
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			invalid = append(invalid, invalidParam(loc, "limit", "number_between", 1, maxSearchLimit))
+		}
+		ret.limit = limit
+	}
+	if len(invalid) > 0 {
+		return nil, invalidParamsProblem(invalid...)
+	}
+	return ret, nil
+}
+
+// SearchEndpoint finds employees by name, see SearchIndex for how matching works
+func (s *SomeServer) SearchEndpoint(ctx context.Context, req interface{}) (interface{}, error) {
+	search := req.(searchRequest)
+	if !s.Search.Ready() {
+		return nil, searchUnavailableProblem()
+	}
+
+	loc := s.localizer(ctx)
+	ret := s.Search.Search(search.query, search.limit)
+	for i := range ret {
+		ret[i].Employee = loc.Employee(ret[i].Employee)
+	}
+	return ret, nil
+}
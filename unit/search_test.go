@@ -0,0 +1,192 @@
+package unit_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/fakeupstream"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSearchIndex gives back an index of the seed employees, loaded and ready to go. Everybody is gen x so results don't
+// change as people age.
+func newSearchIndex(t *testing.T) (*unit.SearchIndex, *fakeupstream.Server) {
+	upstream := fakeupstream.NewServer(fakeupstream.Config{Employees: fakeupstream.SeedEmployees()})
+	ts := httptest.NewServer(upstream)
+	t.Cleanup(ts.Close)
+
+	ret := unit.NewSearchIndex(unit.NewRemoteEmployeeFetcher(ts.URL), unit.NewEmployeeFactory(func(int) domain.Generation {
+		return domain.GenX
+	}))
+	if err := ret.Refresh(testutil.NewTestContext()); err != nil {
+		t.Fatal(err)
+	}
+	return ret, upstream
+}
+
+func TestSearchIndex(t *testing.T) {
+	testIndex, _ := newSearchIndex(t)
+
+	testCases := []struct {
+		desc     string
+		query    string
+		expected []string
+	}{
+		{"exact", "Tiger Nixon", []string{"Tiger Nixon exact"}},
+		{"case and punctuation don't matter", "airi-SATOU", []string{"Airi Satou exact"}},
+		{"prefix", "tig", []string{"Tiger Nixon prefix"}},
+		{"prefix across tokens", "dai rio", []string{"Dai Rios prefix"}},
+		{"shorter names cover more of the name", "jen", []string{"Jena Gaines prefix", "Jenette Caldwell prefix"}},
+		{"last name", "nixon", []string{"Tiger Nixon token"}},
+		{"out of order", "nixon tiger", []string{"Tiger Nixon token"}},
+		{"partial tokens", "nix ti", []string{"Tiger Nixon token"}},
+		{"whole token", "kelly", []string{"Cedric Kelly token"}},
+		{"typo", "nixen", []string{"Tiger Nixon fuzzy"}},
+		{"missing letter", "wiliamson", []string{"Brielle Williamson fuzzy"}},
+		{"typo in a prefix", "fitzpar", []string{"Tatyana Fitzpatrick fuzzy"}},
+		{"exact beats everything else", "paul byrd", []string{"Paul Byrd exact"}},
+		{"too many typos", "nxn", []string{}},
+		{"short tokens need to be right", "xa", []string{}},
+		{"nobody", "zzzzz", []string{}},
+		{"nothing to search for", "!!!", []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			actual := []string{}
+			for _, m := range testIndex.Search(tc.query, 0) {
+				actual = append(actual, m.Name+" "+m.Match)
+			}
+			asserter.Equal(tc.expected, actual)
+		})
+	}
+}
+
+func TestSearchIndex_Ranking(t *testing.T) {
+	asserter := assert.New(t)
+
+	testIndex, _ := newSearchIndex(t)
+
+	res := testIndex.Search("c", 0)
+	asserter.NotEmpty(res)
+	for i := 1; i < len(res); i++ {
+		asserter.True(res[i-1].Score >= res[i].Score, "%v should not come before %v", res[i-1], res[i])
+	}
+	// first names starting with c are prefix matches, shortest name first, everybody else with a c word is a token match
+	var names []string
+	for _, m := range res[:4] {
+		asserter.Equal(unit.MatchPrefix, m.Match)
+		names = append(names, m.Name)
+	}
+	asserter.Equal([]string{"Caesar Vance", "Cedric Kelly", "Colleen Hurst", "Charde Marshall"}, names)
+	asserter.Equal(unit.MatchToken, res[4].Match)
+
+	limited := testIndex.Search("c", 2)
+	asserter.Equal(res[:2], limited)
+}
+
+func TestSearchIndex_RefreshFailureKeepsWhatItHad(t *testing.T) {
+	asserter := assert.New(t)
+
+	testIndex, upstream := newSearchIndex(t)
+	upstream.Update(func(cfg *fakeupstream.Config) {
+		cfg.ErrorRate = 1
+	})
+
+	asserter.Error(testIndex.Refresh(testutil.NewTestContext()))
+	asserter.True(testIndex.Ready())
+	asserter.Len(testIndex.Search("Tiger Nixon", 0), 1)
+
+	upstream.Update(func(cfg *fakeupstream.Config) {
+		cfg.ErrorRate = 0
+		cfg.Employees = cfg.Employees[1:]
+	})
+	asserter.NoError(testIndex.Refresh(testutil.NewTestContext()))
+	asserter.Empty(testIndex.Search("Tiger Nixon", 0))
+}
+
+func TestSearchIndex_RunWithoutInterval(t *testing.T) {
+	asserter := assert.New(t)
+
+	upstream := httptest.NewServer(fakeupstream.NewServer(fakeupstream.Config{Employees: fakeupstream.SeedEmployees()}))
+	t.Cleanup(upstream.Close)
+	testIndex := unit.NewSearchIndex(unit.NewRemoteEmployeeFetcher(upstream.URL), unit.NewEmployeeFactory(unit.MapBirthYear))
+
+	// zero used to go straight into time.NewTicker and panic, now it's a single refresh
+	ctx, cancel := context.WithCancel(testutil.NewTestContext())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		testIndex.Run(ctx, 0)
+	}()
+	waitUntil(t, testIndex.Ready)
+	asserter.Len(testIndex.Search("Tiger Nixon", 0), 1)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't stop when its context was cancelled")
+	}
+}
+
+func TestSearchEndpoint(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		path           string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{"json", "/employees/search?q=jen", nil, 200},
+		{"csv", "/employees/search?q=jen", map[string]string{"Accept": "text/csv"}, 200},
+		{"xml", "/employees/search?q=jen", map[string]string{"Accept": "application/xml"}, 200},
+		{"localized", "/employees/search?q=jen", map[string]string{"Accept-Language": "es"}, 200},
+		{"limit", "/employees/search?q=c&limit=2", nil, 200},
+		{"nothing found", "/employees/search?q=zzzzz", nil, 200},
+		{"no query", "/employees/search", nil, 400},
+		{"bad limit", "/employees/search?q=jen&limit=1000", nil, 400},
+		{"bad limit localized", "/employees/search?q=jen&limit=1000", map[string]string{"Accept-Language": "de"}, 400},
+		{"query too long", "/employees/search?q=" + strings.Repeat("a", 257), nil, 400},
+		{"too many words", "/employees/search?q=" + strings.Repeat("a+", 11), nil, 400},
+		{"not acceptable", "/employees/search?q=jen", map[string]string{"Accept": "text/html"}, 406},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			testIndex, _ := newSearchIndex(t)
+			client := testutil.NewServerBuilder(t).WithSearch(testIndex).WithMessages(loadLocales(t)).Start()
+
+			res := client.Get(tc.path, tc.headers)
+			asserter.Equal(tc.expectedStatus, res.Status)
+			testutil.AssertGolden(t, res)
+		})
+	}
+}
+
+func TestSearchEndpoint_NotReady(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).WithSearch(unit.NewSearchIndex(nil, nil)).Start()
+
+	res := client.Get("/employees/search?q=jen", nil)
+	asserter.Equal(503, res.Status)
+	asserter.Equal(domain.ProblemTypeSearchUnavailable, res.Problem().Type)
+}
+
+func TestSearchEndpoint_Disabled(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).Start()
+
+	res := client.Get("/employees/search?q=jen", nil)
+	asserter.Equal(404, res.Status)
+	asserter.Equal(domain.ProblemTypeRouteNotFound, res.Problem().Type)
+}
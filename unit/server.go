@@ -5,75 +5,439 @@ import (
 	"github.com/NYTimes/gizmo/server/kit"
 	"github.com/go-kit/kit/endpoint"
 	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/i18n"
 	"google.golang.org/grpc"
 	"net/http"
-	"strconv"
+	"runtime/debug"
+	"time"
 )
 
-type Error struct {
-	Message string `json:"message"`
+// statusResponse is the same idea as kit.JSONStatusResponse, an error that knows how it should be rendered, but
+// without baking in JSON so the body can go out in whatever format the client negotiated.
+type statusResponse struct {
+	code int
+	res  interface{}
+	// message and args are where a problem's title and detail come from, so they can be re-rendered in the language
+	// the client asked for. Empty for anything that isn't a problem.
+	message string
+	args    []interface{}
+}
+
+func newStatusResponse(res interface{}, code int) *statusResponse {
+	return &statusResponse{code: code, res: res}
+}
+
+func (s *statusResponse) StatusCode() int {
+	return s.code
+}
+
+func (s *statusResponse) Error() string {
+	return http.StatusText(s.code)
+}
+
+// localize hands back a copy with the problem title and detail in the localizer's language
+func (s *statusResponse) localize(loc *i18n.Localizer) *statusResponse {
+	p, isProblem := s.res.(domain.Error)
+	if !isProblem || s.message == "" {
+		return s
+	}
+	p.Title = loc.Message("problem." + s.message + ".title")
+	p.Detail = ""
+	if i18n.Has("problem." + s.message + ".detail") {
+		p.Detail = loc.Message("problem."+s.message+".detail", s.args...)
+	}
+	ret := *s
+	ret.res = p
+	return &ret
 }
 
 type SomeServer struct {
 	EmployeeFetcher RemoteEmployeeFetcher
 	EmployeeMapper  EmployeeConverter
+	// Codecs are the formats responses can be rendered in, if left nil everything goes out as JSON
+	Codecs *CodecRegistry
+	// CacheMaxAge is how long clients may cache employees without checking back, zero means always revalidate
+	CacheMaxAge time.Duration
+	// Now is here so tests can control time, if left nil time.Now is used
+	Now func() time.Time
+	// Faults exposes fault injection config at /admin/faults when set, leave it nil in anything resembling production
+	Faults *FaultInjector
+	// Search serves /employees/search when set, something needs to be refreshing it (see SearchIndex.Run)
+	Search *SearchIndex
+	// Sync exposes snapshot sync status at /admin/sync when set, EmployeeFetcher should be wrapped with
+	// NewSnapshotFallbackFetcher for the snapshot to actually get used
+	Sync *Syncer
+	// Changes streams roster changes at /employees/changes when set, something needs to be feeding it snapshots (see
+	// Syncer.OnSnapshot)
+	Changes *ChangeFeed
+	// Subscriptions serves the webhook subscription api at /subscriptions when set, something needs to be running it
+	// for anything to get delivered (see SubscriptionDispatcher.Run)
+	Subscriptions *SubscriptionDispatcher
+	// LiveConcurrency is how many lookups each /employees/live connection can have going at once, 8 if left zero
+	LiveConcurrency int
+	// LiveOrigins are the origins (eg https://dashboard.example.com) besides the server's own that web pages can open
+	// /employees/live from
+	LiveOrigins []string
+	// GraphQLMaxDepth and GraphQLMaxComplexity are the biggest queries /graphql will run, 8 levels deep and a
+	// complexity of 1000 if left zero (see the graphql package for how complexity is worked out)
+	GraphQLMaxDepth      int
+	GraphQLMaxComplexity int
+	// Messages are the languages generation labels and problems can be rendered in, if left nil everything is English
+	Messages *i18n.Catalog
+
+	lastModified lastModifiedTracker
 }
 
 func (s *SomeServer) EmployeeEndpoint(ctx context.Context, req interface{}) (interface{}, error) {
-	employeeID := req.(int)
+	employeeID := req.(domain.EmployeeID)
 
 	remote, err := s.EmployeeFetcher.FetchEmployee(ctx, employeeID)
 	if err != nil {
 		_ = kit.LogErrorf(ctx, "error reading employee %+v", err)
-		return nil, kit.NewJSONStatusResponse(Error{"something terrible happened"}, http.StatusInternalServerError)
+		return nil, internalErrorProblem()
 	}
 	if remote == nil {
-		return nil, kit.NewJSONStatusResponse(Error{"employee not found"}, http.StatusNotFound)
+		return nil, employeeNotFoundProblem(employeeID)
 	}
 
 	ret, err := s.EmployeeMapper(remote)
 	if err != nil {
 		_ = kit.LogErrorf(ctx, "error mapping employee, result: %+v, err: %s", remote, err)
-		return nil, kit.NewJSONStatusResponse(Error{"something terrible happened"}, http.StatusInternalServerError)
+		return nil, internalErrorProblem()
 	}
 
-	return ret, nil
+	// a copy, the mapper may well hand the same employee to other requests
+	localized := s.localizer(ctx).Employee(*ret)
+	return &localized, nil
 }
 
-func getRequestID(_ context.Context, r *http.Request) (request interface{}, err error) {
-	id, err := strconv.Atoi(kit.Vars(r)["id"])
+func (s *SomeServer) getRequestID(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := domain.ParseEmployeeID(kit.Vars(r)["id"])
 	if err != nil {
-		return nil, kit.NewJSONStatusResponse(Error{"employee not found"}, http.StatusNotFound)
+		return nil, invalidParamsProblem(invalidParam(s.localizer(ctx), "id", "malformed_employee_id"))
 	}
 
 	return id, nil
 }
 
+func (s *SomeServer) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+func (s *SomeServer) codecs() *CodecRegistry {
+	if s.Codecs == nil {
+		return NewCodecRegistry(JSONCodec())
+	}
+	return s.Codecs
+}
+
+func (s *SomeServer) messages() *i18n.Catalog {
+	if s.Messages == nil {
+		return defaultMessages
+	}
+	return s.Messages
+}
+
+var defaultMessages = i18n.NewCatalog()
+
+func (s *SomeServer) localizer(ctx context.Context) *i18n.Localizer {
+	return s.messages().Localizer(i18n.AcceptLanguage(ctx))
+}
+
+func requestAccept(ctx context.Context) string {
+	accept, _ := ctx.Value(kithttp.ContextKeyRequestAccept).(string)
+	return accept
+}
+
+// negotiating wraps a decoder so requests we have no way of answering get bounced before we go do any real work
+func (s *SomeServer) negotiating(decoder kithttp.DecodeRequestFunc) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		if _, ok := s.codecs().Negotiate(requestAccept(ctx)); !ok {
+			return nil, notAcceptableProblem(s.codecs().MediaTypes())
+		}
+		return decoder(ctx, r)
+	}
+}
+
+// negotiatingStructured is negotiating for endpoints that answer with encodeStructured
+func (s *SomeServer) negotiatingStructured(decoder kithttp.DecodeRequestFunc) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		if _, ok := s.codecs().Structured().Negotiate(requestAccept(ctx)); !ok {
+			return nil, notAcceptableProblem(s.codecs().Structured().MediaTypes())
+		}
+		return decoder(ctx, r)
+	}
+}
+
+// encodeStructured is for the subscription and admin endpoints, what they answer with nests so there's no flattening
+// it into csv. They set their own status and headers the way kithttp.EncodeJSONResponse expects, and that's honored.
+func (s *SomeServer) encodeStructured(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	codec, ok := s.codecs().Structured().Negotiate(requestAccept(ctx))
+	if !ok {
+		return notAcceptableProblem(s.codecs().Structured().MediaTypes())
+	}
+	if headerer, ok := response.(kithttp.Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+	code := http.StatusOK
+	if sc, ok := response.(kithttp.StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	if code == http.StatusNoContent {
+		w.WriteHeader(code)
+		return nil
+	}
+	return writeResponse(w, codec, codec.ContentType, code, response)
+}
+
+func (s *SomeServer) encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	codec, ok := s.codecs().Negotiate(requestAccept(ctx))
+	if !ok {
+		return notAcceptableProblem(s.codecs().MediaTypes())
+	}
+	setContentLanguage(w, s.localizer(ctx))
+	return writeResponse(w, codec, codec.ContentType, http.StatusOK, response)
+}
+
+// encodeEmployee layers the caching headers on top of encodeResponse, and short circuits with a 304 when the client
+// already has what we would send
+func (s *SomeServer) encodeEmployee(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	employee := response.(*domain.Employee)
+	etag := EmployeeETag(employee)
+	// each language is its own representation with its own ETag, tracking them separately keeps clients that ask
+	// in different languages from resetting Last-Modified on each other. Only employees that were found get this far,
+	// so lookups of ids that don't exist never take up room in the tracker.
+	language := s.localizer(ctx).Language()
+	lastModified := s.lastModified.observe(employee.ID+"/"+language, etag, s.now())
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", cacheControl(s.CacheMaxAge))
+
+	if notModified(ctx, etag, lastModified) {
+		w.Header().Add("Vary", "Accept")
+		w.Header().Add("Vary", "Accept-Language")
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	return s.encodeResponse(ctx, w, response)
+}
+
+// encodeError renders anything that goes wrong as a problem, anything that isn't already one gets turned into a
+// generic 500 so we don't leak internals
+func (s *SomeServer) encodeError(ctx context.Context, err error, w http.ResponseWriter) {
+	problem, ok := err.(*statusResponse)
+	if !ok {
+		problem = internalErrorProblem()
+	}
+
+	codec, ok := s.codecs().Negotiate(requestAccept(ctx))
+	if !ok {
+		// the client won't take anything we have, problem+json is the least bad thing to tell them that with
+		codec = JSONCodec()
+		problem = notAcceptableProblem(s.codecs().MediaTypes())
+	}
+
+	loc := s.localizer(ctx)
+	problem = problem.localize(loc)
+	setContentLanguage(w, loc)
+
+	body := problem.res
+	if p, isProblem := body.(domain.Error); isProblem && p.Instance == "" {
+		p.Instance, _ = ctx.Value(kithttp.ContextKeyRequestPath).(string)
+		body = p
+	}
+
+	if err := writeResponse(w, codec, codec.problemContentType(), problem.code, body); err != nil {
+		_ = kit.LogErrorf(ctx, "error encoding error response: %+v", err)
+	}
+}
+
+func setContentLanguage(w http.ResponseWriter, loc *i18n.Localizer) {
+	w.Header().Set("Content-Language", loc.Language())
+	w.Header().Add("Vary", "Accept-Language")
+}
+
+func writeResponse(w http.ResponseWriter, codec Codec, contentType string, code int, body interface{}) error {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(code)
+	return codec.Encode(w, body)
+}
+
 func (s *SomeServer) Middleware(next endpoint.Endpoint) endpoint.Endpoint {
 	return next
 }
 
+// HTTPMiddleware turns panics into problems, otherwise they'd go out as a text/plain body from gizmo
 func (s *SomeServer) HTTPMiddleware(next http.Handler) http.Handler {
-	return next
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if x := recover(); x != nil {
+				_ = kit.LogErrorf(r.Context(), "panic handling request: %v\n%s", x, debug.Stack())
+				s.encodeError(i18n.PopulateAcceptLanguage(r.Context(), r), internalErrorProblem(), w)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (s *SomeServer) HTTPOptions() []kithttp.ServerOption {
-	return []kithttp.ServerOption{}
+	return []kithttp.ServerOption{
+		kithttp.ServerErrorEncoder(s.encodeError),
+		kithttp.ServerBefore(populateConditionalHeaders),
+		kithttp.ServerBefore(i18n.PopulateAcceptLanguage),
+	}
 }
 
 func (s *SomeServer) HTTPRouterOptions() []kit.RouterOption {
-	return []kit.RouterOption{}
+	return []kit.RouterOption{
+		kit.RouterSelect("gorilla"),
+		kit.RouterNotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// no ServerBefore for routes that don't exist, so we dig the language out ourselves
+			s.encodeError(i18n.PopulateAcceptLanguage(r.Context(), r), routeNotFoundProblem(), w)
+		})),
+	}
 }
 
 func (s *SomeServer) HTTPEndpoints() map[string]map[string]kit.HTTPEndpoint {
-	return map[string]map[string]kit.HTTPEndpoint{
+	ret := map[string]map[string]kit.HTTPEndpoint{
 		"/employee/{id}": {
 			http.MethodGet: {
 				Endpoint: s.EmployeeEndpoint,
-				Decoder:  getRequestID,
+				Decoder:  s.negotiating(s.getRequestID),
+				Encoder:  s.encodeEmployee,
+			},
+		},
+		"/employees/live": {
+			http.MethodGet: {
+				Endpoint: s.LiveLookupsEndpoint,
+				Decoder:  s.decodeLiveLookups,
+				Encoder:  s.encodeLiveLookups,
+			},
+		},
+		"/generations": {
+			http.MethodGet: {
+				Endpoint: s.GenerationsEndpoint,
+				Decoder:  s.negotiating(decodeNothing),
+				Encoder:  s.encodeResponse,
+			},
+		},
+		"/graphql": {
+			http.MethodGet: {
+				Endpoint: s.GraphQLEndpoint,
+				Decoder:  s.decodeGraphQL,
+				Encoder:  s.encodeGraphQL,
+			},
+			http.MethodPost: {
+				Endpoint: s.GraphQLEndpoint,
+				Decoder:  s.decodeGraphQL,
+				Encoder:  s.encodeGraphQL,
+			},
+		},
+		"/openapi.json": {
+			http.MethodGet: {
+				Endpoint: s.OpenAPIEndpoint,
+				Encoder:  kithttp.EncodeJSONResponse,
 			},
 		},
 	}
+	if s.Search != nil {
+		ret["/employees/search"] = map[string]kit.HTTPEndpoint{
+			http.MethodGet: {
+				Endpoint: s.SearchEndpoint,
+				Decoder:  s.negotiating(s.decodeSearch),
+				Encoder:  s.encodeResponse,
+			},
+		}
+	}
+	if s.Changes != nil {
+		ret["/employees/changes"] = map[string]kit.HTTPEndpoint{
+			http.MethodGet: {
+				Endpoint: s.ChangesEndpoint,
+				Decoder:  s.decodeChanges,
+				Encoder:  s.encodeChanges,
+				Options:  []kithttp.ServerOption{kithttp.ServerErrorEncoder(s.encodeStreamError)},
+			},
+		}
+	}
+	if s.Subscriptions != nil {
+		ret["/subscriptions"] = map[string]kit.HTTPEndpoint{
+			http.MethodGet: {
+				Endpoint: s.ListSubscriptionsEndpoint,
+				Decoder:  s.negotiatingStructured(decodeNothing),
+				Encoder:  s.encodeStructured,
+			},
+			http.MethodPost: {
+				Endpoint: s.CreateSubscriptionEndpoint,
+				Decoder:  s.negotiatingStructured(s.decodeSubscriptionRequest),
+				Encoder:  s.encodeStructured,
+			},
+		}
+		ret["/subscriptions/{id}"] = map[string]kit.HTTPEndpoint{
+			http.MethodGet: {
+				Endpoint: s.GetSubscriptionEndpoint,
+				Decoder:  s.negotiatingStructured(decodeSubscriptionID),
+				Encoder:  s.encodeStructured,
+			},
+			http.MethodDelete: {
+				Endpoint: s.DeleteSubscriptionEndpoint,
+				Decoder:  s.negotiatingStructured(decodeSubscriptionID),
+				Encoder:  s.encodeStructured,
+			},
+		}
+		ret["/subscriptions/{id}/dead-letters"] = map[string]kit.HTTPEndpoint{
+			http.MethodGet: {
+				Endpoint: s.ListDeadLettersEndpoint,
+				Decoder:  s.negotiatingStructured(decodeSubscriptionID),
+				Encoder:  s.encodeStructured,
+			},
+		}
+		ret["/subscriptions/{id}/dead-letters/replay"] = map[string]kit.HTTPEndpoint{
+			http.MethodPost: {
+				Endpoint: s.ReplayDeadLettersEndpoint,
+				Decoder:  s.negotiatingStructured(decodeSubscriptionID),
+				Encoder:  s.encodeStructured,
+			},
+		}
+	}
+	if s.Sync != nil {
+		ret["/admin/sync"] = map[string]kit.HTTPEndpoint{
+			http.MethodGet: {
+				Endpoint: s.GetSyncEndpoint,
+				Decoder:  s.negotiatingStructured(decodeNothing),
+				Encoder:  s.encodeStructured,
+			},
+			http.MethodPost: {
+				Endpoint: s.PostSyncEndpoint,
+				Decoder:  s.negotiatingStructured(decodeNothing),
+				Encoder:  s.encodeStructured,
+			},
+		}
+	}
+	if s.Faults != nil {
+		ret["/admin/faults"] = map[string]kit.HTTPEndpoint{
+			http.MethodGet: {
+				Endpoint: s.GetFaultsEndpoint,
+				Decoder:  s.negotiatingStructured(decodeNothing),
+				Encoder:  s.encodeStructured,
+			},
+			http.MethodPut: {
+				Endpoint: s.PutFaultsEndpoint,
+				Decoder:  s.negotiatingStructured(s.decodeFaultConfig),
+				Encoder:  s.encodeStructured,
+			},
+		}
+	}
+	return ret
 }
 
 func (s *SomeServer) RPCMiddleware() grpc.UnaryServerInterceptor {
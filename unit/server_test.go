@@ -1,15 +1,13 @@
-package unit
+package unit_test
 
 import (
-	"context"
 	"errors"
-	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/http/httptest"
 	"testing"
+	"time"
 
-	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -17,141 +15,361 @@ import (
 func TestEmployeeEndpoint_ErrorFetchingEmployee(t *testing.T) {
 	asserter := assert.New(t)
 
-	fetcher := &MockEmployeeFetcher{}
-
-	fetcher.On("FetchEmployee", mock.Anything, 2).Return(nil, errors.New("testing FTW"))
-
-	testInstance := SomeServer{
-		EmployeeFetcher: fetcher,
-		EmployeeMapper: func(employee *RemoteEmployee) (employee2 *Employee, err error) {
+	client := testutil.NewServerBuilder(t).
+		WithCodecs(nil).
+		ExpectFetchError("2", errors.New("testing FTW")).
+		WithMapper(func(employee *domain.RemoteEmployee) (employee2 *domain.Employee, err error) {
 			asserter.Fail("we should not have reached this point")
 			return nil, nil
-		},
-	}
-	srv := kit.NewServer(&testInstance)
-	ts := httptest.NewServer(srv)
-	defer ts.Close()
+		}).
+		Start()
 
-	status, body := doRequest(ts.URL, "/employee/2")
-	asserter.Equal(500, status)
-	asserter.Equal("{\"message\":\"something terrible happened\"}", body)
+	employee, problem, res := client.GetEmployee("2", nil)
+	asserter.Nil(employee)
+	asserter.Equal(500, res.Status)
+	testutil.AssertGolden(t, res)
+	asserter.Equal(&domain.Error{
+		Type:     domain.ProblemTypeBlank,
+		Title:    "Internal Server Error",
+		Status:   500,
+		Detail:   "something terrible happened",
+		Instance: "/employee/2",
+	}, problem)
 }
 
 func TestEmployeeEndpoint_ErrorMappingEmployee(t *testing.T) {
 	asserter := assert.New(t)
 
-	fetcher := &MockEmployeeFetcher{}
-
-	expectedRemoteEmployee := &RemoteEmployee{
-		Status: "whatever",
-	}
-
-	fetcher.On("FetchEmployee", mock.Anything, 2).Return(expectedRemoteEmployee, nil)
+	expectedRemoteEmployee := testutil.NewRemoteEmployee().WithStatus("whatever").Build()
 
-	testInstance := SomeServer{
-		EmployeeFetcher: fetcher,
-		EmployeeMapper: func(employee *RemoteEmployee) (*Employee, error) {
+	client := testutil.NewServerBuilder(t).
+		WithCodecs(nil).
+		ExpectEmployee("2", expectedRemoteEmployee).
+		WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
 			asserter.Equal(expectedRemoteEmployee, employee)
 			return nil, errors.New("KaBOOM")
-		},
-	}
-	srv := kit.NewServer(&testInstance)
-	ts := httptest.NewServer(srv)
-	defer ts.Close()
+		}).
+		Start()
 
-	status, body := doRequest(ts.URL, "/employee/2")
-	asserter.Equal(500, status)
-	asserter.Equal("{\"message\":\"something terrible happened\"}", body)
+	_, _, res := client.GetEmployee("2", nil)
+	asserter.Equal(500, res.Status)
+	testutil.AssertGolden(t, res)
 }
 
 func TestEmployeeEndpoint_NotFound(t *testing.T) {
 	asserter := assert.New(t)
 
-	fetcher := &MockEmployeeFetcher{}
-
-	fetcher.On("FetchEmployee", mock.Anything, 2).Return(nil, nil)
-
-	testInstance := SomeServer{
-		EmployeeFetcher: fetcher,
-		EmployeeMapper: func(employee *RemoteEmployee) (*Employee, error) {
+	client := testutil.NewServerBuilder(t).
+		WithCodecs(nil).
+		ExpectEmployee("2", nil).
+		WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
 			asserter.Fail("we should not have reached this point")
 			return nil, nil
-		},
-	}
-	srv := kit.NewServer(&testInstance)
-	ts := httptest.NewServer(srv)
-	defer ts.Close()
+		}).
+		Start()
 
-	status, body := doRequest(ts.URL, "/employee/2")
-	asserter.Equal(404, status)
-	asserter.Equal("{\"message\":\"employee not found\"}", body)
+	_, problem, res := client.GetEmployee("2", nil)
+	asserter.Equal(404, res.Status)
+	testutil.AssertGolden(t, res)
+	asserter.Equal(domain.ProblemTypeEmployeeNotFound, problem.Type)
 }
 
 func TestEmployeeEndpoint_HappyPath(t *testing.T) {
 	asserter := assert.New(t)
 
-	fetcher := &MockEmployeeFetcher{}
-
-	expectedRemoteEmployee := &RemoteEmployee{
-		Status: "whatever",
-	}
+	expectedRemoteEmployee := testutil.NewRemoteEmployee().WithStatus("whatever").Build()
 
-	result := Employee{
+	result := domain.Employee{
 		ID:         "123",
 		Name:       "Bob McTester",
 		Age:        21,
 		Generation: "DrinksRUs",
 	}
 
-	fetcher.On("FetchEmployee", mock.Anything, 2).Return(expectedRemoteEmployee, nil)
-
-	testInstance := SomeServer{
-		EmployeeFetcher: fetcher,
-		EmployeeMapper: func(employee *RemoteEmployee) (*Employee, error) {
+	client := testutil.NewServerBuilder(t).
+		WithCodecs(nil).
+		ExpectEmployee("2", expectedRemoteEmployee).
+		WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
 			asserter.Equal(expectedRemoteEmployee, employee)
 			return &result, nil
+		}).
+		Start()
+
+	employee, problem, res := client.GetEmployee("2", nil)
+	asserter.Equal(200, res.Status)
+	testutil.AssertGolden(t, res)
+	// generations we don't know about have no code, and get shown as is
+	expected := result
+	expected.GenerationLabel = "DrinksRUs"
+	asserter.Equal(&expected, employee)
+	asserter.Nil(problem)
+	asserter.Empty(result.GenerationLabel, "the mapper's employee should be left alone")
+}
+
+func TestEmployeeEndpoint_RealMapper(t *testing.T) {
+	asserter := assert.New(t)
+
+	builder := testutil.NewServerBuilder(t)
+	builder.Fetcher().EXPECT().
+		FetchEmployee(mock.Anything, domain.EmployeeID("7")).
+		Return(testutil.NewRemoteEmployee().WithID(7).WithName("Herrod Chandler").WithAge(0).Build(), nil).
+		Once()
+	client := builder.Start()
+
+	employee, _, res := client.GetEmployee("7", map[string]string{"Accept": "application/xml"})
+	asserter.Equal(200, res.Status)
+	asserter.Equal(&domain.Employee{
+		ID:              "7",
+		Name:            "Herrod Chandler",
+		Age:             0,
+		Generation:      domain.GenZ,
+		GenerationCode:  "gen_z",
+		GenerationLabel: "Generation Z",
+	}, employee)
+}
+
+func TestEmployeeEndpoint_IDFormats(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		path           string
+		expectedID     domain.EmployeeID
+		expectedStatus int
+	}{
+		{
+			"numeric",
+			"/employee/0042",
+			"42",
+			200,
+		},
+		{
+			"prefixed",
+			"/employee/EMP-42",
+			"emp-42",
+			200,
+		},
+		{
+			"uuid",
+			"/employee/0f8fad5b-d9cb-469f-a165-70867728950e",
+			"0f8fad5b-d9cb-469f-a165-70867728950e",
+			200,
+		},
+		{
+			"malformed",
+			"/employee/BLAH",
+			"",
+			400,
 		},
 	}
-	srv := kit.NewServer(&testInstance)
-	ts := httptest.NewServer(srv)
-	defer ts.Close()
-
-	status, body := doRequest(ts.URL, "/employee/2")
-	fetcher.AssertExpectations(t)
-	asserter.Equal(200, status)
-	asserter.Equal("{\"id\":\"123\",\"employee_name\":\"Bob McTester\",\"age\":21,\"generation\":\"DrinksRUs\"}\n", body)
-}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			builder := testutil.NewServerBuilder(t).
+				WithCodecs(nil).
+				WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
+					return &domain.Employee{ID: "123", Name: "Bob McTester", Age: 21, Generation: domain.GenZ}, nil
+				})
+			if tc.expectedID != "" {
+				builder.ExpectEmployee(tc.expectedID, &domain.RemoteEmployee{})
+			}
+			client := builder.Start()
 
-func doRequest(apiBase string, path string) (int, string) {
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s%s", apiBase, path), nil)
-	if err != nil {
-		panic(err)
+			res := client.Get(tc.path, nil)
+			asserter.Equal(tc.expectedStatus, res.Status)
+			testutil.AssertGolden(t, res)
+		})
 	}
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		panic(err)
+func TestEmployeeEndpoint_ContentNegotiation(t *testing.T) {
+	result := domain.Employee{
+		ID:         "123",
+		Name:       "Bob McTester",
+		Age:        21,
+		Generation: domain.GenZ,
 	}
 
-	defer res.Body.Close()
-	bytes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		panic(err)
+	testCases := []struct {
+		desc           string
+		accept         string
+		fetchResult    *domain.RemoteEmployee
+		expectedStatus int
+	}{
+		{
+			"json",
+			"application/json",
+			&domain.RemoteEmployee{},
+			200,
+		},
+		{
+			"xml",
+			"application/xml",
+			&domain.RemoteEmployee{},
+			200,
+		},
+		{
+			"csv",
+			"text/csv",
+			&domain.RemoteEmployee{},
+			200,
+		},
+		{
+			"msgpack",
+			"application/msgpack",
+			&domain.RemoteEmployee{},
+			200,
+		},
+		{
+			"errors follow negotiation",
+			"text/csv",
+			nil,
+			404,
+		},
+		{
+			"xml problems",
+			"application/xml",
+			nil,
+			404,
+		},
+		{
+			"not acceptable",
+			"text/html",
+			nil,
+			406,
+		},
 	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			builder := testutil.NewServerBuilder(t).
+				WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
+					return &result, nil
+				})
+			// not acceptable is sorted out before anything gets fetched
+			if tc.expectedStatus != 406 {
+				builder.ExpectEmployee("2", tc.fetchResult)
+			}
+			client := builder.Start()
 
-	return res.StatusCode, string(bytes)
+			res := client.Get("/employee/2", map[string]string{"Accept": tc.accept})
+			asserter.Equal(tc.expectedStatus, res.Status)
+			testutil.AssertGolden(t, res)
+		})
+	}
 }
 
-// yay, programmable mocks via testify!
-type MockEmployeeFetcher struct {
-	mock.Mock
+func TestEmployeeEndpoint_NotAcceptableSkipsFetch(t *testing.T) {
+	asserter := assert.New(t)
+
+	builder := testutil.NewServerBuilder(t).
+		WithCodecs(nil).
+		WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
+			asserter.Fail("we should not have reached this point")
+			return nil, nil
+		})
+	client := builder.Start()
+
+	res := client.Get("/employee/2", map[string]string{"Accept": "application/xml"})
+	builder.Fetcher().AssertNotCalled(t, "FetchEmployee", mock.Anything, mock.Anything)
+	asserter.Equal(406, res.Status)
+	testutil.AssertGolden(t, res)
 }
 
-func (m *MockEmployeeFetcher) FetchEmployee(ctx context.Context, employeeID int) (*RemoteEmployee, error) {
-	args := m.Called(ctx, employeeID)
-	ret := args.Get(0)
-	if ret == nil {
-		return nil, args.Error(1)
+func TestEmployeeEndpoint_ConditionalGet(t *testing.T) {
+	asserter := assert.New(t)
+
+	result := domain.Employee{
+		ID:         "123",
+		Name:       "Bob McTester",
+		Age:        21,
+		Generation: domain.GenZ,
 	}
-	return ret.(*RemoteEmployee), args.Error(1)
+	now := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+
+	client := testutil.NewServerBuilder(t).
+		WithCodecs(nil).
+		ExpectEmployee("2", &domain.RemoteEmployee{}).
+		WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
+			return &result, nil
+		}).
+		WithCacheMaxAge(time.Minute).
+		WithNow(func() time.Time {
+			return now
+		}).
+		Start()
+
+	res := client.Get("/employee/2", nil)
+	asserter.Equal(200, res.Status)
+	etag := res.Header.Get("ETag")
+	localized := result
+	localized.GenerationCode = "gen_z"
+	localized.GenerationLabel = "Generation Z"
+	asserter.Equal(unit.EmployeeETag(&localized), etag)
+	asserter.Equal("Wed, 04 Mar 2020 05:06:07 GMT", res.Header.Get("Last-Modified"))
+	asserter.Equal("max-age=60", res.Header.Get("Cache-Control"))
+	asserter.NotEmpty(res.Body)
+
+	// time moves on but nothing changed, so we should get a 304 and the original Last-Modified
+	now = now.Add(time.Hour)
+	res = client.Get("/employee/2", map[string]string{"If-None-Match": etag})
+	asserter.Equal(304, res.Status)
+	asserter.Equal(etag, res.Header.Get("ETag"))
+	asserter.Equal("Wed, 04 Mar 2020 05:06:07 GMT", res.Header.Get("Last-Modified"))
+	asserter.Empty(res.Body)
+
+	res = client.Get("/employee/2", map[string]string{"If-Modified-Since": "Wed, 04 Mar 2020 05:06:07 GMT"})
+	asserter.Equal(304, res.Status)
+
+	// now bob has a birthday, so the client's copy is stale
+	result.Age = 22
+	res = client.Get("/employee/2", map[string]string{"If-None-Match": etag})
+	asserter.Equal(200, res.Status)
+	asserter.NotEqual(etag, res.Header.Get("ETag"))
+	asserter.Equal("Wed, 04 Mar 2020 06:06:07 GMT", res.Header.Get("Last-Modified"))
+	testutil.AssertGoldenNamed(t, t.Name()+"/after_birthday", res)
+}
+
+func TestEmployeeEndpoint_ErrorsNotCached(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).
+		WithCodecs(nil).
+		ExpectEmployee("2", nil).
+		WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
+			asserter.Fail("we should not have reached this point")
+			return nil, nil
+		}).
+		Start()
+
+	res := client.Get("/employee/2", map[string]string{"If-None-Match": "*"})
+	asserter.Equal(404, res.Status)
+	asserter.Empty(res.Header.Get("ETag"))
+	asserter.Empty(res.Header.Get("Cache-Control"))
+}
+
+func TestUnknownRoute(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).Start()
+
+	res := client.Get("/employees/2", nil)
+	asserter.Equal(404, res.Status)
+	testutil.AssertGolden(t, res)
+}
+
+func TestEmployeeEndpoint_Panic(t *testing.T) {
+	asserter := assert.New(t)
+
+	client := testutil.NewServerBuilder(t).
+		WithCodecs(nil).
+		ExpectEmployee("2", &domain.RemoteEmployee{}).
+		WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
+			panic("oh noes")
+		}).
+		Start()
+
+	res := client.Get("/employee/2", nil)
+	asserter.Equal(500, res.Status)
+	testutil.AssertGolden(t, res)
 }
@@ -0,0 +1,739 @@
+package unit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/i18n"
+	"github.com/pkg/errors"
+)
+
+// WEBHOOK_URLS is fine for a couple of receivers we know about up front, subscriptions let anybody sign up for the
+// changes they care about at runtime. Subscriptions and the deliveries that never made it (dead letters) are kept in a
+// json file so they survive restarts. Deliveries go out from a pool of workers, so unlike WEBHOOK_URLS they can arrive
+// out of order, the change id (X-Webhook-Id) is what to sort and dedupe on.
+//
+// Anybody who can reach /subscriptions can point deliveries wherever they like, so subscriptions only ever get
+// delivered to the public internet. URLs for localhost or private, loopback and link-local addresses (cloud metadata
+// endpoints included) are turned away when subscribing, and since a name can resolve anywhere the address gets checked
+// again when connecting. Receivers on a private network are what WEBHOOK_URLS is for, it's set by whoever runs the
+// service and isn't restricted.
+
+const (
+	subscriptionStoreFormat = 1
+	// maxDeadLetters is how many dead letters are kept, across every subscription, the oldest go first
+	maxDeadLetters         = 1000
+	defaultDeliveryWorkers = 4
+	deliveryQueueSize      = 100
+	minSecretLength        = 16
+)
+
+// SubscriptionRequest is what it takes to sign up for changes. Filters that are left out match everything, the ones
+// that are there all have to match.
+type SubscriptionRequest struct {
+	URL string `json:"url"`
+	// Secret signs deliveries, one gets generated if it's left out
+	Secret string `json:"secret,omitempty"`
+	// Events are the kinds of change wanted, added, removed or changed
+	Events []string `json:"events,omitempty"`
+	// Generations are anything domain.ParseGeneration understands, a change matches if the employee was in one of
+	// them before or is after
+	Generations []string `json:"generations,omitempty"`
+	EmployeeIDs []string `json:"employee_ids,omitempty"`
+}
+
+// Validate checks the request makes sense, reasons come out in whatever language loc speaks
+func (r SubscriptionRequest) Validate(loc *i18n.Localizer) []domain.InvalidParam {
+	var ret []domain.InvalidParam
+	if u, err := url.Parse(r.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		ret = append(ret, invalidParam(loc, "url", "http_url"))
+	} else if !publicHost(u.Hostname()) {
+		ret = append(ret, invalidParam(loc, "url", "public_url"))
+	}
+	if r.Secret != "" && len(r.Secret) < minSecretLength {
+		ret = append(ret, invalidParam(loc, "secret", "min_characters", minSecretLength))
+	}
+	for i, e := range r.Events {
+		switch e {
+		case domain.ChangeAdded, domain.ChangeRemoved, domain.ChangeChanged:
+		default:
+			ret = append(ret, invalidParam(loc, fmt.Sprintf("events[%d]", i), "unknown_event", e))
+		}
+	}
+	for i, g := range r.Generations {
+		if _, err := domain.ParseGeneration(g); err != nil {
+			ret = append(ret, invalidParam(loc, fmt.Sprintf("generations[%d]", i), "unknown_generation", g))
+		}
+	}
+	for i, id := range r.EmployeeIDs {
+		if _, err := domain.ParseEmployeeID(id); err != nil {
+			ret = append(ret, invalidParam(loc, fmt.Sprintf("employee_ids[%d]", i), "malformed_employee_id"))
+		}
+	}
+	return ret
+}
+
+// publicHost is false for hosts that are obviously somewhere private, names get checked for real when connecting (see
+// publicOnlyTransport)
+func publicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return publicIP(ip)
+	}
+	return true
+}
+
+// privateNetworks are the ranges net.IP doesn't have an Is method for in every go we build with. 240.0.0.0/4 is
+// reserved and takes the broadcast address along with it.
+var privateNetworks = mustParseCIDRs("0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "240.0.0.0/4", "fc00::/7")
+
+// nat64Network and sixToFourNetwork are ipv6 ranges with an ipv4 address tucked inside, see embeddedIPv4
+var (
+	nat64Network     = mustParseCIDRs("64:ff9b::/96")[0]
+	sixToFourNetwork = mustParseCIDRs("2002::/16")[0]
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	var ret []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ret = append(ret, network)
+	}
+	return ret
+}
+
+// embeddedIPv4 digs the ipv4 address out of NAT64 and 6to4 addresses, which end up delivered to that ipv4 address.
+// Blocking the prefixes outright would turn away perfectly public addresses, so it's the address inside that gets
+// judged. Anything else gives nil.
+func embeddedIPv4(ip net.IP) net.IP {
+	if ip.To4() != nil {
+		return nil
+	}
+	ip = ip.To16()
+	switch {
+	case ip == nil:
+		return nil
+	case nat64Network.Contains(ip):
+		return net.IPv4(ip[12], ip[13], ip[14], ip[15])
+	case sixToFourNetwork.Contains(ip):
+		return net.IPv4(ip[2], ip[3], ip[4], ip[5])
+	}
+	return nil
+}
+
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	if embedded := embeddedIPv4(ip); embedded != nil {
+		return publicIP(embedded)
+	}
+	return true
+}
+
+// publicOnlyTransport won't connect anywhere publicIP doesn't like. It's checked on the address actually being
+// connected to, so a name that resolves somewhere private (or starts to after subscribing) gets caught too.
+func publicOnlyTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return errors.Errorf("refusing to deliver to %s, it isn't a public address", host)
+			}
+			return nil
+		},
+	}
+	ret := http.DefaultTransport.(*http.Transport).Clone()
+	ret.DialContext = dialer.DialContext
+	// going through a proxy would mean the proxy's address is the one that gets checked
+	ret.Proxy = nil
+	return ret
+}
+
+type Subscription struct {
+	XMLName xml.Name `json:"-" xml:"subscription"`
+	ID      string   `json:"id" xml:"id"`
+	URL     string   `json:"url" xml:"url"`
+	// Secret only gets handed out when the subscription is created
+	Secret string   `json:"secret,omitempty" xml:"secret,omitempty"`
+	Events []string `json:"events,omitempty" xml:"event,omitempty"`
+	// Generations are generation codes, eg gen_x
+	Generations []string  `json:"generations,omitempty" xml:"generation,omitempty"`
+	EmployeeIDs []string  `json:"employee_ids,omitempty" xml:"employee_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at" xml:"created_at"`
+}
+
+// Matches says whether a change is one the subscription wants
+func (s Subscription) Matches(change domain.EmployeeChange) bool {
+	if len(s.Events) > 0 && !contains(s.Events, change.Type) {
+		return false
+	}
+	if len(s.EmployeeIDs) > 0 && !contains(s.EmployeeIDs, change.EmployeeID) {
+		return false
+	}
+	if len(s.Generations) > 0 {
+		before := change.Before != nil && contains(s.Generations, change.Before.Generation.Code())
+		after := change.After != nil && contains(s.Generations, change.After.Generation.Code())
+		if !before && !after {
+			return false
+		}
+	}
+	return true
+}
+
+// redacted is the subscription without its secret, for everything but the response to creating it
+func (s Subscription) redacted() Subscription {
+	s.Secret = ""
+	return s
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// DeadLetter is a change that couldn't be delivered to a subscription, it sticks around until it's replayed or the
+// subscription is deleted
+type DeadLetter struct {
+	XMLName        xml.Name              `json:"-" xml:"dead_letter"`
+	ID             string                `json:"id" xml:"id"`
+	SubscriptionID string                `json:"subscription_id" xml:"subscription_id"`
+	Change         domain.EmployeeChange `json:"change" xml:"change"`
+	Attempts       int                   `json:"attempts" xml:"attempts"`
+	LastError      string                `json:"last_error" xml:"last_error"`
+	FailedAt       time.Time             `json:"failed_at" xml:"failed_at"`
+}
+
+// SubscriptionList and DeadLetterList only exist to get the XML right, a bare slice would come out as several
+// documents glued together
+type SubscriptionList []Subscription
+
+func (l SubscriptionList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "subscriptions"}
+	return e.EncodeElement(struct {
+		Items []Subscription `xml:"subscription"`
+	}{l}, start)
+}
+
+type DeadLetterList []DeadLetter
+
+func (l DeadLetterList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "dead_letters"}
+	return e.EncodeElement(struct {
+		Items []DeadLetter `xml:"dead_letter"`
+	}{l}, start)
+}
+
+// subscriptionFile is what the store keeps on disk
+type subscriptionFile struct {
+	Format        int            `json:"format"`
+	Subscriptions []Subscription `json:"subscriptions"`
+	DeadLetters   []DeadLetter   `json:"dead_letters"`
+}
+
+type SubscriptionStore struct {
+	path string
+	// Now and Rand are here so tests can control time and the ids and secrets handed out, if left nil time.Now and
+	// crypto/rand are used
+	Now  func() time.Time
+	Rand io.Reader
+
+	mu            sync.Mutex
+	subscriptions []Subscription
+	deadLetters   []DeadLetter
+}
+
+// NewSubscriptionStore keeps subscriptions in a json file at path, or only in memory if path is empty. Call Load to
+// pick up the ones from a previous run.
+func NewSubscriptionStore(path string) *SubscriptionStore {
+	return &SubscriptionStore{path: path}
+}
+
+func (s *SubscriptionStore) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+func (s *SubscriptionStore) newID(prefix string, size int) (string, error) {
+	r := s.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+	raw := make([]byte, size)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return prefix + hex.EncodeToString(raw), nil
+}
+
+// Load reads the store's file, if there is one. Not having one yet isn't an error.
+func (s *SubscriptionStore) Load() error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	file := new(subscriptionFile)
+	if err := json.Unmarshal(raw, file); err != nil {
+		return errors.Wrapf(err, "reading subscriptions %s", s.path)
+	}
+	if file.Format != subscriptionStoreFormat {
+		return errors.Errorf("subscriptions %s are format %d, only format %d is understood", s.path, file.Format, subscriptionStoreFormat)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscriptions = file.Subscriptions
+	s.deadLetters = file.DeadLetters
+	return nil
+}
+
+// save writes everything out, callers need to hold the lock
+func (s *SubscriptionStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	return writeJSONFile(s.path, subscriptionFile{
+		Format:        subscriptionStoreFormat,
+		Subscriptions: s.subscriptions,
+		DeadLetters:   s.deadLetters,
+	})
+}
+
+// Create adds a subscription, the request should have been validated already. What comes back includes the secret,
+// it's the only time it will.
+func (s *SubscriptionStore) Create(req SubscriptionRequest) (Subscription, error) {
+	id, err := s.newID("sub_", 8)
+	if err != nil {
+		return Subscription{}, err
+	}
+	ret := Subscription{ID: id, URL: req.URL, Secret: req.Secret, Events: req.Events, CreatedAt: s.now()}
+	if ret.Secret == "" {
+		if ret.Secret, err = s.newID("", 32); err != nil {
+			return Subscription{}, err
+		}
+	}
+	// stored the way changes describe things, so matching is a straight comparison
+	for _, g := range req.Generations {
+		generation, _ := domain.ParseGeneration(g)
+		ret.Generations = append(ret.Generations, generation.Code())
+	}
+	for _, raw := range req.EmployeeIDs {
+		employeeID, _ := domain.ParseEmployeeID(raw)
+		ret.EmployeeIDs = append(ret.EmployeeIDs, employeeID.String())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscriptions = append(s.subscriptions, ret)
+	if err := s.save(); err != nil {
+		s.subscriptions = s.subscriptions[:len(s.subscriptions)-1]
+		return Subscription{}, err
+	}
+	return ret, nil
+}
+
+// List is every subscription, oldest first, secrets included
+func (s *SubscriptionStore) List() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Subscription{}, s.subscriptions...)
+}
+
+func (s *SubscriptionStore) Get(id string) (Subscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subscriptions {
+		if sub.ID == id {
+			return sub, true
+		}
+	}
+	return Subscription{}, false
+}
+
+// Delete removes a subscription and its dead letters, the bool is false if there was no such subscription
+func (s *SubscriptionStore) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscriptions := make([]Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		if sub.ID != id {
+			subscriptions = append(subscriptions, sub)
+		}
+	}
+	if len(subscriptions) == len(s.subscriptions) {
+		return false, nil
+	}
+	previous, previousDeadLetters := s.subscriptions, s.deadLetters
+	s.subscriptions = subscriptions
+	s.deadLetters, _ = partitionDeadLetters(s.deadLetters, id)
+	if err := s.save(); err != nil {
+		s.subscriptions, s.deadLetters = previous, previousDeadLetters
+		return false, err
+	}
+	return true, nil
+}
+
+// AddDeadLetter records a delivery that never made it. Dead letters for subscriptions that have since been deleted
+// are dropped.
+func (s *SubscriptionStore) AddDeadLetter(deadLetter DeadLetter) error {
+	id, err := s.newID("dl_", 8)
+	if err != nil {
+		return err
+	}
+	deadLetter.ID = id
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := false
+	for _, sub := range s.subscriptions {
+		found = found || sub.ID == deadLetter.SubscriptionID
+	}
+	if !found {
+		return nil
+	}
+	s.deadLetters = append(s.deadLetters, deadLetter)
+	if over := len(s.deadLetters) - maxDeadLetters; over > 0 {
+		s.deadLetters = append([]DeadLetter{}, s.deadLetters[over:]...)
+	}
+	return s.save()
+}
+
+// DeadLetters is what couldn't be delivered to a subscription, oldest first
+func (s *SubscriptionStore) DeadLetters(subscriptionID string) []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ret := partitionDeadLetters(s.deadLetters, subscriptionID)
+	return ret
+}
+
+// TakeDeadLetters removes a subscription's dead letters and hands them back, oldest first
+func (s *SubscriptionStore) TakeDeadLetters(subscriptionID string) ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.deadLetters
+	rest, ret := partitionDeadLetters(s.deadLetters, subscriptionID)
+	if len(ret) == 0 {
+		return nil, nil
+	}
+	s.deadLetters = rest
+	if err := s.save(); err != nil {
+		s.deadLetters = previous
+		return nil, err
+	}
+	return ret, nil
+}
+
+// partitionDeadLetters splits dead letters into everybody else's and the subscription's
+func partitionDeadLetters(deadLetters []DeadLetter, subscriptionID string) ([]DeadLetter, []DeadLetter) {
+	others, ret := []DeadLetter{}, []DeadLetter{}
+	for _, dl := range deadLetters {
+		if dl.SubscriptionID == subscriptionID {
+			ret = append(ret, dl)
+		} else {
+			others = append(others, dl)
+		}
+	}
+	return others, ret
+}
+
+type deliveryJob struct {
+	subscription Subscription
+	change       domain.EmployeeChange
+}
+
+// SubscriptionDispatcher delivers changes to whichever subscriptions want them
+type SubscriptionDispatcher struct {
+	WebhookSender
+
+	feed    *ChangeFeed
+	store   *SubscriptionStore
+	workers int
+	from    string
+	jobs    chan deliveryJob
+
+	mu sync.Mutex
+	// ctx is Run's, for replays to queue things up under
+	ctx context.Context
+}
+
+// NewSubscriptionDispatcher delivers every change published to feed from here on to the subscriptions in store that
+// want it, using workers deliveries at a time (4 if workers is zero or less). Nothing gets sent until Run. Deliveries
+// only go to public addresses, replace Client to change that.
+func NewSubscriptionDispatcher(feed *ChangeFeed, store *SubscriptionStore, workers int) *SubscriptionDispatcher {
+	if workers <= 0 {
+		workers = defaultDeliveryWorkers
+	}
+	ret := &SubscriptionDispatcher{
+		WebhookSender: NewWebhookSender(),
+		feed:          feed,
+		store:         store,
+		workers:       workers,
+		from:          feed.Latest(),
+		jobs:          make(chan deliveryJob, deliveryQueueSize),
+	}
+	ret.Client = &http.Client{Timeout: ret.Client.Timeout, Transport: publicOnlyTransport()}
+	return ret
+}
+
+func (d *SubscriptionDispatcher) Store() *SubscriptionStore {
+	return d.store
+}
+
+// Run delivers changes until ctx is done. Anything still waiting to go out by then gets dead lettered, so it can be
+// replayed after a restart.
+func (d *SubscriptionDispatcher) Run(ctx context.Context) {
+	d.mu.Lock()
+	d.ctx = ctx
+	d.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case job := <-d.jobs:
+					d.deliver(ctx, job)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// when the queue is full this blocks, and if it blocks long enough the feed cuts us off and we catch up from its
+	// history once there's room again
+	followFeed(ctx, d.feed, d.from, "subscription deliveries", func(ctx context.Context, change domain.EmployeeChange) {
+		for _, sub := range d.store.List() {
+			if sub.Matches(change) {
+				d.enqueue(ctx, deliveryJob{sub, change})
+			}
+		}
+	})
+	wg.Wait()
+
+	for {
+		select {
+		case job := <-d.jobs:
+			d.deadLetter(ctx, job, 0, ctx.Err())
+		default:
+			return
+		}
+	}
+}
+
+// enqueue waits for room in the queue, if ctx is done first the job gets dead lettered
+func (d *SubscriptionDispatcher) enqueue(ctx context.Context, job deliveryJob) {
+	select {
+	case d.jobs <- job:
+	case <-ctx.Done():
+		d.deadLetter(ctx, job, 0, ctx.Err())
+	}
+}
+
+func (d *SubscriptionDispatcher) deliver(ctx context.Context, job deliveryJob) {
+	// it might have been deleted while the job was waiting in the queue
+	sub, ok := d.store.Get(job.subscription.ID)
+	if !ok {
+		return
+	}
+	attempts, err := d.Send(ctx, sub.URL, sub.Secret, job.change)
+	if err != nil {
+		d.deadLetter(ctx, job, attempts, err)
+	}
+}
+
+func (d *SubscriptionDispatcher) deadLetter(ctx context.Context, job deliveryJob, attempts int, cause error) {
+	_ = kit.LogErrorf(ctx, "giving up delivering change %s to subscription %s after %d attempt(s): %+v", job.change.ID, job.subscription.ID, attempts, cause)
+	err := d.store.AddDeadLetter(DeadLetter{
+		SubscriptionID: job.subscription.ID,
+		Change:         job.change,
+		Attempts:       attempts,
+		LastError:      cause.Error(),
+		FailedAt:       d.now(),
+	})
+	if err != nil {
+		_ = kit.LogErrorf(ctx, "error saving dead letter for change %s to subscription %s: %+v", job.change.ID, job.subscription.ID, err)
+	}
+}
+
+// runContext is Run's context, or if it isn't running yet one that never ends so jobs wait in the queue for it
+func (d *SubscriptionDispatcher) runContext() context.Context {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// Replay takes a subscription's dead letters to be delivered again, handing back how many there were. They get queued
+// in the background, there can be a lot more of them than there's room for in the queue. Ones that fail again come
+// back as new dead letters.
+func (d *SubscriptionDispatcher) Replay(subscriptionID string) (int, error) {
+	deadLetters, err := d.store.TakeDeadLetters(subscriptionID)
+	if err != nil {
+		return 0, err
+	}
+	sub, ok := d.store.Get(subscriptionID)
+	if !ok {
+		return 0, nil
+	}
+	// not the request's context, that's done as soon as the 202 goes out
+	ctx := d.runContext()
+	go func() {
+		for _, dl := range deadLetters {
+			d.enqueue(ctx, deliveryJob{sub, dl.Change})
+		}
+	}()
+	return len(deadLetters), nil
+}
+
+// ReplayResult is what comes back from replaying dead letters
+type ReplayResult struct {
+	XMLName  xml.Name `json:"-" xml:"replay"`
+	Replayed int      `json:"replayed" xml:"replayed"`
+}
+
+// StatusCode is accepted, deliveries happen in the background
+func (r ReplayResult) StatusCode() int {
+	return http.StatusAccepted
+}
+
+// createdSubscription is a new subscription, answered with a 201 and where to find it
+type createdSubscription struct {
+	Subscription
+}
+
+func (c createdSubscription) StatusCode() int {
+	return http.StatusCreated
+}
+
+func (c createdSubscription) Headers() http.Header {
+	return http.Header{"Location": []string{"/subscriptions/" + c.ID}}
+}
+
+// noContent is for endpoints with nothing to say beyond the status
+type noContent struct{}
+
+func (noContent) StatusCode() int {
+	return http.StatusNoContent
+}
+
+func (s *SomeServer) decodeSubscriptionRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	req := SubscriptionRequest{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return nil, invalidParamsProblem(domain.InvalidParam{Name: "body", Reason: err.Error()})
+	}
+	if invalid := req.Validate(s.localizer(ctx)); len(invalid) > 0 {
+		return nil, invalidParamsProblem(invalid...)
+	}
+	return req, nil
+}
+
+func decodeSubscriptionID(_ context.Context, r *http.Request) (interface{}, error) {
+	return kit.Vars(r)["id"], nil
+}
+
+func (s *SomeServer) CreateSubscriptionEndpoint(ctx context.Context, req interface{}) (interface{}, error) {
+	ret, err := s.Subscriptions.Store().Create(req.(SubscriptionRequest))
+	if err != nil {
+		_ = kit.LogErrorf(ctx, "error creating subscription: %+v", err)
+		return nil, internalErrorProblem()
+	}
+	return createdSubscription{ret}, nil
+}
+
+func (s *SomeServer) ListSubscriptionsEndpoint(_ context.Context, _ interface{}) (interface{}, error) {
+	ret := SubscriptionList{}
+	for _, sub := range s.Subscriptions.Store().List() {
+		ret = append(ret, sub.redacted())
+	}
+	return ret, nil
+}
+
+func (s *SomeServer) GetSubscriptionEndpoint(_ context.Context, req interface{}) (interface{}, error) {
+	ret, ok := s.Subscriptions.Store().Get(req.(string))
+	if !ok {
+		return nil, subscriptionNotFoundProblem(req.(string))
+	}
+	return ret.redacted(), nil
+}
+
+func (s *SomeServer) DeleteSubscriptionEndpoint(ctx context.Context, req interface{}) (interface{}, error) {
+	found, err := s.Subscriptions.Store().Delete(req.(string))
+	if err != nil {
+		_ = kit.LogErrorf(ctx, "error deleting subscription: %+v", err)
+		return nil, internalErrorProblem()
+	}
+	if !found {
+		return nil, subscriptionNotFoundProblem(req.(string))
+	}
+	return noContent{}, nil
+}
+
+func (s *SomeServer) ListDeadLettersEndpoint(_ context.Context, req interface{}) (interface{}, error) {
+	if _, ok := s.Subscriptions.Store().Get(req.(string)); !ok {
+		return nil, subscriptionNotFoundProblem(req.(string))
+	}
+	return DeadLetterList(s.Subscriptions.Store().DeadLetters(req.(string))), nil
+}
+
+func (s *SomeServer) ReplayDeadLettersEndpoint(ctx context.Context, req interface{}) (interface{}, error) {
+	if _, ok := s.Subscriptions.Store().Get(req.(string)); !ok {
+		return nil, subscriptionNotFoundProblem(req.(string))
+	}
+	replayed, err := s.Subscriptions.Replay(req.(string))
+	if err != nil {
+		_ = kit.LogErrorf(ctx, "error replaying dead letters: %+v", err)
+		return nil, internalErrorProblem()
+	}
+	return ReplayResult{Replayed: replayed}, nil
+}
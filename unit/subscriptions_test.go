@@ -0,0 +1,521 @@
+package unit_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/i18n"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionRequest_Validate(t *testing.T) {
+	notPublic := "must be on the public internet, not localhost or a private, loopback or link-local address"
+	testCases := []struct {
+		desc     string
+		input    unit.SubscriptionRequest
+		expected []domain.InvalidParam
+	}{
+		{"just a url", unit.SubscriptionRequest{URL: "https://example.com/hook"}, nil},
+		{
+			"everything",
+			unit.SubscriptionRequest{
+				URL:         "http://hooks.example.com:9000/hook",
+				Secret:      "sixteen chars ok",
+				Events:      []string{"added", "changed"},
+				Generations: []string{"boomer", "gen_x"},
+				EmployeeIDs: []string{"1", "emp-2"},
+			},
+			nil,
+		},
+		{"no url", unit.SubscriptionRequest{}, []domain.InvalidParam{{Name: "url", Reason: "must be an absolute http or https url"}}},
+		{"relative url", unit.SubscriptionRequest{URL: "/hook"}, []domain.InvalidParam{{Name: "url", Reason: "must be an absolute http or https url"}}},
+		{"not http", unit.SubscriptionRequest{URL: "ftp://example.com"}, []domain.InvalidParam{{Name: "url", Reason: "must be an absolute http or https url"}}},
+		{"localhost", unit.SubscriptionRequest{URL: "http://localhost:9000/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"loopback", unit.SubscriptionRequest{URL: "http://127.0.0.1/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"private", unit.SubscriptionRequest{URL: "https://10.1.2.3/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"cloud metadata", unit.SubscriptionRequest{URL: "http://169.254.169.254/latest/meta-data"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"ipv6 loopback", unit.SubscriptionRequest{URL: "http://[::1]:8080/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"ipv4 mapped ipv6", unit.SubscriptionRequest{URL: "http://[::ffff:192.168.0.1]/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"benchmarking", unit.SubscriptionRequest{URL: "http://198.19.0.1/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"ietf protocol assignments", unit.SubscriptionRequest{URL: "http://192.0.0.8/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"reserved", unit.SubscriptionRequest{URL: "http://240.0.0.1/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"broadcast", unit.SubscriptionRequest{URL: "http://255.255.255.255/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"nat64 private", unit.SubscriptionRequest{URL: "http://[64:ff9b::10.1.2.3]/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"nat64 loopback", unit.SubscriptionRequest{URL: "http://[64:ff9b::7f00:1]/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"6to4 private", unit.SubscriptionRequest{URL: "http://[2002:c0a8:1::1]/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"6to4 cloud metadata", unit.SubscriptionRequest{URL: "http://[2002:a9fe:a9fe::]/hook"}, []domain.InvalidParam{{Name: "url", Reason: notPublic}}},
+		{"public ip", unit.SubscriptionRequest{URL: "http://93.184.216.34/hook"}, nil},
+		{"nat64 public", unit.SubscriptionRequest{URL: "http://[64:ff9b::93.184.216.34]/hook"}, nil},
+		{"6to4 public", unit.SubscriptionRequest{URL: "http://[2002:5db8:d822::1]/hook"}, nil},
+		{"public ipv6", unit.SubscriptionRequest{URL: "http://[2606:2800:220:1:248:1893:25c8:1946]/hook"}, nil},
+		{
+			"everything wrong",
+			unit.SubscriptionRequest{
+				URL:         "https://example.com/hook",
+				Secret:      "shh",
+				Events:      []string{"added", "hired"},
+				Generations: []string{"gen alpha"},
+				EmployeeIDs: []string{"abc"},
+			},
+			[]domain.InvalidParam{
+				{Name: "secret", Reason: "must be at least 16 characters"},
+				{Name: "events[1]", Reason: `unknown event "hired"`},
+				{Name: "generations[0]", Reason: `"gen alpha": unknown generation`},
+				{Name: "employee_ids[0]", Reason: "malformed employee id"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+			asserter.Equal(tc.expected, tc.input.Validate(i18n.NewCatalog().Localizer("")))
+		})
+	}
+}
+
+func TestSubscriptionRequest_Validate_Localized(t *testing.T) {
+	asserter := assert.New(t)
+
+	german := loadLocales(t).Localizer("de")
+	req := unit.SubscriptionRequest{URL: "http://10.1.2.3/hook", Secret: "shh", Events: []string{"hired"}}
+	asserter.Equal([]domain.InvalidParam{
+		{Name: "url", Reason: "muss im öffentlichen Internet liegen, nicht auf localhost oder einer privaten, Loopback- oder Link-Local-Adresse"},
+		{Name: "secret", Reason: "muss mindestens 16 Zeichen lang sein"},
+		{Name: "events[0]", Reason: `unbekanntes Ereignis "hired"`},
+	}, req.Validate(german))
+}
+
+func TestSubscription_Matches(t *testing.T) {
+	boomer := &domain.Employee{ID: "1", Generation: domain.BabyBoomer}
+	genX := &domain.Employee{ID: "1", Generation: domain.GenX}
+	agedUp := domain.EmployeeChange{Type: domain.ChangeChanged, EmployeeID: "1", Before: genX, After: boomer}
+	hired := domain.EmployeeChange{Type: domain.ChangeAdded, EmployeeID: "2", After: genX}
+
+	testCases := []struct {
+		desc         string
+		subscription unit.Subscription
+		change       domain.EmployeeChange
+		expected     bool
+	}{
+		{"no filters", unit.Subscription{}, agedUp, true},
+		{"event", unit.Subscription{Events: []string{"changed"}}, agedUp, true},
+		{"wrong event", unit.Subscription{Events: []string{"added", "removed"}}, agedUp, false},
+		{"employee", unit.Subscription{EmployeeIDs: []string{"3", "1"}}, agedUp, true},
+		{"wrong employee", unit.Subscription{EmployeeIDs: []string{"3"}}, agedUp, false},
+		{"moved into the generation", unit.Subscription{Generations: []string{"baby_boomer"}}, agedUp, true},
+		{"moved out of the generation", unit.Subscription{Generations: []string{"gen_x"}}, agedUp, true},
+		{"wrong generation", unit.Subscription{Generations: []string{"millennial"}}, agedUp, false},
+		{"no before to match", unit.Subscription{Generations: []string{"baby_boomer"}}, hired, false},
+		{"everything has to match", unit.Subscription{Events: []string{"added"}, EmployeeIDs: []string{"1"}}, hired, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+			asserter.Equal(tc.expected, tc.subscription.Matches(tc.change))
+		})
+	}
+}
+
+// newSubscriptionStore hands out the same ids and secrets every time
+func newSubscriptionStore(path string) *unit.SubscriptionStore {
+	ret := unit.NewSubscriptionStore(path)
+	ret.Now = func() time.Time {
+		return syncTime
+	}
+	ret.Rand = rand.New(rand.NewSource(42))
+	return ret
+}
+
+func TestSubscriptionStore(t *testing.T) {
+	asserter := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "subscriptions.json")
+	testInstance := newSubscriptionStore(path)
+	asserter.NoError(testInstance.Load(), "nothing there yet is fine")
+
+	first, err := testInstance.Create(unit.SubscriptionRequest{URL: "https://example.com/one", Generations: []string{"Boomers"}, EmployeeIDs: []string{"emp-007"}})
+	asserter.NoError(err)
+	asserter.True(strings.HasPrefix(first.ID, "sub_"))
+	asserter.Len(first.Secret, 64, "a secret should have been generated")
+	asserter.Equal([]string{"baby_boomer"}, first.Generations)
+	asserter.Equal([]string{"emp-7"}, first.EmployeeIDs)
+	asserter.Equal(syncTime, first.CreatedAt)
+	second, err := testInstance.Create(unit.SubscriptionRequest{URL: "https://example.com/two", Secret: "a secret of my own"})
+	asserter.NoError(err)
+	asserter.Equal("a secret of my own", second.Secret)
+	asserter.NotEqual(first.ID, second.ID)
+
+	asserter.NoError(testInstance.AddDeadLetter(unit.DeadLetter{SubscriptionID: first.ID, Change: domain.EmployeeChange{ID: "2-1"}, Attempts: 5}))
+	asserter.NoError(testInstance.AddDeadLetter(unit.DeadLetter{SubscriptionID: second.ID, Change: domain.EmployeeChange{ID: "2-1"}}))
+	asserter.NoError(testInstance.AddDeadLetter(unit.DeadLetter{SubscriptionID: "sub_gone", Change: domain.EmployeeChange{ID: "2-1"}}))
+
+	// a fresh process picks up where the last one left off
+	restarted := unit.NewSubscriptionStore(path)
+	asserter.NoError(restarted.Load())
+	asserter.Equal([]unit.Subscription{first, second}, restarted.List())
+	found, ok := restarted.Get(second.ID)
+	asserter.True(ok)
+	asserter.Equal(second, found)
+	deadLetters := restarted.DeadLetters(first.ID)
+	if asserter.Len(deadLetters, 1) {
+		asserter.True(strings.HasPrefix(deadLetters[0].ID, "dl_"))
+		asserter.Equal("2-1", deadLetters[0].Change.ID)
+		asserter.Equal(5, deadLetters[0].Attempts)
+	}
+	asserter.Empty(restarted.DeadLetters("sub_gone"), "dead letters for subscriptions that don't exist should be dropped")
+
+	taken, err := restarted.TakeDeadLetters(first.ID)
+	asserter.NoError(err)
+	asserter.Equal(deadLetters, taken)
+	asserter.Empty(restarted.DeadLetters(first.ID))
+
+	deleted, err := restarted.Delete(second.ID)
+	asserter.NoError(err)
+	asserter.True(deleted)
+	asserter.Empty(restarted.DeadLetters(second.ID), "dead letters go with their subscription")
+	deleted, err = restarted.Delete(second.ID)
+	asserter.NoError(err)
+	asserter.False(deleted)
+
+	again := unit.NewSubscriptionStore(path)
+	asserter.NoError(again.Load())
+	asserter.Equal([]unit.Subscription{first}, again.List())
+}
+
+func TestSubscriptionStore_LoadBad(t *testing.T) {
+	asserter := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "subscriptions.json")
+	if err := ioutil.WriteFile(path, []byte(`{"format": 2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err := unit.NewSubscriptionStore(path).Load()
+	if asserter.Error(err) {
+		asserter.Contains(err.Error(), "are format 2, only format 1 is understood")
+	}
+}
+
+// runSubscriptions runs a dispatcher until the test is done, with no waiting between retries
+func runSubscriptions(t *testing.T, feed *unit.ChangeFeed, store *unit.SubscriptionStore) *unit.SubscriptionDispatcher {
+	ret := unit.NewSubscriptionDispatcher(feed, store, 2)
+	// the receivers are all on loopback, which subscriptions normally aren't allowed to deliver to
+	ret.Client = &http.Client{Timeout: 5 * time.Second}
+	ret.MaxAttempts = 2
+	ret.Now = func() time.Time {
+		return syncTime
+	}
+	ret.Sleep = func(context.Context, time.Duration) error {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(testutil.NewTestContext())
+	done := make(chan struct{})
+	go func() {
+		ret.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return ret
+}
+
+// waitUntil polls until condition holds, failing the test if it takes too long
+func waitUntil(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("gave up waiting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscriptionDispatcher(t *testing.T) {
+	asserter := assert.New(t)
+
+	feed := newChangeFeed(t, 0)
+	store := newSubscriptionStore("")
+	everything, everythingURL := newWebhookReceiver(t)
+	boomers, boomersURL := newWebhookReceiver(t)
+	// fails both attempts at the first delivery, and is fine after that
+	flaky, flakyURL := newWebhookReceiver(t, 500, 500)
+
+	_, err := store.Create(unit.SubscriptionRequest{URL: everythingURL})
+	asserter.NoError(err)
+	_, err = store.Create(unit.SubscriptionRequest{URL: boomersURL, Secret: "boomers only please", Generations: []string{"boomer"}})
+	asserter.NoError(err)
+	flakySub, err := store.Create(unit.SubscriptionRequest{URL: flakyURL, EmployeeIDs: []string{"2"}})
+	asserter.NoError(err)
+	testInstance := runSubscriptions(t, feed, store)
+
+	// Tiger gets older, which boomers care about, and so does Garrett, which the flaky one cares about
+	asserter.NoError(feed.Observe(rosterSnapshot(3, rosterEmployee(1, "Tiger Nixon", 61), rosterEmployee(2, "Garrett Winters", 41), rosterEmployee(4, "Cedric Kelly", 22))))
+
+	delivered := map[string]bool{}
+	for _, d := range everything.waitFor(t, 2) {
+		delivered[d.header.Get(unit.WebhookIDHeader)] = true
+	}
+	asserter.Equal(map[string]bool{"3-1": true, "3-2": true}, delivered)
+
+	toBoomers := boomers.waitFor(t, 1)
+	asserter.Equal("3-1", toBoomers[0].header.Get(unit.WebhookIDHeader))
+	asserter.Equal(unit.SignWebhook("boomers only please", "1583298367", toBoomers[0].body), toBoomers[0].header.Get(unit.WebhookSignatureHeader))
+
+	flaky.waitFor(t, 2)
+	waitUntil(t, func() bool {
+		return len(store.DeadLetters(flakySub.ID)) == 1
+	})
+	deadLetter := store.DeadLetters(flakySub.ID)[0]
+	asserter.Equal("3-2", deadLetter.Change.ID)
+	asserter.Equal(2, deadLetter.Attempts)
+	asserter.Equal("unexpected response code, got 500", deadLetter.LastError)
+	asserter.Equal(syncTime, deadLetter.FailedAt)
+
+	// the flaky one is better now
+	replayed, err := testInstance.Replay(flakySub.ID)
+	asserter.NoError(err)
+	asserter.Equal(1, replayed)
+	deliveries := flaky.waitFor(t, 1)
+	asserter.Len(deliveries, 3)
+	asserter.Equal("3-2", deliveries[2].header.Get(unit.WebhookIDHeader))
+	asserter.Empty(store.DeadLetters(flakySub.ID))
+
+	// and once it's gone it doesn't get anything more
+	_, err = store.Delete(flakySub.ID)
+	asserter.NoError(err)
+	asserter.NoError(feed.Observe(rosterSnapshot(4, rosterEmployee(1, "Tiger Nixon", 61), rosterEmployee(2, "Garrett Winters", 42), rosterEmployee(4, "Cedric Kelly", 22))))
+	everything.waitFor(t, 1)
+	select {
+	case <-flaky.received:
+		asserter.Fail("deleted subscriptions shouldn't get deliveries")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSubscriptionsAPI(t *testing.T) {
+	asserter := assert.New(t)
+
+	store := newSubscriptionStore(filepath.Join(t.TempDir(), "subscriptions.json"))
+	client := testutil.NewServerBuilder(t).
+		WithSubscriptions(unit.NewSubscriptionDispatcher(newChangeFeed(t, 0), store, 0)).
+		WithMessages(loadLocales(t)).
+		Start()
+	post := func(path string, body string) *testutil.Response {
+		return client.Do("POST", path, strings.NewReader(body), map[string]string{"Content-Type": "application/json"})
+	}
+
+	res := post("/subscriptions", `{"url": "https://example.com/hook", "events": ["changed"], "generations": ["boomer"]}`)
+	asserter.Equal(201, res.Status)
+	testutil.AssertGoldenNamed(t, t.Name()+"/create", res)
+	created := store.List()[0]
+	asserter.Equal("/subscriptions/"+created.ID, res.Header.Get("Location"))
+
+	res = post("/subscriptions", `{"url": "nope", "events": ["fired"]}`)
+	asserter.Equal(400, res.Status)
+	testutil.AssertGoldenNamed(t, t.Name()+"/create_invalid", res)
+
+	res = post("/subscriptions", `{"url": "https://example.com/hook", "callback": "https://example.com/other"}`)
+	asserter.Equal(400, res.Status)
+
+	// secrets only come back on create
+	res = client.Get("/subscriptions", nil)
+	asserter.Equal(200, res.Status)
+	testutil.AssertGoldenNamed(t, t.Name()+"/list", res)
+	res = client.Get("/subscriptions/"+created.ID, nil)
+	asserter.Equal(200, res.Status)
+	testutil.AssertGoldenNamed(t, t.Name()+"/get", res)
+
+	asserter.NoError(store.AddDeadLetter(unit.DeadLetter{
+		SubscriptionID: created.ID,
+		Change:         domain.EmployeeChange{ID: "2-1", Type: domain.ChangeChanged, EmployeeID: "1", Version: 2, At: syncTime},
+		Attempts:       5,
+		LastError:      "unexpected response code, got 503",
+		FailedAt:       syncTime,
+	}))
+	res = client.Get("/subscriptions/"+created.ID+"/dead-letters", nil)
+	asserter.Equal(200, res.Status)
+	testutil.AssertGoldenNamed(t, t.Name()+"/dead_letters", res)
+
+	// nothing is running the dispatcher, so the replay just sits in the queue
+	res = post("/subscriptions/"+created.ID+"/dead-letters/replay", "")
+	asserter.Equal(202, res.Status)
+	asserter.JSONEq(`{"replayed": 1}`, res.Body)
+	asserter.Empty(store.DeadLetters(created.ID))
+
+	res = client.Do("DELETE", "/subscriptions/"+created.ID, nil, nil)
+	asserter.Equal(204, res.Status)
+	asserter.Empty(res.Body)
+	asserter.Empty(store.List())
+
+	res = client.Get("/subscriptions/"+created.ID, map[string]string{"Accept-Language": "es"})
+	asserter.Equal(404, res.Status)
+	testutil.AssertGoldenNamed(t, t.Name()+"/not_found", res)
+	for _, path := range []string{"/subscriptions/sub_nope/dead-letters", "/subscriptions/sub_nope/dead-letters/replay"} {
+		method := "GET"
+		if strings.HasSuffix(path, "replay") {
+			method = "POST"
+		}
+		res = client.Do(method, path, nil, nil)
+		asserter.Equal(404, res.Status, path)
+		asserter.Equal(domain.ProblemTypeSubscriptionNotFound, res.Problem().Type, path)
+	}
+	res = client.Do("DELETE", "/subscriptions/sub_nope", nil, nil)
+	asserter.Equal(404, res.Status)
+}
+
+func TestSubscriptionsAPI_ContentNegotiation(t *testing.T) {
+	store := newSubscriptionStore(filepath.Join(t.TempDir(), "subscriptions.json"))
+	created, err := store.Create(unit.SubscriptionRequest{URL: "https://example.com/hook", Events: []string{"changed"}, EmployeeIDs: []string{"1", "2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddDeadLetter(unit.DeadLetter{
+		SubscriptionID: created.ID,
+		Change: domain.EmployeeChange{
+			ID:         "2-1",
+			Type:       domain.ChangeChanged,
+			EmployeeID: "1",
+			Version:    2,
+			At:         syncTime,
+			Changes:    []domain.FieldChange{{Field: "age", From: "61", To: "62"}},
+		},
+		Attempts:  5,
+		LastError: "unexpected response code, got 503",
+		FailedAt:  syncTime,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	client := testutil.NewServerBuilder(t).
+		WithSubscriptions(unit.NewSubscriptionDispatcher(newChangeFeed(t, 0), store, 0)).
+		Start()
+
+	testCases := []struct {
+		desc           string
+		path           string
+		accept         string
+		expectedStatus int
+	}{
+		{"list xml", "/subscriptions", "application/xml", 200},
+		{"list msgpack", "/subscriptions", "application/msgpack", 200},
+		// there's no flattening a subscription into a row
+		{"list csv", "/subscriptions", "text/csv", 406},
+		{"list anything but json", "/subscriptions", "*/*, application/*;q=0", 200},
+		{"get xml", "/subscriptions/" + created.ID, "application/xml", 200},
+		{"dead letters xml", "/subscriptions/" + created.ID + "/dead-letters", "application/xml", 200},
+		{"not found xml", "/subscriptions/sub_nope", "application/xml", 404},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			res := client.Get(tc.path, map[string]string{"Accept": tc.accept})
+			asserter.Equal(tc.expectedStatus, res.Status)
+			testutil.AssertGolden(t, res)
+		})
+	}
+}
+
+func TestSubscriptionsAPI_CreateAsXML(t *testing.T) {
+	asserter := assert.New(t)
+
+	store := newSubscriptionStore(filepath.Join(t.TempDir(), "subscriptions.json"))
+	client := testutil.NewServerBuilder(t).
+		WithSubscriptions(unit.NewSubscriptionDispatcher(newChangeFeed(t, 0), store, 0)).
+		Start()
+
+	// status and headers come along no matter the format
+	res := client.Do("POST", "/subscriptions", strings.NewReader(`{"url": "https://example.com/hook"}`), map[string]string{
+		"Content-Type": "application/json",
+		"Accept":       "application/xml",
+	})
+	asserter.Equal(201, res.Status)
+	asserter.Equal("application/xml; charset=utf-8", res.Header.Get("Content-Type"))
+	created := store.List()[0]
+	asserter.Equal("/subscriptions/"+created.ID, res.Header.Get("Location"))
+	asserter.Contains(res.Body, "<subscription><id>"+created.ID+"</id>")
+
+	res = client.Do("DELETE", "/subscriptions/"+created.ID, nil, map[string]string{"Accept": "application/xml"})
+	asserter.Equal(204, res.Status)
+	asserter.Empty(res.Body)
+}
+
+func TestSubscriptionDispatcher_OnlyDeliversToPublicAddresses(t *testing.T) {
+	asserter := assert.New(t)
+
+	receiver, receiverURL := newWebhookReceiver(t)
+	testInstance := unit.NewSubscriptionDispatcher(newChangeFeed(t, 0), newSubscriptionStore(""), 0)
+	testInstance.MaxAttempts = 1
+
+	// a name that resolves to loopback gets caught as well as a plain ip
+	for _, target := range []string{receiverURL, strings.Replace(receiverURL, "127.0.0.1", "localhost", 1)} {
+		attempts, err := testInstance.Send(testutil.NewTestContext(), target, "sixteen chars ok", domain.EmployeeChange{ID: "1-1"})
+		asserter.Equal(1, attempts, target)
+		if asserter.Error(err, target) {
+			asserter.Contains(err.Error(), "isn't a public address", target)
+		}
+	}
+	select {
+	case <-receiver.received:
+		asserter.Fail("nothing should have been delivered")
+	default:
+	}
+
+	// the dial gets refused before anything is sent, so these don't need to go anywhere real
+	port := receiverURL[strings.LastIndex(receiverURL, ":")+1:]
+	for _, host := range []string{
+		"198.18.0.1",
+		"192.0.0.1",
+		"240.0.0.1",
+		"255.255.255.255",
+		"[64:ff9b::7f00:1]",
+		"[64:ff9b::a00:1]",
+		"[2002:7f00:1::]",
+		"[2002:c0a8:1::1]",
+	} {
+		target := "http://" + host + ":" + port
+		attempts, err := testInstance.Send(testutil.NewTestContext(), target, "sixteen chars ok", domain.EmployeeChange{ID: "1-1"})
+		asserter.Equal(1, attempts, target)
+		if asserter.Error(err, target) {
+			asserter.Contains(err.Error(), "isn't a public address", target)
+		}
+	}
+}
+
+func TestSubscriptionDispatcher_ReplayDoesNotWait(t *testing.T) {
+	asserter := assert.New(t)
+
+	store := newSubscriptionStore("")
+	sub, err := store.Create(unit.SubscriptionRequest{URL: "https://example.com/hook"})
+	asserter.NoError(err)
+	// more than the queue holds, and nothing is running to drain it
+	for i := 0; i < 150; i++ {
+		asserter.NoError(store.AddDeadLetter(unit.DeadLetter{SubscriptionID: sub.ID, Change: domain.EmployeeChange{ID: fmt.Sprintf("1-%d", i)}, FailedAt: syncTime}))
+	}
+	testInstance := unit.NewSubscriptionDispatcher(newChangeFeed(t, 0), store, 0)
+
+	done := make(chan int)
+	go func() {
+		replayed, err := testInstance.Replay(sub.ID)
+		asserter.NoError(err)
+		done <- replayed
+	}()
+	select {
+	case replayed := <-done:
+		asserter.Equal(150, replayed)
+	case <-time.After(5 * time.Second):
+		asserter.Fail("replay waited on the queue")
+	}
+}
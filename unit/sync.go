@@ -0,0 +1,316 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/pkg/errors"
+)
+
+// Every lookup goes to the upstream, so when it's down so are we. The syncer keeps a copy of the whole roster on disk,
+// refreshed in the background, and the fallback fetcher serves from that copy when the upstream lets us down. The
+// copy can be stale, which beats a 500.
+
+// snapshotFormat is bumped whenever Snapshot changes in a way older code can't read
+const snapshotFormat = 1
+
+// Snapshot is the roster as of TakenAt. Version goes up by one with every successful sync, so two snapshots with the
+// same version are the same data.
+type Snapshot struct {
+	Format    int                         `json:"format"`
+	Version   int64                       `json:"version"`
+	TakenAt   time.Time                   `json:"taken_at"`
+	Employees []domain.RemoteEmployeeData `json:"employees"`
+}
+
+// SyncStatus is how the syncer is getting on, for the admin route
+type SyncStatus struct {
+	XMLName xml.Name `json:"-" xml:"sync"`
+	// Version and Employees describe the snapshot being served, zero if there isn't one yet
+	Version   int64 `json:"version" xml:"version"`
+	Employees int   `json:"employees" xml:"employees"`
+	// TakenAt is when the snapshot being served was pulled from upstream
+	TakenAt     *time.Time `json:"taken_at,omitempty" xml:"taken_at,omitempty"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty" xml:"last_attempt,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty" xml:"last_success,omitempty"`
+	// LastError is why the most recent sync failed, empty if it worked
+	LastError           string `json:"last_error,omitempty" xml:"last_error,omitempty"`
+	ConsecutiveFailures int    `json:"consecutive_failures" xml:"consecutive_failures"`
+	TotalFailures       int    `json:"total_failures" xml:"total_failures"`
+	// FallbackLookups counts the lookups that were answered from the snapshot because upstream failed
+	FallbackLookups int `json:"fallback_lookups" xml:"fallback_lookups"`
+}
+
+type Syncer struct {
+	fetcher RemoteEmployeeLister
+	path    string
+	// Now is here so tests can control time, if left nil time.Now is used
+	Now func() time.Time
+	// OnSnapshot, when set, gets told about every snapshot the syncer starts serving, the one Load finds as well as
+	// each one Sync pulls. It's called one snapshot at a time, in order. Errors get logged, the snapshot is used either
+	// way.
+	OnSnapshot func(snapshot *Snapshot) error
+
+	// syncing holds off a manual sync while a scheduled one is running, or they'd both claim the same version. Load
+	// takes it too so OnSnapshot sees snapshots in order.
+	syncing  sync.Mutex
+	mu       sync.RWMutex
+	snapshot *Snapshot
+	byID     map[domain.EmployeeID]domain.RemoteEmployeeData
+	status   SyncStatus
+}
+
+// NewSyncer keeps a snapshot of everybody fetcher lists at path. Call Load to pick up where a previous run left off.
+func NewSyncer(fetcher RemoteEmployeeLister, path string) *Syncer {
+	return &Syncer{fetcher: fetcher, path: path}
+}
+
+func (s *Syncer) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+// Load reads the snapshot on disk, if there is one. Not having one yet isn't an error.
+func (s *Syncer) Load(ctx context.Context) error {
+	s.syncing.Lock()
+	defer s.syncing.Unlock()
+
+	raw, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	snapshot := new(Snapshot)
+	if err := json.Unmarshal(raw, snapshot); err != nil {
+		return errors.Wrapf(err, "reading snapshot %s", s.path)
+	}
+	if snapshot.Format != snapshotFormat {
+		return errors.Errorf("snapshot %s is format %d, only format %d is understood", s.path, snapshot.Format, snapshotFormat)
+	}
+
+	s.mu.Lock()
+	s.use(snapshot)
+	s.mu.Unlock()
+	s.notify(ctx, snapshot)
+	return nil
+}
+
+// Sync pulls the roster from upstream and writes a new snapshot. If either fails the old snapshot stays put.
+func (s *Syncer) Sync(ctx context.Context) error {
+	s.syncing.Lock()
+	defer s.syncing.Unlock()
+
+	now := s.now()
+	err := s.sync(ctx, now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LastAttempt = &now
+	if err != nil {
+		s.status.LastError = err.Error()
+		s.status.ConsecutiveFailures++
+		s.status.TotalFailures++
+		return err
+	}
+	s.status.LastSuccess = &now
+	s.status.LastError = ""
+	s.status.ConsecutiveFailures = 0
+	return nil
+}
+
+func (s *Syncer) sync(ctx context.Context, now time.Time) error {
+	employees, err := s.fetcher.FetchEmployees(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	version := int64(1)
+	if s.snapshot != nil {
+		version = s.snapshot.Version + 1
+	}
+	s.mu.RUnlock()
+
+	snapshot := &Snapshot{
+		Format:    snapshotFormat,
+		Version:   version,
+		TakenAt:   now,
+		Employees: employees,
+	}
+	if err := writeJSONFile(s.path, snapshot); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.use(snapshot)
+	s.mu.Unlock()
+	s.notify(ctx, snapshot)
+	return nil
+}
+
+func (s *Syncer) notify(ctx context.Context, snapshot *Snapshot) {
+	if s.OnSnapshot == nil {
+		return
+	}
+	if err := s.OnSnapshot(snapshot); err != nil {
+		_ = kit.LogErrorf(ctx, "error handling snapshot %d: %+v", snapshot.Version, err)
+	}
+}
+
+// writeJSONFile goes to a temp file and renames it into place, so a crash part way through can't leave half a file
+// behind
+func writeJSONFile(path string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		_ = tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp.Name(), path))
+}
+
+// use swaps in a snapshot, callers need to hold the write lock
+func (s *Syncer) use(snapshot *Snapshot) {
+	byID := make(map[domain.EmployeeID]domain.RemoteEmployeeData, len(snapshot.Employees))
+	for _, e := range snapshot.Employees {
+		byID[domain.EmployeeIDFromInt(e.ID)] = e
+	}
+	s.snapshot = snapshot
+	s.byID = byID
+	s.status.Version = snapshot.Version
+	s.status.Employees = len(snapshot.Employees)
+	takenAt := snapshot.TakenAt
+	s.status.TakenAt = &takenAt
+}
+
+// Run syncs right away, and then every interval until ctx is done. Failures get logged and retried next time around.
+// An interval of zero or less means syncing just the once, same as SearchIndex.Run.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	var ticks <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		if err := s.Sync(ctx); err != nil {
+			_ = kit.LogErrorf(ctx, "error syncing employee snapshot: %+v", err)
+		}
+		select {
+		case <-ticks:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Syncer) Status() SyncStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+// Lookup finds an employee in the snapshot
+func (s *Syncer) Lookup(employeeID domain.EmployeeID) (*domain.RemoteEmployee, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.byID[employeeID]
+	if !ok {
+		return nil, false
+	}
+	return &domain.RemoteEmployee{Status: "success", Data: &data}, true
+}
+
+// Employees is everybody in the snapshot, nil if there isn't one yet
+func (s *Syncer) Employees() []domain.RemoteEmployeeData {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.snapshot == nil {
+		return nil
+	}
+	return append([]domain.RemoteEmployeeData{}, s.snapshot.Employees...)
+}
+
+func (s *Syncer) countFallback() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.FallbackLookups++
+}
+
+type snapshotFallbackFetcher struct {
+	next   RemoteEmployeeFetcher
+	syncer *Syncer
+}
+
+func (f *snapshotFallbackFetcher) FetchEmployee(ctx context.Context, employeeID domain.EmployeeID) (*domain.RemoteEmployee, error) {
+	ret, err := f.next.FetchEmployee(ctx, employeeID)
+	if err == nil || ctx.Err() != nil {
+		return ret, err
+	}
+	// employees missing from the snapshot might just be newer than it, so that's still the upstream's error rather
+	// than a not found
+	fallback, ok := f.syncer.Lookup(employeeID)
+	if !ok {
+		return nil, err
+	}
+	_ = kit.LogWarningf(ctx, "upstream failed fetching employee %s, answering from snapshot: %s", employeeID, err)
+	f.syncer.countFallback()
+	return fallback, nil
+}
+
+func (f *snapshotFallbackFetcher) FetchEmployees(ctx context.Context) ([]domain.RemoteEmployeeData, error) {
+	ret, err := f.next.FetchEmployees(ctx)
+	if err == nil || ctx.Err() != nil {
+		return ret, err
+	}
+	fallback := f.syncer.Employees()
+	if fallback == nil {
+		return nil, err
+	}
+	_ = kit.LogWarningf(ctx, "upstream failed listing employees, answering from snapshot: %s", err)
+	f.syncer.countFallback()
+	return fallback, nil
+}
+
+// NewSnapshotFallbackFetcher decorates a RemoteEmployeeFetcher so upstream failures get answered from the syncer's
+// snapshot when it can. The syncer should be syncing from next, not from this, or it will happily re-save its own
+// snapshot whenever upstream is down.
+func NewSnapshotFallbackFetcher(next RemoteEmployeeFetcher, syncer *Syncer) RemoteEmployeeFetcher {
+	return &snapshotFallbackFetcher{next, syncer}
+}
+
+func (s *SomeServer) GetSyncEndpoint(_ context.Context, _ interface{}) (interface{}, error) {
+	return s.Sync.Status(), nil
+}
+
+// PostSyncEndpoint syncs right now rather than waiting for the next go around, failures are reported in the status
+// rather than as an error since the request itself did what was asked
+func (s *SomeServer) PostSyncEndpoint(ctx context.Context, _ interface{}) (interface{}, error) {
+	if err := s.Sync.Sync(ctx); err != nil {
+		_ = kit.LogErrorf(ctx, "error syncing employee snapshot: %+v", err)
+	}
+	return s.Sync.Status(), nil
+}
@@ -0,0 +1,247 @@
+package unit_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/fakeupstream"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/jonsabados/unit-testing-party/unit/testutil/fetchercontract"
+	"github.com/stretchr/testify/assert"
+)
+
+var syncTime = time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+
+// newSyncUpstream serves the first few seed employees, the returned fetcher talks to it
+func newSyncUpstream(t *testing.T) (*fakeupstream.Server, unit.RemoteEmployeeFetcher) {
+	upstream := fakeupstream.NewServer(fakeupstream.Config{Employees: fakeupstream.SeedEmployees()[:3]})
+	ts := httptest.NewServer(upstream)
+	t.Cleanup(ts.Close)
+	return upstream, unit.NewRemoteEmployeeFetcher(ts.URL)
+}
+
+func newSyncer(fetcher unit.RemoteEmployeeLister, path string) *unit.Syncer {
+	ret := unit.NewSyncer(fetcher, path)
+	ret.Now = func() time.Time {
+		return syncTime
+	}
+	return ret
+}
+
+func TestSyncer_SyncAndLoad(t *testing.T) {
+	asserter := assert.New(t)
+
+	_, fetcher := newSyncUpstream(t)
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	testInstance := newSyncer(fetcher, path)
+	asserter.NoError(testInstance.Load(testutil.NewTestContext()), "no snapshot yet is fine")
+	_, found := testInstance.Lookup("1")
+	asserter.False(found)
+
+	asserter.NoError(testInstance.Sync(testutil.NewTestContext()))
+	status := testInstance.Status()
+	asserter.Equal(int64(1), status.Version)
+	asserter.Equal(3, status.Employees)
+	asserter.Equal(&syncTime, status.LastSuccess)
+	asserter.Equal(&syncTime, status.TakenAt)
+	asserter.Empty(status.LastError)
+
+	raw, err := ioutil.ReadFile(path)
+	asserter.NoError(err)
+	snapshot := new(unit.Snapshot)
+	asserter.NoError(json.Unmarshal(raw, snapshot))
+	asserter.Equal(1, snapshot.Format)
+	asserter.Equal(int64(1), snapshot.Version)
+	asserter.Len(snapshot.Employees, 3)
+
+	// a fresh process picks up where the last one left off
+	restarted := newSyncer(fetcher, path)
+	asserter.NoError(restarted.Load(testutil.NewTestContext()))
+	employee, found := restarted.Lookup("2")
+	if asserter.True(found) {
+		asserter.Equal("Garrett Winters", employee.Data.EmployeeName)
+	}
+	asserter.Equal(int64(1), restarted.Status().Version)
+	asserter.Nil(restarted.Status().LastSuccess, "nothing has been synced by this syncer yet")
+
+	asserter.NoError(restarted.Sync(testutil.NewTestContext()))
+	asserter.Equal(int64(2), restarted.Status().Version)
+}
+
+func TestSyncer_FailureKeepsSnapshot(t *testing.T) {
+	asserter := assert.New(t)
+
+	upstream, fetcher := newSyncUpstream(t)
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	testInstance := newSyncer(fetcher, path)
+	asserter.NoError(testInstance.Sync(testutil.NewTestContext()))
+	before, err := ioutil.ReadFile(path)
+	asserter.NoError(err)
+
+	upstream.Update(func(cfg *fakeupstream.Config) {
+		cfg.ErrorRate = 1
+	})
+	for i := 0; i < 2; i++ {
+		asserter.Error(testInstance.Sync(testutil.NewTestContext()))
+	}
+	status := testInstance.Status()
+	asserter.Equal(int64(1), status.Version)
+	asserter.Equal(3, status.Employees)
+	asserter.Equal(2, status.ConsecutiveFailures)
+	asserter.Equal(2, status.TotalFailures)
+	asserter.Contains(status.LastError, "unexpected response code, got 500")
+	after, err := ioutil.ReadFile(path)
+	asserter.NoError(err)
+	asserter.Equal(before, after)
+
+	upstream.Update(func(cfg *fakeupstream.Config) {
+		cfg.ErrorRate = 0
+	})
+	asserter.NoError(testInstance.Sync(testutil.NewTestContext()))
+	status = testInstance.Status()
+	asserter.Equal(int64(2), status.Version)
+	asserter.Equal(0, status.ConsecutiveFailures)
+	asserter.Equal(2, status.TotalFailures)
+	asserter.Empty(status.LastError)
+}
+
+func TestSyncer_LoadBad(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		contents    string
+		expectedErr string
+	}{
+		{"garbage", "{", "reading snapshot"},
+		{"newer format", `{"format": 2, "version": 7}`, "is format 2, only format 1 is understood"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			path := filepath.Join(t.TempDir(), "snapshot.json")
+			if err := ioutil.WriteFile(path, []byte(tc.contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			err := unit.NewSyncer(nil, path).Load(testutil.NewTestContext())
+			if asserter.Error(err) {
+				asserter.Contains(err.Error(), tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestSyncer_RunWithoutInterval(t *testing.T) {
+	asserter := assert.New(t)
+
+	_, fetcher := newSyncUpstream(t)
+	syncer := newSyncer(fetcher, filepath.Join(t.TempDir(), "snapshot.json"))
+
+	// zero used to go straight into time.NewTicker and panic, now it's a single sync
+	ctx, cancel := context.WithCancel(testutil.NewTestContext())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		syncer.Run(ctx, 0)
+	}()
+	waitUntil(t, func() bool {
+		return syncer.Status().Version == 1
+	})
+	asserter.Equal(3, syncer.Status().Employees)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't stop when its context was cancelled")
+	}
+}
+
+func TestSnapshotFallbackFetcher(t *testing.T) {
+	asserter := assert.New(t)
+
+	upstream, fetcher := newSyncUpstream(t)
+	syncer := newSyncer(fetcher, filepath.Join(t.TempDir(), "snapshot.json"))
+	asserter.NoError(syncer.Sync(testutil.NewTestContext()))
+	testInstance := unit.NewSnapshotFallbackFetcher(fetcher, syncer)
+
+	// upstream is fine, so it's what gets used
+	upstream.Update(func(cfg *fakeupstream.Config) {
+		cfg.Employees[0].EmployeeName = "Tiger Nixon Jr."
+	})
+	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), "1")
+	asserter.NoError(err)
+	asserter.Equal("Tiger Nixon Jr.", res.Data.EmployeeName)
+
+	upstream.Update(func(cfg *fakeupstream.Config) {
+		cfg.ErrorRate = 1
+	})
+	res, err = testInstance.FetchEmployee(testutil.NewTestContext(), "1")
+	asserter.NoError(err)
+	asserter.Equal(testutil.NewRemoteEmployee().Build(), res)
+
+	// not in the snapshot, which doesn't mean they don't exist
+	res, err = testInstance.FetchEmployee(testutil.NewTestContext(), "9000")
+	asserter.Error(err)
+	asserter.Nil(res)
+
+	list, err := testInstance.FetchEmployees(testutil.NewTestContext())
+	asserter.NoError(err)
+	asserter.Len(list, 3)
+
+	asserter.Equal(2, syncer.Status().FallbackLookups)
+}
+
+// with nothing in the snapshot the fallback has nothing to add, and had better be invisible
+func TestSnapshotFallbackFetcher_Contract(t *testing.T) {
+	fetchercontract.Run(t, func(t *testing.T, upstream *fetchercontract.Upstream) unit.RemoteEmployeeFetcher {
+		fetcher := unit.NewRemoteEmployeeFetcher(upstream.URL)
+		return unit.NewSnapshotFallbackFetcher(fetcher, unit.NewSyncer(fetcher, filepath.Join(t.TempDir(), "snapshot.json")))
+	})
+}
+
+func TestAdminSync(t *testing.T) {
+	asserter := assert.New(t)
+
+	upstream, fetcher := newSyncUpstream(t)
+	syncer := newSyncer(fetcher, filepath.Join(t.TempDir(), "snapshot.json"))
+	client := testutil.NewServerBuilder(t).
+		WithFetcher(unit.NewSnapshotFallbackFetcher(fetcher, syncer)).
+		WithMapper(func(employee *domain.RemoteEmployee) (*domain.Employee, error) {
+			return &domain.Employee{ID: "1", Name: employee.Data.EmployeeName, Age: 61, Generation: domain.BabyBoomer}, nil
+		}).
+		WithSync(syncer).
+		Start()
+
+	res := client.Get("/admin/sync", nil)
+	asserter.Equal(200, res.Status)
+	testutil.AssertGoldenNamed(t, t.Name()+"/before", res)
+
+	res = client.Do("POST", "/admin/sync", nil, nil)
+	asserter.Equal(200, res.Status)
+	testutil.AssertGoldenNamed(t, t.Name()+"/synced", res)
+
+	// upstream goes away, but the snapshot has our back
+	upstream.Update(func(cfg *fakeupstream.Config) {
+		cfg.ErrorRate = 1
+	})
+	employee, _, res := client.GetEmployee("1", nil)
+	asserter.Equal(200, res.Status)
+	asserter.Equal("Tiger Nixon", employee.Name)
+
+	res = client.Do("POST", "/admin/sync", nil, nil)
+	asserter.Equal(200, res.Status)
+	testutil.AssertGoldenNamed(t, t.Name()+"/failed", res)
+
+	res = client.Get("/admin/sync", map[string]string{"Accept": "application/xml"})
+	asserter.Equal(200, res.Status)
+	testutil.AssertGoldenNamed(t, t.Name()+"/xml", res)
+}
@@ -0,0 +1,235 @@
+// Package cassette is an http.RoundTripper that records real HTTP interactions to a file and plays them back later,
+// so tests that need upstream responses don't need the upstream (or a hand rolled httptest server per test).
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type Mode int
+
+const (
+	// ModeStrict only ever replays, anything not on the cassette fails. This is what tests should normally use.
+	ModeStrict Mode = iota
+	// ModeReplay replays what it can and sends anything else to the real transport, recording the result
+	ModeReplay
+	// ModeRecord ignores whatever is on the cassette and records everything fresh
+	ModeRecord
+)
+
+// ModeFromEnv reads the mode out of the CASSETTE_MODE environment variable (record, replay or strict), defaulting to
+// strict. This lets cassettes get re-recorded with something like `CASSETTE_MODE=record go test ./...`.
+func ModeFromEnv() Mode {
+	switch os.Getenv("CASSETTE_MODE") {
+	case "record":
+		return ModeRecord
+	case "replay":
+		return ModeReplay
+	default:
+		return ModeStrict
+	}
+}
+
+// ErrNoMatch is what ModeStrict hands back for requests that aren't on the cassette
+var ErrNoMatch = errors.New("no matching interaction on cassette")
+
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder is the RoundTripper, it is safe for concurrent use
+type Recorder struct {
+	path string
+	mode Mode
+	real http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+	dirty    bool
+}
+
+// New loads the cassette at path (unless recording, or it doesn't exist yet) and returns a Recorder around it. real
+// is used for anything that needs to hit the network, http.DefaultTransport if nil.
+func New(path string, mode Mode, real http.RoundTripper) (*Recorder, error) {
+	if real == nil {
+		real = http.DefaultTransport
+	}
+	ret := &Recorder{
+		path: path,
+		mode: mode,
+		real: real,
+	}
+
+	if mode == ModeRecord {
+		return ret, nil
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && mode == ModeReplay {
+		return ret, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := json.Unmarshal(bytes, &ret.cassette); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse cassette %s", path)
+	}
+	ret.used = make([]bool, len(ret.cassette.Interactions))
+	return ret, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode != ModeRecord {
+		if res, ok := r.replay(key, req); ok {
+			return res, nil
+		}
+		if r.mode == ModeStrict {
+			return nil, errors.Wrapf(ErrNoMatch, "%s %s?%s", key.Method, key.Path, key.Query)
+		}
+	}
+
+	return r.record(key, req)
+}
+
+// replay finds the first unused interaction matching the request. Once every match has been used the last one keeps
+// getting handed out, so polling the same url works without recording it N times.
+func (r *Recorder) replay(key Request, req *http.Request) (*http.Response, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := -1
+	for i, interaction := range r.cassette.Interactions {
+		if interaction.Request != key {
+			continue
+		}
+		found = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return nil, false
+	}
+	r.used[found] = true
+	return toHTTPResponse(r.cassette.Interactions[found].Response, req), true
+}
+
+func (r *Recorder) record(key Request, req *http.Request) (*http.Response, error) {
+	res, err := r.real.RoundTrip(req)
+	if err != nil {
+		// transport errors aren't recorded, there isn't a meaningful way to play them back
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	recorded := Response{
+		Status:  res.StatusCode,
+		Headers: res.Header,
+		Body:    string(body),
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{key, recorded})
+	r.used = append(r.used, true)
+	r.dirty = true
+	r.mu.Unlock()
+
+	return toHTTPResponse(recorded, req), nil
+}
+
+// Save writes the cassette back out if anything new was recorded
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.dirty {
+		return nil
+	}
+	bytes, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := ioutil.WriteFile(r.path, append(bytes, '\n'), 0644); err != nil {
+		return errors.WithStack(err)
+	}
+	r.dirty = false
+	return nil
+}
+
+// requestKey pulls out what we match on. Reading the body means putting it back afterwards so the real transport
+// still has something to send.
+func requestKey(req *http.Request) (Request, error) {
+	ret := Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query().Encode(),
+	}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return Request{}, errors.WithStack(err)
+		}
+		_ = req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		ret.Body = string(body)
+	}
+	return ret, nil
+}
+
+func toHTTPResponse(recorded Response, req *http.Request) *http.Response {
+	headers := make(http.Header)
+	for k, v := range recorded.Headers {
+		headers[k] = append([]string(nil), v...)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,142 @@
+package cassette
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doRequest(client *http.Client, method string, url string, body string) (int, string, error) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	bytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		panic(err)
+	}
+	return res.StatusCode, string(bytes), nil
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	asserter := assert.New(t)
+
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		n := atomic.AddInt32(&hits, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Hit", strconv.Itoa(int(n)))
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte(r.URL.RawQuery + "|" + string(body)))
+	}))
+	path := filepath.Join(t.TempDir(), "nested", "cassette.json")
+
+	recorder, err := New(path, ModeRecord, nil)
+	asserter.NoError(err)
+	client := &http.Client{Transport: recorder}
+	status, body, err := doRequest(client, http.MethodPost, ts.URL+"/thing?b=2&a=1", "hello")
+	asserter.NoError(err)
+	asserter.Equal(http.StatusTeapot, status)
+	asserter.Equal("b=2&a=1|hello", body)
+	asserter.NoError(recorder.Save())
+	ts.Close()
+
+	// server is gone now, so anything that comes back is from the cassette
+	replayer, err := New(path, ModeStrict, nil)
+	asserter.NoError(err)
+	client = &http.Client{Transport: replayer}
+
+	// query order shouldn't matter, and neither should the host
+	status, body, err = doRequest(client, http.MethodPost, "http://elsewhere.invalid/thing?a=1&b=2", "hello")
+	asserter.NoError(err)
+	asserter.Equal(http.StatusTeapot, status)
+	asserter.Equal("b=2&a=1|hello", body)
+
+	_, _, err = doRequest(client, http.MethodPost, "http://elsewhere.invalid/thing?a=1&b=2", "goodbye")
+	asserter.Error(err)
+	asserter.Contains(err.Error(), ErrNoMatch.Error())
+
+	_, _, err = doRequest(client, http.MethodGet, "http://elsewhere.invalid/thing?a=1&b=2", "hello")
+	asserter.Error(err)
+	asserter.Equal(int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestReplayInOrder(t *testing.T) {
+	asserter := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	asserter.NoError(ioutil.WriteFile(path, []byte(`{"interactions":[
+		{"request":{"method":"GET","path":"/poll"},"response":{"status":202,"body":"working"}},
+		{"request":{"method":"GET","path":"/poll"},"response":{"status":200,"body":"done"}}
+	]}`), 0644))
+
+	recorder, err := New(path, ModeStrict, nil)
+	asserter.NoError(err)
+	client := &http.Client{Transport: recorder}
+
+	for _, expected := range []string{"working", "done", "done"} {
+		_, body, err := doRequest(client, http.MethodGet, "http://whatever.invalid/poll", "")
+		asserter.NoError(err)
+		asserter.Equal(expected, body)
+	}
+}
+
+func TestReplayFallsThroughToRecord(t *testing.T) {
+	asserter := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		_, _ = w.Write([]byte("live " + r.URL.Path))
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	asserter.NoError(ioutil.WriteFile(path, []byte(`{"interactions":[
+		{"request":{"method":"GET","path":"/old"},"response":{"status":200,"body":"canned"}}
+	]}`), 0644))
+
+	recorder, err := New(path, ModeReplay, nil)
+	asserter.NoError(err)
+	client := &http.Client{Transport: recorder}
+
+	_, body, err := doRequest(client, http.MethodGet, ts.URL+"/old", "")
+	asserter.NoError(err)
+	asserter.Equal("canned", body)
+	_, body, err = doRequest(client, http.MethodGet, ts.URL+"/new", "")
+	asserter.NoError(err)
+	asserter.Equal("live /new", body)
+	asserter.NoError(recorder.Save())
+
+	saved, err := ioutil.ReadFile(path)
+	asserter.NoError(err)
+	asserter.Contains(string(saved), `"path": "/new"`)
+	asserter.Contains(string(saved), `"body": "live /new"`)
+}
+
+func TestMissingCassette(t *testing.T) {
+	asserter := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "nope.json")
+
+	_, err := New(path, ModeStrict, nil)
+	asserter.Error(err)
+
+	recorder, err := New(path, ModeReplay, nil)
+	asserter.NoError(err)
+	asserter.NoError(recorder.Save())
+	_, err = ioutil.ReadFile(path)
+	asserter.Error(err, "nothing recorded so nothing should have been written")
+}
@@ -0,0 +1,113 @@
+package testutil
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+)
+
+// Client talks to a running SomeServer and decodes what comes back. Transport level failures fail the test right away
+// since there is never anything interesting to assert about them.
+type Client struct {
+	t       *testing.T
+	BaseURL string
+	HTTP    *http.Client
+}
+
+func NewClient(t *testing.T, baseURL string) *Client {
+	return &Client{
+		t:       t,
+		BaseURL: baseURL,
+		HTTP:    http.DefaultClient,
+	}
+}
+
+// Response is the raw result of a request
+type Response struct {
+	Status int
+	Header http.Header
+	Body   string
+}
+
+// Problem decodes the body as a problem, or gives back nil if the body wasn't one
+func (r *Response) Problem() *domain.Error {
+	ret := new(domain.Error)
+	if !r.decode(ret) || ret.Type == "" {
+		return nil
+	}
+	return ret
+}
+
+func (r *Response) decode(v interface{}) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case strings.HasSuffix(mediaType, "json"):
+		return json.Unmarshal([]byte(r.Body), v) == nil
+	case strings.HasSuffix(mediaType, "xml"):
+		return xml.Unmarshal([]byte(r.Body), v) == nil
+	default:
+		return false
+	}
+}
+
+// Do makes a request, headers may be nil
+func (c *Client) Do(method string, path string, body io.Reader, headers map[string]string) *Response {
+	c.t.Helper()
+
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	bytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return &Response{
+		Status: res.StatusCode,
+		Header: res.Header,
+		Body:   string(bytes),
+	}
+}
+
+func (c *Client) Get(path string, headers map[string]string) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodGet, path, nil, headers)
+}
+
+// GetEmployee looks up an employee. On success the employee is decoded, otherwise the problem is, and the raw response
+// is always there for checking headers and such. Only JSON and XML bodies get decoded.
+func (c *Client) GetEmployee(employeeID string, headers map[string]string) (*domain.Employee, *domain.Error, *Response) {
+	c.t.Helper()
+	res := c.Get("/employee/"+employeeID, headers)
+	if res.Status != http.StatusOK {
+		return nil, res.Problem(), res
+	}
+	employee := new(domain.Employee)
+	if !res.decode(employee) {
+		return nil, nil, res
+	}
+	return employee, nil, res
+}
+
+// PutJSON sends body as-is with a JSON content type
+func (c *Client) PutJSON(path string, body string) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodPut, path, strings.NewReader(body), map[string]string{"Content-Type": "application/json"})
+}
@@ -0,0 +1,347 @@
+// Package fetchercontract is a conformance suite for unit.RemoteEmployeeFetcher implementations. Anything that wants to
+// stand in for the REST fetcher (caches, retries, an alternate upstream) should be run through it, since SomeServer
+// leans on every fetcher behaving the same way:
+//
+//   - an employee that doesn't exist is a nil result with a nil error, not an error
+//   - upstream failures are errors, never a nil result with a nil error (which would be reported as not found)
+//   - a cancelled context makes the fetch give up promptly with an error
+//   - it's safe to share between goroutines
+//   - what comes back is exactly what the upstream said
+//   - listing gives back everybody, in the order upstream has them, and fails the same way single fetches do
+//
+// Usage is along the lines of
+//
+//	func TestMyFetcher_Contract(t *testing.T) {
+//		fetchercontract.Run(t, func(t *testing.T, upstream *fetchercontract.Upstream) unit.RemoteEmployeeFetcher {
+//			return NewMyFetcher(unit.NewRemoteEmployeeFetcher(upstream.URL))
+//		})
+//	}
+package fetchercontract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/fakeupstream"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// Factory builds the fetcher under test, talking to upstream.URL one way or another. It's called once per scenario
+// and each scenario gets a fresh upstream.
+type Factory func(t *testing.T, upstream *Upstream) unit.RemoteEmployeeFetcher
+
+// Upstream is a fake of the employee API that the suite steers to set up each scenario
+type Upstream struct {
+	URL string
+
+	fake    *fakeupstream.Server
+	ts      *httptest.Server
+	release chan struct{}
+	once    sync.Once
+}
+
+func newUpstream(t *testing.T) *Upstream {
+	fake := fakeupstream.NewServer(fakeupstream.Config{})
+	ts := httptest.NewServer(fake)
+	ret := &Upstream{
+		URL:     ts.URL,
+		fake:    fake,
+		ts:      ts,
+		release: make(chan struct{}),
+	}
+	t.Cleanup(func() {
+		ret.unblock()
+		ts.Close()
+	})
+	return ret
+}
+
+// SetEmployees replaces the roster the upstream serves
+func (u *Upstream) SetEmployees(employees ...domain.RemoteEmployeeData) {
+	u.fake.Update(func(cfg *fakeupstream.Config) {
+		cfg.Employees = employees
+	})
+}
+
+// Fail makes every request get answered with status
+func (u *Upstream) Fail(status int) {
+	u.fake.Update(func(cfg *fakeupstream.Config) {
+		cfg.ErrorRate = 1
+		cfg.ErrorStatus = status
+	})
+}
+
+// Hang makes every request stall until the scenario is over
+func (u *Upstream) Hang() {
+	u.fake.Update(func(cfg *fakeupstream.Config) {
+		cfg.Latency = time.Nanosecond
+		cfg.Sleep = func(time.Duration) {
+			<-u.release
+		}
+	})
+}
+
+// Close takes the upstream away entirely, so connections get refused
+func (u *Upstream) Close() {
+	u.unblock()
+	u.ts.Close()
+}
+
+func (u *Upstream) unblock() {
+	u.once.Do(func() {
+		close(u.release)
+	})
+}
+
+// Run puts the fetcher built by factory through every scenario as subtests of t
+func Run(t *testing.T, factory Factory) {
+	scenarios := []struct {
+		desc string
+		run  func(t *testing.T, factory Factory)
+	}{
+		{"not found", testNotFound},
+		{"upstream errors", testUpstreamErrors},
+		{"upstream unreachable", testUpstreamUnreachable},
+		{"cancellation", testCancellation},
+		{"already cancelled", testAlreadyCancelled},
+		{"concurrency", testConcurrency},
+		{"payload fidelity", testPayloadFidelity},
+		{"list", testList},
+		{"list upstream errors", testListUpstreamErrors},
+	}
+	for _, s := range scenarios {
+		s := s
+		t.Run(s.desc, func(t *testing.T) {
+			s.run(t, factory)
+		})
+	}
+}
+
+func testNotFound(t *testing.T, factory Factory) {
+	testCases := []struct {
+		desc       string
+		employeeID domain.EmployeeID
+	}{
+		{"numeric", "404"},
+		{"prefixed", "emp-404"},
+		{"uuid", "0f8fad5b-d9cb-469f-a165-70867728950e"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			upstream := newUpstream(t)
+			upstream.SetEmployees(domain.RemoteEmployeeData{ID: 1, EmployeeName: "Tiger Nixon", EmployeeAge: 61})
+
+			res, err := factory(t, upstream).FetchEmployee(testutil.NewTestContext(), tc.employeeID)
+			asserter.NoError(err, "not found must not be an error")
+			asserter.Nil(res, "not found must be a nil result")
+		})
+	}
+}
+
+func testUpstreamErrors(t *testing.T, factory Factory) {
+	for _, status := range []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusNotFound} {
+		t.Run(fmt.Sprint(status), func(t *testing.T) {
+			asserter := assert.New(t)
+
+			upstream := newUpstream(t)
+			upstream.SetEmployees(domain.RemoteEmployeeData{ID: 1, EmployeeName: "Tiger Nixon", EmployeeAge: 61})
+			upstream.Fail(status)
+
+			res, err := factory(t, upstream).FetchEmployee(testutil.NewTestContext(), "1")
+			asserter.Error(err, "a %d from upstream must be an error, otherwise it reads as not found", status)
+			asserter.Nil(res)
+		})
+	}
+}
+
+func testUpstreamUnreachable(t *testing.T, factory Factory) {
+	asserter := assert.New(t)
+
+	upstream := newUpstream(t)
+	testInstance := factory(t, upstream)
+	upstream.Close()
+
+	res, err := testInstance.FetchEmployee(testutil.NewTestContext(), "1")
+	asserter.Error(err)
+	asserter.Nil(res)
+}
+
+func testCancellation(t *testing.T, factory Factory) {
+	asserter := assert.New(t)
+
+	upstream := newUpstream(t)
+	upstream.SetEmployees(domain.RemoteEmployeeData{ID: 1, EmployeeName: "Tiger Nixon", EmployeeAge: 61})
+	upstream.Hang()
+	testInstance := factory(t, upstream)
+
+	ctx, cancel := context.WithCancel(testutil.NewTestContext())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	type result struct {
+		res *domain.RemoteEmployee
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := testInstance.FetchEmployee(ctx, "1")
+		done <- result{res, err}
+	}()
+
+	select {
+	case r := <-done:
+		asserter.Error(r.err)
+		asserter.True(errors.Is(r.err, context.Canceled), "expected an error wrapping context.Canceled, got %v", r.err)
+		asserter.Nil(r.res)
+	case <-time.After(5 * time.Second):
+		asserter.Fail("fetch didn't give up after its context was cancelled")
+	}
+}
+
+func testAlreadyCancelled(t *testing.T, factory Factory) {
+	asserter := assert.New(t)
+
+	upstream := newUpstream(t)
+	upstream.SetEmployees(domain.RemoteEmployeeData{ID: 1, EmployeeName: "Tiger Nixon", EmployeeAge: 61})
+	testInstance := factory(t, upstream)
+
+	ctx, cancel := context.WithCancel(testutil.NewTestContext())
+	cancel()
+
+	res, err := testInstance.FetchEmployee(ctx, "1")
+	asserter.Error(err)
+	asserter.True(errors.Is(err, context.Canceled), "expected an error wrapping context.Canceled, got %v", err)
+	asserter.Nil(res)
+}
+
+func testConcurrency(t *testing.T, factory Factory) {
+	asserter := assert.New(t)
+
+	const employeeCount = 20
+	const workers = 100
+
+	var employees []domain.RemoteEmployeeData
+	for i := 1; i <= employeeCount; i++ {
+		employees = append(employees, domain.RemoteEmployeeData{
+			ID:             i,
+			EmployeeName:   fmt.Sprintf("Employee %d", i),
+			EmployeeSalary: i * 1000,
+			EmployeeAge:    20 + i,
+		})
+	}
+	upstream := newUpstream(t)
+	upstream.SetEmployees(employees...)
+	testInstance := factory(t, upstream)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			expected := employees[w%employeeCount]
+			res, err := testInstance.FetchEmployee(testutil.NewTestContext(), domain.EmployeeIDFromInt(expected.ID))
+			if asserter.NoError(err) {
+				asserter.Equal(remoteEmployee(expected), res)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func testPayloadFidelity(t *testing.T, factory Factory) {
+	testCases := []struct {
+		desc     string
+		employee domain.RemoteEmployeeData
+	}{
+		{
+			"everything filled in",
+			domain.RemoteEmployeeData{ID: 1, EmployeeName: "Tiger Nixon", EmployeeSalary: 320800, EmployeeAge: 61, ProfileImage: "https://example.com/tiger.png"},
+		},
+		{
+			"zero values",
+			domain.RemoteEmployeeData{ID: 2},
+		},
+		{
+			"unicode and punctuation",
+			domain.RemoteEmployeeData{ID: 3, EmployeeName: "Zoë O'Brien-Ålesund \"Z\" 山田", EmployeeSalary: 1, EmployeeAge: 1},
+		},
+		{
+			"big numbers",
+			domain.RemoteEmployeeData{ID: 2147483647, EmployeeName: "Max", EmployeeSalary: 2147483647, EmployeeAge: 150},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			upstream := newUpstream(t)
+			upstream.SetEmployees(tc.employee)
+
+			res, err := factory(t, upstream).FetchEmployee(testutil.NewTestContext(), domain.EmployeeIDFromInt(tc.employee.ID))
+			asserter.NoError(err)
+			asserter.Equal(remoteEmployee(tc.employee), res)
+		})
+	}
+}
+
+func testList(t *testing.T, factory Factory) {
+	testCases := []struct {
+		desc      string
+		employees []domain.RemoteEmployeeData
+	}{
+		{"nobody", nil},
+		{"one", []domain.RemoteEmployeeData{{ID: 1, EmployeeName: "Tiger Nixon", EmployeeAge: 61}}},
+		{"upstream order", fakeupstream.SeedEmployees()},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			upstream := newUpstream(t)
+			upstream.SetEmployees(tc.employees...)
+
+			res, err := factory(t, upstream).FetchEmployees(testutil.NewTestContext())
+			asserter.NoError(err)
+			expected := make([]domain.RemoteEmployeeData, 0, len(tc.employees))
+			for _, e := range tc.employees {
+				expected = append(expected, *remoteEmployee(e).Data)
+			}
+			asserter.Equal(len(expected), len(res))
+			if len(expected) > 0 {
+				asserter.Equal(expected, res)
+			}
+		})
+	}
+}
+
+func testListUpstreamErrors(t *testing.T, factory Factory) {
+	asserter := assert.New(t)
+
+	upstream := newUpstream(t)
+	upstream.SetEmployees(domain.RemoteEmployeeData{ID: 1, EmployeeName: "Tiger Nixon", EmployeeAge: 61})
+	upstream.Fail(http.StatusInternalServerError)
+
+	res, err := factory(t, upstream).FetchEmployees(testutil.NewTestContext())
+	asserter.Error(err)
+	asserter.Nil(res)
+}
+
+func remoteEmployee(e domain.RemoteEmployeeData) *domain.RemoteEmployee {
+	return testutil.NewRemoteEmployee().
+		WithID(e.ID).
+		WithName(e.EmployeeName).
+		WithSalary(e.EmployeeSalary).
+		WithAge(e.EmployeeAge).
+		WithProfileImage(e.ProfileImage).
+		Build()
+}
@@ -0,0 +1,124 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jonsabados/unit-testing-party/jsondiff"
+)
+
+// Golden files are snapshots of what a response is expected to look like, so tests don't have to spell out every byte of
+// a body in a string literal. When a response changes on purpose re-run the tests with -update, eg
+// `go test ./unit/ -update`, and review the diff of fixture/golden like any other code change.
+
+var update = flag.Bool("update", false, "rewrite golden files with whatever the tests produce")
+
+// GoldenDir is where snapshots live, relative to the package under test
+var GoldenDir = filepath.Join("fixture", "golden")
+
+// goldenResponse is what gets written to disk. JSON bodies are stored as JSON so the files diff nicely and key order or
+// whitespace changes don't count as differences, other text is stored as a string and binary as base64.
+type goldenResponse struct {
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	BodyBase64  []byte          `json:"body_base64,omitempty"`
+}
+
+// AssertGolden compares a response against fixture/golden/<test name>.json
+func AssertGolden(t *testing.T, res *Response) {
+	t.Helper()
+	AssertGoldenNamed(t, t.Name(), res)
+}
+
+// AssertGoldenNamed is AssertGolden for tests that need more than one snapshot
+func AssertGoldenNamed(t *testing.T, name string, res *Response) {
+	t.Helper()
+
+	snapshot := goldenResponse{
+		Status:      res.Status,
+		ContentType: res.Header.Get("Content-Type"),
+	}
+	mediaType, _, _ := mime.ParseMediaType(snapshot.ContentType)
+	switch {
+	case res.Body == "":
+	case strings.HasSuffix(mediaType, "json") && json.Valid([]byte(res.Body)):
+		snapshot.Body = json.RawMessage(res.Body)
+	case utf8.ValidString(res.Body):
+		snapshot.Body, _ = json.Marshal(res.Body)
+	default:
+		snapshot.BodyBase64 = []byte(res.Body)
+	}
+
+	actual, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertGoldenJSON(t, name, actual)
+}
+
+// AssertGoldenJSON compares any JSON document against fixture/golden/<name>.json. Both sides are normalized first and
+// a mismatch is reported as a list of the paths that differ rather than two walls of text.
+func AssertGoldenJSON(t *testing.T, name string, actual []byte) {
+	t.Helper()
+
+	path := filepath.Join(GoldenDir, filepath.FromSlash(name)+".json")
+	normalized, err := NormalizeJSON(actual)
+	if err != nil {
+		t.Fatalf("actual value isn't valid JSON: %v", err)
+	}
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, normalized, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read golden file, run with -update to create it: %v", err)
+	}
+	expected, err = NormalizeJSON(expected)
+	if err != nil {
+		t.Fatalf("golden file %s isn't valid JSON: %v", path, err)
+	}
+	if bytes.Equal(expected, normalized) {
+		return
+	}
+
+	var expectedValue, actualValue interface{}
+	_ = json.Unmarshal(expected, &expectedValue)
+	_ = json.Unmarshal(normalized, &actualValue)
+	t.Errorf("response doesn't match %s (run with -update if the change is intended):\n%s", path,
+		strings.Join(jsondiff.Diff(expectedValue, actualValue), "\n"))
+}
+
+// NormalizeJSON re-encodes a document with sorted keys and consistent indentation
+func NormalizeJSON(raw []byte) ([]byte, error) {
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
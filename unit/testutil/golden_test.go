@@ -0,0 +1,52 @@
+package testutil
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeJSON(t *testing.T) {
+	asserter := assert.New(t)
+
+	a, err := NormalizeJSON([]byte(`{"b":1,"a":{"d":[1,2],"c":"<x>"}}`))
+	asserter.NoError(err)
+	b, err := NormalizeJSON([]byte("{\n\"a\": {\"c\": \"<x>\", \"d\": [1, 2]},   \"b\": 1}\n"))
+	asserter.NoError(err)
+	asserter.Equal(string(a), string(b))
+	asserter.Equal("{\n  \"a\": {\n    \"c\": \"<x>\",\n    \"d\": [\n      1,\n      2\n    ]\n  },\n  \"b\": 1\n}\n", string(a))
+
+	_, err = NormalizeJSON([]byte(`{nope`))
+	asserter.Error(err)
+}
+
+func TestAssertGolden_Update(t *testing.T) {
+	asserter := assert.New(t)
+
+	oldDir := GoldenDir
+	GoldenDir = t.TempDir()
+	*update = true
+	defer func() {
+		GoldenDir = oldDir
+		*update = false
+	}()
+
+	responses := map[string]*Response{
+		"json":   {Status: 200, Header: http.Header{"Content-Type": {"application/json"}}, Body: `{"b":2,"a":1}`},
+		"text":   {Status: 404, Header: http.Header{"Content-Type": {"text/csv"}}, Body: "a,b\n1,2\n"},
+		"binary": {Status: 200, Header: http.Header{"Content-Type": {"application/msgpack"}}, Body: "\x81\xa1a\x01"},
+		"empty":  {Status: 304, Header: http.Header{}},
+	}
+	for name, res := range responses {
+		AssertGoldenNamed(t, filepath.Join("nested", name), res)
+	}
+
+	// and now they should all match what was written
+	*update = false
+	for name, res := range responses {
+		AssertGoldenNamed(t, filepath.Join("nested", name), res)
+	}
+	asserter.False(t.Failed())
+}
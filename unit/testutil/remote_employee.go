@@ -0,0 +1,68 @@
+package testutil
+
+import (
+	"github.com/jonsabados/unit-testing-party/domain"
+)
+
+// RemoteEmployeeBuilder makes upstream employees without having to spell out the data struct every time.
+// The defaults are Tiger Nixon, employee 1, as the upstream has him.
+type RemoteEmployeeBuilder struct {
+	employee *domain.RemoteEmployee
+}
+
+func NewRemoteEmployee() *RemoteEmployeeBuilder {
+	ret := &domain.RemoteEmployee{Status: "success"}
+	ret.Data = &domain.RemoteEmployeeData{
+		ID:             1,
+		EmployeeName:   "Tiger Nixon",
+		EmployeeSalary: 320800,
+		EmployeeAge:    61,
+	}
+	return &RemoteEmployeeBuilder{ret}
+}
+
+func (b *RemoteEmployeeBuilder) WithID(id int) *RemoteEmployeeBuilder {
+	b.employee.Data.ID = id
+	return b
+}
+
+func (b *RemoteEmployeeBuilder) WithName(name string) *RemoteEmployeeBuilder {
+	b.employee.Data.EmployeeName = name
+	return b
+}
+
+func (b *RemoteEmployeeBuilder) WithSalary(salary int) *RemoteEmployeeBuilder {
+	b.employee.Data.EmployeeSalary = salary
+	return b
+}
+
+func (b *RemoteEmployeeBuilder) WithAge(age int) *RemoteEmployeeBuilder {
+	b.employee.Data.EmployeeAge = age
+	return b
+}
+
+func (b *RemoteEmployeeBuilder) WithProfileImage(image string) *RemoteEmployeeBuilder {
+	b.employee.Data.ProfileImage = image
+	return b
+}
+
+func (b *RemoteEmployeeBuilder) WithStatus(status string) *RemoteEmployeeBuilder {
+	b.employee.Status = status
+	return b
+}
+
+// WithoutData is what the upstream sends back for employees it doesn't know about
+func (b *RemoteEmployeeBuilder) WithoutData() *RemoteEmployeeBuilder {
+	b.employee.Data = nil
+	return b
+}
+
+// Build hands back a copy, so one builder can be used to stamp out several employees
+func (b *RemoteEmployeeBuilder) Build() *domain.RemoteEmployee {
+	ret := *b.employee
+	if b.employee.Data != nil {
+		data := *b.employee.Data
+		ret.Data = &data
+	}
+	return &ret
+}
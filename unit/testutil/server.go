@@ -0,0 +1,159 @@
+package testutil
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/i18n"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+// ServerBuilder puts together a unit.SomeServer for tests. Anything not explicitly set gets a sensible default: a mock
+// fetcher (which fails the test if it gets called without being told what to do), the real employee mapper and every
+// codec the service supports.
+type ServerBuilder struct {
+	t       *testing.T
+	fetcher *mocks.RemoteEmployeeFetcher
+	// options get applied to the server in Build, it can't be built up front and copied since it holds a mutex
+	options []func(s *unit.SomeServer)
+}
+
+func NewServerBuilder(t *testing.T) *ServerBuilder {
+	return &ServerBuilder{
+		t:       t,
+		fetcher: mocks.NewRemoteEmployeeFetcher(t),
+	}
+}
+
+func (b *ServerBuilder) with(option func(s *unit.SomeServer)) *ServerBuilder {
+	b.options = append(b.options, option)
+	return b
+}
+
+// Fetcher is the default mock fetcher, program it with Fetcher().EXPECT() or Fetcher().On(). It isn't what the server
+// uses if WithFetcher was called.
+func (b *ServerBuilder) Fetcher() *mocks.RemoteEmployeeFetcher {
+	return b.fetcher
+}
+
+// ExpectEmployee is shorthand for programming the default fetcher to hand back an employee for an id
+func (b *ServerBuilder) ExpectEmployee(employeeID domain.EmployeeID, employee *domain.RemoteEmployee) *ServerBuilder {
+	b.fetcher.EXPECT().FetchEmployee(mock.Anything, employeeID).Return(employee, nil)
+	return b
+}
+
+// ExpectFetchError is shorthand for programming the default fetcher to blow up for an id
+func (b *ServerBuilder) ExpectFetchError(employeeID domain.EmployeeID, err error) *ServerBuilder {
+	b.fetcher.EXPECT().FetchEmployee(mock.Anything, employeeID).Return(nil, err)
+	return b
+}
+
+func (b *ServerBuilder) WithFetcher(fetcher unit.RemoteEmployeeFetcher) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.EmployeeFetcher = fetcher
+	})
+}
+
+func (b *ServerBuilder) WithMapper(mapper unit.EmployeeConverter) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.EmployeeMapper = mapper
+	})
+}
+
+func (b *ServerBuilder) WithCodecs(codecs *unit.CodecRegistry) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.Codecs = codecs
+	})
+}
+
+func (b *ServerBuilder) WithCacheMaxAge(maxAge time.Duration) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.CacheMaxAge = maxAge
+	})
+}
+
+func (b *ServerBuilder) WithNow(now func() time.Time) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.Now = now
+	})
+}
+
+func (b *ServerBuilder) WithFaults(faults *unit.FaultInjector) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.Faults = faults
+	})
+}
+
+func (b *ServerBuilder) WithSearch(search *unit.SearchIndex) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.Search = search
+	})
+}
+
+func (b *ServerBuilder) WithSync(syncer *unit.Syncer) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.Sync = syncer
+	})
+}
+
+func (b *ServerBuilder) WithChanges(changes *unit.ChangeFeed) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.Changes = changes
+	})
+}
+
+func (b *ServerBuilder) WithSubscriptions(subscriptions *unit.SubscriptionDispatcher) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.Subscriptions = subscriptions
+	})
+}
+
+func (b *ServerBuilder) WithLiveConcurrency(concurrency int) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.LiveConcurrency = concurrency
+	})
+}
+
+func (b *ServerBuilder) WithLiveOrigins(origins ...string) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.LiveOrigins = origins
+	})
+}
+
+func (b *ServerBuilder) WithGraphQLLimits(maxDepth int, maxComplexity int) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.GraphQLMaxDepth = maxDepth
+		s.GraphQLMaxComplexity = maxComplexity
+	})
+}
+
+func (b *ServerBuilder) WithMessages(messages *i18n.Catalog) *ServerBuilder {
+	return b.with(func(s *unit.SomeServer) {
+		s.Messages = messages
+	})
+}
+
+// Build hands back the server without starting anything, for tests that want to poke at it directly
+func (b *ServerBuilder) Build() *unit.SomeServer {
+	ret := &unit.SomeServer{
+		EmployeeFetcher: b.fetcher,
+		EmployeeMapper:  unit.NewEmployeeFactory(unit.MapBirthYear),
+		Codecs:          unit.NewDefaultCodecRegistry(),
+	}
+	for _, option := range b.options {
+		option(ret)
+	}
+	return ret
+}
+
+// Start runs the server on a random port until the test finishes, and hands back a client pointed at it
+func (b *ServerBuilder) Start() *Client {
+	ts := httptest.NewServer(kit.NewServer(b.Build()))
+	b.t.Cleanup(ts.Close)
+	return NewClient(b.t, ts.URL)
+}
@@ -0,0 +1,37 @@
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerBuilder_Build(t *testing.T) {
+	asserter := assert.New(t)
+
+	defaults := NewServerBuilder(t).Build()
+	asserter.NotNil(defaults.EmployeeFetcher)
+	asserter.NotNil(defaults.EmployeeMapper)
+	asserter.NotNil(defaults.Codecs)
+
+	faults := unit.NewFaultInjector(unit.FaultConfig{})
+	builder := NewServerBuilder(t).
+		WithCacheMaxAge(time.Minute).
+		WithFaults(faults).
+		WithLiveOrigins("https://dashboard.example.com").
+		WithGraphQLLimits(3, 30)
+	first := builder.Build()
+	asserter.Equal(time.Minute, first.CacheMaxAge)
+	asserter.True(faults == first.Faults)
+	asserter.Equal([]string{"https://dashboard.example.com"}, first.LiveOrigins)
+	asserter.Equal(3, first.GraphQLMaxDepth)
+	asserter.Equal(30, first.GraphQLMaxComplexity)
+
+	// each build is a server of its own, the later option wins
+	second := builder.WithCacheMaxAge(time.Hour).Build()
+	asserter.True(first != second)
+	asserter.Equal(time.Minute, first.CacheMaxAge)
+	asserter.Equal(time.Hour, second.CacheMaxAge)
+}
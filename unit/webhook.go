@@ -0,0 +1,219 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NYTimes/gizmo/server/kit"
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/pkg/errors"
+)
+
+// Webhooks are the change feed for things that would rather be told than hold a connection open. Each change gets
+// POSTed on its own, as JSON, signed so receivers can tell it came from us.
+//
+// Receivers should recompute the signature over timestamp + "." + body with the shared secret and compare (in
+// constant time), and reject timestamps that are too old so a captured delivery can't be replayed later. The change
+// id is in X-Webhook-Id, deliveries that got retried can show up twice and that's the thing to dedupe on.
+
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookIDHeader        = "X-Webhook-Id"
+	WebhookEventHeader     = "X-Webhook-Event"
+
+	defaultWebhookAttempts = 5
+	defaultWebhookBackoff  = time.Second
+)
+
+// SignWebhook is the signature that goes in X-Webhook-Signature, timestamp being what's in X-Webhook-Timestamp
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookSender POSTs changes, signed, retrying failures with exponential backoff
+type WebhookSender struct {
+	Client *http.Client
+	// MaxAttempts is how many times a change gets tried before giving up on it, Backoff is how long to wait after the
+	// first failure, doubling after each one after that
+	MaxAttempts int
+	Backoff     time.Duration
+	// Now and Sleep are here so tests can control time, if left nil the real thing is used
+	Now   func() time.Time
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewWebhookSender() WebhookSender {
+	return WebhookSender{
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: defaultWebhookAttempts,
+		Backoff:     defaultWebhookBackoff,
+	}
+}
+
+func (s *WebhookSender) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+func (s *WebhookSender) sleep(ctx context.Context, duration time.Duration) error {
+	if s.Sleep != nil {
+		return s.Sleep(ctx, duration)
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Send tries a change until it goes through, it isn't worth trying again or attempts run out. It hands back how many
+// attempts it took, and the last error if it never went through.
+func (s *WebhookSender) Send(ctx context.Context, url string, secret string, change domain.EmployeeChange) (int, error) {
+	body, err := json.Marshal(localizeChange(english, change))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	backoff := s.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(ctx, url, secret, change, body)
+		if err == nil {
+			return attempt, nil
+		}
+		if !retry || attempt >= s.MaxAttempts || ctx.Err() != nil {
+			return attempt, err
+		}
+		_ = kit.LogWarningf(ctx, "error delivering change %s to %s, retrying in %s: %s", change.ID, url, backoff, err)
+		if err := s.sleep(ctx, backoff); err != nil {
+			return attempt, errors.WithStack(err)
+		}
+		backoff *= 2
+	}
+}
+
+// post makes one delivery attempt, the bool says whether it's worth trying again if it failed
+func (s *WebhookSender) post(ctx context.Context, url string, secret string, change domain.EmployeeChange, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, change.ID)
+	req.Header.Set(WebhookEventHeader, change.Type)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, timestamp, body))
+
+	res, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	// drained so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode == http.StatusRequestTimeout, res.StatusCode == http.StatusTooManyRequests, res.StatusCode >= 500:
+		return true, errors.Errorf("unexpected response code, got %d", res.StatusCode)
+	default:
+		// anything else is the receiver telling us the request itself is no good, sending it again won't change that
+		return false, errors.Errorf("unexpected response code, got %d", res.StatusCode)
+	}
+}
+
+// WebhookDispatcher sends every change to one url
+type WebhookDispatcher struct {
+	WebhookSender
+
+	feed   *ChangeFeed
+	url    string
+	secret string
+	// from is where delivery starts, the feed's latest change when the dispatcher was made
+	from string
+}
+
+// NewWebhookDispatcher POSTs every change published to feed from here on to url, signed with secret. Nothing gets sent
+// until Run, changes published in between are held on to (as long as they're still in the feed's history).
+func NewWebhookDispatcher(feed *ChangeFeed, url string, secret string) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		WebhookSender: NewWebhookSender(),
+		feed:          feed,
+		url:           url,
+		secret:        secret,
+		from:          feed.Latest(),
+	}
+}
+
+// Run delivers changes, one at a time and in order, until ctx is done
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	followFeed(ctx, d.feed, d.from, "webhook deliveries to "+d.url, d.deliver)
+}
+
+// deliver logs rather than returning errors, there's nothing a caller could do about them
+func (d *WebhookDispatcher) deliver(ctx context.Context, change domain.EmployeeChange) {
+	if attempts, err := d.Send(ctx, d.url, d.secret, change); err != nil {
+		_ = kit.LogErrorf(ctx, "giving up delivering change %s to %s after %d attempt(s): %+v", change.ID, d.url, attempts, err)
+	}
+}
+
+// followFeed hands every change after from to handle, one at a time and in order, until ctx is done. When handle is
+// slow enough that the feed cuts it off it catches up from the feed's history, anything that has fallen out of the
+// history by then is lost. what is for the log message when that happens.
+func followFeed(ctx context.Context, feed *ChangeFeed, from string, what string, handle func(ctx context.Context, change domain.EmployeeChange)) {
+	last := from
+	for {
+		// last is always an id the feed handed out, so this can't fail
+		sub, _ := feed.Subscribe(last)
+		last = drainSubscription(ctx, sub, last, handle)
+		sub.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		_ = kit.LogWarningf(ctx, "%s fell behind, catching up from %s", what, last)
+	}
+}
+
+// drainSubscription handles the replay and then whatever gets published until the subscription gets cut off or ctx is
+// done, handing back the id of the last change handled
+func drainSubscription(ctx context.Context, sub *ChangeSubscription, last string, handle func(ctx context.Context, change domain.EmployeeChange)) string {
+	batch := sub.Replay
+	for {
+		for _, change := range batch {
+			if ctx.Err() != nil {
+				return last
+			}
+			handle(ctx, change)
+			last = change.ID
+		}
+		select {
+		case changes, ok := <-sub.C:
+			if !ok {
+				return last
+			}
+			batch = changes
+		case <-ctx.Done():
+			return last
+		}
+	}
+}
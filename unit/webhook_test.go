@@ -0,0 +1,175 @@
+package unit_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonsabados/unit-testing-party/domain"
+	"github.com/jonsabados/unit-testing-party/unit"
+	"github.com/jonsabados/unit-testing-party/unit/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type webhookDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver answers deliveries with statuses, in order, and 200 once it runs out of them
+type webhookReceiver struct {
+	mu         sync.Mutex
+	statuses   []int
+	deliveries []webhookDelivery
+	received   chan struct{}
+}
+
+func newWebhookReceiver(t *testing.T, statuses ...int) (*webhookReceiver, string) {
+	ret := &webhookReceiver{statuses: statuses, received: make(chan struct{}, 100)}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		ret.mu.Lock()
+		ret.deliveries = append(ret.deliveries, webhookDelivery{r.Header, body})
+		status := http.StatusOK
+		if len(ret.statuses) > 0 {
+			status, ret.statuses = ret.statuses[0], ret.statuses[1:]
+		}
+		ret.mu.Unlock()
+		w.WriteHeader(status)
+		ret.received <- struct{}{}
+	}))
+	t.Cleanup(ts.Close)
+	return ret, ts.URL
+}
+
+// waitFor blocks until count deliveries have shown up and hands them back
+func (r *webhookReceiver) waitFor(t *testing.T, count int) []webhookDelivery {
+	for i := 0; i < count; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only got %d of %d deliveries", i, count)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]webhookDelivery{}, r.deliveries...)
+}
+
+// newDispatcher runs a dispatcher until the test is done, sleeps don't actually sleep and are handed back instead
+func newDispatcher(t *testing.T, feed *unit.ChangeFeed, url string, setup func(d *unit.WebhookDispatcher)) *[]time.Duration {
+	var mu sync.Mutex
+	sleeps := &[]time.Duration{}
+	ret := unit.NewWebhookDispatcher(feed, url, "s3cr3t")
+	ret.Now = func() time.Time {
+		return syncTime
+	}
+	ret.Sleep = func(_ context.Context, d time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*sleeps = append(*sleeps, d)
+		return nil
+	}
+	if setup != nil {
+		setup(ret)
+	}
+
+	ctx, cancel := context.WithCancel(testutil.NewTestContext())
+	done := make(chan struct{})
+	go func() {
+		ret.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return sleeps
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	asserter := assert.New(t)
+
+	feed := newChangeFeed(t, 0)
+	receiver, url := newWebhookReceiver(t)
+	// made after version 2, so only what happens from here on gets sent
+	newDispatcher(t, feed, url, nil)
+	asserter.NoError(feed.Observe(rosterSnapshot(3, rosterEmployee(1, "Tiger Nixon", 60), rosterEmployee(2, "Garrett Winters", 41), rosterEmployee(4, "Cedric Kelly", 22))))
+
+	delivery := receiver.waitFor(t, 1)[0]
+	asserter.Equal("application/json", delivery.header.Get("Content-Type"))
+	asserter.Equal("3-1", delivery.header.Get(unit.WebhookIDHeader))
+	asserter.Equal(domain.ChangeChanged, delivery.header.Get(unit.WebhookEventHeader))
+	asserter.Equal("1583298367", delivery.header.Get(unit.WebhookTimestampHeader))
+
+	// worked out by hand rather than with SignWebhook, so a receiver following the docs would agree
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write([]byte("1583298367." + string(delivery.body)))
+	asserter.Equal("sha256="+hex.EncodeToString(mac.Sum(nil)), delivery.header.Get(unit.WebhookSignatureHeader))
+	asserter.Equal(delivery.header.Get(unit.WebhookSignatureHeader), unit.SignWebhook("s3cr3t", "1583298367", delivery.body))
+
+	change := new(domain.EmployeeChange)
+	asserter.NoError(json.Unmarshal(delivery.body, change))
+	asserter.Equal("2", change.EmployeeID)
+	asserter.Equal([]domain.FieldChange{{Field: "age", From: "40", To: "41"}}, change.Changes)
+	if asserter.NotNil(change.After) {
+		asserter.Equal("Generation X", change.After.GenerationLabel)
+	}
+}
+
+func TestWebhookDispatcher_Retries(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		statuses       []int
+		maxAttempts    int
+		expectedIDs    []string
+		expectedSleeps []time.Duration
+	}{
+		{"first time", nil, 5, []string{"3-1", "3-2"}, []time.Duration{}},
+		{
+			"retried until it works",
+			[]int{500, 429, 408},
+			5,
+			[]string{"3-1", "3-1", "3-1", "3-1", "3-2"},
+			[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			"gives up",
+			[]int{503, 503, 503},
+			3,
+			[]string{"3-1", "3-1", "3-1", "3-2"},
+			[]time.Duration{time.Second, 2 * time.Second},
+		},
+		{"not worth retrying", []int{400}, 5, []string{"3-1", "3-2"}, []time.Duration{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			asserter := assert.New(t)
+
+			feed := newChangeFeed(t, 0)
+			receiver, url := newWebhookReceiver(t, tc.statuses...)
+			sleeps := newDispatcher(t, feed, url, func(d *unit.WebhookDispatcher) {
+				d.MaxAttempts = tc.maxAttempts
+			})
+			asserter.NoError(feed.Observe(rosterSnapshot(3, rosterEmployee(1, "Tiger Nixon", 61), rosterEmployee(2, "Garrett Winters", 41), rosterEmployee(4, "Cedric Kelly", 22))))
+
+			actual := []string{}
+			for _, d := range receiver.waitFor(t, len(tc.expectedIDs)) {
+				actual = append(actual, d.header.Get(unit.WebhookIDHeader))
+			}
+			asserter.Equal(tc.expectedIDs, actual)
+			asserter.Equal(tc.expectedSleeps, *sleeps)
+		})
+	}
+}